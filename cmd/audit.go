@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/dhaifley/dauth/server"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	auditCmd.AddCommand(auditVerifyCmd)
+	rootCmd.AddCommand(auditCmd)
+}
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Manages the audit log",
+	Long:  "The audit command groups commands which manage the audit log.",
+}
+
+var auditVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Verifies the audit log",
+	Long: "The verify command checks the chain of hashes of the audit log, " +
+		"and reports the first event which was changed, or which follows " +
+		"removed events.",
+	Run: func(cmd *cobra.Command, args []string) {
+		s := server.Server{}
+		if err := s.ConnectSQL(nil); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		defer s.Close()
+		c, err := s.VerifyAudit(context.Background())
+		if err != nil {
+			fmt.Println(err)
+			fmt.Println("Audit events verified:", c.Count)
+			s.Close()
+			os.Exit(1)
+		}
+
+		fmt.Println("Audit events verified:", c.Count)
+		fmt.Println("Audit log head:", c.Head)
+	},
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 
 	"github.com/dhaifley/dauth/lib"
+	"github.com/dhaifley/dauth/server"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -38,6 +39,159 @@ func init() {
 	if err := viper.BindEnv("key"); err != nil {
 		fmt.Println(err)
 	}
+
+	viper.SetDefault("signing_key_id", "")
+	if err := viper.BindEnv("signing_key_id"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("signing_key_grace", "24h")
+	if err := viper.BindEnv("signing_key_grace"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("signing_alg", "HS256")
+	if err := viper.BindEnv("signing_alg"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("auth_stateless", false)
+	if err := viper.BindEnv("auth_stateless"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("token_issuer", lib.ServiceInfo.Name)
+	if err := viper.BindEnv("token_issuer"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("token_audience", "")
+	if err := viper.BindEnv("token_audience"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("refresh_token_lifetime", "720h")
+	if err := viper.BindEnv("refresh_token_lifetime"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("password_cost", lib.DefaultPasswordCost)
+	if err := viper.BindEnv("password_cost"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("password_min_length", lib.DefaultPasswordMinLength)
+	if err := viper.BindEnv("password_min_length"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("password_history", lib.DefaultPasswordHistory)
+	if err := viper.BindEnv("password_history"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("password_breached_file", "")
+	if err := viper.BindEnv("password_breached_file"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("login_throttle_store", "sql")
+	if err := viper.BindEnv("login_throttle_store"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("login_failure_threshold", lib.DefaultLoginThreshold)
+	if err := viper.BindEnv("login_failure_threshold"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("login_failure_delay", lib.DefaultLoginDelay.String())
+	if err := viper.BindEnv("login_failure_delay"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("login_lockout", lib.DefaultLoginLockout.String())
+	if err := viper.BindEnv("login_lockout"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("log_redact_fields", "")
+	if err := viper.BindEnv("log_redact_fields"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("token_reap_interval",
+		server.DefaultReapInterval.String())
+	if err := viper.BindEnv("token_reap_interval"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("token_reap_batch_size", server.DefaultReapBatchSize)
+	if err := viper.BindEnv("token_reap_batch_size"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("token_reap_jitter", server.DefaultReapJitter.String())
+	if err := viper.BindEnv("token_reap_jitter"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("auth_cache_size", lib.DefaultCacheSize)
+	if err := viper.BindEnv("auth_cache_size"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("auth_cache_ttl", lib.DefaultCacheTTL.String())
+	if err := viper.BindEnv("auth_cache_ttl"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("session_touch_interval",
+		server.DefaultSessionTouchInterval.String())
+	if err := viper.BindEnv("session_touch_interval"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("auth_cache_listen", true)
+	if err := viper.BindEnv("auth_cache_listen"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("auth_cache_fallback_ttl",
+		server.DefaultCacheFallbackTTL.String())
+	if err := viper.BindEnv("auth_cache_fallback_ttl"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("metrics", true)
+	if err := viper.BindEnv("metrics"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("metrics_token_stats_interval",
+		server.DefaultTokenStatsInterval.String())
+	if err := viper.BindEnv("metrics_token_stats_interval"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("trace_exporter", server.TraceExporterNone)
+	if err := viper.BindEnv("trace_exporter"); err != nil {
+		fmt.Println(err)
+	}
+
+	if err := viper.BindEnv("trace_otlp_endpoint"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("trace_otlp_insecure", false)
+	if err := viper.BindEnv("trace_otlp_insecure"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("trace_sample_ratio", 1.0)
+	if err := viper.BindEnv("trace_sample_ratio"); err != nil {
+		fmt.Println(err)
+	}
 }
 
 // Execute starts the command processor.
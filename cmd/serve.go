@@ -1,8 +1,14 @@
 package cmd
 
 import (
+	"context"
+	"fmt"
 	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/spf13/viper"
 
@@ -14,7 +20,18 @@ import (
 	"google.golang.org/grpc"
 )
 
+// ShutdownTimeout is how long the HTTP server waits for requests in
+// progress to finish when shutting down.
+const ShutdownTimeout = 30 * time.Second
+
 func init() {
+	serveCmd.Flags().String("signing-alg", "HS256",
+		"default token signing algorithm (HS256, RS256, ES256 or EdDSA)")
+	if err := viper.BindPFlag("signing_alg",
+		serveCmd.Flags().Lookup("signing-alg")); err != nil {
+		fmt.Println(err)
+	}
+
 	rootCmd.AddCommand(serveCmd)
 }
 
@@ -23,29 +40,109 @@ var serveCmd = &cobra.Command{
 	Short: "Starts the application server",
 	Long:  "The serve command starts the application server.",
 	Run: func(cmd *cobra.Command, args []string) {
-		s := server.Server{Log: logrus.New()}
+		s := server.Server{
+			Stateless:       viper.GetBool("auth_stateless"),
+			Issuer:          viper.GetString("token_issuer"),
+			Audience:        viper.GetString("token_audience"),
+			RefreshLifetime: viper.GetDuration("refresh_token_lifetime"),
+			PasswordCost:    viper.GetInt("password_cost"),
+			Log:             logrus.New(),
+		}
+
 		s.Log.(*logrus.Logger).Out = os.Stdout
 		s.Log.(*logrus.Logger).Formatter = new(logrus.JSONFormatter)
+		s.LoadRedaction()
 		err := s.ConnectSQL(nil)
 		if err != nil {
 			s.Log.Fatal(err.Error())
 		}
 
 		defer s.Close()
+		if err := s.LoadKeys(); err != nil {
+			s.Log.Fatal(err.Error())
+		}
+
+		if err := s.LoadThrottle(); err != nil {
+			s.Log.Fatal(err.Error())
+		}
+
+		if err := s.LoadPasswordPolicy(); err != nil {
+			s.Log.Fatal(err.Error())
+		}
+
+		s.LoadReaper()
+		s.LoadCache()
+		s.LoadSessions()
+		s.LoadMetrics()
+		if err := s.LoadTracing(); err != nil {
+			s.Log.Fatal(err.Error())
+		}
+
+		if err := s.LoadNotifier(); err != nil {
+			s.Log.Fatal(err.Error())
+		}
+
 		lis, err := net.Listen("tcp", ":3612")
 		if err != nil {
 			s.Log.Fatal(err)
 		}
 
+		cert, key := viper.GetString("cert"), viper.GetString("key")
+		if cert == "" || key == "" {
+			s.Log.Fatal("cert and key are required")
+		}
+
 		var opts []grpc.ServerOption
-		creds, err := dlib.GetGRPCServerCredentials(viper.GetString("cert"), viper.GetString("key"))
+		creds, err := dlib.GetGRPCServerCredentials(cert, key)
 		if err != nil {
 			s.Log.Fatal(err)
 		}
 
-		opts = []grpc.ServerOption{grpc.Creds(creds)}
+		opts = []grpc.ServerOption{
+			grpc.Creds(creds),
+			grpc.UnaryInterceptor(s.UnaryInterceptor),
+			grpc.StreamInterceptor(s.StreamInterceptor),
+		}
+
 		grpcServer := grpc.NewServer(opts...)
 		ptypes.RegisterAuthServer(grpcServer, &s)
-		s.Log.Fatal(grpcServer.Serve(lis))
+		server.RegisterAuthExtServer(grpcServer, &s)
+		httpServer := &http.Server{Addr: ":3611", Handler: s.Routes()}
+		go func() {
+			err := httpServer.ListenAndServeTLS(cert, key)
+			if err != nil && err != http.ErrServerClosed {
+				s.Log.Fatal(err)
+			}
+		}()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		reaped := make(chan struct{})
+		go func() {
+			s.Reaper.Run(ctx)
+			close(reaped)
+		}()
+
+		go s.ListenInvalidations(ctx)
+
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-sig
+			s.Log.Info("Shutting down")
+			cancel()
+			<-reaped
+			sctx, scancel := context.WithTimeout(context.Background(),
+				ShutdownTimeout)
+			defer scancel()
+			if err := httpServer.Shutdown(sctx); err != nil {
+				s.Log.Error(err)
+			}
+
+			grpcServer.GracefulStop()
+		}()
+
+		if err := grpcServer.Serve(lis); err != nil {
+			s.Log.Fatal(err)
+		}
 	},
 }
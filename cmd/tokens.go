@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/dhaifley/dauth/server"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	tokensCmd.AddCommand(tokensPruneCmd)
+	rootCmd.AddCommand(tokensCmd)
+}
+
+var tokensCmd = &cobra.Command{
+	Use:   "tokens",
+	Short: "Manages stored tokens",
+	Long:  "The tokens command groups commands which manage stored tokens.",
+}
+
+var tokensPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Deletes expired tokens",
+	Long: "The prune command deletes all expired tokens, refresh tokens " +
+		"and sessions once, using the same batches as the token reaper of " +
+		"the serve command.",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := pruneTokens(); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	},
+}
+
+// pruneTokens runs the token reaper once and prints the numbers of records
+// deleted.
+func pruneTokens() error {
+	s := server.Server{}
+	defer s.Close()
+	if err := s.ConnectSQL(nil); err != nil {
+		return err
+	}
+
+	s.LoadReaper()
+	c, err := s.Reaper.Prune(context.Background(), time.Now())
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Expired tokens deleted:", c.Tokens)
+	fmt.Println("Expired refresh tokens deleted:", c.RefreshTokens)
+	fmt.Println("Expired sessions deleted:", c.Sessions)
+	fmt.Println("Revocation records deleted:", c.Revocations)
+	return nil
+}
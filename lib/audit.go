@@ -0,0 +1,302 @@
+package lib
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/dhaifley/dlib"
+)
+
+// Outcomes of audit events.
+const (
+	AuditSuccess = "success"
+	AuditPending = "pending"
+	AuditDenied  = "denied"
+	AuditFailure = "failure"
+)
+
+// AuditEvent values record who did what to whom in the audit log. Each
+// event holds the hash of the event before it, and its own hash covers that
+// hash and its fields, so that changing or removing an event breaks the
+// chain of hashes after it.
+type AuditEvent struct {
+	ID       int64      `json:"id"`
+	ActorID  int64      `json:"actor_id,omitempty"`
+	Actor    string     `json:"actor,omitempty"`
+	Action   string     `json:"action"`
+	Target   string     `json:"target,omitempty"`
+	Outcome  string     `json:"outcome"`
+	Peer     string     `json:"peer,omitempty"`
+	Created  *time.Time `json:"created,omitempty"`
+	PrevHash string     `json:"prev_hash,omitempty"`
+	Hash     string     `json:"hash"`
+}
+
+// AuditEventRow values are used to scan audit event database rows.
+type AuditEventRow struct {
+	ID       int64
+	ActorID  int64
+	Actor    string
+	Action   string
+	Target   string
+	Outcome  string
+	Peer     string
+	Created  dlib.NullTime
+	PrevHash string
+	Hash     string
+}
+
+// ToAuditEvent converts an AuditEventRow value into an AuditEvent.
+func (r *AuditEventRow) ToAuditEvent() AuditEvent {
+	v := AuditEvent{
+		ID:       r.ID,
+		ActorID:  r.ActorID,
+		Actor:    r.Actor,
+		Action:   r.Action,
+		Target:   r.Target,
+		Outcome:  r.Outcome,
+		Peer:     r.Peer,
+		PrevHash: r.PrevHash,
+		Hash:     r.Hash,
+	}
+
+	if r.Created.Valid {
+		v.Created = &r.Created.Time
+	}
+
+	return v
+}
+
+// ComputeHash returns the hex encoded SHA-256 hash of an audit event,
+// covering the hash of the previous event and every field but the id.
+// Times are hashed in UTC with the microsecond precision of the database.
+func (e *AuditEvent) ComputeHash() string {
+	created := ""
+	if e.Created != nil {
+		created = e.Created.UTC().Truncate(time.Microsecond).
+			Format(time.RFC3339Nano)
+	}
+
+	b, _ := json.Marshal([]interface{}{
+		e.PrevHash,
+		e.ActorID,
+		e.Actor,
+		e.Action,
+		e.Target,
+		e.Outcome,
+		e.Peer,
+		created,
+	})
+
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// Seal links an audit event to the event before it, whose hash is prev, and
+// sets its hash.
+func (e *AuditEvent) Seal(prev string) {
+	if e.Created != nil {
+		t := e.Created.Truncate(time.Microsecond)
+		e.Created = &t
+	}
+
+	e.PrevHash = prev
+	e.Hash = e.ComputeHash()
+}
+
+// AuditChain values verify the chain of hashes of the audit log, one event
+// at a time in id order, starting from the first event.
+type AuditChain struct {
+	Head  string
+	Count int64
+}
+
+// Verify checks that an audit event follows the events verified before it
+// and that its hash matches its fields.
+func (c *AuditChain) Verify(e *AuditEvent) error {
+	if e.PrevHash != c.Head {
+		return dlib.NewError(http.StatusConflict,
+			fmt.Sprintf("audit event %d does not follow the previous event",
+				e.ID))
+	}
+
+	if e.Hash != e.ComputeHash() {
+		return dlib.NewError(http.StatusConflict,
+			fmt.Sprintf("audit event %d does not match its hash", e.ID))
+	}
+
+	c.Head = e.Hash
+	c.Count++
+	return nil
+}
+
+// AuditFind values are used to find audit events. Fields which are set must
+// all match, and Start and End bound the creation time of the events.
+type AuditFind struct {
+	ActorID *int64     `json:"actor_id,omitempty"`
+	Actor   *string    `json:"actor,omitempty"`
+	Action  *string    `json:"action,omitempty"`
+	Target  *string    `json:"target,omitempty"`
+	Outcome *string    `json:"outcome,omitempty"`
+	Start   *time.Time `json:"start,omitempty"`
+	End     *time.Time `json:"end,omitempty"`
+	Limit   *int64     `json:"limit,omitempty"`
+}
+
+// AuditAccessor is an interface describing values capable of providing
+// access to the audit log in the database.
+type AuditAccessor interface {
+	GetAuditEvents(ctx context.Context, opt *AuditFind) <-chan dlib.Result
+	GetAuditHead(ctx context.Context) <-chan dlib.Result
+	SaveAuditEvent(ctx context.Context, e *AuditEvent) <-chan dlib.Result
+}
+
+// AuditAccess values are used to access the audit log in the database.
+type AuditAccess struct {
+	DBS dlib.SQLExecutor
+}
+
+// NewAuditAccessor creates a new AuditAccess value for database access.
+func NewAuditAccessor(dbs dlib.SQLExecutor) AuditAccessor {
+	aa := AuditAccess{DBS: dbs}
+	return &aa
+}
+
+// GetAuditEvents finds audit events, in the order they were saved. Since the
+// audit log can be large, reading stops when ctx is done, so that a caller
+// which stops receiving does not hold the query open.
+func (aa *AuditAccess) GetAuditEvents(ctx context.Context,
+	opt *AuditFind) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 256)
+
+	go func() {
+		defer close(ch)
+		rows, err := traceQuery(ctx, aa.DBS, `
+			SELECT
+				a.id,
+				a.actor_id,
+				a.actor,
+				a.action,
+				a.target,
+				a.outcome,
+				a.peer,
+				a.created,
+				a.prev_hash,
+				a.hash
+			FROM get_audit_events($1, $2, $3, $4, $5, $6, $7, $8) AS a`,
+			opt.ActorID,
+			opt.Actor,
+			opt.Action,
+			opt.Target,
+			opt.Outcome,
+			opt.Start,
+			opt.End,
+			opt.Limit)
+		if err != nil {
+			ch <- dlib.Result{Err: err}
+			return
+		}
+
+		defer rows.Close()
+		for rows.Next() {
+			r := AuditEventRow{}
+			res := dlib.Result{Num: 1}
+			if err := rows.Scan(&r.ID, &r.ActorID, &r.Actor, &r.Action,
+				&r.Target, &r.Outcome, &r.Peer, &r.Created, &r.PrevHash,
+				&r.Hash); err != nil {
+				res = dlib.Result{Err: err}
+			} else {
+				res.Val = r.ToAuditEvent()
+			}
+
+			select {
+			case ch <- res:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ch
+}
+
+// GetAuditHead finds the hash of the last audit event, which is empty when
+// the audit log is empty.
+func (aa *AuditAccess) GetAuditHead(ctx context.Context) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 256)
+
+	go func() {
+		defer close(ch)
+		rows, err := traceQuery(ctx, aa.DBS,
+			"SELECT get_audit_head() AS hash")
+		if err != nil {
+			ch <- dlib.Result{Err: err}
+			return
+		}
+
+		defer rows.Close()
+		for rows.Next() {
+			var v string
+			if err := rows.Scan(&v); err != nil {
+				ch <- dlib.Result{Err: err}
+				continue
+			}
+
+			ch <- dlib.Result{Val: v, Num: 1}
+		}
+	}()
+
+	return ch
+}
+
+// SaveAuditEvent appends a sealed audit event to the audit log. The event is
+// only saved if its PrevHash is still the hash of the last event, otherwise
+// the result has a Num of zero and the event must be sealed again.
+func (aa *AuditAccess) SaveAuditEvent(ctx context.Context,
+	e *AuditEvent) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 256)
+
+	go func() {
+		defer close(ch)
+		rows, err := traceQuery(ctx, aa.DBS, `
+			SELECT save_audit_event($1, $2, $3, $4, $5, $6, $7, $8, $9)
+				AS id`,
+			e.ActorID,
+			e.Actor,
+			e.Action,
+			e.Target,
+			e.Outcome,
+			e.Peer,
+			e.Created,
+			e.PrevHash,
+			e.Hash)
+		if err != nil {
+			ch <- dlib.Result{Err: err}
+			return
+		}
+
+		defer rows.Close()
+		n := 0
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				ch <- dlib.Result{Err: err}
+				continue
+			}
+
+			if id > 0 {
+				e.ID = id
+				n++
+			}
+		}
+
+		ch <- dlib.Result{Val: *e, Num: n}
+	}()
+
+	return ch
+}
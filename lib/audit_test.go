@@ -0,0 +1,194 @@
+package lib
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/dhaifley/dlib"
+)
+
+type MockAuditRows struct {
+	row    int
+	rows   int
+	closed chan struct{}
+}
+
+func (m *MockAuditRows) Close() error {
+	if m.closed != nil {
+		close(m.closed)
+	}
+
+	return nil
+}
+
+func (m *MockAuditRows) Next() bool {
+	m.row++
+	if m.row > 1 && m.row > m.rows {
+		return false
+	}
+
+	return true
+}
+
+func (m *MockAuditRows) Scan(dest ...interface{}) error {
+	for _, d := range dest {
+		switch v := d.(type) {
+		case *int64:
+			*v = 1
+		case *string:
+			*v = "test"
+		case *dlib.NullTime:
+			dt := time.Date(2083, 2, 2, 0, 0, 0, 0, time.Local)
+			*v = dlib.NullTime{Time: dt, Valid: true}
+		default:
+			return dlib.NewError(500, "Invalid type")
+		}
+	}
+
+	return nil
+}
+
+type MockAuditDBSession struct {
+	Rows   int
+	Closed chan struct{}
+}
+
+func (m *MockAuditDBSession) Close() error {
+	return nil
+}
+
+func (m *MockAuditDBSession) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return nil, nil
+}
+
+func (m *MockAuditDBSession) Query(query string, args ...interface{}) (dlib.SQLRows, error) {
+	mr := MockAuditRows{rows: m.Rows, closed: m.Closed}
+	return &mr, nil
+}
+
+func (m *MockAuditDBSession) Ping() error {
+	return nil
+}
+
+func (m *MockAuditDBSession) Stats() sql.DBStats {
+	return sql.DBStats{OpenConnections: 0}
+}
+
+func TestAuditAccess(t *testing.T) {
+	ctx := context.Background()
+	aa := NewAuditAccessor(&MockAuditDBSession{})
+	var a []AuditEvent
+	for r := range aa.GetAuditEvents(ctx, &AuditFind{}) {
+		if r.Err != nil {
+			t.Error(r.Err)
+		}
+
+		if v, ok := r.Val.(AuditEvent); ok {
+			a = append(a, v)
+		}
+	}
+
+	if len(a) != 1 || a[0].Action != "test" || a[0].Hash != "test" ||
+		a[0].Created == nil {
+		t.Errorf("Audit event expected: test, got: %+v", a)
+	}
+
+	for r := range aa.GetAuditHead(ctx) {
+		if r.Err != nil {
+			t.Error(r.Err)
+		}
+
+		if r.Val != "test" {
+			t.Errorf("Head expected: test, got: %v", r.Val)
+		}
+	}
+
+	e := AuditEvent{Action: "test"}
+	for r := range aa.SaveAuditEvent(ctx, &e) {
+		if r.Err != nil {
+			t.Error(r.Err)
+		}
+
+		if r.Num != 1 || e.ID != 1 {
+			t.Errorf("Saved expected: 1, got: %v, id: %v", r.Num, e.ID)
+		}
+	}
+}
+
+func TestAuditAccessCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	closed := make(chan struct{})
+	aa := NewAuditAccessor(&MockAuditDBSession{Rows: 1000, Closed: closed})
+	ch := aa.GetAuditEvents(ctx, &AuditFind{})
+	<-ch
+	cancel()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the rows to be closed when the context is done")
+	}
+}
+
+func TestAuditChain(t *testing.T) {
+	created := time.Date(2018, 9, 4, 1, 2, 3, 456789123, time.UTC)
+	events := []AuditEvent{
+		{ID: 1, ActorID: 1, Actor: "admin", Action: "SaveGrants",
+			Target: "user:2 perm:3", Outcome: AuditSuccess},
+		{ID: 2, Actor: "test", Action: "Login", Outcome: AuditFailure,
+			Peer: "127.0.0.1"},
+		{ID: 3, ActorID: 2, Actor: "test", Action: "Login",
+			Target: "user:2", Outcome: AuditSuccess},
+	}
+
+	head := ""
+	for i := range events {
+		events[i].Created = &created
+		events[i].Seal(head)
+		head = events[i].Hash
+	}
+
+	if events[0].Created.Nanosecond() != 456789000 {
+		t.Errorf("Created expected to be truncated, got: %v",
+			events[0].Created)
+	}
+
+	// Times read back from the database are in the local time zone.
+	local := events[1].Created.In(time.FixedZone("test", 3600))
+	events[1].Created = &local
+	c := AuditChain{}
+	for i := range events {
+		if err := c.Verify(&events[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if c.Count != 3 || c.Head != head {
+		t.Errorf("Chain expected: 3 %v, got: %+v", head, c)
+	}
+
+	tampered := make([]AuditEvent, len(events))
+	copy(tampered, events)
+	tampered[1].Outcome = AuditSuccess
+	c = AuditChain{}
+	err := c.Verify(&tampered[0])
+	if err == nil {
+		err = c.Verify(&tampered[1])
+	}
+
+	if err == nil || c.Count != 1 {
+		t.Errorf("Expected the changed event to fail, got: %v", err)
+	}
+
+	c = AuditChain{}
+	for _, i := range []int{0, 2} {
+		if err = c.Verify(&events[i]); err != nil {
+			break
+		}
+	}
+
+	if err == nil || c.Count != 1 {
+		t.Errorf("Expected the removed event to be found, got: %v", err)
+	}
+}
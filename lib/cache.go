@@ -0,0 +1,189 @@
+package lib
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Default cache settings.
+const (
+	DefaultCacheSize = 10000
+	DefaultCacheTTL  = time.Minute
+)
+
+// Cache values are size bounded, least recently used caches whose entries
+// expire after a time to live. Caches are safe for concurrent use.
+type Cache struct {
+	Size int
+	TTL  time.Duration
+	mu   sync.Mutex
+	ll   *list.List
+	m    map[interface{}]*list.Element
+	st   CacheStats
+}
+
+// CacheStats values count cache lookups and removals.
+type CacheStats struct {
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+	Entries   int    `json:"entries"`
+}
+
+type cacheEntry struct {
+	key     interface{}
+	val     interface{}
+	expires time.Time
+}
+
+// NewCache creates a new Cache holding up to size entries for up to ttl.
+// Zero settings are replaced by the defaults.
+func NewCache(size int, ttl time.Duration) *Cache {
+	if size <= 0 {
+		size = DefaultCacheSize
+	}
+
+	if ttl <= 0 {
+		ttl = DefaultCacheTTL
+	}
+
+	c := Cache{
+		Size: size,
+		TTL:  ttl,
+		ll:   list.New(),
+		m:    map[interface{}]*list.Element{},
+	}
+
+	return &c
+}
+
+// Get returns the value cached for a key, if it has not expired.
+func (c *Cache) Get(key interface{}) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.m[key]
+	if !ok {
+		c.st.Misses++
+		return nil, false
+	}
+
+	ce := e.Value.(*cacheEntry)
+	if !time.Now().Before(ce.expires) {
+		c.remove(e)
+		c.st.Misses++
+		return nil, false
+	}
+
+	c.ll.MoveToFront(e)
+	c.st.Hits++
+	return ce.val, true
+}
+
+// Set caches a value for a key for the time to live of the cache.
+func (c *Cache) Set(key, val interface{}) {
+	c.SetTTL(key, val, c.MaxTTL())
+}
+
+// MaxTTL returns the time to live of the cache.
+func (c *Cache) MaxTTL() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.TTL
+}
+
+// SetMaxTTL changes the time to live of the cache. Entries cached for
+// longer than the new time to live expire sooner.
+func (c *Cache) SetMaxTTL(ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.TTL = ttl
+	max := time.Now().Add(ttl)
+	for e := c.ll.Front(); e != nil; e = e.Next() {
+		if ce := e.Value.(*cacheEntry); ce.expires.After(max) {
+			ce.expires = max
+		}
+	}
+}
+
+// SetTTL caches a value for a key for the shorter of ttl and the time to
+// live of the cache. The least recently used entry is evicted when the
+// cache is full.
+func (c *Cache) SetTTL(key, val interface{}, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if ttl > c.TTL {
+		ttl = c.TTL
+	}
+
+	if ttl <= 0 {
+		return
+	}
+
+	ce := cacheEntry{key: key, val: val, expires: time.Now().Add(ttl)}
+	if e, ok := c.m[key]; ok {
+		e.Value = &ce
+		c.ll.MoveToFront(e)
+		return
+	}
+
+	c.m[key] = c.ll.PushFront(&ce)
+	for c.ll.Len() > c.Size {
+		c.remove(c.ll.Back())
+		c.st.Evictions++
+	}
+}
+
+// Delete removes the entries for the provided keys.
+func (c *Cache) Delete(keys ...interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, k := range keys {
+		if e, ok := c.m[k]; ok {
+			c.remove(e)
+		}
+	}
+}
+
+// DeleteFunc removes the entries for which f returns true, and returns the
+// number removed.
+func (c *Cache) DeleteFunc(f func(key, val interface{}) bool) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for e := c.ll.Front(); e != nil; {
+		next := e.Next()
+		ce := e.Value.(*cacheEntry)
+		if f(ce.key, ce.val) {
+			c.remove(e)
+			n++
+		}
+
+		e = next
+	}
+
+	return n
+}
+
+// Purge removes all entries.
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ll.Init()
+	c.m = map[interface{}]*list.Element{}
+}
+
+// Stats returns the lookup counts and the number of entries of the cache.
+func (c *Cache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st := c.st
+	st.Entries = c.ll.Len()
+	return st
+}
+
+// remove removes an entry. The caller must hold the lock.
+func (c *Cache) remove(e *list.Element) {
+	c.ll.Remove(e)
+	delete(c.m, e.Value.(*cacheEntry).key)
+}
@@ -0,0 +1,101 @@
+package lib
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCacheGetSet(t *testing.T) {
+	c := NewCache(2, time.Minute)
+	if _, ok := c.Get("a"); ok {
+		t.Error("Expected a miss for an empty cache")
+	}
+
+	c.Set("a", 1)
+	c.Set("b", 2)
+	if v, ok := c.Get("a"); !ok || v != 1 {
+		t.Errorf("Value expected: 1, got: %v", v)
+	}
+
+	c.Set("c", 3)
+	if _, ok := c.Get("b"); ok {
+		t.Error("Expected the least recently used entry to be evicted")
+	}
+
+	if _, ok := c.Get("a"); !ok {
+		t.Error("Expected a recently used entry to be kept")
+	}
+
+	st := c.Stats()
+	if st.Hits != 2 || st.Misses != 2 || st.Evictions != 1 ||
+		st.Entries != 2 {
+		t.Errorf("Stats expected: 2 2 1 2, got: %+v", st)
+	}
+}
+
+func TestCacheExpiry(t *testing.T) {
+	c := NewCache(10, time.Minute)
+	c.SetTTL("a", 1, time.Millisecond)
+	c.SetTTL("b", 2, time.Hour)
+	c.SetTTL("c", 3, -time.Second)
+	time.Sleep(5 * time.Millisecond)
+	if _, ok := c.Get("a"); ok {
+		t.Error("Expected the entry to expire")
+	}
+
+	if _, ok := c.Get("b"); !ok {
+		t.Error("Expected the entry to be cached")
+	}
+
+	if _, ok := c.Get("c"); ok {
+		t.Error("Expected an expired value not to be cached")
+	}
+}
+
+func TestCacheSetMaxTTL(t *testing.T) {
+	c := NewCache(10, time.Hour)
+	c.Set("a", 1)
+	c.SetMaxTTL(time.Millisecond)
+	c.Set("b", 2)
+	time.Sleep(5 * time.Millisecond)
+	for _, k := range []string{"a", "b"} {
+		if _, ok := c.Get(k); ok {
+			t.Errorf("Expected %v to expire", k)
+		}
+	}
+
+	c.SetMaxTTL(0)
+	c.Set("c", 3)
+	if _, ok := c.Get("c"); ok {
+		t.Error("Expected nothing to be cached without a time to live")
+	}
+
+	c.SetMaxTTL(time.Hour)
+	c.Set("d", 4)
+	if _, ok := c.Get("d"); !ok {
+		t.Error("Expected the entry to be cached")
+	}
+}
+
+func TestCacheDelete(t *testing.T) {
+	c := NewCache(10, time.Minute)
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set(int64(3), 3)
+	c.Delete("a")
+	if n := c.DeleteFunc(func(k, v interface{}) bool {
+		_, ok := k.(int64)
+		return ok
+	}); n != 1 {
+		t.Errorf("Deleted expected: 1, got: %v", n)
+	}
+
+	if st := c.Stats(); st.Entries != 1 {
+		t.Errorf("Entries expected: 1, got: %v", st.Entries)
+	}
+
+	c.Purge()
+	if st := c.Stats(); st.Entries != 0 {
+		t.Errorf("Entries expected: 0, got: %v", st.Entries)
+	}
+}
@@ -0,0 +1,112 @@
+package lib
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/dhaifley/dlib"
+)
+
+// TokenClaims values contain the claims carried by tokens issued by dauth.
+// MFAPending marks tokens which only allow completing two-factor
+// authentication, and PassChange marks tokens which only allow changing the
+// password of the user. Neither must be accepted as access tokens.
+type TokenClaims struct {
+	User       string `json:"user"`
+	UserID     int64  `json:"user_id"`
+	Created    int64  `json:"created"`
+	Expires    int64  `json:"expires"`
+	MFAPending bool   `json:"mfa_pending,omitempty"`
+	PassChange bool   `json:"pass_change,omitempty"`
+	jwt.StandardClaims
+}
+
+// NewTokenClaims creates a new TokenClaims value for a user with the
+// provided issuer, audience and lifetime.
+func NewTokenClaims(user string, userID int64, iss, aud string,
+	created, expires time.Time) (*TokenClaims, error) {
+	jti, err := NewTokenID()
+	if err != nil {
+		return nil, err
+	}
+
+	tc := TokenClaims{
+		User:    user,
+		UserID:  userID,
+		Created: created.Unix(),
+		Expires: expires.Unix(),
+		StandardClaims: jwt.StandardClaims{
+			Id:        jti,
+			Issuer:    iss,
+			Audience:  aud,
+			IssuedAt:  created.Unix(),
+			NotBefore: created.Unix(),
+			ExpiresAt: expires.Unix(),
+		},
+	}
+
+	return &tc, nil
+}
+
+// Verify checks the time based claims, which must all be present, and the
+// issuer and audience claims when iss or aud are not empty.
+func (tc *TokenClaims) Verify(iss, aud string) error {
+	now := time.Now().Unix()
+	if !tc.VerifyExpiresAt(now, true) {
+		return dlib.NewError(http.StatusUnauthorized, "token is expired")
+	}
+
+	if !tc.VerifyNotBefore(now, true) {
+		return dlib.NewError(http.StatusUnauthorized, "token is not valid yet")
+	}
+
+	if iss != "" && !tc.VerifyIssuer(iss, true) {
+		return dlib.NewError(http.StatusUnauthorized, "invalid token issuer")
+	}
+
+	if aud != "" && !tc.VerifyAudience(aud, true) {
+		return dlib.NewError(http.StatusUnauthorized, "invalid token audience")
+	}
+
+	return nil
+}
+
+// Verify parses a token string, verifies its signature using the keys in
+// the ring and checks its claims.
+func (kr *KeyRing) Verify(ts, iss, aud string) (*TokenClaims, error) {
+	tc := TokenClaims{}
+	t, err := kr.Parse(ts, &tc)
+	if err != nil || !t.Valid {
+		return nil, dlib.NewError(http.StatusUnauthorized, "invalid token")
+	}
+
+	if err := tc.Verify(iss, aud); err != nil {
+		return nil, err
+	}
+
+	return &tc, nil
+}
+
+// ParseTokenClaims returns the claims of a token string without verifying
+// its signature. It must only be used on tokens read from the database.
+func ParseTokenClaims(ts string) (*TokenClaims, error) {
+	tc := TokenClaims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(ts, &tc); err != nil {
+		return nil, dlib.NewError(http.StatusBadRequest, "invalid token")
+	}
+
+	return &tc, nil
+}
+
+// NewTokenID creates a new random token identifier.
+func NewTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,80 @@
+package lib
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenClaimsVerify(t *testing.T) {
+	now := time.Now()
+	cases := []struct {
+		created, expires time.Time
+		iss, aud         string
+		fail             bool
+	}{
+		{created: now, expires: now.Add(time.Hour), iss: "dauth", aud: "test"},
+		{created: now, expires: now.Add(time.Hour)},
+		{created: now.Add(-2 * time.Hour), expires: now.Add(-time.Hour),
+			fail: true},
+		{created: now.Add(time.Hour), expires: now.Add(2 * time.Hour),
+			fail: true},
+		{created: now, expires: now.Add(time.Hour), iss: "other", fail: true},
+		{created: now, expires: now.Add(time.Hour), aud: "other", fail: true},
+	}
+
+	for _, c := range cases {
+		tc, err := NewTokenClaims("test", 1, "dauth", "test",
+			c.created, c.expires)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = tc.Verify(c.iss, c.aud)
+		if c.fail && err == nil {
+			t.Errorf("Expected error for claims: %v", tc)
+		}
+
+		if !c.fail && err != nil {
+			t.Errorf("Unexpected error for claims: %v, %v", tc, err)
+		}
+	}
+
+	tc := TokenClaims{User: "test"}
+	if err := tc.Verify("", ""); err == nil {
+		t.Error("Expected error for claims without expiration")
+	}
+}
+
+func TestKeyRingVerify(t *testing.T) {
+	kr, err := NewKeyRingFromConfig([]KeyConfig{
+		{ID: "test", Secret: "test"},
+	}, "test", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	tc, err := NewTokenClaims("test", 1, "dauth", "test", now,
+		now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts, err := kr.Sign(tc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vc, err := kr.Verify(ts, "dauth", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if vc.UserID != 1 || vc.Id != tc.Id {
+		t.Errorf("Claims expected: %v, got: %v", tc, vc)
+	}
+
+	if _, err := kr.Verify(ts+"x", "dauth", "test"); err == nil {
+		t.Error("Expected error for invalid signature")
+	}
+}
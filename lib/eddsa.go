@@ -0,0 +1,63 @@
+package lib
+
+import (
+	"crypto/ed25519"
+	"errors"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// SigningMethodEdDSA implements the EdDSA token signing method using
+// Ed25519 keys. It expects an ed25519.PrivateKey for signing and an
+// ed25519.PublicKey for verification.
+type SigningMethodEdDSA struct{}
+
+// ErrEdDSAVerification is returned when an EdDSA signature is invalid.
+var ErrEdDSAVerification = errors.New("ed25519: verification error")
+
+// SigningMethodEd25519 is the EdDSA signing method instance.
+var SigningMethodEd25519 *SigningMethodEdDSA
+
+func init() {
+	SigningMethodEd25519 = &SigningMethodEdDSA{}
+	jwt.RegisterSigningMethod(SigningMethodEd25519.Alg(),
+		func() jwt.SigningMethod {
+			return SigningMethodEd25519
+		})
+}
+
+// Alg returns the name of the signing method.
+func (m *SigningMethodEdDSA) Alg() string {
+	return "EdDSA"
+}
+
+// Verify verifies the signature of a signing string.
+func (m *SigningMethodEdDSA) Verify(signingString, signature string,
+	key interface{}) error {
+	pk, ok := key.(ed25519.PublicKey)
+	if !ok || len(pk) != ed25519.PublicKeySize {
+		return jwt.ErrInvalidKeyType
+	}
+
+	sig, err := jwt.DecodeSegment(signature)
+	if err != nil {
+		return err
+	}
+
+	if !ed25519.Verify(pk, []byte(signingString), sig) {
+		return ErrEdDSAVerification
+	}
+
+	return nil
+}
+
+// Sign signs a signing string and returns the encoded signature.
+func (m *SigningMethodEdDSA) Sign(signingString string,
+	key interface{}) (string, error) {
+	sk, ok := key.(ed25519.PrivateKey)
+	if !ok || len(sk) != ed25519.PrivateKeySize {
+		return "", jwt.ErrInvalidKeyType
+	}
+
+	return jwt.EncodeSegment(ed25519.Sign(sk, []byte(signingString))), nil
+}
@@ -0,0 +1,425 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dhaifley/dlib"
+)
+
+// Grant values give a perm to a user, role or group for the resources
+// matching Resource, and only when all Conditions hold. Resource uses the
+// segments and wildcards of perm expressions, for example project:42 or
+// project:*, and an empty Resource matches any resource.
+type Grant struct {
+	ID         int64       `json:"id"`
+	UserID     int64       `json:"user_id,omitempty"`
+	RoleID     int64       `json:"role_id,omitempty"`
+	GroupID    int64       `json:"group_id,omitempty"`
+	PermID     int64       `json:"perm_id"`
+	Resource   string      `json:"resource,omitempty"`
+	Conditions []Condition `json:"conditions,omitempty"`
+}
+
+// GrantFind values are used to find grants in the database.
+type GrantFind struct {
+	ID      *int64 `json:"id,omitempty"`
+	UserID  *int64 `json:"user_id,omitempty"`
+	RoleID  *int64 `json:"role_id,omitempty"`
+	GroupID *int64 `json:"group_id,omitempty"`
+	PermID  *int64 `json:"perm_id,omitempty"`
+}
+
+// GrantRow values are used to scan grant database rows.
+type GrantRow struct {
+	ID         int64
+	UserID     int64
+	RoleID     int64
+	GroupID    int64
+	PermID     int64
+	Resource   string
+	Conditions string
+}
+
+// ToGrant converts a GrantRow value into a Grant.
+func (r *GrantRow) ToGrant() (Grant, error) {
+	v := Grant{
+		ID:       r.ID,
+		UserID:   r.UserID,
+		RoleID:   r.RoleID,
+		GroupID:  r.GroupID,
+		PermID:   r.PermID,
+		Resource: r.Resource,
+	}
+
+	if r.Conditions != "" {
+		if err := json.Unmarshal([]byte(r.Conditions),
+			&v.Conditions); err != nil {
+			return v, err
+		}
+	}
+
+	return v, nil
+}
+
+// Condition operators.
+const (
+	ConditionEq      = "eq"
+	ConditionNe      = "ne"
+	ConditionIn      = "in"
+	ConditionCIDR    = "cidr"
+	ConditionBetween = "between"
+)
+
+// Condition values test an attribute of an access request. Attr names a
+// request attribute: resource, user, ip, time or any attribute supplied
+// with the request, such as owner or tenant. Value is compared using Op:
+//
+//	eq, ne   the attribute equals, or does not equal, Value
+//	in       the attribute is one of the comma separated values in Value
+//	cidr     the attribute is an IP address in the network Value
+//	between  the attribute is within the range Value, such as 09:00-17:00
+//
+// A Value starting with $ names another attribute to compare with, so the
+// condition owner eq $user holds for resources owned by the user.
+type Condition struct {
+	Attr  string `json:"attr"`
+	Op    string `json:"op"`
+	Value string `json:"value"`
+}
+
+// AccessRequest values describe a perm requested for a resource. The time
+// attribute is the time of day of Time, in UTC, as HH:MM.
+type AccessRequest struct {
+	Service    string
+	Name       string
+	Resource   string
+	UserID     int64
+	IP         string
+	Time       time.Time
+	Attributes map[string]string
+}
+
+// Attr returns the value of an attribute of the request.
+func (r *AccessRequest) Attr(name string) string {
+	switch name {
+	case "resource":
+		return r.Resource
+	case "user":
+		return strconv.FormatInt(r.UserID, 10)
+	case "ip":
+		return r.IP
+	case "time":
+		if r.Time.IsZero() {
+			return ""
+		}
+
+		return r.Time.UTC().Format("15:04")
+	default:
+		return r.Attributes[name]
+	}
+}
+
+// Match returns whether the resource and conditions of the grant match an
+// access request. The perm of the grant is matched separately.
+func (g *Grant) Match(r *AccessRequest) bool {
+	return g.match(r, false)
+}
+
+// MatchDeny is Match for deny grants. A missing resource, or a condition
+// which can not be evaluated, matches, so that a request can not avoid a
+// deny grant by leaving out what it checks.
+func (g *Grant) MatchDeny(r *AccessRequest) bool {
+	return g.match(r, true)
+}
+
+// match implements Match and MatchDeny. Requests without a resource, and
+// conditions which can not be evaluated, match if missing is true.
+func (g *Grant) match(r *AccessRequest, missing bool) bool {
+	if g.Resource != "" {
+		if r.Resource == "" {
+			if !missing {
+				return false
+			}
+		} else if !matchSegments(
+			strings.Split(g.Resource, PermSeparator),
+			strings.Split(r.Resource, PermSeparator)) {
+			return false
+		}
+	}
+
+	for _, c := range g.Conditions {
+		if !c.match(r, missing) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Specificity ranks grants by their resource selector, in the same way as
+// PermPattern.Specificity. Grants without a resource rank lowest.
+func (g *Grant) Specificity() int {
+	if g.Resource == "" {
+		return 0
+	}
+
+	return specificity(strings.Split(g.Resource, PermSeparator))
+}
+
+// Match returns whether the condition holds for an access request. Missing
+// attributes never satisfy a condition, and unknown operators never hold.
+func (c *Condition) Match(r *AccessRequest) bool {
+	return c.match(r, false)
+}
+
+// MatchDeny is Match for the conditions of deny grants. A condition which
+// can not be evaluated, because an attribute is missing, a value is invalid
+// or the operator is unknown, holds.
+func (c *Condition) MatchDeny(r *AccessRequest) bool {
+	return c.match(r, true)
+}
+
+// match implements Match and MatchDeny, returning missing when the
+// condition can not be evaluated.
+func (c *Condition) match(r *AccessRequest, missing bool) bool {
+	a := r.Attr(c.Attr)
+	if a == "" {
+		return missing
+	}
+
+	v := c.Value
+	if strings.HasPrefix(v, "$") {
+		v = r.Attr(strings.TrimPrefix(v, "$"))
+		if v == "" {
+			return missing
+		}
+	}
+
+	switch c.Op {
+	case ConditionEq:
+		return a == v
+	case ConditionNe:
+		return a != v
+	case ConditionIn:
+		for _, s := range strings.Split(v, ",") {
+			if strings.TrimSpace(s) == a {
+				return true
+			}
+		}
+
+		return false
+	case ConditionCIDR:
+		_, n, err := net.ParseCIDR(v)
+		ip := net.ParseIP(a)
+		if err != nil || ip == nil {
+			return missing
+		}
+
+		return n.Contains(ip)
+	case ConditionBetween:
+		parts := strings.SplitN(v, "-", 2)
+		if len(parts) != 2 {
+			return missing
+		}
+
+		from, to := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if from <= to {
+			return a >= from && a < to
+		}
+
+		return a >= from || a < to
+	default:
+		return missing
+	}
+}
+
+// GrantAccess values are used to access grant records in the database.
+type GrantAccess struct {
+	DBS dlib.SQLExecutor
+}
+
+// GrantAccessor is an interface describing values capable of providing
+// access to grant records in the database.
+type GrantAccessor interface {
+	GetGrants(ctx context.Context, opt *GrantFind) <-chan dlib.Result
+	DeleteGrants(ctx context.Context, opt *GrantFind) <-chan dlib.Result
+	SaveGrant(ctx context.Context, g *Grant) <-chan dlib.Result
+	GetUserGrants(ctx context.Context, userID int64) <-chan dlib.Result
+}
+
+// NewGrantAccessor creates a new GrantAccess instance and returns a pointer
+// to it.
+func NewGrantAccessor(dbs dlib.SQLExecutor) GrantAccessor {
+	ga := GrantAccess{DBS: dbs}
+	return &ga
+}
+
+// GetGrants finds grant values in the database.
+func (ga *GrantAccess) GetGrants(ctx context.Context,
+	opt *GrantFind) <-chan dlib.Result {
+	return ga.grants(ctx, `
+		SELECT
+			g.id,
+			g.user_id,
+			g.role_id,
+			g.group_id,
+			g.perm_id,
+			g.resource,
+			g.conditions
+		FROM get_grants($1, $2, $3, $4, $5) AS g`,
+		opt.ID,
+		opt.UserID,
+		opt.RoleID,
+		opt.GroupID,
+		opt.PermID)
+}
+
+// GetUserGrants finds the grants given to a user directly, through the
+// user's roles, and through the groups the user belongs to.
+func (ga *GrantAccess) GetUserGrants(ctx context.Context,
+	userID int64) <-chan dlib.Result {
+	return ga.grants(ctx, `
+		SELECT
+			g.id,
+			g.user_id,
+			g.role_id,
+			g.group_id,
+			g.perm_id,
+			g.resource,
+			g.conditions
+		FROM get_user_grants($1) AS g`,
+		userID)
+}
+
+// DeleteGrants deletes grant values from the database.
+func (ga *GrantAccess) DeleteGrants(ctx context.Context,
+	opt *GrantFind) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 256)
+
+	go func() {
+		defer close(ch)
+		rows, err := traceQuery(ctx, ga.DBS,
+			"SELECT delete_grants($1, $2, $3, $4, $5) AS num",
+			opt.ID,
+			opt.UserID,
+			opt.RoleID,
+			opt.GroupID,
+			opt.PermID)
+		if err != nil {
+			ch <- dlib.Result{Err: err}
+			return
+		}
+
+		defer rows.Close()
+		n := 0
+		for rows.Next() {
+			r := struct{ Num int }{Num: 0}
+			if err := rows.Scan(&r.Num); err != nil {
+				ch <- dlib.Result{Err: err}
+				continue
+			}
+
+			n += r.Num
+		}
+
+		ch <- dlib.Result{Num: n, Err: nil}
+	}()
+
+	return ch
+}
+
+// SaveGrant saves a grant value to the database.
+func (ga *GrantAccess) SaveGrant(ctx context.Context,
+	g *Grant) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 256)
+
+	go func() {
+		defer close(ch)
+		conds := ""
+		if len(g.Conditions) > 0 {
+			b, err := json.Marshal(g.Conditions)
+			if err != nil {
+				ch <- dlib.Result{Err: err}
+				return
+			}
+
+			conds = string(b)
+		}
+
+		rows, err := traceQuery(ctx, ga.DBS,
+			"SELECT save_grant($1, $2, $3, $4, $5, $6, $7) AS id",
+			g.ID,
+			g.UserID,
+			g.RoleID,
+			g.GroupID,
+			g.PermID,
+			g.Resource,
+			conds)
+		if err != nil {
+			ch <- dlib.Result{Err: err}
+			return
+		}
+
+		defer rows.Close()
+		for rows.Next() {
+			r := struct{ ID int64 }{ID: 0}
+			if err := rows.Scan(&r.ID); err != nil {
+				ch <- dlib.Result{Err: err}
+				continue
+			}
+
+			g.ID = r.ID
+		}
+
+		ch <- dlib.Result{Val: *g, Err: nil}
+	}()
+
+	return ch
+}
+
+// grants runs a query returning grant rows and sends the values.
+func (ga *GrantAccess) grants(ctx context.Context, query string,
+	args ...interface{}) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 256)
+
+	go func() {
+		defer close(ch)
+		rows, err := traceQuery(ctx, ga.DBS, query, args...)
+		if err != nil {
+			ch <- dlib.Result{Err: err}
+			return
+		}
+
+		defer rows.Close()
+		for rows.Next() {
+			r := GrantRow{}
+			if err := rows.Scan(
+				&r.ID,
+				&r.UserID,
+				&r.RoleID,
+				&r.GroupID,
+				&r.PermID,
+				&r.Resource,
+				&r.Conditions,
+			); err != nil {
+				ch <- dlib.Result{Err: err}
+				continue
+			}
+
+			v, err := r.ToGrant()
+			if err != nil {
+				ch <- dlib.Result{Err: err}
+				continue
+			}
+
+			ch <- dlib.Result{Val: v, Num: 1}
+		}
+	}()
+
+	return ch
+}
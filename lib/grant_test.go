@@ -0,0 +1,293 @@
+package lib
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/dhaifley/dlib"
+	"github.com/dhaifley/dlib/dauth"
+)
+
+type MockGrantRows struct {
+	row int
+}
+
+func (m *MockGrantRows) Close() error {
+	return nil
+}
+
+func (m *MockGrantRows) Next() bool {
+	m.row++
+	if m.row > 1 {
+		return false
+	}
+
+	return true
+}
+
+func (m *MockGrantRows) Scan(dest ...interface{}) error {
+	for i, d := range dest {
+		switch v := d.(type) {
+		case *int64:
+			*v = int64(1)
+		case *int:
+			*v = 1
+		case *string:
+			*v = "project:42"
+			if i == 6 {
+				*v = `[{"attr":"tenant","op":"eq","value":"acme"}]`
+			}
+		default:
+			return dlib.NewError(500, "Invalid type")
+		}
+	}
+
+	return nil
+}
+
+type MockGrantDBSession struct{}
+
+func (m *MockGrantDBSession) Close() error {
+	return nil
+}
+
+func (m *MockGrantDBSession) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return nil, nil
+}
+
+func (m *MockGrantDBSession) Query(query string, args ...interface{}) (dlib.SQLRows, error) {
+	mr := MockGrantRows{}
+	return &mr, nil
+}
+
+func (m *MockGrantDBSession) Ping() error {
+	return nil
+}
+
+func (m *MockGrantDBSession) Stats() sql.DBStats {
+	return sql.DBStats{OpenConnections: 0}
+}
+
+func TestConditionMatch(t *testing.T) {
+	r := AccessRequest{
+		Resource: "project:42",
+		UserID:   7,
+		IP:       "10.1.2.3",
+		Time:     time.Date(2018, 9, 4, 10, 30, 0, 0, time.UTC),
+		Attributes: map[string]string{
+			"owner":  "7",
+			"tenant": "acme",
+		},
+	}
+
+	cases := []struct {
+		c   Condition
+		exp bool
+	}{
+		{Condition{"tenant", ConditionEq, "acme"}, true},
+		{Condition{"tenant", ConditionEq, "other"}, false},
+		{Condition{"tenant", ConditionNe, "other"}, true},
+		{Condition{"owner", ConditionEq, "$user"}, true},
+		{Condition{"owner", ConditionEq, "$missing"}, false},
+		{Condition{"missing", ConditionNe, "acme"}, false},
+		{Condition{"tenant", ConditionIn, "other, acme"}, true},
+		{Condition{"ip", ConditionCIDR, "10.0.0.0/8"}, true},
+		{Condition{"ip", ConditionCIDR, "192.168.0.0/16"}, false},
+		{Condition{"ip", ConditionCIDR, "invalid"}, false},
+		{Condition{"time", ConditionBetween, "09:00-17:00"}, true},
+		{Condition{"time", ConditionBetween, "17:00-09:00"}, false},
+		{Condition{"time", ConditionBetween, "22:00-11:00"}, true},
+		{Condition{"resource", "unknown", "project:42"}, false},
+	}
+
+	for _, c := range cases {
+		if got := c.c.Match(&r); got != c.exp {
+			t.Errorf("%v expected: %v, got: %v", c.c, c.exp, got)
+		}
+	}
+
+	deny := []struct {
+		c   Condition
+		exp bool
+	}{
+		{Condition{"tenant", ConditionEq, "acme"}, true},
+		{Condition{"tenant", ConditionEq, "other"}, false},
+		{Condition{"owner", ConditionEq, "$missing"}, true},
+		{Condition{"missing", ConditionEq, "acme"}, true},
+		{Condition{"ip", ConditionCIDR, "192.168.0.0/16"}, false},
+		{Condition{"ip", ConditionCIDR, "invalid"}, true},
+		{Condition{"time", ConditionBetween, "invalid"}, true},
+		{Condition{"resource", "unknown", "project:42"}, true},
+	}
+
+	for _, c := range deny {
+		if got := c.c.MatchDeny(&r); got != c.exp {
+			t.Errorf("%v deny expected: %v, got: %v", c.c, c.exp, got)
+		}
+	}
+}
+
+func TestGrantMatch(t *testing.T) {
+	r := AccessRequest{
+		Resource:   "project:42",
+		Attributes: map[string]string{"tenant": "acme"},
+	}
+
+	cases := []struct {
+		g   Grant
+		exp bool
+	}{
+		{Grant{}, true},
+		{Grant{Resource: "project:42"}, true},
+		{Grant{Resource: "project:*"}, true},
+		{Grant{Resource: "project:43"}, false},
+		{Grant{Resource: "project:*", Conditions: []Condition{
+			{"tenant", ConditionEq, "acme"}}}, true},
+		{Grant{Resource: "project:*", Conditions: []Condition{
+			{"tenant", ConditionEq, "acme"},
+			{"tenant", ConditionEq, "other"}}}, false},
+	}
+
+	for _, c := range cases {
+		if got := c.g.Match(&r); got != c.exp {
+			t.Errorf("%v expected: %v, got: %v", c.g, c.exp, got)
+		}
+	}
+
+	if (&Grant{Resource: "project:*"}).Match(&AccessRequest{}) {
+		t.Error("Expected resource grant not to match without a resource")
+	}
+
+	if !(&Grant{Resource: "project:*"}).MatchDeny(&AccessRequest{}) {
+		t.Error("Expected resource deny grant to match without a resource")
+	}
+
+	if (&Grant{Resource: "project:13"}).MatchDeny(&r) {
+		t.Error("Expected resource deny grant not to match other resources")
+	}
+}
+
+func TestPermMatcherDecide(t *testing.T) {
+	edit := dauth.Perm{ID: 1, Service: "projects", Name: "edit"}
+	deny := dauth.Perm{ID: 2, Service: "!projects", Name: "edit"}
+	m := NewPermMatcher()
+	m.AddGrant(edit, &Grant{ID: 1, Resource: "project:*", Conditions: []Condition{
+		{"tenant", ConditionEq, "acme"}}})
+	m.AddGrant(edit, &Grant{ID: 2, Resource: "project:42"})
+	m.AddGrant(deny, &Grant{ID: 3, Resource: "project:13"})
+	cases := []struct {
+		resource string
+		tenant   string
+		allowed  bool
+		denied   bool
+		grant    int64
+	}{
+		{"project:42", "", true, false, 2},
+		{"project:42", "acme", true, false, 2},
+		{"project:7", "acme", true, false, 1},
+		{"project:7", "other", false, false, 0},
+		{"project:13", "acme", false, true, 3},
+	}
+
+	for _, c := range cases {
+		d := m.Decide(&AccessRequest{
+			Service:    "projects",
+			Name:       "edit",
+			Resource:   c.resource,
+			Attributes: map[string]string{"tenant": c.tenant},
+		})
+		if d.Allowed != c.allowed || d.Denied != c.denied {
+			t.Errorf("%v expected: %v %v, got: %v %v", c.resource,
+				c.allowed, c.denied, d.Allowed, d.Denied)
+			continue
+		}
+
+		if c.grant != 0 && (d.Grant == nil || d.Grant.ID != c.grant) {
+			t.Errorf("%v grant expected: %v, got: %v", c.resource, c.grant,
+				d.Grant)
+		}
+	}
+
+	if _, ok := m.Match("projects", "edit"); ok {
+		t.Error("Expected resource grants not to match without a resource")
+	}
+
+	d := m.Decide(&AccessRequest{Service: "projects", Name: "edit"})
+	if !d.Denied || d.Grant == nil || d.Grant.ID != 3 {
+		t.Errorf("Expected resource deny without a resource, got: %v", d)
+	}
+
+	m.AddGrant(deny, &Grant{ID: 4, Conditions: []Condition{
+		{"tenant", ConditionEq, "evil"}}})
+	d = m.Decide(&AccessRequest{Service: "projects", Name: "edit",
+		Resource: "project:42"})
+	if !d.Denied || d.Grant == nil || d.Grant.ID != 4 {
+		t.Errorf("Expected conditional deny without attributes, got: %v", d)
+	}
+
+	d = m.Decide(&AccessRequest{Service: "projects", Name: "edit",
+		Resource: "project:42", Attributes: map[string]string{
+			"tenant": "acme"}})
+	if !d.Allowed || d.Denied {
+		t.Errorf("Expected conditional deny not to match, got: %v", d)
+	}
+
+	gs := m.Grants()
+	if len(gs) != 4 || !gs[0].Allowed || !gs[2].Denied ||
+		gs[2].Grant.ID != 3 {
+		t.Errorf("Grants expected: 4 with denies last, got: %v", gs)
+	}
+}
+
+func TestGrantAccess(t *testing.T) {
+	ctx := context.Background()
+	ga := NewGrantAccessor(&MockGrantDBSession{})
+	id := int64(1)
+	for _, ch := range []<-chan dlib.Result{
+		ga.GetGrants(ctx, &GrantFind{ID: &id}),
+		ga.GetUserGrants(ctx, 1),
+	} {
+		var a []Grant
+		for r := range ch {
+			if r.Err != nil {
+				t.Error(r.Err)
+			}
+
+			if v, ok := r.Val.(Grant); ok {
+				a = append(a, v)
+			}
+		}
+
+		if len(a) != 1 || a[0].Resource != "project:42" ||
+			len(a[0].Conditions) != 1 || a[0].Conditions[0].Value != "acme" {
+			t.Errorf("Grant expected for project:42, got: %v", a)
+		}
+	}
+
+	g := Grant{UserID: 1, PermID: 1, Conditions: []Condition{
+		{"tenant", ConditionEq, "acme"}}}
+	for r := range ga.SaveGrant(ctx, &g) {
+		if r.Err != nil {
+			t.Error(r.Err)
+		}
+	}
+
+	if g.ID != 1 {
+		t.Errorf("ID expected: 1, got: %v", g.ID)
+	}
+
+	n := 0
+	for r := range ga.DeleteGrants(ctx, &GrantFind{ID: &id}) {
+		if r.Err != nil {
+			t.Error(r.Err)
+		}
+
+		n = r.Num
+	}
+
+	if n != 1 {
+		t.Errorf("Delete count expected: 1, got: %v", n)
+	}
+}
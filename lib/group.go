@@ -0,0 +1,495 @@
+package lib
+
+import (
+	"context"
+	"github.com/dhaifley/dlib"
+)
+
+// Group values represent teams of users. Perms granted to a group are held
+// by its members, and by the members of all groups nested in it.
+type Group struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// GroupFind values are used to find groups in the database.
+type GroupFind struct {
+	ID   *int64  `json:"id,omitempty"`
+	Name *string `json:"name,omitempty"`
+}
+
+// GroupPerm values grant a perm to a group.
+type GroupPerm struct {
+	ID      int64 `json:"id"`
+	GroupID int64 `json:"group_id"`
+	PermID  int64 `json:"perm_id"`
+}
+
+// GroupPermFind values are used to find group_perm records in the database.
+type GroupPermFind struct {
+	ID      *int64 `json:"id,omitempty"`
+	GroupID *int64 `json:"group_id,omitempty"`
+	PermID  *int64 `json:"perm_id,omitempty"`
+}
+
+// UserGroup values make a user a member of a group.
+type UserGroup struct {
+	ID      int64 `json:"id"`
+	UserID  int64 `json:"user_id"`
+	GroupID int64 `json:"group_id"`
+}
+
+// UserGroupFind values are used to find user_group records in the database.
+type UserGroupFind struct {
+	ID      *int64 `json:"id,omitempty"`
+	UserID  *int64 `json:"user_id,omitempty"`
+	GroupID *int64 `json:"group_id,omitempty"`
+}
+
+// GroupGroup values nest the child group in the parent group, so that the
+// members of the child inherit the perms of the parent.
+type GroupGroup struct {
+	ID       int64 `json:"id"`
+	ParentID int64 `json:"parent_id"`
+	ChildID  int64 `json:"child_id"`
+}
+
+// GroupGroupFind values are used to find group_group records in the
+// database.
+type GroupGroupFind struct {
+	ID       *int64 `json:"id,omitempty"`
+	ParentID *int64 `json:"parent_id,omitempty"`
+	ChildID  *int64 `json:"child_id,omitempty"`
+}
+
+// GroupAccess values are used to access group, group_perm, user_group and
+// group_group records in the database.
+type GroupAccess struct {
+	DBS dlib.SQLExecutor
+}
+
+// GroupAccessor is an interface describing values capable of providing
+// access to group, group_perm, user_group and group_group records in the
+// database.
+type GroupAccessor interface {
+	GetGroups(ctx context.Context, opt *GroupFind) <-chan dlib.Result
+	GetGroupByID(ctx context.Context, id int64) <-chan dlib.Result
+	DeleteGroups(ctx context.Context, opt *GroupFind) <-chan dlib.Result
+	DeleteGroupByID(ctx context.Context, id int64) <-chan dlib.Result
+	SaveGroup(ctx context.Context, g *Group) <-chan dlib.Result
+	SaveGroups(ctx context.Context, g []Group) <-chan dlib.Result
+	GetGroupPerms(ctx context.Context,
+		opt *GroupPermFind) <-chan dlib.Result
+	DeleteGroupPerms(ctx context.Context,
+		opt *GroupPermFind) <-chan dlib.Result
+	SaveGroupPerm(ctx context.Context, gp *GroupPerm) <-chan dlib.Result
+	GetUserGroups(ctx context.Context,
+		opt *UserGroupFind) <-chan dlib.Result
+	DeleteUserGroups(ctx context.Context,
+		opt *UserGroupFind) <-chan dlib.Result
+	SaveUserGroup(ctx context.Context, ug *UserGroup) <-chan dlib.Result
+	GetGroupGroups(ctx context.Context,
+		opt *GroupGroupFind) <-chan dlib.Result
+	DeleteGroupGroups(ctx context.Context,
+		opt *GroupGroupFind) <-chan dlib.Result
+	SaveGroupGroup(ctx context.Context, gg *GroupGroup) <-chan dlib.Result
+	GetUserGroupPerms(ctx context.Context, userID int64) <-chan dlib.Result
+}
+
+// NewGroupAccessor creates a new GroupAccess instance and returns a pointer
+// to it.
+func NewGroupAccessor(dbs dlib.SQLExecutor) GroupAccessor {
+	ga := GroupAccess{DBS: dbs}
+	return &ga
+}
+
+// GetGroups finds group values in the database.
+func (ga *GroupAccess) GetGroups(ctx context.Context,
+	opt *GroupFind) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 256)
+
+	go func() {
+		defer close(ch)
+		rows, err := traceQuery(ctx, ga.DBS, `
+			SELECT
+				g.id,
+				g.name,
+				g.description
+			FROM get_groups($1, $2) AS g`,
+			opt.ID,
+			opt.Name)
+		if err != nil {
+			ch <- dlib.Result{Err: err}
+			return
+		}
+
+		defer rows.Close()
+		for rows.Next() {
+			v := Group{}
+			if err := rows.Scan(
+				&v.ID,
+				&v.Name,
+				&v.Description,
+			); err != nil {
+				ch <- dlib.Result{Err: err}
+				continue
+			}
+
+			ch <- dlib.Result{Val: v, Num: 1}
+		}
+	}()
+
+	return ch
+}
+
+// GetGroupByID finds a group value in the database by ID.
+func (ga *GroupAccess) GetGroupByID(ctx context.Context,
+	id int64) <-chan dlib.Result {
+	opt := GroupFind{ID: &id}
+	return ga.GetGroups(ctx, &opt)
+}
+
+// DeleteGroups deletes group values from the database, along with their
+// group_perm, user_group and group_group records.
+func (ga *GroupAccess) DeleteGroups(ctx context.Context,
+	opt *GroupFind) <-chan dlib.Result {
+	return ga.count(ctx,
+		"SELECT delete_groups($1, $2) AS num", opt.ID, opt.Name)
+}
+
+// DeleteGroupByID deletes a group value from the database by ID.
+func (ga *GroupAccess) DeleteGroupByID(ctx context.Context,
+	id int64) <-chan dlib.Result {
+	opt := GroupFind{ID: &id}
+	return ga.DeleteGroups(ctx, &opt)
+}
+
+// SaveGroup saves a group value to the database.
+func (ga *GroupAccess) SaveGroup(ctx context.Context,
+	g *Group) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 256)
+
+	go func() {
+		defer close(ch)
+		id, err := ga.save(ctx, "SELECT save_group($1, $2, $3) AS id",
+			g.ID,
+			g.Name,
+			g.Description)
+		if err != nil {
+			ch <- dlib.Result{Err: err}
+			return
+		}
+
+		g.ID = id
+		ch <- dlib.Result{Val: *g, Err: nil}
+	}()
+
+	return ch
+}
+
+// SaveGroups saves a slice of group values to the database.
+func (ga *GroupAccess) SaveGroups(ctx context.Context,
+	g []Group) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 256)
+
+	go func() {
+		defer close(ch)
+		for i := range g {
+			for sr := range ga.SaveGroup(ctx, &g[i]) {
+				ch <- sr
+			}
+		}
+	}()
+
+	return ch
+}
+
+// GetGroupPerms finds group_perm values in the database.
+func (ga *GroupAccess) GetGroupPerms(ctx context.Context,
+	opt *GroupPermFind) <-chan dlib.Result {
+	return ga.groupPerms(ctx, `
+		SELECT
+			gp.id,
+			gp.group_id,
+			gp.perm_id
+		FROM get_group_perms($1, $2, $3) AS gp`,
+		opt.ID,
+		opt.GroupID,
+		opt.PermID)
+}
+
+// DeleteGroupPerms deletes group_perm values from the database.
+func (ga *GroupAccess) DeleteGroupPerms(ctx context.Context,
+	opt *GroupPermFind) <-chan dlib.Result {
+	return ga.count(ctx, "SELECT delete_group_perms($1, $2, $3) AS num",
+		opt.ID,
+		opt.GroupID,
+		opt.PermID)
+}
+
+// SaveGroupPerm saves a group_perm value to the database.
+func (ga *GroupAccess) SaveGroupPerm(ctx context.Context,
+	gp *GroupPerm) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 256)
+
+	go func() {
+		defer close(ch)
+		id, err := ga.save(ctx,
+			"SELECT save_group_perm($1, $2, $3) AS id",
+			gp.ID,
+			gp.GroupID,
+			gp.PermID)
+		if err != nil {
+			ch <- dlib.Result{Err: err}
+			return
+		}
+
+		gp.ID = id
+		ch <- dlib.Result{Val: *gp, Err: nil}
+	}()
+
+	return ch
+}
+
+// GetUserGroups finds user_group values in the database.
+func (ga *GroupAccess) GetUserGroups(ctx context.Context,
+	opt *UserGroupFind) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 256)
+
+	go func() {
+		defer close(ch)
+		rows, err := traceQuery(ctx, ga.DBS, `
+			SELECT
+				ug.id,
+				ug.user_id,
+				ug.group_id
+			FROM get_user_groups($1, $2, $3) AS ug`,
+			opt.ID,
+			opt.UserID,
+			opt.GroupID)
+		if err != nil {
+			ch <- dlib.Result{Err: err}
+			return
+		}
+
+		defer rows.Close()
+		for rows.Next() {
+			v := UserGroup{}
+			if err := rows.Scan(
+				&v.ID,
+				&v.UserID,
+				&v.GroupID,
+			); err != nil {
+				ch <- dlib.Result{Err: err}
+				continue
+			}
+
+			ch <- dlib.Result{Val: v, Num: 1}
+		}
+	}()
+
+	return ch
+}
+
+// DeleteUserGroups deletes user_group values from the database.
+func (ga *GroupAccess) DeleteUserGroups(ctx context.Context,
+	opt *UserGroupFind) <-chan dlib.Result {
+	return ga.count(ctx, "SELECT delete_user_groups($1, $2, $3) AS num",
+		opt.ID,
+		opt.UserID,
+		opt.GroupID)
+}
+
+// SaveUserGroup saves a user_group value to the database.
+func (ga *GroupAccess) SaveUserGroup(ctx context.Context,
+	ug *UserGroup) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 256)
+
+	go func() {
+		defer close(ch)
+		id, err := ga.save(ctx,
+			"SELECT save_user_group($1, $2, $3) AS id",
+			ug.ID,
+			ug.UserID,
+			ug.GroupID)
+		if err != nil {
+			ch <- dlib.Result{Err: err}
+			return
+		}
+
+		ug.ID = id
+		ch <- dlib.Result{Val: *ug, Err: nil}
+	}()
+
+	return ch
+}
+
+// GetGroupGroups finds group_group values in the database.
+func (ga *GroupAccess) GetGroupGroups(ctx context.Context,
+	opt *GroupGroupFind) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 256)
+
+	go func() {
+		defer close(ch)
+		rows, err := traceQuery(ctx, ga.DBS, `
+			SELECT
+				gg.id,
+				gg.parent_id,
+				gg.child_id
+			FROM get_group_groups($1, $2, $3) AS gg`,
+			opt.ID,
+			opt.ParentID,
+			opt.ChildID)
+		if err != nil {
+			ch <- dlib.Result{Err: err}
+			return
+		}
+
+		defer rows.Close()
+		for rows.Next() {
+			v := GroupGroup{}
+			if err := rows.Scan(
+				&v.ID,
+				&v.ParentID,
+				&v.ChildID,
+			); err != nil {
+				ch <- dlib.Result{Err: err}
+				continue
+			}
+
+			ch <- dlib.Result{Val: v, Num: 1}
+		}
+	}()
+
+	return ch
+}
+
+// DeleteGroupGroups deletes group_group values from the database.
+func (ga *GroupAccess) DeleteGroupGroups(ctx context.Context,
+	opt *GroupGroupFind) <-chan dlib.Result {
+	return ga.count(ctx, "SELECT delete_group_groups($1, $2, $3) AS num",
+		opt.ID,
+		opt.ParentID,
+		opt.ChildID)
+}
+
+// SaveGroupGroup saves a group_group value to the database. The database
+// refuses nestings which would make a group its own ancestor.
+func (ga *GroupAccess) SaveGroupGroup(ctx context.Context,
+	gg *GroupGroup) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 256)
+
+	go func() {
+		defer close(ch)
+		id, err := ga.save(ctx,
+			"SELECT save_group_group($1, $2, $3) AS id",
+			gg.ID,
+			gg.ParentID,
+			gg.ChildID)
+		if err != nil {
+			ch <- dlib.Result{Err: err}
+			return
+		}
+
+		gg.ID = id
+		ch <- dlib.Result{Val: *gg, Err: nil}
+	}()
+
+	return ch
+}
+
+// GetUserGroupPerms finds the group_perm values of all groups a user belongs
+// to, directly or through nested groups.
+func (ga *GroupAccess) GetUserGroupPerms(ctx context.Context,
+	userID int64) <-chan dlib.Result {
+	return ga.groupPerms(ctx, `
+		SELECT
+			gp.id,
+			gp.group_id,
+			gp.perm_id
+		FROM get_user_group_perms($1) AS gp`,
+		userID)
+}
+
+// groupPerms runs a query returning group_perm rows and sends the values.
+func (ga *GroupAccess) groupPerms(ctx context.Context, query string,
+	args ...interface{}) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 256)
+
+	go func() {
+		defer close(ch)
+		rows, err := traceQuery(ctx, ga.DBS, query, args...)
+		if err != nil {
+			ch <- dlib.Result{Err: err}
+			return
+		}
+
+		defer rows.Close()
+		for rows.Next() {
+			v := GroupPerm{}
+			if err := rows.Scan(
+				&v.ID,
+				&v.GroupID,
+				&v.PermID,
+			); err != nil {
+				ch <- dlib.Result{Err: err}
+				continue
+			}
+
+			ch <- dlib.Result{Val: v, Num: 1}
+		}
+	}()
+
+	return ch
+}
+
+// save runs a query returning a single id column and returns the id.
+func (ga *GroupAccess) save(ctx context.Context,
+	query string, args ...interface{}) (int64, error) {
+	rows, err := traceQuery(ctx, ga.DBS, query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	defer rows.Close()
+	id := int64(0)
+	for rows.Next() {
+		if err := rows.Scan(&id); err != nil {
+			return 0, err
+		}
+	}
+
+	return id, nil
+}
+
+// count runs a query returning a single count column and sends the total.
+func (ga *GroupAccess) count(ctx context.Context, query string,
+	args ...interface{}) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 256)
+
+	go func() {
+		defer close(ch)
+		rows, err := traceQuery(ctx, ga.DBS, query, args...)
+		if err != nil {
+			ch <- dlib.Result{Err: err}
+			return
+		}
+
+		defer rows.Close()
+		n := 0
+		for rows.Next() {
+			r := struct{ Num int }{Num: 0}
+			if err := rows.Scan(&r.Num); err != nil {
+				ch <- dlib.Result{Err: err}
+				continue
+			}
+
+			n += r.Num
+		}
+
+		ch <- dlib.Result{Num: n, Err: nil}
+	}()
+
+	return ch
+}
@@ -0,0 +1,108 @@
+package lib
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dhaifley/dlib"
+)
+
+func TestGroupAccessGetGroups(t *testing.T) {
+	ctx := context.Background()
+	ga := NewGroupAccessor(&MockRoleDBSession{})
+	var a []Group
+	for r := range ga.GetGroupByID(ctx, 1) {
+		if r.Err != nil {
+			t.Error(r.Err)
+		}
+
+		if v, ok := r.Val.(Group); ok {
+			a = append(a, v)
+		}
+	}
+
+	if len(a) != 1 || a[0].ID != 1 || a[0].Name != "test" {
+		t.Errorf("Group expected: 1 test, got: %v", a)
+	}
+}
+
+func TestGroupAccessSaves(t *testing.T) {
+	ctx := context.Background()
+	ga := NewGroupAccessor(&MockRoleDBSession{})
+	g := []Group{{Name: "test"}}
+	gp := GroupPerm{GroupID: 1, PermID: 1}
+	ug := UserGroup{UserID: 1, GroupID: 1}
+	gg := GroupGroup{ParentID: 1, ChildID: 2}
+	for _, ch := range []<-chan dlib.Result{
+		ga.SaveGroups(ctx, g),
+		ga.SaveGroupPerm(ctx, &gp),
+		ga.SaveUserGroup(ctx, &ug),
+		ga.SaveGroupGroup(ctx, &gg),
+	} {
+		for r := range ch {
+			if r.Err != nil {
+				t.Error(r.Err)
+			}
+		}
+	}
+
+	if g[0].ID != 1 || gp.ID != 1 || ug.ID != 1 || gg.ID != 1 {
+		t.Errorf("IDs expected: 1, got: %v, %v, %v, %v", g[0].ID, gp.ID,
+			ug.ID, gg.ID)
+	}
+}
+
+func TestGroupAccessMembers(t *testing.T) {
+	ctx := context.Background()
+	ga := NewGroupAccessor(&MockRoleDBSession{})
+	id := int64(1)
+	n := 0
+	for _, ch := range []<-chan dlib.Result{
+		ga.GetGroupPerms(ctx, &GroupPermFind{GroupID: &id}),
+		ga.GetUserGroupPerms(ctx, 1),
+		ga.GetUserGroups(ctx, &UserGroupFind{UserID: &id}),
+		ga.GetGroupGroups(ctx, &GroupGroupFind{ParentID: &id}),
+	} {
+		for r := range ch {
+			if r.Err != nil {
+				t.Error(r.Err)
+			}
+
+			switch r.Val.(type) {
+			case GroupPerm, UserGroup, GroupGroup:
+				n++
+			}
+		}
+	}
+
+	if n != 4 {
+		t.Errorf("Values expected: 4, got: %v", n)
+	}
+}
+
+func TestGroupAccessDeletes(t *testing.T) {
+	ctx := context.Background()
+	ga := NewGroupAccessor(&MockRoleDBSession{})
+	id := int64(1)
+	chs := []<-chan dlib.Result{
+		ga.DeleteGroupByID(ctx, 1),
+		ga.DeleteGroupPerms(ctx, &GroupPermFind{ID: &id}),
+		ga.DeleteUserGroups(ctx, &UserGroupFind{ID: &id}),
+		ga.DeleteGroupGroups(ctx, &GroupGroupFind{ID: &id}),
+	}
+
+	for i, ch := range chs {
+		n := 0
+		for r := range ch {
+			if r.Err != nil {
+				t.Error(r.Err)
+			}
+
+			n = r.Num
+		}
+
+		if n != 1 {
+			t.Errorf("Delete count %v expected: 1, got: %v", i, n)
+		}
+	}
+}
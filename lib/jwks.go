@@ -0,0 +1,95 @@
+package lib
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+	"sort"
+	"time"
+)
+
+// JWK values represent a public key in JSON Web Key format.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKSet values represent a JSON Web Key Set.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWK returns the public part of an asymmetric key in JSON Web Key format.
+// HMAC keys have no public part and are never published.
+func (k *Key) JWK() (JWK, bool) {
+	if k.Private == nil {
+		return JWK{}, false
+	}
+
+	enc := base64.RawURLEncoding.EncodeToString
+	j := JWK{Kid: k.ID, Use: "sig", Alg: k.Method.Alg()}
+	switch pk := k.Private.Public().(type) {
+	case *rsa.PublicKey:
+		j.Kty = "RSA"
+		j.N = enc(pk.N.Bytes())
+		j.E = enc(big.NewInt(int64(pk.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (pk.Curve.Params().BitSize + 7) / 8
+		j.Kty = "EC"
+		j.Crv = pk.Curve.Params().Name
+		j.X = enc(padBytes(pk.X.Bytes(), size))
+		j.Y = enc(padBytes(pk.Y.Bytes(), size))
+	case ed25519.PublicKey:
+		j.Kty = "OKP"
+		j.Crv = "Ed25519"
+		j.X = enc(pk)
+	default:
+		return JWK{}, false
+	}
+
+	return j, true
+}
+
+// JWKS returns the set of public keys that may currently verify tokens.
+func (kr *KeyRing) JWKS() JWKSet {
+	ids := make([]string, 0, len(kr.keys))
+	for id := range kr.keys {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+	set := JWKSet{Keys: []JWK{}}
+	now := time.Now()
+	for _, id := range ids {
+		k := kr.keys[id]
+		if k.Retired != nil && now.After(k.Retired.Add(kr.Grace)) {
+			continue
+		}
+
+		if j, ok := k.JWK(); ok {
+			set.Keys = append(set.Keys, j)
+		}
+	}
+
+	return set
+}
+
+// padBytes left pads a big endian integer to the provided size.
+func padBytes(b []byte, size int) []byte {
+	if len(b) >= size {
+		return b
+	}
+
+	p := make([]byte, size)
+	copy(p[size-len(b):], b)
+	return p
+}
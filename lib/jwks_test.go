@@ -0,0 +1,47 @@
+package lib
+
+import (
+	"testing"
+	"time"
+)
+
+func TestKeyRingJWKS(t *testing.T) {
+	rt := time.Now().Add(-2 * time.Hour)
+	kr, err := NewKeyRingFromConfig([]KeyConfig{
+		{ID: "hmac", Secret: "test"},
+		{ID: "rsa", Alg: "RS256", Secret: testPEMKey(t, "RS256")},
+		{ID: "ec", Alg: "ES256", Secret: testPEMKey(t, "ES256")},
+		{ID: "ed", Alg: "EdDSA", Secret: testPEMKey(t, "EdDSA")},
+		{ID: "old", Alg: "EdDSA", Secret: testPEMKey(t, "EdDSA"),
+			Retired: rt.Format(time.RFC3339)},
+	}, "rsa", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	set := kr.JWKS()
+	exp := []struct{ kid, kty, crv string }{
+		{kid: "ec", kty: "EC", crv: "P-256"},
+		{kid: "ed", kty: "OKP", crv: "Ed25519"},
+		{kid: "rsa", kty: "RSA"},
+	}
+
+	if len(set.Keys) != len(exp) {
+		t.Fatalf("Key count expected: %v, got: %v", len(exp), len(set.Keys))
+	}
+
+	for i, e := range exp {
+		k := set.Keys[i]
+		if k.Kid != e.kid || k.Kty != e.kty || k.Crv != e.crv {
+			t.Errorf("Key expected: %v, got: %v", e, k)
+		}
+	}
+
+	if len(set.Keys[0].X) != 43 || len(set.Keys[0].Y) != 43 {
+		t.Errorf("Invalid EC coordinate encoding: %v", set.Keys[0])
+	}
+
+	if set.Keys[2].E != "AQAB" {
+		t.Errorf("RSA exponent expected: AQAB, got: %v", set.Keys[2].E)
+	}
+}
@@ -0,0 +1,278 @@
+package lib
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/dhaifley/dlib"
+)
+
+// Key values represent a single token signing key. HMAC keys hold a shared
+// secret, while RSA, ECDSA and Ed25519 keys hold a private key.
+type Key struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Secret  []byte
+	Private crypto.Signer
+	Retired *time.Time
+}
+
+// SignKey returns the key material used to sign tokens.
+func (k *Key) SignKey() interface{} {
+	if k.Private != nil {
+		return k.Private
+	}
+
+	return k.Secret
+}
+
+// VerifyKey returns the key material used to verify tokens.
+func (k *Key) VerifyKey() interface{} {
+	if k.Private != nil {
+		return k.Private.Public()
+	}
+
+	return k.Secret
+}
+
+// KeyConfig values describe a signing key as it appears in configuration.
+// The secret may be provided inline or read from a file. For asymmetric
+// algorithms the secret must be a PEM encoded private key. Retired, when
+// set, is an RFC 3339 timestamp after which the key is no longer used to
+// sign.
+type KeyConfig struct {
+	ID      string `mapstructure:"id"`
+	Alg     string `mapstructure:"alg"`
+	Secret  string `mapstructure:"secret"`
+	File    string `mapstructure:"file"`
+	Retired string `mapstructure:"retired"`
+}
+
+// ToKey converts a KeyConfig value into a Key.
+func (kc *KeyConfig) ToKey() (*Key, error) {
+	if kc.ID == "" {
+		return nil, dlib.NewError(http.StatusInternalServerError,
+			"signing key id missing")
+	}
+
+	alg := kc.Alg
+	if alg == "" {
+		alg = jwt.SigningMethodHS256.Alg()
+	}
+
+	m := jwt.GetSigningMethod(alg)
+	if m == nil {
+		return nil, dlib.NewError(http.StatusInternalServerError,
+			"signing key "+kc.ID+" has unsupported algorithm "+alg)
+	}
+
+	var b []byte
+	switch {
+	case kc.Secret != "":
+		b = []byte(kc.Secret)
+	case kc.File != "":
+		fb, err := ioutil.ReadFile(kc.File)
+		if err != nil {
+			return nil, err
+		}
+
+		b = []byte(strings.TrimSpace(string(fb)))
+	}
+
+	if len(b) == 0 {
+		return nil, dlib.NewError(http.StatusInternalServerError,
+			"signing key "+kc.ID+" has no secret")
+	}
+
+	k := Key{ID: kc.ID, Method: m}
+	if _, ok := m.(*jwt.SigningMethodHMAC); ok {
+		k.Secret = b
+	} else {
+		pk, err := parsePrivateKey(b)
+		if err != nil {
+			return nil, err
+		}
+
+		if !keyMatchesMethod(pk, m) {
+			return nil, dlib.NewError(http.StatusInternalServerError,
+				"signing key "+kc.ID+" does not match algorithm "+alg)
+		}
+
+		k.Private = pk
+	}
+
+	if kc.Retired != "" {
+		rt, err := time.Parse(time.RFC3339, kc.Retired)
+		if err != nil {
+			return nil, err
+		}
+
+		k.Retired = &rt
+	}
+
+	return &k, nil
+}
+
+// KeyRing values hold the set of keys used to sign and verify tokens.
+// Tokens are always signed with the designated signing key and carry its id
+// in the kid header. Any key in the ring may verify a token until it has
+// been retired for longer than the grace period.
+type KeyRing struct {
+	Signing string
+	Grace   time.Duration
+	keys    map[string]*Key
+}
+
+// NewKeyRing creates a new KeyRing value containing the provided keys.
+func NewKeyRing(signing string, grace time.Duration,
+	keys ...*Key) (*KeyRing, error) {
+	kr := KeyRing{
+		Signing: signing,
+		Grace:   grace,
+		keys:    make(map[string]*Key, len(keys)),
+	}
+
+	for _, k := range keys {
+		kr.keys[k.ID] = k
+	}
+
+	if _, err := kr.SigningKey(); err != nil {
+		return nil, err
+	}
+
+	return &kr, nil
+}
+
+// NewKeyRingFromConfig creates a new KeyRing value from key configuration.
+func NewKeyRingFromConfig(cfg []KeyConfig, signing string,
+	grace time.Duration) (*KeyRing, error) {
+	keys := make([]*Key, 0, len(cfg))
+	for _, kc := range cfg {
+		k, err := kc.ToKey()
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, k)
+	}
+
+	return NewKeyRing(signing, grace, keys...)
+}
+
+// Key returns the key in the ring with the provided id.
+func (kr *KeyRing) Key(id string) (*Key, bool) {
+	k, ok := kr.keys[id]
+	return k, ok
+}
+
+// SigningKey returns the key currently designated for signing tokens.
+func (kr *KeyRing) SigningKey() (*Key, error) {
+	k, ok := kr.Key(kr.Signing)
+	if !ok {
+		return nil, dlib.NewError(http.StatusInternalServerError,
+			"signing key "+kr.Signing+" not found")
+	}
+
+	if k.Retired != nil && !k.Retired.After(time.Now()) {
+		return nil, dlib.NewError(http.StatusInternalServerError,
+			"signing key "+kr.Signing+" is retired")
+	}
+
+	return k, nil
+}
+
+// Sign creates a signed token string for the provided claims.
+func (kr *KeyRing) Sign(claims jwt.Claims) (string, error) {
+	k, err := kr.SigningKey()
+	if err != nil {
+		return "", err
+	}
+
+	t := jwt.NewWithClaims(k.Method, claims)
+	t.Header["kid"] = k.ID
+	return t.SignedString(k.SignKey())
+}
+
+// Keyfunc returns the key used to verify the provided token. It is suitable
+// for use with the jwt parsing functions.
+func (kr *KeyRing) Keyfunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	k, ok := kr.Key(kid)
+	if !ok {
+		return nil, dlib.NewError(http.StatusUnauthorized,
+			"unknown signing key")
+	}
+
+	if t.Method.Alg() != k.Method.Alg() {
+		return nil, dlib.NewError(http.StatusUnauthorized,
+			"invalid signing method")
+	}
+
+	if k.Retired != nil && time.Now().After(k.Retired.Add(kr.Grace)) {
+		return nil, dlib.NewError(http.StatusUnauthorized,
+			"expired signing key")
+	}
+
+	return k.VerifyKey(), nil
+}
+
+// Parse parses and verifies a token string using the keys in the ring.
+func (kr *KeyRing) Parse(ts string, claims jwt.Claims) (*jwt.Token, error) {
+	if claims == nil {
+		claims = jwt.MapClaims{}
+	}
+
+	return jwt.ParseWithClaims(ts, claims, kr.Keyfunc)
+}
+
+// parsePrivateKey parses a PEM encoded PKCS #8, PKCS #1 or SEC 1 private key.
+func parsePrivateKey(b []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, jwt.ErrKeyMustBePEMEncoded
+	}
+
+	if k, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		if pk, ok := k.(crypto.Signer); ok {
+			return pk, nil
+		}
+	}
+
+	if k, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return k, nil
+	}
+
+	if k, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return k, nil
+	}
+
+	return nil, dlib.NewError(http.StatusInternalServerError,
+		"unsupported private key type")
+}
+
+// keyMatchesMethod checks that a private key can be used with a signing
+// method.
+func keyMatchesMethod(pk crypto.Signer, m jwt.SigningMethod) bool {
+	switch v := m.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		_, ok := pk.(*rsa.PrivateKey)
+		return ok
+	case *jwt.SigningMethodECDSA:
+		ek, ok := pk.(*ecdsa.PrivateKey)
+		return ok && ek.Curve.Params().BitSize == v.CurveBits
+	case *SigningMethodEdDSA:
+		_, ok := pk.(ed25519.PrivateKey)
+		return ok
+	default:
+		return false
+	}
+}
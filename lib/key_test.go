@@ -0,0 +1,195 @@
+package lib
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+func TestKeyConfigToKey(t *testing.T) {
+	f, err := ioutil.TempFile("", "dauth_key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString("file-secret\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	f.Close()
+	cases := []struct {
+		cfg    KeyConfig
+		secret string
+		fail   bool
+	}{
+		{cfg: KeyConfig{ID: "a", Secret: "inline"}, secret: "inline"},
+		{cfg: KeyConfig{ID: "b", File: f.Name()}, secret: "file-secret"},
+		{cfg: KeyConfig{ID: "c"}, fail: true},
+		{cfg: KeyConfig{Secret: "test"}, fail: true},
+		{cfg: KeyConfig{ID: "d", Secret: "test", Retired: "bad"}, fail: true},
+	}
+
+	for _, c := range cases {
+		k, err := c.cfg.ToKey()
+		if c.fail {
+			if err == nil {
+				t.Errorf("Expected error for key config: %v", c.cfg)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		if string(k.Secret) != c.secret {
+			t.Errorf("Secret expected: %v, got: %v", c.secret, string(k.Secret))
+		}
+	}
+}
+
+func TestNewKeyRing(t *testing.T) {
+	rt := time.Now().Add(-time.Hour)
+	if _, err := NewKeyRing("missing", 0,
+		&Key{ID: "a", Method: jwt.SigningMethodHS256, Secret: []byte("a")},
+	); err == nil {
+		t.Error("Expected error for missing signing key")
+	}
+
+	if _, err := NewKeyRing("a", 0,
+		&Key{ID: "a", Method: jwt.SigningMethodHS256, Secret: []byte("a"),
+			Retired: &rt},
+	); err == nil {
+		t.Error("Expected error for retired signing key")
+	}
+}
+
+func TestKeyRingRotation(t *testing.T) {
+	old, err := NewKeyRing("old", time.Hour,
+		&Key{ID: "old", Method: jwt.SigningMethodHS256, Secret: []byte("old")},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts, err := old.Sign(jwt.MapClaims{"user": "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rt := time.Now().Add(-time.Minute)
+	kr, err := NewKeyRing("new", time.Hour,
+		&Key{ID: "new", Method: jwt.SigningMethodHS256, Secret: []byte("new")},
+		&Key{ID: "old", Method: jwt.SigningMethodHS256, Secret: []byte("old"),
+			Retired: &rt},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := kr.Parse(ts, nil); err != nil {
+		t.Errorf("Token signed with retired key in grace period: %v", err)
+	}
+
+	nts, err := kr.Sign(jwt.MapClaims{"user": "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tok, err := kr.Parse(nts, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tok.Header["kid"] != "new" {
+		t.Errorf("Key id expected: new, got: %v", tok.Header["kid"])
+	}
+
+	kr.Grace = 0
+	if _, err := kr.Parse(ts, nil); err == nil {
+		t.Error("Expected error for token signed with expired key")
+	}
+
+	if _, err := old.Parse(nts, nil); err == nil {
+		t.Error("Expected error for token signed with unknown key")
+	}
+}
+
+func testPEMKey(t *testing.T, alg string) string {
+	var pk interface{}
+	var err error
+	switch alg {
+	case "RS256":
+		pk, err = rsa.GenerateKey(rand.Reader, 2048)
+	case "ES256":
+		pk, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "EdDSA":
+		_, pk, err = ed25519.GenerateKey(rand.Reader)
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := x509.MarshalPKCS8PrivateKey(pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: b}))
+}
+
+func TestKeyRingAsymmetric(t *testing.T) {
+	for _, alg := range []string{"RS256", "ES256", "EdDSA"} {
+		kr, err := NewKeyRingFromConfig([]KeyConfig{
+			{ID: alg, Alg: alg, Secret: testPEMKey(t, alg)},
+		}, alg, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ts, err := kr.Sign(jwt.MapClaims{"user": "test"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tok, err := kr.Parse(ts, nil)
+		if err != nil {
+			t.Errorf("%v: %v", alg, err)
+			continue
+		}
+
+		if tok.Method.Alg() != alg {
+			t.Errorf("Alg expected: %v, got: %v", alg, tok.Method.Alg())
+		}
+	}
+
+	if _, err := (&KeyConfig{
+		ID:     "bad",
+		Alg:    "ES256",
+		Secret: testPEMKey(t, "EdDSA"),
+	}).ToKey(); err == nil {
+		t.Error("Expected error for key not matching algorithm")
+	}
+
+	if _, err := (&KeyConfig{
+		ID:     "bad",
+		Alg:    "RS256",
+		Secret: "not a pem key",
+	}).ToKey(); err == nil {
+		t.Error("Expected error for key not PEM encoded")
+	}
+}
@@ -0,0 +1,279 @@
+package lib
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/dhaifley/dlib"
+)
+
+// LoginFailure values count the failed logins for a key, such as a user name
+// or a client address, and record when the last one happened.
+type LoginFailure struct {
+	Key   string
+	Count int
+	Last  *time.Time
+}
+
+// LoginFailureRow values are used to scan login failure database rows.
+type LoginFailureRow struct {
+	Key   string
+	Count int
+	Last  dlib.NullTime
+}
+
+// ToLoginFailure converts a LoginFailureRow value into a LoginFailure.
+func (r *LoginFailureRow) ToLoginFailure() LoginFailure {
+	v := LoginFailure{Key: r.Key, Count: r.Count}
+	if r.Last.Valid {
+		v.Last = &r.Last.Time
+	}
+
+	return v
+}
+
+// LoginFailureAccessor is an interface describing values capable of
+// storing login failure counters.
+type LoginFailureAccessor interface {
+	GetLoginFailure(ctx context.Context, key string) <-chan dlib.Result
+	AddLoginFailure(ctx context.Context,
+		key string, window time.Duration) <-chan dlib.Result
+	RemoveLoginFailure(ctx context.Context, key string) <-chan dlib.Result
+	DeleteLoginFailures(ctx context.Context, key string) <-chan dlib.Result
+}
+
+// LoginFailureAccess values are used to access login failure records in the
+// database.
+type LoginFailureAccess struct {
+	DBS dlib.SQLExecutor
+}
+
+// NewLoginFailureAccessor creates a new LoginFailureAccess value for
+// database access.
+func NewLoginFailureAccessor(dbs dlib.SQLExecutor) LoginFailureAccessor {
+	lfa := LoginFailureAccess{DBS: dbs}
+	return &lfa
+}
+
+// GetLoginFailure finds the login failure value for a key in the database.
+func (lfa *LoginFailureAccess) GetLoginFailure(ctx context.Context,
+	key string) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 256)
+
+	go func() {
+		defer close(ch)
+		rows, err := traceQuery(ctx, lfa.DBS, `
+			SELECT
+				f.key,
+				f.count,
+				f.last
+			FROM get_login_failure($1) AS f`,
+			key)
+		if err != nil {
+			ch <- dlib.Result{Err: err}
+			return
+		}
+
+		defer rows.Close()
+		for rows.Next() {
+			r := LoginFailureRow{}
+			if err := rows.Scan(&r.Key, &r.Count, &r.Last); err != nil {
+				ch <- dlib.Result{Err: err}
+				continue
+			}
+
+			v := r.ToLoginFailure()
+			ch <- dlib.Result{Val: v, Num: 1}
+		}
+	}()
+
+	return ch
+}
+
+// AddLoginFailure counts a failed login for a key and returns the updated
+// login failure value. Failures older than window are forgotten.
+func (lfa *LoginFailureAccess) AddLoginFailure(ctx context.Context, key string,
+	window time.Duration) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 256)
+
+	go func() {
+		defer close(ch)
+		rows, err := traceQuery(ctx, lfa.DBS, `
+			SELECT
+				f.key,
+				f.count,
+				f.last
+			FROM add_login_failure($1, $2) AS f`,
+			key,
+			window.Seconds())
+		if err != nil {
+			ch <- dlib.Result{Err: err}
+			return
+		}
+
+		defer rows.Close()
+		for rows.Next() {
+			r := LoginFailureRow{}
+			if err := rows.Scan(&r.Key, &r.Count, &r.Last); err != nil {
+				ch <- dlib.Result{Err: err}
+				continue
+			}
+
+			v := r.ToLoginFailure()
+			ch <- dlib.Result{Val: v, Num: 1}
+		}
+	}()
+
+	return ch
+}
+
+// RemoveLoginFailure uncounts one failed login for a key.
+func (lfa *LoginFailureAccess) RemoveLoginFailure(ctx context.Context,
+	key string) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 256)
+
+	go func() {
+		defer close(ch)
+		rows, err := traceQuery(ctx, lfa.DBS,
+			"SELECT remove_login_failure($1) AS num",
+			key)
+		if err != nil {
+			ch <- dlib.Result{Err: err}
+			return
+		}
+
+		defer rows.Close()
+		n := 0
+		for rows.Next() {
+			r := struct{ Num int }{Num: 0}
+			if err := rows.Scan(&r.Num); err != nil {
+				ch <- dlib.Result{Err: err}
+				continue
+			}
+
+			n += r.Num
+		}
+
+		ch <- dlib.Result{Num: n, Err: nil}
+	}()
+
+	return ch
+}
+
+// DeleteLoginFailures clears the login failures counted for a key.
+func (lfa *LoginFailureAccess) DeleteLoginFailures(ctx context.Context,
+	key string) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 256)
+
+	go func() {
+		defer close(ch)
+		rows, err := traceQuery(ctx, lfa.DBS,
+			"SELECT delete_login_failures($1) AS num",
+			key)
+		if err != nil {
+			ch <- dlib.Result{Err: err}
+			return
+		}
+
+		defer rows.Close()
+		n := 0
+		for rows.Next() {
+			r := struct{ Num int }{Num: 0}
+			if err := rows.Scan(&r.Num); err != nil {
+				ch <- dlib.Result{Err: err}
+				continue
+			}
+
+			n += r.Num
+		}
+
+		ch <- dlib.Result{Num: n, Err: nil}
+	}()
+
+	return ch
+}
+
+// MemLoginFailureAccess values store login failure counters in memory. They
+// are only suitable when a single server handles logins.
+type MemLoginFailureAccess struct {
+	mu       sync.Mutex
+	failures map[string]LoginFailure
+}
+
+// NewMemLoginFailureAccessor creates a new in memory login failure store.
+func NewMemLoginFailureAccessor() LoginFailureAccessor {
+	mfa := MemLoginFailureAccess{failures: map[string]LoginFailure{}}
+	return &mfa
+}
+
+// GetLoginFailure finds the login failure value for a key.
+func (mfa *MemLoginFailureAccess) GetLoginFailure(ctx context.Context,
+	key string) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 1)
+	mfa.mu.Lock()
+	defer mfa.mu.Unlock()
+	if v, ok := mfa.failures[key]; ok {
+		ch <- dlib.Result{Val: v, Num: 1}
+	}
+
+	close(ch)
+	return ch
+}
+
+// AddLoginFailure counts a failed login for a key and returns the updated
+// login failure value. Failures older than window are forgotten.
+func (mfa *MemLoginFailureAccess) AddLoginFailure(ctx context.Context,
+	key string,
+	window time.Duration) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 1)
+	mfa.mu.Lock()
+	defer mfa.mu.Unlock()
+	now := time.Now()
+	v, ok := mfa.failures[key]
+	if !ok || v.Last == nil || now.Sub(*v.Last) > window {
+		v = LoginFailure{Key: key}
+	}
+
+	v.Count++
+	v.Last = &now
+	mfa.failures[key] = v
+	ch <- dlib.Result{Val: v, Num: 1}
+	close(ch)
+	return ch
+}
+
+// RemoveLoginFailure uncounts one failed login for a key.
+func (mfa *MemLoginFailureAccess) RemoveLoginFailure(ctx context.Context,
+	key string) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 1)
+	mfa.mu.Lock()
+	defer mfa.mu.Unlock()
+	n := 0
+	if v, ok := mfa.failures[key]; ok && v.Count > 0 {
+		v.Count--
+		mfa.failures[key] = v
+		n = 1
+	}
+
+	ch <- dlib.Result{Num: n}
+	close(ch)
+	return ch
+}
+
+// DeleteLoginFailures clears the login failures counted for a key.
+func (mfa *MemLoginFailureAccess) DeleteLoginFailures(ctx context.Context,
+	key string) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 1)
+	mfa.mu.Lock()
+	defer mfa.mu.Unlock()
+	n := 0
+	if _, ok := mfa.failures[key]; ok {
+		delete(mfa.failures, key)
+		n = 1
+	}
+
+	ch <- dlib.Result{Num: n}
+	close(ch)
+	return ch
+}
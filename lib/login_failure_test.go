@@ -0,0 +1,194 @@
+package lib
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/dhaifley/dlib"
+)
+
+type MockLoginFailureRows struct {
+	row int
+}
+
+func (m *MockLoginFailureRows) Close() error {
+	return nil
+}
+
+func (m *MockLoginFailureRows) Next() bool {
+	m.row++
+	if m.row > 1 {
+		return false
+	}
+
+	return true
+}
+
+func (m *MockLoginFailureRows) Scan(dest ...interface{}) error {
+	for _, d := range dest {
+		switch v := d.(type) {
+		case *int:
+			*v = 1
+		case *string:
+			*v = "test"
+		case *dlib.NullTime:
+			dt := time.Date(1983, 2, 2, 0, 0, 0, 0, time.Local)
+			*v = dlib.NullTime{Time: dt, Valid: true}
+		default:
+			return dlib.NewError(500, "Invalid type")
+		}
+	}
+
+	return nil
+}
+
+type MockLoginFailureDBSession struct{}
+
+func (m *MockLoginFailureDBSession) Close() error {
+	return nil
+}
+
+func (m *MockLoginFailureDBSession) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return nil, nil
+}
+
+func (m *MockLoginFailureDBSession) Query(query string, args ...interface{}) (dlib.SQLRows, error) {
+	mr := MockLoginFailureRows{}
+	return &mr, nil
+}
+
+func (m *MockLoginFailureDBSession) Ping() error {
+	return nil
+}
+
+func (m *MockLoginFailureDBSession) Stats() sql.DBStats {
+	return sql.DBStats{OpenConnections: 0}
+}
+
+func TestLoginFailureAccessGetLoginFailure(t *testing.T) {
+	ctx := context.Background()
+	ma := NewLoginFailureAccessor(&MockLoginFailureDBSession{})
+	var a LoginFailure
+	for r := range ma.GetLoginFailure(ctx, "test") {
+		if r.Err != nil {
+			t.Error(r.Err)
+		}
+
+		if v, ok := r.Val.(LoginFailure); ok {
+			a = v
+		}
+	}
+
+	if a.Key != "test" || a.Count != 1 || a.Last == nil {
+		t.Errorf("Login failure expected: test, got: %v", a)
+	}
+}
+
+func TestLoginFailureAccessAddLoginFailure(t *testing.T) {
+	ctx := context.Background()
+	ma := NewLoginFailureAccessor(&MockLoginFailureDBSession{})
+	var a LoginFailure
+	for r := range ma.AddLoginFailure(ctx, "test", time.Minute) {
+		if r.Err != nil {
+			t.Error(r.Err)
+		}
+
+		if v, ok := r.Val.(LoginFailure); ok {
+			a = v
+		}
+	}
+
+	if a.Count != 1 {
+		t.Errorf("Count expected: 1, got: %v", a.Count)
+	}
+}
+
+func TestLoginFailureAccessRemoveLoginFailure(t *testing.T) {
+	ctx := context.Background()
+	ma := NewLoginFailureAccessor(&MockLoginFailureDBSession{})
+	var n int
+	for r := range ma.RemoveLoginFailure(ctx, "test") {
+		if r.Err != nil {
+			t.Error(r.Err)
+		}
+
+		n = r.Num
+	}
+
+	if n != 1 {
+		t.Errorf("Remove count expected: 1, got: %v", n)
+	}
+}
+
+func TestLoginFailureAccessDeleteLoginFailures(t *testing.T) {
+	ctx := context.Background()
+	ma := NewLoginFailureAccessor(&MockLoginFailureDBSession{})
+	var n int
+	for r := range ma.DeleteLoginFailures(ctx, "test") {
+		if r.Err != nil {
+			t.Error(r.Err)
+		}
+
+		n = r.Num
+	}
+
+	if n != 1 {
+		t.Errorf("Delete count expected: 1, got: %v", n)
+	}
+}
+
+func TestMemLoginFailureAccess(t *testing.T) {
+	ctx := context.Background()
+	ma := NewMemLoginFailureAccessor()
+	for i := 0; i < 3; i++ {
+		for r := range ma.AddLoginFailure(ctx, "test", time.Minute) {
+			if r.Err != nil {
+				t.Error(r.Err)
+			}
+		}
+	}
+
+	var a LoginFailure
+	for r := range ma.GetLoginFailure(ctx, "test") {
+		a = r.Val.(LoginFailure)
+	}
+
+	if a.Count != 3 {
+		t.Errorf("Count expected: 3, got: %v", a.Count)
+	}
+
+	for r := range ma.AddLoginFailure(ctx, "test", 0) {
+		a = r.Val.(LoginFailure)
+	}
+
+	if a.Count != 1 {
+		t.Errorf("Count after window expected: 1, got: %v", a.Count)
+	}
+
+	for r := range ma.RemoveLoginFailure(ctx, "test") {
+		if r.Num != 1 {
+			t.Errorf("Remove count expected: 1, got: %v", r.Num)
+		}
+	}
+
+	for r := range ma.RemoveLoginFailure(ctx, "test") {
+		if r.Num != 0 {
+			t.Errorf("Remove count expected: 0, got: %v", r.Num)
+		}
+	}
+
+	n := 0
+	for r := range ma.DeleteLoginFailures(ctx, "test") {
+		n = r.Num
+	}
+
+	if n != 1 {
+		t.Errorf("Delete count expected: 1, got: %v", n)
+	}
+
+	for r := range ma.GetLoginFailure(ctx, "test") {
+		t.Errorf("Expected no login failure, got: %v", r.Val)
+	}
+}
@@ -0,0 +1,344 @@
+package lib
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// MetricsContentType is the content type of the Prometheus text format
+// written by a MetricRegistry.
+const MetricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Types of metric families.
+const (
+	MetricCounter   = "counter"
+	MetricGauge     = "gauge"
+	MetricHistogram = "histogram"
+)
+
+// DefaultLatencyBuckets are the upper bounds, in seconds, of the buckets of
+// latency histograms.
+var DefaultLatencyBuckets = []float64{
+	0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10,
+}
+
+// Sample values are the samples of a metric family. Suffix is appended to
+// the name of the family, and Labels holds label names and values in pairs.
+type Sample struct {
+	Suffix string
+	Labels []string
+	Value  float64
+}
+
+// MetricFamily values hold the samples of a metric at the time they were
+// collected.
+type MetricFamily struct {
+	Name    string
+	Help    string
+	Type    string
+	Samples []Sample
+}
+
+// NewMetricFamily creates a new MetricFamily value with no samples.
+func NewMetricFamily(name, help, typ string) *MetricFamily {
+	return &MetricFamily{Name: name, Help: help, Type: typ}
+}
+
+// Add adds a sample to a metric family, with label names and values in
+// pairs.
+func (f *MetricFamily) Add(v float64, labels ...string) *MetricFamily {
+	f.Samples = append(f.Samples, Sample{Labels: labels, Value: v})
+	return f
+}
+
+// Collector is an interface describing values which provide metrics.
+type Collector interface {
+	Collect() []MetricFamily
+}
+
+// CollectorFunc values are functions which provide metrics.
+type CollectorFunc func() []MetricFamily
+
+// Collect calls the function.
+func (cf CollectorFunc) Collect() []MetricFamily {
+	return cf()
+}
+
+// MetricRegistry values write the metrics of their collectors in the
+// Prometheus text format.
+type MetricRegistry struct {
+	mu sync.Mutex
+	cs []Collector
+}
+
+// NewMetricRegistry creates a new MetricRegistry with no collectors.
+func NewMetricRegistry() *MetricRegistry {
+	return &MetricRegistry{}
+}
+
+// Register adds collectors to the registry.
+func (r *MetricRegistry) Register(cs ...Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cs = append(r.cs, cs...)
+}
+
+// WriteText writes the metrics of every collector, ordered by name.
+func (r *MetricRegistry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	cs := append([]Collector{}, r.cs...)
+	r.mu.Unlock()
+	var fs []MetricFamily
+	for _, c := range cs {
+		fs = append(fs, c.Collect()...)
+	}
+
+	sort.SliceStable(fs, func(i, j int) bool {
+		return fs[i].Name < fs[j].Name
+	})
+
+	bw := bufio.NewWriter(w)
+	for _, f := range fs {
+		bw.WriteString("# HELP " + f.Name + " " + escapeHelp(f.Help) + "\n")
+		bw.WriteString("# TYPE " + f.Name + " " + f.Type + "\n")
+		for _, s := range f.Samples {
+			bw.WriteString(f.Name + s.Suffix)
+			if len(s.Labels) > 1 {
+				bw.WriteString("{")
+				for i := 0; i+1 < len(s.Labels); i += 2 {
+					if i > 0 {
+						bw.WriteString(",")
+					}
+
+					bw.WriteString(s.Labels[i] + `="` +
+						escapeLabel(s.Labels[i+1]) + `"`)
+				}
+
+				bw.WriteString("}")
+			}
+
+			bw.WriteString(" " + formatMetric(s.Value) + "\n")
+		}
+	}
+
+	return bw.Flush()
+}
+
+// CounterVec values count events by label values.
+type CounterVec struct {
+	name   string
+	help   string
+	labels []string
+	mu     sync.Mutex
+	vals   map[string]*counterVal
+}
+
+type counterVal struct {
+	values []string
+	v      float64
+}
+
+// NewCounterVec creates a new CounterVec with the provided label names.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{
+		name:   name,
+		help:   help,
+		labels: labels,
+		vals:   map[string]*counterVal{},
+	}
+}
+
+// Add adds to the counter of the provided label values.
+func (c *CounterVec) Add(v float64, values ...string) {
+	values = labelValues(c.labels, values)
+	k := strings.Join(values, "\xff")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cv, ok := c.vals[k]
+	if !ok {
+		cv = &counterVal{values: values}
+		c.vals[k] = cv
+	}
+
+	cv.v += v
+}
+
+// Inc adds one to the counter of the provided label values.
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Value returns the counter of the provided label values.
+func (c *CounterVec) Value(values ...string) float64 {
+	k := strings.Join(labelValues(c.labels, values), "\xff")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cv, ok := c.vals[k]; ok {
+		return cv.v
+	}
+
+	return 0
+}
+
+// Collect returns the counters, ordered by label values.
+func (c *CounterVec) Collect() []MetricFamily {
+	f := NewMetricFamily(c.name, c.help, MetricCounter)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	keys := make([]string, 0, len(c.vals))
+	for k := range c.vals {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	for _, k := range keys {
+		cv := c.vals[k]
+		f.Add(cv.v, labelPairs(c.labels, cv.values)...)
+	}
+
+	return []MetricFamily{*f}
+}
+
+// HistogramVec values count observations in buckets by label values.
+type HistogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+	mu      sync.Mutex
+	vals    map[string]*histogramVal
+}
+
+type histogramVal struct {
+	values []string
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// NewHistogramVec creates a new HistogramVec with the provided bucket
+// upper bounds, in increasing order, and label names.
+func NewHistogramVec(name, help string, buckets []float64,
+	labels ...string) *HistogramVec {
+	return &HistogramVec{
+		name:    name,
+		help:    help,
+		labels:  labels,
+		buckets: buckets,
+		vals:    map[string]*histogramVal{},
+	}
+}
+
+// Observe adds an observation to the histogram of the provided label
+// values.
+func (h *HistogramVec) Observe(v float64, values ...string) {
+	values = labelValues(h.labels, values)
+	k := strings.Join(values, "\xff")
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hv, ok := h.vals[k]
+	if !ok {
+		hv = &histogramVal{values: values,
+			counts: make([]uint64, len(h.buckets))}
+		h.vals[k] = hv
+	}
+
+	for i, b := range h.buckets {
+		if v <= b {
+			hv.counts[i]++
+		}
+	}
+
+	hv.count++
+	hv.sum += v
+}
+
+// Count returns the number of observations of the provided label values.
+func (h *HistogramVec) Count(values ...string) uint64 {
+	k := strings.Join(labelValues(h.labels, values), "\xff")
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if hv, ok := h.vals[k]; ok {
+		return hv.count
+	}
+
+	return 0
+}
+
+// Collect returns the cumulative buckets, sum and count of each histogram,
+// ordered by label values.
+func (h *HistogramVec) Collect() []MetricFamily {
+	f := NewMetricFamily(h.name, h.help, MetricHistogram)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	keys := make([]string, 0, len(h.vals))
+	for k := range h.vals {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	for _, k := range keys {
+		hv := h.vals[k]
+		lp := labelPairs(h.labels, hv.values)
+		for i, b := range h.buckets {
+			f.Samples = append(f.Samples, Sample{Suffix: "_bucket",
+				Labels: append(lp, "le", formatMetric(b)),
+				Value:  float64(hv.counts[i])})
+		}
+
+		f.Samples = append(f.Samples,
+			Sample{Suffix: "_bucket", Labels: append(lp, "le", "+Inf"),
+				Value: float64(hv.count)},
+			Sample{Suffix: "_sum", Labels: lp, Value: hv.sum},
+			Sample{Suffix: "_count", Labels: lp, Value: float64(hv.count)})
+	}
+
+	return []MetricFamily{*f}
+}
+
+// labelValues returns one value for each label name.
+func labelValues(labels, values []string) []string {
+	lv := make([]string, len(labels))
+	copy(lv, values)
+	return lv
+}
+
+// labelPairs returns label names and values in pairs. The slice returned
+// has no spare capacity, so that appending to it copies it.
+func labelPairs(labels, values []string) []string {
+	lp := make([]string, 0, 2*len(labels))
+	for i, l := range labels {
+		lp = append(lp, l, values[i])
+	}
+
+	return lp[:len(lp):len(lp)]
+}
+
+// formatMetric formats a sample value.
+func formatMetric(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// escapeLabel escapes a label value.
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+// escapeHelp escapes the help text of a metric family.
+func escapeHelp(v string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(v)
+}
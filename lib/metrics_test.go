@@ -0,0 +1,59 @@
+package lib
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestMetricRegistry(t *testing.T) {
+	c := NewCounterVec("test_requests_total", "Requests.", "rpc", "code")
+	c.Inc("Login", "200")
+	c.Inc("Login", "200")
+	c.Add(3, "Auth", "401")
+	if v := c.Value("Login", "200"); v != 2 {
+		t.Errorf("Counter expected: 2, got: %v", v)
+	}
+
+	h := NewHistogramVec("test_duration_seconds", "Latency.",
+		[]float64{0.1, 1}, "rpc")
+	h.Observe(0.05, "Login")
+	h.Observe(0.5, "Login")
+	h.Observe(2, "Login")
+	if n := h.Count("Login"); n != 3 {
+		t.Errorf("Count expected: 3, got: %v", n)
+	}
+
+	r := NewMetricRegistry()
+	r.Register(c, h, CollectorFunc(func() []MetricFamily {
+		f := NewMetricFamily("test_open", "Open \"conns\"\nnow.", MetricGauge)
+		f.Add(4)
+		f.Add(math.Inf(1), "pool", "a\"b\\c\nd")
+		return []MetricFamily{*f}
+	}))
+
+	var b bytes.Buffer
+	if err := r.WriteText(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	exp := `# HELP test_duration_seconds Latency.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{rpc="Login",le="0.1"} 1
+test_duration_seconds_bucket{rpc="Login",le="1"} 2
+test_duration_seconds_bucket{rpc="Login",le="+Inf"} 3
+test_duration_seconds_sum{rpc="Login"} 2.55
+test_duration_seconds_count{rpc="Login"} 3
+# HELP test_open Open "conns"\nnow.
+# TYPE test_open gauge
+test_open 4
+test_open{pool="a\"b\\c\nd"} +Inf
+# HELP test_requests_total Requests.
+# TYPE test_requests_total counter
+test_requests_total{rpc="Auth",code="401"} 3
+test_requests_total{rpc="Login",code="200"} 2
+`
+	if b.String() != exp {
+		t.Errorf("Metrics expected:\n%v\ngot:\n%v", exp, b.String())
+	}
+}
@@ -0,0 +1,194 @@
+package lib
+
+import (
+	"context"
+	"time"
+
+	"github.com/dhaifley/dlib"
+)
+
+// UserMFA values hold the two-factor authentication settings of a user.
+// Enabled is set once the user has confirmed the secret with a valid code.
+// Required forces two-factor authentication for the user even when it has
+// not been enabled. LastStep is the last TOTP time step accepted, so codes
+// can not be replayed.
+type UserMFA struct {
+	UserID   int64
+	Secret   string
+	Enabled  bool
+	Required bool
+	LastStep int64
+	Created  *time.Time
+}
+
+// UserMFARow values are used to scan user MFA database rows.
+type UserMFARow struct {
+	UserID   int64
+	Secret   string
+	Enabled  bool
+	Required bool
+	LastStep int64
+	Created  dlib.NullTime
+}
+
+// ToUserMFA converts a UserMFARow value into a UserMFA.
+func (r *UserMFARow) ToUserMFA() UserMFA {
+	v := UserMFA{
+		UserID:   r.UserID,
+		Secret:   r.Secret,
+		Enabled:  r.Enabled,
+		Required: r.Required,
+		LastStep: r.LastStep,
+	}
+
+	if r.Created.Valid {
+		v.Created = &r.Created.Time
+	}
+
+	return v
+}
+
+// MFAAccess values are used to access two-factor authentication records in
+// the database.
+type MFAAccess struct {
+	DBS dlib.SQLExecutor
+}
+
+// MFAAccessor is an interface describing values capable of providing
+// access to two-factor authentication records in the database.
+type MFAAccessor interface {
+	GetUserMFA(ctx context.Context, userID int64) <-chan dlib.Result
+	SaveUserMFA(ctx context.Context, m *UserMFA) <-chan dlib.Result
+	UseTOTPStep(ctx context.Context, userID, step int64) <-chan dlib.Result
+	DeleteRecoveryCodes(ctx context.Context,
+		userID int64) <-chan dlib.Result
+	SaveRecoveryCode(ctx context.Context,
+		userID int64, code string) <-chan dlib.Result
+	UseRecoveryCode(ctx context.Context,
+		userID int64, code string) <-chan dlib.Result
+}
+
+// NewMFAAccessor creates a new MFAAccess value for database access.
+func NewMFAAccessor(dbs dlib.SQLExecutor) MFAAccessor {
+	ma := MFAAccess{DBS: dbs}
+	return &ma
+}
+
+// GetUserMFA finds the two-factor authentication settings of a user.
+func (ma *MFAAccess) GetUserMFA(ctx context.Context,
+	userID int64) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 256)
+
+	go func() {
+		defer close(ch)
+		rows, err := traceQuery(ctx, ma.DBS, `
+			SELECT
+				m.user_id,
+				m.secret,
+				m.enabled,
+				m.required,
+				m.last_step,
+				m.created
+			FROM get_user_mfa($1) AS m`,
+			userID)
+		if err != nil {
+			ch <- dlib.Result{Err: err}
+			return
+		}
+
+		defer rows.Close()
+		for rows.Next() {
+			r := UserMFARow{}
+			if err := rows.Scan(
+				&r.UserID,
+				&r.Secret,
+				&r.Enabled,
+				&r.Required,
+				&r.LastStep,
+				&r.Created,
+			); err != nil {
+				ch <- dlib.Result{Err: err}
+				continue
+			}
+
+			v := r.ToUserMFA()
+			ch <- dlib.Result{Val: v, Num: 1}
+		}
+	}()
+
+	return ch
+}
+
+// SaveUserMFA saves the two-factor authentication settings of a user.
+func (ma *MFAAccess) SaveUserMFA(ctx context.Context,
+	m *UserMFA) <-chan dlib.Result {
+	return ma.count(ctx,
+		"SELECT save_user_mfa($1, $2, $3, $4, $5, $6) AS num",
+		m.UserID,
+		m.Secret,
+		m.Enabled,
+		m.Required,
+		m.LastStep,
+		m.Created)
+}
+
+// UseTOTPStep records that a TOTP code for a time step was accepted for a
+// user. The result has Num set to 1 only if no code for the same or a later
+// time step was accepted before.
+func (ma *MFAAccess) UseTOTPStep(ctx context.Context,
+	userID, step int64) <-chan dlib.Result {
+	return ma.count(ctx,
+		"SELECT use_totp_step($1, $2) AS num", userID, step)
+}
+
+// DeleteRecoveryCodes deletes all recovery codes of a user.
+func (ma *MFAAccess) DeleteRecoveryCodes(ctx context.Context,
+	userID int64) <-chan dlib.Result {
+	return ma.count(ctx, "SELECT delete_recovery_codes($1) AS num", userID)
+}
+
+// SaveRecoveryCode saves the hash of a recovery code for a user.
+func (ma *MFAAccess) SaveRecoveryCode(ctx context.Context, userID int64,
+	code string) <-chan dlib.Result {
+	return ma.count(ctx,
+		"SELECT save_recovery_code($1, $2) AS num", userID, code)
+}
+
+// UseRecoveryCode marks the recovery code matching a hash as used. The
+// result has Num set to 1 only if an unused matching code was found.
+func (ma *MFAAccess) UseRecoveryCode(ctx context.Context, userID int64,
+	code string) <-chan dlib.Result {
+	return ma.count(ctx,
+		"SELECT use_recovery_code($1, $2) AS num", userID, code)
+}
+
+// count runs a query returning a single count column and sends the total.
+func (ma *MFAAccess) count(ctx context.Context, query string,
+	args ...interface{}) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 256)
+
+	go func() {
+		defer close(ch)
+		rows, err := traceQuery(ctx, ma.DBS, query, args...)
+		if err != nil {
+			ch <- dlib.Result{Err: err}
+			return
+		}
+
+		defer rows.Close()
+		n := 0
+		for rows.Next() {
+			r := struct{ Num int }{Num: 0}
+			if err := rows.Scan(&r.Num); err != nil {
+				ch <- dlib.Result{Err: err}
+				continue
+			}
+
+			n += r.Num
+		}
+
+		ch <- dlib.Result{Num: n, Err: nil}
+	}()
+
+	return ch
+}
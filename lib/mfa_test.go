@@ -0,0 +1,118 @@
+package lib
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/dhaifley/dlib"
+)
+
+type MockMFARows struct {
+	row int
+}
+
+func (m *MockMFARows) Close() error {
+	return nil
+}
+
+func (m *MockMFARows) Next() bool {
+	m.row++
+	if m.row > 1 {
+		return false
+	}
+
+	return true
+}
+
+func (m *MockMFARows) Scan(dest ...interface{}) error {
+	for _, d := range dest {
+		switch v := d.(type) {
+		case *int64:
+			*v = int64(1)
+		case *int:
+			*v = 1
+		case *string:
+			*v = "test"
+		case *bool:
+			*v = true
+		case *dlib.NullTime:
+			dt := time.Date(1983, 2, 2, 0, 0, 0, 0, time.Local)
+			*v = dlib.NullTime{Time: dt, Valid: true}
+		default:
+			return dlib.NewError(500, "Invalid type")
+		}
+	}
+
+	return nil
+}
+
+type MockMFADBSession struct{}
+
+func (m *MockMFADBSession) Close() error {
+	return nil
+}
+
+func (m *MockMFADBSession) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return nil, nil
+}
+
+func (m *MockMFADBSession) Query(query string, args ...interface{}) (dlib.SQLRows, error) {
+	mr := MockMFARows{}
+	return &mr, nil
+}
+
+func (m *MockMFADBSession) Ping() error {
+	return nil
+}
+
+func (m *MockMFADBSession) Stats() sql.DBStats {
+	return sql.DBStats{OpenConnections: 0}
+}
+
+func TestMFAAccessGetUserMFA(t *testing.T) {
+	ctx := context.Background()
+	ma := NewMFAAccessor(&MockMFADBSession{})
+	var a UserMFA
+	for r := range ma.GetUserMFA(ctx, 1) {
+		if r.Err != nil {
+			t.Error(r.Err)
+		}
+
+		if v, ok := r.Val.(UserMFA); ok {
+			a = v
+		}
+	}
+
+	if a.UserID != 1 || !a.Enabled || a.Created == nil {
+		t.Errorf("User MFA expected for user 1, got: %v", a)
+	}
+}
+
+func TestMFAAccessCounts(t *testing.T) {
+	ctx := context.Background()
+	ma := NewMFAAccessor(&MockMFADBSession{})
+	chs := []<-chan dlib.Result{
+		ma.SaveUserMFA(ctx, &UserMFA{UserID: 1, Secret: "test"}),
+		ma.UseTOTPStep(ctx, 1, 1),
+		ma.DeleteRecoveryCodes(ctx, 1),
+		ma.SaveRecoveryCode(ctx, 1, "test"),
+		ma.UseRecoveryCode(ctx, 1, "test"),
+	}
+
+	for i, ch := range chs {
+		n := 0
+		for r := range ch {
+			if r.Err != nil {
+				t.Error(r.Err)
+			}
+
+			n = r.Num
+		}
+
+		if n != 1 {
+			t.Errorf("Count %v expected: 1, got: %v", i, n)
+		}
+	}
+}
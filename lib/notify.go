@@ -0,0 +1,217 @@
+package lib
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// InvalidateChannel is the Postgres notification channel on which the SQL
+// save and delete functions announce changed rows.
+const InvalidateChannel = "dauth_invalidate"
+
+// Invalidation kinds. Token keys are the SHA-256 hashes of tokens returned
+// by HashToken, so that tokens are not sent to every listener. User keys are
+// user ids, and perms keys are user ids, or empty when the perms of all users
+// changed.
+const (
+	InvalidateToken = "token"
+	InvalidateUser  = "user"
+	InvalidatePerms = "perms"
+)
+
+// Default notifier settings.
+const (
+	DefaultNotifyMinReconnect = 10 * time.Second
+	DefaultNotifyMaxReconnect = time.Minute
+	DefaultNotifyPing         = 90 * time.Second
+)
+
+// Invalidation values describe rows changed in the database.
+type Invalidation struct {
+	Kind string `json:"kind"`
+	Key  string `json:"key,omitempty"`
+}
+
+// ParseInvalidation parses a notification payload of the form kind:key.
+func ParseInvalidation(payload string) (Invalidation, error) {
+	parts := strings.SplitN(payload, ":", 2)
+	inv := Invalidation{Kind: parts[0]}
+	if len(parts) == 2 {
+		inv.Key = parts[1]
+	}
+
+	switch inv.Kind {
+	case InvalidateToken, InvalidateUser, InvalidatePerms:
+		return inv, nil
+	default:
+		return inv, fmt.Errorf("invalid invalidation payload: %q", payload)
+	}
+}
+
+// String returns the notification payload of the invalidation.
+func (inv Invalidation) String() string {
+	return inv.Kind + ":" + inv.Key
+}
+
+// Notifier is an interface describing values which deliver invalidations
+// announced by other servers. States receives false when the connection
+// delivering them drops, since invalidations may then be missed, and true
+// when it is connected again.
+type Notifier interface {
+	Invalidations() <-chan Invalidation
+	States() <-chan bool
+	Close() error
+}
+
+// PQNotifier values deliver invalidations using Postgres LISTEN.
+type PQNotifier struct {
+	l      *pq.Listener
+	inv    chan Invalidation
+	states chan bool
+	done   chan struct{}
+	once   sync.Once
+}
+
+// NewPQNotifier creates a new PQNotifier listening on InvalidateChannel
+// using the provided connection string. Connection errors, and payloads
+// which can not be parsed, are passed to onError.
+func NewPQNotifier(conn string, onError func(error)) (*PQNotifier, error) {
+	n := PQNotifier{
+		inv:    make(chan Invalidation, 256),
+		states: make(chan bool, 16),
+		done:   make(chan struct{}),
+	}
+
+	if onError == nil {
+		onError = func(error) {}
+	}
+
+	n.l = pq.NewListener(conn, DefaultNotifyMinReconnect,
+		DefaultNotifyMaxReconnect,
+		func(ev pq.ListenerEventType, err error) {
+			switch ev {
+			case pq.ListenerEventConnected, pq.ListenerEventReconnected:
+				n.state(true)
+			case pq.ListenerEventDisconnected:
+				n.state(false)
+				onError(err)
+			case pq.ListenerEventConnectionAttemptFailed:
+				onError(err)
+			}
+		})
+	if err := n.l.Listen(InvalidateChannel); err != nil {
+		n.l.Close()
+		return nil, err
+	}
+
+	go n.run(onError)
+	return &n, nil
+}
+
+// Invalidations returns the channel receiving invalidations.
+func (n *PQNotifier) Invalidations() <-chan Invalidation {
+	return n.inv
+}
+
+// States returns the channel receiving connection state changes.
+func (n *PQNotifier) States() <-chan bool {
+	return n.states
+}
+
+// Close stops listening and closes the connection.
+func (n *PQNotifier) Close() error {
+	var err error
+	n.once.Do(func() {
+		close(n.done)
+		err = n.l.Close()
+	})
+
+	return err
+}
+
+// run delivers notifications until the notifier is closed, pinging the
+// connection when it has been idle, so that a dropped connection is found.
+func (n *PQNotifier) run(onError func(error)) {
+	t := time.NewTicker(DefaultNotifyPing)
+	defer t.Stop()
+	for {
+		select {
+		case <-n.done:
+			return
+		case pn := <-n.l.Notify:
+			if pn == nil {
+				continue
+			}
+
+			inv, err := ParseInvalidation(pn.Extra)
+			if err != nil {
+				onError(err)
+				continue
+			}
+
+			select {
+			case n.inv <- inv:
+			case <-n.done:
+				return
+			}
+		case <-t.C:
+			go n.l.Ping()
+		}
+	}
+}
+
+// state sends a connection state change, dropping it if the receiver is
+// not keeping up, since a later state supersedes it.
+func (n *PQNotifier) state(connected bool) {
+	select {
+	case n.states <- connected:
+	default:
+	}
+}
+
+// MemNotifier values deliver invalidations sent within the process. They
+// stand in for a PQNotifier in tests.
+type MemNotifier struct {
+	inv    chan Invalidation
+	states chan bool
+}
+
+// NewMemNotifier creates a new MemNotifier, which is connected.
+func NewMemNotifier() *MemNotifier {
+	n := MemNotifier{
+		inv:    make(chan Invalidation, 256),
+		states: make(chan bool, 16),
+	}
+
+	n.states <- true
+	return &n
+}
+
+// Notify sends an invalidation.
+func (n *MemNotifier) Notify(kind, key string) {
+	n.inv <- Invalidation{Kind: kind, Key: key}
+}
+
+// SetConnected sends a connection state change.
+func (n *MemNotifier) SetConnected(connected bool) {
+	n.states <- connected
+}
+
+// Invalidations returns the channel receiving invalidations.
+func (n *MemNotifier) Invalidations() <-chan Invalidation {
+	return n.inv
+}
+
+// States returns the channel receiving connection state changes.
+func (n *MemNotifier) States() <-chan bool {
+	return n.states
+}
+
+// Close does nothing for a MemNotifier.
+func (n *MemNotifier) Close() error {
+	return nil
+}
@@ -0,0 +1,63 @@
+package lib
+
+import "testing"
+
+func TestParseInvalidation(t *testing.T) {
+	cases := []struct {
+		payload string
+		exp     Invalidation
+		err     bool
+	}{
+		{"token:abc:def", Invalidation{InvalidateToken, "abc:def"}, false},
+		{"user:7", Invalidation{InvalidateUser, "7"}, false},
+		{"perms:", Invalidation{InvalidatePerms, ""}, false},
+		{"perms", Invalidation{InvalidatePerms, ""}, false},
+		{"role:1", Invalidation{}, true},
+		{"", Invalidation{}, true},
+	}
+
+	for _, c := range cases {
+		inv, err := ParseInvalidation(c.payload)
+		if c.err {
+			if err == nil {
+				t.Errorf("%q expected an error", c.payload)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%q unexpected error: %v", c.payload, err)
+		}
+
+		if inv != c.exp {
+			t.Errorf("%q expected: %v, got: %v", c.payload, c.exp, inv)
+		}
+	}
+
+	if s := (Invalidation{InvalidateUser, "7"}).String(); s != "user:7" {
+		t.Errorf("Payload expected: user:7, got: %v", s)
+	}
+}
+
+func TestMemNotifier(t *testing.T) {
+	n := NewMemNotifier()
+	if !<-n.States() {
+		t.Error("Expected the notifier to start connected")
+	}
+
+	n.Notify(InvalidateUser, "7")
+	if inv := <-n.Invalidations(); inv.Kind != InvalidateUser ||
+		inv.Key != "7" {
+		t.Errorf("Invalidation expected: user:7, got: %v", inv)
+	}
+
+	n.SetConnected(false)
+	if <-n.States() {
+		t.Error("Expected the notifier to be disconnected")
+	}
+
+	if err := n.Close(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,116 @@
+package lib
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/dhaifley/dlib"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// DefaultPasswordCost is the bcrypt cost used to hash passwords when no
+// cost is configured.
+const DefaultPasswordCost = 12
+
+// noPasswordHashes holds the bcrypt hashes compared by CheckNoPassword,
+// keyed by cost.
+var noPasswordHashes sync.Map
+
+// HashPassword creates a salted bcrypt hash of a password. The algorithm
+// and cost are stored as a prefix of the hash. Passwords longer than
+// MaxPasswordLength bytes are rejected.
+func HashPassword(pw string, cost int) (string, error) {
+	if cost == 0 {
+		cost = DefaultPasswordCost
+	}
+
+	if len(pw) > MaxPasswordLength {
+		return "", dlib.NewError(http.StatusBadRequest,
+			fmt.Sprintf("password must be at most %v bytes",
+				MaxPasswordLength))
+	}
+
+	h, err := bcrypt.GenerateFromPassword([]byte(pw), cost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(h), nil
+}
+
+// CheckPassword verifies a password against a stored hash. Hashes created by
+// the previous unsalted scheme are still accepted. When the password matches
+// and rehash is true, the stored hash is out of date and should be replaced
+// by one created with HashPassword.
+func CheckPassword(hash, pw string, cost int) (ok, rehash bool, err error) {
+	if cost == 0 {
+		cost = DefaultPasswordCost
+	}
+
+	if !isBcryptHash(hash) {
+		lh, err := dlib.EncryptString(pw)
+		if err != nil {
+			return false, false, err
+		}
+
+		ok := hash != "" &&
+			subtle.ConstantTimeCompare([]byte(lh), []byte(hash)) == 1
+		return ok, ok, nil
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(hash), []byte(pw))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return false, false, nil
+	} else if err != nil {
+		return false, false, err
+	}
+
+	hc, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return false, false, err
+	}
+
+	return true, hc != cost, nil
+}
+
+// CheckNoPassword spends the time of a password check without a stored
+// hash. It is used when a login names an unknown user, so that unknown users
+// take as long to reject as wrong passwords.
+func CheckNoPassword(pw string, cost int) {
+	if cost == 0 {
+		cost = DefaultPasswordCost
+	}
+
+	h, err := noPasswordHash(cost)
+	if err != nil {
+		return
+	}
+
+	bcrypt.CompareHashAndPassword(h, []byte(pw))
+}
+
+// noPasswordHash returns the bcrypt hash compared by CheckNoPassword for a
+// cost, creating it on first use.
+func noPasswordHash(cost int) ([]byte, error) {
+	if h, ok := noPasswordHashes.Load(cost); ok {
+		return h.([]byte), nil
+	}
+
+	h, err := bcrypt.GenerateFromPassword([]byte("no password"), cost)
+	if err != nil {
+		return nil, err
+	}
+
+	noPasswordHashes.Store(cost, h)
+	return h, nil
+}
+
+// isBcryptHash returns whether a stored hash has a bcrypt prefix.
+func isBcryptHash(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") ||
+		strings.HasPrefix(hash, "$2b$") ||
+		strings.HasPrefix(hash, "$2y$")
+}
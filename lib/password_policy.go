@@ -0,0 +1,142 @@
+package lib
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dhaifley/dlib"
+)
+
+// Default password policy settings.
+const (
+	DefaultPasswordMinLength = 8
+	DefaultPasswordHistory   = 5
+)
+
+// MaxPasswordLength is the longest password accepted, in bytes, since
+// bcrypt ignores anything after it.
+const MaxPasswordLength = 72
+
+// PasswordPolicy values describe the passwords users may choose. Passwords
+// must have at least MinLength characters, must not be in the breached
+// password list and must not match any of the previous hashes checked.
+// History is the number of previous hashes kept for each user.
+type PasswordPolicy struct {
+	MinLength int
+	History   int
+	breached  map[string]struct{}
+}
+
+// NewPasswordPolicy creates a new PasswordPolicy value.
+func NewPasswordPolicy(minLength, history int) *PasswordPolicy {
+	pp := PasswordPolicy{
+		MinLength: minLength,
+		History:   history,
+		breached:  map[string]struct{}{},
+	}
+
+	return &pp
+}
+
+// LoadBreached reads a list of breached passwords from a file, one per
+// line. Lines of 40 hexadecimal characters, optionally followed by a colon
+// and a count as in the Pwned Passwords downloads, are SHA-1 hashes of
+// passwords. Other lines are passwords. Blank lines and lines starting with
+// # are skipped. It returns the number of entries read.
+func (pp *PasswordPolicy) LoadBreached(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+
+	defer f.Close()
+	if pp.breached == nil {
+		pp.breached = map[string]struct{}{}
+	}
+
+	n := 0
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		h := line
+		if i := strings.IndexByte(line, ':'); i == 40 {
+			h = line[:i]
+		}
+
+		if !isSHA1Hex(h) {
+			h = passwordSHA1(line)
+		}
+
+		pp.breached[strings.ToUpper(h)] = struct{}{}
+		n++
+	}
+
+	return n, sc.Err()
+}
+
+// Breached returns whether a password is in the breached password list.
+func (pp *PasswordPolicy) Breached(pw string) bool {
+	_, ok := pp.breached[passwordSHA1(pw)]
+	return ok
+}
+
+// Check returns an error describing why a password may not be used, or nil
+// if it may. Previous are the hashes of passwords it must not match.
+func (pp *PasswordPolicy) Check(pw string, previous []string) error {
+	if utf8.RuneCountInString(pw) < pp.MinLength {
+		return dlib.NewError(http.StatusBadRequest,
+			fmt.Sprintf("password must be at least %v characters",
+				pp.MinLength))
+	}
+
+	if len(pw) > MaxPasswordLength {
+		return dlib.NewError(http.StatusBadRequest,
+			fmt.Sprintf("password must be at most %v bytes",
+				MaxPasswordLength))
+	}
+
+	if pp.Breached(pw) {
+		return dlib.NewError(http.StatusBadRequest,
+			"password has appeared in a data breach")
+	}
+
+	for _, h := range previous {
+		ok, _, err := CheckPassword(h, pw, 0)
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			return dlib.NewError(http.StatusBadRequest,
+				"password was used recently")
+		}
+	}
+
+	return nil
+}
+
+// passwordSHA1 returns the upper case hexadecimal SHA-1 hash of a password.
+func passwordSHA1(pw string) string {
+	h := sha1.Sum([]byte(pw))
+	return strings.ToUpper(hex.EncodeToString(h[:]))
+}
+
+// isSHA1Hex returns whether a string is a hexadecimal SHA-1 hash.
+func isSHA1Hex(v string) bool {
+	if len(v) != 40 {
+		return false
+	}
+
+	_, err := hex.DecodeString(v)
+	return err == nil
+}
@@ -0,0 +1,79 @@
+package lib
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPasswordPolicyLoadBreached(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dauth")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "breached.txt")
+	data := "# test list\n\npassword1\n" +
+		strings.ToLower(passwordSHA1("letmein99")) + "\n" +
+		passwordSHA1("qwerty123") + ":42\n"
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	pp := NewPasswordPolicy(DefaultPasswordMinLength, DefaultPasswordHistory)
+	n, err := pp.LoadBreached(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 3 {
+		t.Errorf("Entries expected: 3, got: %v", n)
+	}
+
+	for _, pw := range []string{"password1", "letmein99", "qwerty123"} {
+		if !pp.Breached(pw) {
+			t.Errorf("Expected %q to be breached", pw)
+		}
+	}
+
+	if pp.Breached("correct horse") {
+		t.Error("Expected an unlisted password not to be breached")
+	}
+
+	if _, err := pp.LoadBreached(filepath.Join(dir, "missing")); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
+
+func TestPasswordPolicyCheck(t *testing.T) {
+	h, err := HashPassword("old password", bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pp := NewPasswordPolicy(8, 1)
+	pp.breached[passwordSHA1("password1")] = struct{}{}
+	cases := []struct {
+		pw string
+		ok bool
+	}{
+		{pw: "correct horse", ok: true},
+		{pw: "ééééééé", ok: false},
+		{pw: "éééééééé", ok: true},
+		{pw: strings.Repeat("a", MaxPasswordLength+1), ok: false},
+		{pw: "password1", ok: false},
+		{pw: "old password", ok: false},
+	}
+
+	for _, c := range cases {
+		err := pp.Check(c.pw, []string{h})
+		if (err == nil) != c.ok {
+			t.Errorf("Check(%q) expected ok: %v, got: %v", c.pw, c.ok, err)
+		}
+	}
+}
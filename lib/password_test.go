@@ -0,0 +1,76 @@
+package lib
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/dhaifley/dlib"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHashPassword(t *testing.T) {
+	a, err := HashPassword("test", bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := HashPassword("test", bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a == b || !isBcryptHash(a) {
+		t.Errorf("Expected distinct salted hashes, got: %v, %v", a, b)
+	}
+
+	_, err = HashPassword(strings.Repeat("x", MaxPasswordLength+1),
+		bcrypt.MinCost)
+	if e, ok := err.(*dlib.Error); !ok || e.Code != http.StatusBadRequest {
+		t.Errorf("Error expected: %v, got: %v", http.StatusBadRequest, err)
+	}
+}
+
+func TestCheckPassword(t *testing.T) {
+	h, err := HashPassword("test", bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		hash   string
+		pw     string
+		cost   int
+		ok     bool
+		rehash bool
+	}{
+		{hash: h, pw: "test", cost: bcrypt.MinCost, ok: true, rehash: false},
+		{hash: h, pw: "test", cost: bcrypt.MinCost + 1, ok: true, rehash: true},
+		{hash: h, pw: "wrong", cost: bcrypt.MinCost, ok: false, rehash: false},
+		{hash: "", pw: "", cost: bcrypt.MinCost, ok: false, rehash: false},
+	}
+
+	for _, c := range cases {
+		ok, rehash, err := CheckPassword(c.hash, c.pw, c.cost)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ok != c.ok || rehash != c.rehash {
+			t.Errorf("Expected ok: %v, rehash: %v, got: %v, %v",
+				c.ok, c.rehash, ok, rehash)
+		}
+	}
+}
+
+func TestCheckNoPassword(t *testing.T) {
+	CheckNoPassword(strings.Repeat("x", 100), bcrypt.MinCost)
+	h, err := noPasswordHash(bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c, err := bcrypt.Cost(h); err != nil || c != bcrypt.MinCost {
+		t.Errorf("Cost expected: %v, got: %v, %v", bcrypt.MinCost, c, err)
+	}
+}
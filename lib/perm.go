@@ -1,6 +1,7 @@
 package lib
 
 import (
+	"context"
 	"github.com/dhaifley/dlib"
 	"github.com/dhaifley/dlib/dauth"
 )
@@ -13,12 +14,12 @@ type PermAccess struct {
 // PermAccessor is an interface describing values capable of providing
 // access to perm records in the database.
 type PermAccessor interface {
-	GetPerms(opt *dauth.PermFind) <-chan dlib.Result
-	GetPermByID(id int64) <-chan dlib.Result
-	DeletePerms(opt *dauth.PermFind) <-chan dlib.Result
-	DeletePermByID(id int64) <-chan dlib.Result
-	SavePerm(t *dauth.Perm) <-chan dlib.Result
-	SavePerms(t []dauth.Perm) <-chan dlib.Result
+	GetPerms(ctx context.Context, opt *dauth.PermFind) <-chan dlib.Result
+	GetPermByID(ctx context.Context, id int64) <-chan dlib.Result
+	DeletePerms(ctx context.Context, opt *dauth.PermFind) <-chan dlib.Result
+	DeletePermByID(ctx context.Context, id int64) <-chan dlib.Result
+	SavePerm(ctx context.Context, t *dauth.Perm) <-chan dlib.Result
+	SavePerms(ctx context.Context, t []dauth.Perm) <-chan dlib.Result
 }
 
 // NewPermAccessor creates a new PermAccess instance and
@@ -29,12 +30,13 @@ func NewPermAccessor(dbs dlib.SQLExecutor) PermAccessor {
 }
 
 // GetPerms finds perm values in the database.
-func (pa *PermAccess) GetPerms(opt *dauth.PermFind) <-chan dlib.Result {
+func (pa *PermAccess) GetPerms(ctx context.Context,
+	opt *dauth.PermFind) <-chan dlib.Result {
 	ch := make(chan dlib.Result, 256)
 
 	go func() {
 		defer close(ch)
-		rows, err := pa.DBS.Query(`
+		rows, err := traceQuery(ctx, pa.DBS, `
 			SELECT
 				p.id,
 				p.service,
@@ -69,18 +71,20 @@ func (pa *PermAccess) GetPerms(opt *dauth.PermFind) <-chan dlib.Result {
 }
 
 // GetPermByID finds a perm value in the database by ID.
-func (pa *PermAccess) GetPermByID(id int64) <-chan dlib.Result {
+func (pa *PermAccess) GetPermByID(ctx context.Context,
+	id int64) <-chan dlib.Result {
 	opt := dauth.PermFind{ID: &id}
-	return pa.GetPerms(&opt)
+	return pa.GetPerms(ctx, &opt)
 }
 
 // DeletePerms deletes perm values from the database.
-func (pa *PermAccess) DeletePerms(opt *dauth.PermFind) <-chan dlib.Result {
+func (pa *PermAccess) DeletePerms(ctx context.Context,
+	opt *dauth.PermFind) <-chan dlib.Result {
 	ch := make(chan dlib.Result, 256)
 
 	go func() {
 		defer close(ch)
-		rows, err := pa.DBS.Query(
+		rows, err := traceQuery(ctx, pa.DBS,
 			"SELECT delete_perms($1, $2, $3) AS num",
 			opt.ID,
 			opt.Service,
@@ -109,18 +113,20 @@ func (pa *PermAccess) DeletePerms(opt *dauth.PermFind) <-chan dlib.Result {
 }
 
 // DeletePermByID deletes a perm value from the database by ID.
-func (pa *PermAccess) DeletePermByID(id int64) <-chan dlib.Result {
+func (pa *PermAccess) DeletePermByID(ctx context.Context,
+	id int64) <-chan dlib.Result {
 	opt := dauth.PermFind{ID: &id}
-	return pa.DeletePerms(&opt)
+	return pa.DeletePerms(ctx, &opt)
 }
 
 // SavePerm saves a perm value to the database.
-func (pa *PermAccess) SavePerm(u *dauth.Perm) <-chan dlib.Result {
+func (pa *PermAccess) SavePerm(ctx context.Context,
+	u *dauth.Perm) <-chan dlib.Result {
 	ch := make(chan dlib.Result, 256)
 
 	go func() {
 		defer close(ch)
-		rows, err := pa.DBS.Query(
+		rows, err := traceQuery(ctx, pa.DBS,
 			"SELECT save_perm($1, $2, $3) AS id",
 			u.ID,
 			u.Service,
@@ -148,14 +154,15 @@ func (pa *PermAccess) SavePerm(u *dauth.Perm) <-chan dlib.Result {
 }
 
 // SavePerms saves a slice of perm values to the database.
-func (pa *PermAccess) SavePerms(u []dauth.Perm) <-chan dlib.Result {
+func (pa *PermAccess) SavePerms(ctx context.Context,
+	u []dauth.Perm) <-chan dlib.Result {
 	ch := make(chan dlib.Result, 256)
 
 	go func() {
 		defer close(ch)
 		if u != nil {
 			for _, v := range u {
-				for sr := range pa.SavePerm(&v) {
+				for sr := range pa.SavePerm(ctx, &v) {
 					ch <- sr
 				}
 			}
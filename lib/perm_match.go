@@ -0,0 +1,248 @@
+package lib
+
+import (
+	"strings"
+
+	"github.com/dhaifley/dlib/dauth"
+)
+
+// Perm expressions are the Service and Name of a perm joined by a colon and
+// split into colon separated segments, for example billing:invoices:read.
+// In a granted perm a * segment matches any one segment, and a * as the last
+// segment matches one or more segments, so billing:invoices:* matches
+// billing:invoices:read and billing:invoices:read:own. A Service or Name of
+// admin is the same as *, so the admin/admin perm is *:* and matches every
+// perm. A Service starting with ! makes the grant a deny, which overrides all
+// allowing grants.
+
+// PermSeparator separates the segments of a perm expression.
+const PermSeparator = ":"
+
+// PermWildcard is the segment matching any segment.
+const PermWildcard = "*"
+
+// PermDeny is the Service prefix of deny grants.
+const PermDeny = "!"
+
+// PermPattern values are parsed perm grants.
+type PermPattern struct {
+	Deny     bool
+	Segments []string
+}
+
+// ParsePermPattern parses the Service and Name of a granted perm.
+func ParsePermPattern(service, name string) PermPattern {
+	p := PermPattern{}
+	if strings.HasPrefix(service, PermDeny) {
+		p.Deny = true
+		service = strings.TrimPrefix(service, PermDeny)
+	}
+
+	p.Segments = append(permSegments(service), permSegments(name)...)
+	return p
+}
+
+// permSegments splits one field of a perm into segments, treating admin as
+// a wildcard.
+func permSegments(field string) []string {
+	if field == "admin" {
+		return []string{PermWildcard}
+	}
+
+	return strings.Split(field, PermSeparator)
+}
+
+// Match returns whether the pattern matches a requested perm.
+func (p PermPattern) Match(service, name string) bool {
+	req := append(strings.Split(service, PermSeparator),
+		strings.Split(name, PermSeparator)...)
+	return matchSegments(p.Segments, req)
+}
+
+// matchSegments returns whether pattern segments match requested segments.
+func matchSegments(pattern, req []string) bool {
+	for i, s := range pattern {
+		if i >= len(req) {
+			return false
+		}
+
+		if s == PermWildcard {
+			if i == len(pattern)-1 {
+				return true
+			}
+
+			continue
+		}
+
+		if s != req[i] {
+			return false
+		}
+	}
+
+	return len(req) == len(pattern)
+}
+
+// Literal returns whether the pattern has no wildcard segments, so that it
+// matches exactly one perm.
+func (p PermPattern) Literal() bool {
+	for _, s := range p.Segments {
+		if s == PermWildcard {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Specificity ranks patterns matching the same perm. Patterns with more
+// literal segments before their first wildcard rank higher, then patterns
+// with more literal segments, then longer patterns.
+func (p PermPattern) Specificity() int {
+	return specificity(p.Segments)
+}
+
+// specificity ranks pattern segments as described for PermPattern.
+func specificity(segments []string) int {
+	prefix, literal := 0, 0
+	wild := false
+	for _, s := range segments {
+		if s == PermWildcard {
+			wild = true
+			continue
+		}
+
+		literal++
+		if !wild {
+			prefix++
+		}
+	}
+
+	return prefix<<16 | literal<<8 | len(segments)
+}
+
+// PermMatcher values decide requested perms against a set of granted perms.
+// A request is allowed if at least one allowing grant matches it and no
+// deny grant does. Perms may be added with a Grant, limiting them to the
+// resources and conditions of the grant.
+type PermMatcher struct {
+	entries []permEntry
+}
+
+type permEntry struct {
+	perm    dauth.Perm
+	pattern PermPattern
+	grant   *Grant
+}
+
+// Decision values are the results of deciding access requests. Perm and
+// Grant hold the deciding grant: the deny grant if the request was denied,
+// otherwise the most specific allowing grant. Grant is nil for perms granted
+// without a resource or conditions.
+type Decision struct {
+	Allowed bool
+	Denied  bool
+	Perm    *dauth.Perm
+	Grant   *Grant
+}
+
+// NewPermMatcher creates a new PermMatcher for a set of granted perms.
+func NewPermMatcher(perms ...dauth.Perm) *PermMatcher {
+	m := PermMatcher{}
+	for _, p := range perms {
+		m.Add(p)
+	}
+
+	return &m
+}
+
+// Add adds a granted perm to the matcher.
+func (m *PermMatcher) Add(p dauth.Perm) {
+	m.AddGrant(p, nil)
+}
+
+// AddGrant adds a perm granted for the resources and conditions of a grant
+// to the matcher.
+func (m *PermMatcher) AddGrant(p dauth.Perm, g *Grant) {
+	m.entries = append(m.entries, permEntry{
+		perm:    p,
+		pattern: ParsePermPattern(p.Service, p.Name),
+		grant:   g,
+	})
+}
+
+// Match decides a requested perm without a resource or attributes. If it is
+// allowed, the most specific matching allowing grant is returned, preferring
+// grants added first.
+func (m *PermMatcher) Match(service, name string) (*dauth.Perm, bool) {
+	d := m.Decide(&AccessRequest{Service: service, Name: name})
+	if !d.Allowed {
+		return nil, false
+	}
+
+	return d.Perm, true
+}
+
+// Decide decides an access request. Any matching deny grant denies it,
+// including deny grants whose resource or attributes the request lacks.
+// Otherwise the most specific matching allowing grant allows it, ranking
+// the perm first, then the resource selector, then the number of conditions.
+func (m *PermMatcher) Decide(r *AccessRequest) Decision {
+	best := -1
+	for i := range m.entries {
+		e := &m.entries[i]
+		if !e.pattern.Match(r.Service, r.Name) {
+			continue
+		}
+
+		if e.pattern.Deny {
+			if e.grant == nil || e.grant.MatchDeny(r) {
+				return Decision{Denied: true, Perm: &e.perm, Grant: e.grant}
+			}
+
+			continue
+		}
+
+		if e.grant != nil && !e.grant.Match(r) {
+			continue
+		}
+
+		if best < 0 || e.rank() > m.entries[best].rank() {
+			best = i
+		}
+	}
+
+	if best < 0 {
+		return Decision{}
+	}
+
+	e := &m.entries[best]
+	return Decision{Allowed: true, Perm: &e.perm, Grant: e.grant}
+}
+
+// Grants returns the decision each perm added to the matcher makes for the
+// requests it matches, in the order the perms were added.
+func (m *PermMatcher) Grants() []Decision {
+	res := make([]Decision, 0, len(m.entries))
+	for i := range m.entries {
+		e := &m.entries[i]
+		res = append(res, Decision{
+			Allowed: !e.pattern.Deny,
+			Denied:  e.pattern.Deny,
+			Perm:    &e.perm,
+			Grant:   e.grant,
+		})
+	}
+
+	return res
+}
+
+// rank orders matching entries by specificity.
+func (e *permEntry) rank() int64 {
+	r := int64(e.pattern.Specificity()) << 32
+	if e.grant != nil {
+		r |= int64(e.grant.Specificity())<<8 | 1<<7 |
+			int64(len(e.grant.Conditions)&0x7f)
+	}
+
+	return r
+}
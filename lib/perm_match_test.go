@@ -0,0 +1,93 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/dhaifley/dlib/dauth"
+)
+
+func TestPermPatternMatch(t *testing.T) {
+	cases := []struct {
+		service, name string
+		reqService    string
+		reqName       string
+		exp           bool
+	}{
+		{"test", "test", "test", "test", true},
+		{"test", "test", "test", "wrong", false},
+		{"admin", "admin", "test", "test", true},
+		{"admin", "admin", "billing", "invoices:read", true},
+		{"test", "admin", "test", "anything", true},
+		{"test", "admin", "other", "anything", false},
+		{"admin", "read", "test", "read", true},
+		{"admin", "read", "test", "write", false},
+		{"billing", "invoices:*", "billing", "invoices:read", true},
+		{"billing", "invoices:*", "billing", "invoices:read:own", true},
+		{"billing", "invoices:*", "billing", "invoices", false},
+		{"billing", "invoices:*", "billing", "payments:read", false},
+		{"billing", "*:read", "billing", "invoices:read", true},
+		{"billing", "*:read", "billing", "invoices:write", false},
+		{"billing", "*:read", "billing", "invoices:read:own", false},
+		{"billing", "invoices", "billing", "invoices:read", false},
+		{"!billing", "invoices:delete", "billing", "invoices:delete", true},
+	}
+
+	for _, c := range cases {
+		p := ParsePermPattern(c.service, c.name)
+		if got := p.Match(c.reqService, c.reqName); got != c.exp {
+			t.Errorf("%v/%v matching %v/%v expected: %v, got: %v",
+				c.service, c.name, c.reqService, c.reqName, c.exp, got)
+		}
+	}
+}
+
+func TestPermPatternDeny(t *testing.T) {
+	p := ParsePermPattern("!billing", "*")
+	if !p.Deny {
+		t.Error("Expected deny pattern")
+	}
+
+	if len(p.Segments) != 2 || p.Segments[0] != "billing" {
+		t.Errorf("Segments expected: [billing *], got: %v", p.Segments)
+	}
+}
+
+func TestPermMatcher(t *testing.T) {
+	m := NewPermMatcher(
+		dauth.Perm{ID: 1, Service: "admin", Name: "admin"},
+		dauth.Perm{ID: 2, Service: "billing", Name: "*"},
+		dauth.Perm{ID: 3, Service: "billing", Name: "invoices:*"},
+		dauth.Perm{ID: 4, Service: "billing", Name: "*:read"},
+		dauth.Perm{ID: 5, Service: "!billing", Name: "invoices:delete"},
+	)
+
+	cases := []struct {
+		service, name string
+		id            int64
+		ok            bool
+	}{
+		{"test", "test", 1, true},
+		{"billing", "payments", 2, true},
+		{"billing", "invoices:read", 3, true},
+		{"billing", "payments:read", 4, true},
+		{"billing", "invoices:delete", 0, false},
+	}
+
+	for _, c := range cases {
+		p, ok := m.Match(c.service, c.name)
+		if ok != c.ok {
+			t.Errorf("%v/%v expected: %v, got: %v", c.service, c.name,
+				c.ok, ok)
+			continue
+		}
+
+		if ok && p.ID != c.id {
+			t.Errorf("%v/%v perm expected: %v, got: %v", c.service, c.name,
+				c.id, p.ID)
+		}
+	}
+
+	if _, ok := NewPermMatcher().Match("test", "test"); ok {
+		t.Error("Expected no match without grants")
+	}
+}
@@ -1,6 +1,7 @@
 package lib
 
 import (
+	"context"
 	"database/sql"
 	"testing"
 
@@ -100,11 +101,12 @@ func TestNewPermAccessor(t *testing.T) {
 }
 
 func TestPermAccessGetPerms(t *testing.T) {
+	ctx := context.Background()
 	mdbs := MockPermDBSession{}
 	ma := NewPermAccessor(&mdbs)
 	var as []dauth.Perm
 	id := int64(1)
-	c := ma.GetPerms(&dauth.PermFind{ID: &id})
+	c := ma.GetPerms(ctx, &dauth.PermFind{ID: &id})
 	for r := range c {
 		if r.Err != nil {
 			t.Error(r.Err)
@@ -124,10 +126,11 @@ func TestPermAccessGetPerms(t *testing.T) {
 }
 
 func TestPermAccessGetPermByID(t *testing.T) {
+	ctx := context.Background()
 	mdbs := MockPermDBSession{}
 	ma := NewPermAccessor(&mdbs)
 	var a dauth.Perm
-	c := ma.GetPermByID(1)
+	c := ma.GetPermByID(ctx, 1)
 	for r := range c {
 		if r.Err != nil {
 			t.Error(r.Err)
@@ -147,9 +150,10 @@ func TestPermAccessGetPermByID(t *testing.T) {
 }
 
 func TestPermAccessDeletePermByID(t *testing.T) {
+	ctx := context.Background()
 	mdbs := MockPermDBSession{}
 	ma := NewPermAccessor(&mdbs)
-	c := ma.DeletePermByID(1)
+	c := ma.DeletePermByID(ctx, 1)
 	var n int
 	for r := range c {
 		if r.Err != nil {
@@ -166,10 +170,11 @@ func TestPermAccessDeletePermByID(t *testing.T) {
 }
 
 func TestPermAccessDeletePerms(t *testing.T) {
+	ctx := context.Background()
 	mdbs := MockPermDBSession{}
 	ma := NewPermAccessor(&mdbs)
 	id := int64(1)
-	c := ma.DeletePerms(&dauth.PermFind{ID: &id})
+	c := ma.DeletePerms(ctx, &dauth.PermFind{ID: &id})
 	var n int
 	for r := range c {
 		if r.Err != nil {
@@ -186,10 +191,11 @@ func TestPermAccessDeletePerms(t *testing.T) {
 }
 
 func TestPermAccessSavePerm(t *testing.T) {
+	ctx := context.Background()
 	a := dauth.Perm{ID: 1}
 	mdbs := MockPermDBSession{}
 	ma := NewPermAccessor(&mdbs)
-	c := ma.SavePerm(&a)
+	c := ma.SavePerm(ctx, &a)
 	for r := range c {
 		if r.Err != nil {
 			t.Error(r.Err)
@@ -209,10 +215,11 @@ func TestPermAccessSavePerm(t *testing.T) {
 }
 
 func TestPermAccessSavePerms(t *testing.T) {
+	ctx := context.Background()
 	a := []dauth.Perm{dauth.Perm{ID: 1}}
 	mdbs := MockPermDBSession{}
 	ma := NewPermAccessor(&mdbs)
-	c := ma.SavePerms(a)
+	c := ma.SavePerms(ctx, a)
 	for r := range c {
 		if r.Err != nil {
 			t.Error(r.Err)
@@ -0,0 +1,335 @@
+package lib
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+
+	"github.com/dhaifley/dlib"
+)
+
+// RefreshToken values represent refresh tokens. Only a hash of the token
+// string is stored. All refresh tokens issued from the same login share a
+// family, and TokenID refers to the access token issued alongside.
+type RefreshToken struct {
+	ID      int64
+	Token   string
+	Family  string
+	UserID  int64
+	TokenID int64
+	Created *time.Time
+	Expires *time.Time
+	Used    *time.Time
+}
+
+// RefreshTokenFind values are used to find refresh tokens in the database.
+// AccessToken matches the families of refresh tokens issued alongside the
+// provided access token string.
+type RefreshTokenFind struct {
+	ID          *int64
+	Token       *string
+	Family      *string
+	UserID      *int64
+	AccessToken *string
+}
+
+// RefreshTokenRow values are used to scan refresh token database rows.
+type RefreshTokenRow struct {
+	ID      int64
+	Token   string
+	Family  string
+	UserID  int64
+	TokenID int64
+	Created dlib.NullTime
+	Expires dlib.NullTime
+	Used    dlib.NullTime
+}
+
+// ToRefreshToken converts a RefreshTokenRow value into a RefreshToken.
+func (r *RefreshTokenRow) ToRefreshToken() RefreshToken {
+	v := RefreshToken{
+		ID:      r.ID,
+		Token:   r.Token,
+		Family:  r.Family,
+		UserID:  r.UserID,
+		TokenID: r.TokenID,
+	}
+
+	if r.Created.Valid {
+		v.Created = &r.Created.Time
+	}
+
+	if r.Expires.Valid {
+		v.Expires = &r.Expires.Time
+	}
+
+	if r.Used.Valid {
+		v.Used = &r.Used.Time
+	}
+
+	return v
+}
+
+// NewRefreshToken creates a new random refresh token string.
+func NewRefreshToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken returns the hash of a token string used for storage.
+func HashToken(ts string) string {
+	h := sha256.Sum256([]byte(ts))
+	return hex.EncodeToString(h[:])
+}
+
+// RefreshTokenAccess values are used to access refresh token records in the
+// database.
+type RefreshTokenAccess struct {
+	DBS dlib.SQLExecutor
+}
+
+// RefreshTokenAccessor is an interface describing values capable of
+// providing access to refresh token records in the database.
+type RefreshTokenAccessor interface {
+	GetRefreshTokens(ctx context.Context,
+		opt *RefreshTokenFind) <-chan dlib.Result
+	UseRefreshToken(ctx context.Context, token string) <-chan dlib.Result
+	DeleteRefreshTokens(ctx context.Context,
+		opt *RefreshTokenFind) <-chan dlib.Result
+	DeleteOldRefreshTokens(ctx context.Context,
+		old time.Time, limit int) <-chan dlib.Result
+	SaveRefreshToken(ctx context.Context,
+		t *RefreshToken) <-chan dlib.Result
+}
+
+// NewRefreshTokenAccessor creates a new RefreshTokenAccess value for
+// database access.
+func NewRefreshTokenAccessor(dbs dlib.SQLExecutor) RefreshTokenAccessor {
+	rta := RefreshTokenAccess{DBS: dbs}
+	return &rta
+}
+
+// GetRefreshTokens finds refresh token values in the database.
+func (rta *RefreshTokenAccess) GetRefreshTokens(ctx context.Context,
+	opt *RefreshTokenFind) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 256)
+
+	go func() {
+		defer close(ch)
+		rows, err := traceQuery(ctx, rta.DBS, `
+			SELECT
+				r.id,
+				r.token,
+				r.family,
+				r.user_id,
+				r.token_id,
+				r.created,
+				r.expires,
+				r.used
+			FROM get_refresh_tokens($1, $2, $3, $4, $5) AS r`,
+			opt.ID,
+			opt.Token,
+			opt.Family,
+			opt.UserID,
+			opt.AccessToken)
+		if err != nil {
+			ch <- dlib.Result{Err: err}
+			return
+		}
+
+		defer rows.Close()
+		for rows.Next() {
+			r := RefreshTokenRow{}
+			if err := rows.Scan(
+				&r.ID,
+				&r.Token,
+				&r.Family,
+				&r.UserID,
+				&r.TokenID,
+				&r.Created,
+				&r.Expires,
+				&r.Used,
+			); err != nil {
+				ch <- dlib.Result{Err: err}
+				continue
+			}
+
+			v := r.ToRefreshToken()
+			ch <- dlib.Result{Val: v, Num: 1}
+		}
+	}()
+
+	return ch
+}
+
+// UseRefreshToken marks a refresh token as used and returns it as it was
+// before being marked. A returned value with Used set means the token had
+// already been used.
+func (rta *RefreshTokenAccess) UseRefreshToken(ctx context.Context,
+	token string) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 256)
+
+	go func() {
+		defer close(ch)
+		rows, err := traceQuery(ctx, rta.DBS, `
+			SELECT
+				r.id,
+				r.token,
+				r.family,
+				r.user_id,
+				r.token_id,
+				r.created,
+				r.expires,
+				r.used
+			FROM use_refresh_token($1) AS r`,
+			token)
+		if err != nil {
+			ch <- dlib.Result{Err: err}
+			return
+		}
+
+		defer rows.Close()
+		for rows.Next() {
+			r := RefreshTokenRow{}
+			if err := rows.Scan(
+				&r.ID,
+				&r.Token,
+				&r.Family,
+				&r.UserID,
+				&r.TokenID,
+				&r.Created,
+				&r.Expires,
+				&r.Used,
+			); err != nil {
+				ch <- dlib.Result{Err: err}
+				continue
+			}
+
+			v := r.ToRefreshToken()
+			ch <- dlib.Result{Val: v, Num: 1}
+		}
+	}()
+
+	return ch
+}
+
+// DeleteRefreshTokens deletes every refresh token in the families matching
+// the provided values, together with the access tokens issued alongside
+// them.
+func (rta *RefreshTokenAccess) DeleteRefreshTokens(ctx context.Context,
+	opt *RefreshTokenFind) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 256)
+
+	go func() {
+		defer close(ch)
+		rows, err := traceQuery(ctx, rta.DBS,
+			"SELECT delete_refresh_tokens($1, $2, $3, $4, $5) AS num",
+			opt.ID,
+			opt.Token,
+			opt.Family,
+			opt.UserID,
+			opt.AccessToken)
+		if err != nil {
+			ch <- dlib.Result{Err: err}
+			return
+		}
+
+		defer rows.Close()
+		n := 0
+		for rows.Next() {
+			r := struct{ Num int }{Num: 0}
+			if err := rows.Scan(&r.Num); err != nil {
+				ch <- dlib.Result{Err: err}
+				continue
+			}
+
+			n += r.Num
+		}
+
+		ch <- dlib.Result{Num: n, Err: nil}
+	}()
+
+	return ch
+}
+
+// DeleteOldRefreshTokens deletes at most limit refresh tokens which expired
+// before old, and returns the number deleted.
+func (rta *RefreshTokenAccess) DeleteOldRefreshTokens(ctx context.Context,
+	old time.Time,
+	limit int) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 256)
+
+	go func() {
+		defer close(ch)
+		rows, err := traceQuery(ctx, rta.DBS,
+			"SELECT delete_old_refresh_tokens($1, $2) AS num",
+			old,
+			limit)
+		if err != nil {
+			ch <- dlib.Result{Err: err}
+			return
+		}
+
+		defer rows.Close()
+		n := 0
+		for rows.Next() {
+			r := struct{ Num int }{Num: 0}
+			if err := rows.Scan(&r.Num); err != nil {
+				ch <- dlib.Result{Err: err}
+				continue
+			}
+
+			n += r.Num
+		}
+
+		ch <- dlib.Result{Num: n, Err: nil}
+	}()
+
+	return ch
+}
+
+// SaveRefreshToken saves a refresh token value to the database.
+func (rta *RefreshTokenAccess) SaveRefreshToken(ctx context.Context,
+	t *RefreshToken) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 256)
+
+	go func() {
+		defer close(ch)
+		rows, err := traceQuery(ctx, rta.DBS,
+			"SELECT save_refresh_token($1, $2, $3, $4, $5, $6, $7, $8) AS id",
+			t.ID,
+			t.Token,
+			t.Family,
+			t.UserID,
+			t.TokenID,
+			t.Created,
+			t.Expires,
+			t.Used)
+		if err != nil {
+			ch <- dlib.Result{Err: err}
+			return
+		}
+
+		defer rows.Close()
+		for rows.Next() {
+			r := struct{ ID int64 }{ID: 0}
+			if err := rows.Scan(&r.ID); err != nil {
+				ch <- dlib.Result{Err: err}
+				continue
+			}
+
+			t.ID = r.ID
+		}
+
+		ch <- dlib.Result{Val: *t, Err: nil}
+	}()
+
+	return ch
+}
@@ -0,0 +1,183 @@
+package lib
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/dhaifley/dlib"
+)
+
+type MockRefreshTokenRows struct {
+	row int
+}
+
+func (m *MockRefreshTokenRows) Close() error {
+	return nil
+}
+
+func (m *MockRefreshTokenRows) Next() bool {
+	m.row++
+	if m.row > 1 {
+		return false
+	}
+
+	return true
+}
+
+func (m *MockRefreshTokenRows) Scan(dest ...interface{}) error {
+	for _, d := range dest {
+		switch v := d.(type) {
+		case *int64:
+			*v = int64(1)
+		case *int:
+			*v = 1
+		case *string:
+			*v = "test"
+		case *dlib.NullTime:
+			dt := time.Date(1983, 2, 2, 0, 0, 0, 0, time.Local)
+			*v = dlib.NullTime{Time: dt, Valid: true}
+		default:
+			return dlib.NewError(500, "Invalid type")
+		}
+	}
+
+	return nil
+}
+
+type MockRefreshTokenDBSession struct{}
+
+func (m *MockRefreshTokenDBSession) Close() error {
+	return nil
+}
+
+func (m *MockRefreshTokenDBSession) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return nil, nil
+}
+
+func (m *MockRefreshTokenDBSession) Query(query string, args ...interface{}) (dlib.SQLRows, error) {
+	mr := MockRefreshTokenRows{}
+	return &mr, nil
+}
+
+func (m *MockRefreshTokenDBSession) Ping() error {
+	return nil
+}
+
+func (m *MockRefreshTokenDBSession) Stats() sql.DBStats {
+	return sql.DBStats{OpenConnections: 0}
+}
+
+func TestNewRefreshToken(t *testing.T) {
+	a, err := NewRefreshToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := NewRefreshToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a == b || len(a) != 43 {
+		t.Errorf("Invalid refresh tokens: %v, %v", a, b)
+	}
+
+	if HashToken(a) == a || HashToken(a) != HashToken(a) {
+		t.Error("Invalid refresh token hash")
+	}
+}
+
+func TestRefreshTokenAccessGetRefreshTokens(t *testing.T) {
+	ctx := context.Background()
+	ma := NewRefreshTokenAccessor(&MockRefreshTokenDBSession{})
+	var as []RefreshToken
+	f := "test"
+	for r := range ma.GetRefreshTokens(ctx, &RefreshTokenFind{Family: &f}) {
+		if r.Err != nil {
+			t.Error(r.Err)
+		}
+
+		switch v := r.Val.(type) {
+		case RefreshToken:
+			as = append(as, v)
+		default:
+			t.Errorf("Invalid data type returned")
+		}
+	}
+
+	if len(as) != 1 || as[0].Family != "test" || as[0].Used == nil {
+		t.Errorf("Refresh tokens expected: [1], got: %v", as)
+	}
+}
+
+func TestRefreshTokenAccessUseRefreshToken(t *testing.T) {
+	ctx := context.Background()
+	ma := NewRefreshTokenAccessor(&MockRefreshTokenDBSession{})
+	var a RefreshToken
+	for r := range ma.UseRefreshToken(ctx, "test") {
+		if r.Err != nil {
+			t.Error(r.Err)
+		}
+
+		if v, ok := r.Val.(RefreshToken); ok {
+			a = v
+		}
+	}
+
+	if a.ID != 1 {
+		t.Errorf("ID expected: 1, got: %v", a.ID)
+	}
+}
+
+func TestRefreshTokenAccessDeleteRefreshTokens(t *testing.T) {
+	ctx := context.Background()
+	ma := NewRefreshTokenAccessor(&MockRefreshTokenDBSession{})
+	f := "test"
+	var n int
+	for r := range ma.DeleteRefreshTokens(ctx,
+		&RefreshTokenFind{Family: &f}) {
+		if r.Err != nil {
+			t.Error(r.Err)
+		}
+
+		n = r.Num
+	}
+
+	if n != 1 {
+		t.Errorf("Delete count expected: 1, got: %v", n)
+	}
+}
+
+func TestRefreshTokenAccessDeleteOldRefreshTokens(t *testing.T) {
+	ctx := context.Background()
+	ma := NewRefreshTokenAccessor(&MockRefreshTokenDBSession{})
+	var n int
+	for r := range ma.DeleteOldRefreshTokens(ctx, time.Now(), 10) {
+		if r.Err != nil {
+			t.Error(r.Err)
+		}
+
+		n = r.Num
+	}
+
+	if n != 1 {
+		t.Errorf("Delete count expected: 1, got: %v", n)
+	}
+}
+
+func TestRefreshTokenAccessSaveRefreshToken(t *testing.T) {
+	ctx := context.Background()
+	a := RefreshToken{Token: "test", Family: "test"}
+	ma := NewRefreshTokenAccessor(&MockRefreshTokenDBSession{})
+	for r := range ma.SaveRefreshToken(ctx, &a) {
+		if r.Err != nil {
+			t.Error(r.Err)
+		}
+	}
+
+	if a.ID != 1 {
+		t.Errorf("ID expected: 1, got: %v", a.ID)
+	}
+}
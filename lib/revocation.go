@@ -0,0 +1,188 @@
+package lib
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/dhaifley/dlib"
+)
+
+// RevokedToken values record tokens revoked before they expire. They are
+// keyed by the jti claim of the token, so that verifying a token only
+// requires its claims. A record may be removed once the token has expired.
+type RevokedToken struct {
+	ID      string     `json:"jti"`
+	UserID  int64      `json:"user_id"`
+	Expires *time.Time `json:"expires,omitempty"`
+	Created *time.Time `json:"created,omitempty"`
+}
+
+// RevokedTokenRow values are used to scan revoked token database rows.
+type RevokedTokenRow struct {
+	ID      string
+	UserID  int64
+	Expires dlib.NullTime
+	Created dlib.NullTime
+}
+
+// ToRevokedToken converts a RevokedTokenRow value into a RevokedToken.
+func (r *RevokedTokenRow) ToRevokedToken() RevokedToken {
+	v := RevokedToken{ID: r.ID, UserID: r.UserID}
+	if r.Expires.Valid {
+		v.Expires = &r.Expires.Time
+	}
+
+	if r.Created.Valid {
+		v.Created = &r.Created.Time
+	}
+
+	return v
+}
+
+// NewRevokedToken creates a new RevokedToken value for the claims of a
+// token.
+func NewRevokedToken(tc *TokenClaims) RevokedToken {
+	exp := time.Unix(tc.ExpiresAt, 0)
+	return RevokedToken{ID: tc.Id, UserID: tc.UserID, Expires: &exp}
+}
+
+// RevocationAccessor is an interface describing values capable of storing
+// the token revocation list.
+type RevocationAccessor interface {
+	GetRevokedToken(ctx context.Context, id string) <-chan dlib.Result
+	RevokeToken(ctx context.Context, rt *RevokedToken) <-chan dlib.Result
+	DeleteOldRevokedTokens(ctx context.Context,
+		old time.Time, limit int) <-chan dlib.Result
+}
+
+// RevocationAccess values are used to access revoked token records in the
+// database.
+type RevocationAccess struct {
+	DBS dlib.SQLExecutor
+}
+
+// NewRevocationAccessor creates a new RevocationAccess value for database
+// access.
+func NewRevocationAccessor(dbs dlib.SQLExecutor) RevocationAccessor {
+	ra := RevocationAccess{DBS: dbs}
+	return &ra
+}
+
+// GetRevokedToken finds the revocation record of a token id in the
+// database.
+func (ra *RevocationAccess) GetRevokedToken(ctx context.Context,
+	id string) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 256)
+
+	go func() {
+		defer close(ch)
+		rows, err := traceQuery(ctx, ra.DBS, `
+			SELECT
+				r.jti,
+				r.user_id,
+				r.expires,
+				r.created
+			FROM get_revoked_token($1) AS r`,
+			id)
+		if err != nil {
+			ch <- dlib.Result{Err: err}
+			return
+		}
+
+		defer rows.Close()
+		for rows.Next() {
+			r := RevokedTokenRow{}
+			if err := rows.Scan(&r.ID, &r.UserID, &r.Expires,
+				&r.Created); err != nil {
+				ch <- dlib.Result{Err: err}
+				continue
+			}
+
+			v := r.ToRevokedToken()
+			ch <- dlib.Result{Val: v, Num: 1}
+		}
+	}()
+
+	return ch
+}
+
+// RevokeToken adds a token id to the revocation list until the token
+// expires. The result counts the records added, which is zero if the token
+// was already revoked.
+func (ra *RevocationAccess) RevokeToken(ctx context.Context,
+	rt *RevokedToken) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 256)
+
+	go func() {
+		defer close(ch)
+		if rt.ID == "" || rt.Expires == nil {
+			ch <- dlib.Result{Err: dlib.NewError(http.StatusBadRequest,
+				"invalid revoked token value")}
+			return
+		}
+
+		rows, err := traceQuery(ctx, ra.DBS,
+			"SELECT revoke_token($1, $2, $3, $4) AS num",
+			rt.ID,
+			rt.UserID,
+			rt.Expires,
+			rt.Created)
+		if err != nil {
+			ch <- dlib.Result{Err: err}
+			return
+		}
+
+		defer rows.Close()
+		n := 0
+		for rows.Next() {
+			r := struct{ Num int }{Num: 0}
+			if err := rows.Scan(&r.Num); err != nil {
+				ch <- dlib.Result{Err: err}
+				continue
+			}
+
+			n += r.Num
+		}
+
+		ch <- dlib.Result{Val: *rt, Num: n}
+	}()
+
+	return ch
+}
+
+// DeleteOldRevokedTokens deletes at most limit revocation records of tokens
+// which expired before old, and returns the number deleted.
+func (ra *RevocationAccess) DeleteOldRevokedTokens(ctx context.Context,
+	old time.Time,
+	limit int) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 256)
+
+	go func() {
+		defer close(ch)
+		rows, err := traceQuery(ctx, ra.DBS,
+			"SELECT delete_old_revoked_tokens($1, $2) AS num",
+			old,
+			limit)
+		if err != nil {
+			ch <- dlib.Result{Err: err}
+			return
+		}
+
+		defer rows.Close()
+		n := 0
+		for rows.Next() {
+			r := struct{ Num int }{Num: 0}
+			if err := rows.Scan(&r.Num); err != nil {
+				ch <- dlib.Result{Err: err}
+				continue
+			}
+
+			n += r.Num
+		}
+
+		ch <- dlib.Result{Num: n, Err: nil}
+	}()
+
+	return ch
+}
@@ -0,0 +1,151 @@
+package lib
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/dhaifley/dlib"
+)
+
+type MockRevocationRows struct {
+	row int
+}
+
+func (m *MockRevocationRows) Close() error {
+	return nil
+}
+
+func (m *MockRevocationRows) Next() bool {
+	m.row++
+	if m.row > 1 {
+		return false
+	}
+
+	return true
+}
+
+func (m *MockRevocationRows) Scan(dest ...interface{}) error {
+	for _, d := range dest {
+		switch v := d.(type) {
+		case *int64:
+			*v = 1
+		case *int:
+			*v = 1
+		case *string:
+			*v = "test"
+		case *dlib.NullTime:
+			dt := time.Date(2083, 2, 2, 0, 0, 0, 0, time.Local)
+			*v = dlib.NullTime{Time: dt, Valid: true}
+		default:
+			return dlib.NewError(500, "Invalid type")
+		}
+	}
+
+	return nil
+}
+
+type MockRevocationDBSession struct{}
+
+func (m *MockRevocationDBSession) Close() error {
+	return nil
+}
+
+func (m *MockRevocationDBSession) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return nil, nil
+}
+
+func (m *MockRevocationDBSession) Query(query string, args ...interface{}) (dlib.SQLRows, error) {
+	mr := MockRevocationRows{}
+	return &mr, nil
+}
+
+func (m *MockRevocationDBSession) Ping() error {
+	return nil
+}
+
+func (m *MockRevocationDBSession) Stats() sql.DBStats {
+	return sql.DBStats{OpenConnections: 0}
+}
+
+func TestRevocationAccess(t *testing.T) {
+	ctx := context.Background()
+	ra := NewRevocationAccessor(&MockRevocationDBSession{})
+	var a RevokedToken
+	for r := range ra.GetRevokedToken(ctx, "test") {
+		if r.Err != nil {
+			t.Error(r.Err)
+		}
+
+		if v, ok := r.Val.(RevokedToken); ok {
+			a = v
+		}
+	}
+
+	if a.ID != "test" || a.UserID != 1 || a.Expires == nil {
+		t.Errorf("Revoked token expected: test, got: %+v", a)
+	}
+
+	for r := range ra.RevokeToken(ctx, &a) {
+		if r.Err != nil {
+			t.Error(r.Err)
+		}
+
+		if r.Num != 1 {
+			t.Errorf("Revoked expected: 1, got: %v", r.Num)
+		}
+	}
+
+	for r := range ra.RevokeToken(ctx, &RevokedToken{ID: "test"}) {
+		if r.Err == nil {
+			t.Error("Expected an error without an expiry")
+		}
+	}
+
+	for r := range ra.DeleteOldRevokedTokens(ctx, time.Now(), 10) {
+		if r.Err != nil {
+			t.Error(r.Err)
+		}
+
+		if r.Num != 1 {
+			t.Errorf("Deleted expected: 1, got: %v", r.Num)
+		}
+	}
+}
+
+func TestNewRevokedToken(t *testing.T) {
+	now := time.Now()
+	tc, err := NewTokenClaims("test", 7, "dauth", "", now,
+		now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kr, err := NewKeyRingFromConfig([]KeyConfig{
+		{ID: "test", Secret: "test"},
+	}, "test", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts, err := kr.Sign(tc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pc, err := ParseTokenClaims(ts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rt := NewRevokedToken(pc)
+	if rt.ID != tc.Id || rt.UserID != 7 ||
+		rt.Expires.Unix() != tc.ExpiresAt {
+		t.Errorf("Revoked token expected for %v, got: %+v", tc.Id, rt)
+	}
+
+	if _, err := ParseTokenClaims("test"); err == nil {
+		t.Error("Expected an error for a token which is not a JWT")
+	}
+}
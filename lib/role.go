@@ -0,0 +1,396 @@
+package lib
+
+import (
+	"context"
+	"github.com/dhaifley/dlib"
+)
+
+// Role values represent named sets of perms which can be assigned to users.
+type Role struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// RoleFind values are used to find roles in the database.
+type RoleFind struct {
+	ID   *int64  `json:"id,omitempty"`
+	Name *string `json:"name,omitempty"`
+}
+
+// RolePerm values assign a perm to a role.
+type RolePerm struct {
+	ID     int64 `json:"id"`
+	RoleID int64 `json:"role_id"`
+	PermID int64 `json:"perm_id"`
+}
+
+// RolePermFind values are used to find role_perm records in the database.
+type RolePermFind struct {
+	ID     *int64 `json:"id,omitempty"`
+	RoleID *int64 `json:"role_id,omitempty"`
+	PermID *int64 `json:"perm_id,omitempty"`
+}
+
+// UserRole values assign a role to a user.
+type UserRole struct {
+	ID     int64 `json:"id"`
+	UserID int64 `json:"user_id"`
+	RoleID int64 `json:"role_id"`
+}
+
+// UserRoleFind values are used to find user_role records in the database.
+type UserRoleFind struct {
+	ID     *int64 `json:"id,omitempty"`
+	UserID *int64 `json:"user_id,omitempty"`
+	RoleID *int64 `json:"role_id,omitempty"`
+}
+
+// RoleAccess values are used to access role, role_perm and user_role
+// records in the database.
+type RoleAccess struct {
+	DBS dlib.SQLExecutor
+}
+
+// RoleAccessor is an interface describing values capable of providing
+// access to role, role_perm and user_role records in the database.
+type RoleAccessor interface {
+	GetRoles(ctx context.Context, opt *RoleFind) <-chan dlib.Result
+	GetRoleByID(ctx context.Context, id int64) <-chan dlib.Result
+	DeleteRoles(ctx context.Context, opt *RoleFind) <-chan dlib.Result
+	DeleteRoleByID(ctx context.Context, id int64) <-chan dlib.Result
+	SaveRole(ctx context.Context, r *Role) <-chan dlib.Result
+	SaveRoles(ctx context.Context, r []Role) <-chan dlib.Result
+	GetRolePerms(ctx context.Context, opt *RolePermFind) <-chan dlib.Result
+	DeleteRolePerms(ctx context.Context,
+		opt *RolePermFind) <-chan dlib.Result
+	SaveRolePerm(ctx context.Context, rp *RolePerm) <-chan dlib.Result
+	GetUserRoles(ctx context.Context, opt *UserRoleFind) <-chan dlib.Result
+	DeleteUserRoles(ctx context.Context,
+		opt *UserRoleFind) <-chan dlib.Result
+	SaveUserRole(ctx context.Context, ur *UserRole) <-chan dlib.Result
+	GetUserRolePerms(ctx context.Context, userID int64) <-chan dlib.Result
+}
+
+// NewRoleAccessor creates a new RoleAccess instance and returns a pointer
+// to it.
+func NewRoleAccessor(dbs dlib.SQLExecutor) RoleAccessor {
+	ra := RoleAccess{DBS: dbs}
+	return &ra
+}
+
+// GetRoles finds role values in the database.
+func (ra *RoleAccess) GetRoles(ctx context.Context,
+	opt *RoleFind) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 256)
+
+	go func() {
+		defer close(ch)
+		rows, err := traceQuery(ctx, ra.DBS, `
+			SELECT
+				r.id,
+				r.name,
+				r.description
+			FROM get_roles($1, $2) AS r`,
+			opt.ID,
+			opt.Name)
+		if err != nil {
+			ch <- dlib.Result{Err: err}
+			return
+		}
+
+		defer rows.Close()
+		for rows.Next() {
+			v := Role{}
+			if err := rows.Scan(
+				&v.ID,
+				&v.Name,
+				&v.Description,
+			); err != nil {
+				ch <- dlib.Result{Err: err}
+				continue
+			}
+
+			ch <- dlib.Result{Val: v, Num: 1}
+		}
+	}()
+
+	return ch
+}
+
+// GetRoleByID finds a role value in the database by ID.
+func (ra *RoleAccess) GetRoleByID(ctx context.Context,
+	id int64) <-chan dlib.Result {
+	opt := RoleFind{ID: &id}
+	return ra.GetRoles(ctx, &opt)
+}
+
+// DeleteRoles deletes role values from the database, along with their
+// role_perm and user_role records.
+func (ra *RoleAccess) DeleteRoles(ctx context.Context,
+	opt *RoleFind) <-chan dlib.Result {
+	return ra.count(ctx,
+		"SELECT delete_roles($1, $2) AS num", opt.ID, opt.Name)
+}
+
+// DeleteRoleByID deletes a role value from the database by ID.
+func (ra *RoleAccess) DeleteRoleByID(ctx context.Context,
+	id int64) <-chan dlib.Result {
+	opt := RoleFind{ID: &id}
+	return ra.DeleteRoles(ctx, &opt)
+}
+
+// SaveRole saves a role value to the database.
+func (ra *RoleAccess) SaveRole(ctx context.Context,
+	r *Role) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 256)
+
+	go func() {
+		defer close(ch)
+		id, err := ra.save(ctx, "SELECT save_role($1, $2, $3) AS id",
+			r.ID,
+			r.Name,
+			r.Description)
+		if err != nil {
+			ch <- dlib.Result{Err: err}
+			return
+		}
+
+		r.ID = id
+		ch <- dlib.Result{Val: *r, Err: nil}
+	}()
+
+	return ch
+}
+
+// SaveRoles saves a slice of role values to the database.
+func (ra *RoleAccess) SaveRoles(ctx context.Context,
+	r []Role) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 256)
+
+	go func() {
+		defer close(ch)
+		for i := range r {
+			for sr := range ra.SaveRole(ctx, &r[i]) {
+				ch <- sr
+			}
+		}
+	}()
+
+	return ch
+}
+
+// GetRolePerms finds role_perm values in the database.
+func (ra *RoleAccess) GetRolePerms(ctx context.Context,
+	opt *RolePermFind) <-chan dlib.Result {
+	return ra.rolePerms(ctx, `
+		SELECT
+			rp.id,
+			rp.role_id,
+			rp.perm_id
+		FROM get_role_perms($1, $2, $3) AS rp`,
+		opt.ID,
+		opt.RoleID,
+		opt.PermID)
+}
+
+// DeleteRolePerms deletes role_perm values from the database. Users holding
+// the role lose the perm as soon as it is deleted.
+func (ra *RoleAccess) DeleteRolePerms(ctx context.Context,
+	opt *RolePermFind) <-chan dlib.Result {
+	return ra.count(ctx, "SELECT delete_role_perms($1, $2, $3) AS num",
+		opt.ID,
+		opt.RoleID,
+		opt.PermID)
+}
+
+// SaveRolePerm saves a role_perm value to the database.
+func (ra *RoleAccess) SaveRolePerm(ctx context.Context,
+	rp *RolePerm) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 256)
+
+	go func() {
+		defer close(ch)
+		id, err := ra.save(ctx,
+			"SELECT save_role_perm($1, $2, $3) AS id",
+			rp.ID,
+			rp.RoleID,
+			rp.PermID)
+		if err != nil {
+			ch <- dlib.Result{Err: err}
+			return
+		}
+
+		rp.ID = id
+		ch <- dlib.Result{Val: *rp, Err: nil}
+	}()
+
+	return ch
+}
+
+// GetUserRoles finds user_role values in the database.
+func (ra *RoleAccess) GetUserRoles(ctx context.Context,
+	opt *UserRoleFind) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 256)
+
+	go func() {
+		defer close(ch)
+		rows, err := traceQuery(ctx, ra.DBS, `
+			SELECT
+				ur.id,
+				ur.user_id,
+				ur.role_id
+			FROM get_user_roles($1, $2, $3) AS ur`,
+			opt.ID,
+			opt.UserID,
+			opt.RoleID)
+		if err != nil {
+			ch <- dlib.Result{Err: err}
+			return
+		}
+
+		defer rows.Close()
+		for rows.Next() {
+			v := UserRole{}
+			if err := rows.Scan(
+				&v.ID,
+				&v.UserID,
+				&v.RoleID,
+			); err != nil {
+				ch <- dlib.Result{Err: err}
+				continue
+			}
+
+			ch <- dlib.Result{Val: v, Num: 1}
+		}
+	}()
+
+	return ch
+}
+
+// DeleteUserRoles deletes user_role values from the database.
+func (ra *RoleAccess) DeleteUserRoles(ctx context.Context,
+	opt *UserRoleFind) <-chan dlib.Result {
+	return ra.count(ctx, "SELECT delete_user_roles($1, $2, $3) AS num",
+		opt.ID,
+		opt.UserID,
+		opt.RoleID)
+}
+
+// SaveUserRole saves a user_role value to the database.
+func (ra *RoleAccess) SaveUserRole(ctx context.Context,
+	ur *UserRole) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 256)
+
+	go func() {
+		defer close(ch)
+		id, err := ra.save(ctx,
+			"SELECT save_user_role($1, $2, $3) AS id",
+			ur.ID,
+			ur.UserID,
+			ur.RoleID)
+		if err != nil {
+			ch <- dlib.Result{Err: err}
+			return
+		}
+
+		ur.ID = id
+		ch <- dlib.Result{Val: *ur, Err: nil}
+	}()
+
+	return ch
+}
+
+// GetUserRolePerms finds the role_perm values of all roles held by a user.
+func (ra *RoleAccess) GetUserRolePerms(ctx context.Context,
+	userID int64) <-chan dlib.Result {
+	return ra.rolePerms(ctx, `
+		SELECT
+			rp.id,
+			rp.role_id,
+			rp.perm_id
+		FROM get_user_role_perms($1) AS rp`,
+		userID)
+}
+
+// rolePerms runs a query returning role_perm rows and sends the values.
+func (ra *RoleAccess) rolePerms(ctx context.Context, query string,
+	args ...interface{}) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 256)
+
+	go func() {
+		defer close(ch)
+		rows, err := traceQuery(ctx, ra.DBS, query, args...)
+		if err != nil {
+			ch <- dlib.Result{Err: err}
+			return
+		}
+
+		defer rows.Close()
+		for rows.Next() {
+			v := RolePerm{}
+			if err := rows.Scan(
+				&v.ID,
+				&v.RoleID,
+				&v.PermID,
+			); err != nil {
+				ch <- dlib.Result{Err: err}
+				continue
+			}
+
+			ch <- dlib.Result{Val: v, Num: 1}
+		}
+	}()
+
+	return ch
+}
+
+// save runs a query returning a single id column and returns the id.
+func (ra *RoleAccess) save(ctx context.Context,
+	query string, args ...interface{}) (int64, error) {
+	rows, err := traceQuery(ctx, ra.DBS, query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	defer rows.Close()
+	id := int64(0)
+	for rows.Next() {
+		if err := rows.Scan(&id); err != nil {
+			return 0, err
+		}
+	}
+
+	return id, nil
+}
+
+// count runs a query returning a single count column and sends the total.
+func (ra *RoleAccess) count(ctx context.Context, query string,
+	args ...interface{}) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 256)
+
+	go func() {
+		defer close(ch)
+		rows, err := traceQuery(ctx, ra.DBS, query, args...)
+		if err != nil {
+			ch <- dlib.Result{Err: err}
+			return
+		}
+
+		defer rows.Close()
+		n := 0
+		for rows.Next() {
+			r := struct{ Num int }{Num: 0}
+			if err := rows.Scan(&r.Num); err != nil {
+				ch <- dlib.Result{Err: err}
+				continue
+			}
+
+			n += r.Num
+		}
+
+		ch <- dlib.Result{Num: n, Err: nil}
+	}()
+
+	return ch
+}
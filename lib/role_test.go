@@ -0,0 +1,196 @@
+package lib
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/dhaifley/dlib"
+)
+
+type MockRoleRows struct {
+	row int
+}
+
+func (m *MockRoleRows) Close() error {
+	return nil
+}
+
+func (m *MockRoleRows) Next() bool {
+	m.row++
+	if m.row > 1 {
+		return false
+	}
+
+	return true
+}
+
+func (m *MockRoleRows) Scan(dest ...interface{}) error {
+	for _, d := range dest {
+		switch v := d.(type) {
+		case *int64:
+			*v = int64(1)
+		case *int:
+			*v = 1
+		case *string:
+			*v = "test"
+		default:
+			return dlib.NewError(500, "Invalid type")
+		}
+	}
+
+	return nil
+}
+
+type MockRoleDBSession struct{}
+
+func (m *MockRoleDBSession) Close() error {
+	return nil
+}
+
+func (m *MockRoleDBSession) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return nil, nil
+}
+
+func (m *MockRoleDBSession) Query(query string, args ...interface{}) (dlib.SQLRows, error) {
+	mr := MockRoleRows{}
+	return &mr, nil
+}
+
+func (m *MockRoleDBSession) Ping() error {
+	return nil
+}
+
+func (m *MockRoleDBSession) Stats() sql.DBStats {
+	return sql.DBStats{OpenConnections: 0}
+}
+
+func TestRoleAccessGetRoles(t *testing.T) {
+	ctx := context.Background()
+	ra := NewRoleAccessor(&MockRoleDBSession{})
+	var a []Role
+	for r := range ra.GetRoleByID(ctx, 1) {
+		if r.Err != nil {
+			t.Error(r.Err)
+		}
+
+		if v, ok := r.Val.(Role); ok {
+			a = append(a, v)
+		}
+	}
+
+	if len(a) != 1 || a[0].ID != 1 || a[0].Name != "test" {
+		t.Errorf("Role expected: 1 test, got: %v", a)
+	}
+}
+
+func TestRoleAccessSaveRoles(t *testing.T) {
+	ctx := context.Background()
+	ra := NewRoleAccessor(&MockRoleDBSession{})
+	a := []Role{{Name: "test"}, {Name: "test2"}}
+	n := 0
+	for r := range ra.SaveRoles(ctx, a) {
+		if r.Err != nil {
+			t.Error(r.Err)
+		}
+
+		n++
+	}
+
+	if n != 2 || a[0].ID != 1 || a[1].ID != 1 {
+		t.Errorf("Saved roles expected with ID 1, got: %v", a)
+	}
+}
+
+func TestRoleAccessRolePerms(t *testing.T) {
+	ctx := context.Background()
+	ra := NewRoleAccessor(&MockRoleDBSession{})
+	rp := RolePerm{RoleID: 1, PermID: 1}
+	for r := range ra.SaveRolePerm(ctx, &rp) {
+		if r.Err != nil {
+			t.Error(r.Err)
+		}
+	}
+
+	if rp.ID != 1 {
+		t.Errorf("ID expected: 1, got: %v", rp.ID)
+	}
+
+	id := int64(1)
+	for _, ch := range []<-chan dlib.Result{
+		ra.GetRolePerms(ctx, &RolePermFind{RoleID: &id}),
+		ra.GetUserRolePerms(ctx, 1),
+	} {
+		var a []RolePerm
+		for r := range ch {
+			if r.Err != nil {
+				t.Error(r.Err)
+			}
+
+			if v, ok := r.Val.(RolePerm); ok {
+				a = append(a, v)
+			}
+		}
+
+		if len(a) != 1 || a[0].PermID != 1 {
+			t.Errorf("Role perm expected for perm 1, got: %v", a)
+		}
+	}
+}
+
+func TestRoleAccessUserRoles(t *testing.T) {
+	ctx := context.Background()
+	ra := NewRoleAccessor(&MockRoleDBSession{})
+	ur := UserRole{UserID: 1, RoleID: 1}
+	for r := range ra.SaveUserRole(ctx, &ur) {
+		if r.Err != nil {
+			t.Error(r.Err)
+		}
+	}
+
+	if ur.ID != 1 {
+		t.Errorf("ID expected: 1, got: %v", ur.ID)
+	}
+
+	id := int64(1)
+	var a []UserRole
+	for r := range ra.GetUserRoles(ctx, &UserRoleFind{UserID: &id}) {
+		if r.Err != nil {
+			t.Error(r.Err)
+		}
+
+		if v, ok := r.Val.(UserRole); ok {
+			a = append(a, v)
+		}
+	}
+
+	if len(a) != 1 || a[0].RoleID != 1 {
+		t.Errorf("User role expected for role 1, got: %v", a)
+	}
+}
+
+func TestRoleAccessDeletes(t *testing.T) {
+	ctx := context.Background()
+	ra := NewRoleAccessor(&MockRoleDBSession{})
+	id := int64(1)
+	chs := []<-chan dlib.Result{
+		ra.DeleteRoleByID(ctx, 1),
+		ra.DeleteRolePerms(ctx, &RolePermFind{ID: &id}),
+		ra.DeleteUserRoles(ctx, &UserRoleFind{ID: &id}),
+	}
+
+	for i, ch := range chs {
+		n := 0
+		for r := range ch {
+			if r.Err != nil {
+				t.Error(r.Err)
+			}
+
+			n = r.Num
+		}
+
+		if n != 1 {
+			t.Errorf("Delete count %v expected: 1, got: %v", i, n)
+		}
+	}
+}
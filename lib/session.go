@@ -0,0 +1,235 @@
+package lib
+
+import (
+	"context"
+	"time"
+
+	"github.com/dhaifley/dlib"
+)
+
+// Session values describe where a user logged in. A session lasts as long
+// as the refresh token family started by the login, and its id is the
+// family.
+type Session struct {
+	ID        string     `json:"id"`
+	UserID    int64      `json:"user_id"`
+	Address   string     `json:"address,omitempty"`
+	UserAgent string     `json:"user_agent,omitempty"`
+	Device    string     `json:"device,omitempty"`
+	Created   *time.Time `json:"created,omitempty"`
+	LastUsed  *time.Time `json:"last_used,omitempty"`
+	Expires   *time.Time `json:"expires,omitempty"`
+}
+
+// SessionRow values are used to scan session database rows.
+type SessionRow struct {
+	ID        string
+	UserID    int64
+	Address   string
+	UserAgent string
+	Device    string
+	Created   dlib.NullTime
+	LastUsed  dlib.NullTime
+	Expires   dlib.NullTime
+}
+
+// ToSession converts a SessionRow value into a Session.
+func (r *SessionRow) ToSession() Session {
+	v := Session{
+		ID:        r.ID,
+		UserID:    r.UserID,
+		Address:   r.Address,
+		UserAgent: r.UserAgent,
+		Device:    r.Device,
+	}
+
+	if r.Created.Valid {
+		v.Created = &r.Created.Time
+	}
+
+	if r.LastUsed.Valid {
+		v.LastUsed = &r.LastUsed.Time
+	}
+
+	if r.Expires.Valid {
+		v.Expires = &r.Expires.Time
+	}
+
+	return v
+}
+
+// SessionAccessor is an interface describing values capable of providing
+// access to session records in the database.
+type SessionAccessor interface {
+	GetSessions(ctx context.Context,
+		userID int64, id *string) <-chan dlib.Result
+	SaveSession(ctx context.Context, s *Session) <-chan dlib.Result
+	TouchSession(ctx context.Context,
+		token string, used time.Time) <-chan dlib.Result
+	DeleteOldSessions(ctx context.Context,
+		old time.Time, limit int) <-chan dlib.Result
+}
+
+// SessionAccess values are used to access session records in the database.
+type SessionAccess struct {
+	DBS dlib.SQLExecutor
+}
+
+// NewSessionAccessor creates a new SessionAccess value for database access.
+func NewSessionAccessor(dbs dlib.SQLExecutor) SessionAccessor {
+	sa := SessionAccess{DBS: dbs}
+	return &sa
+}
+
+// GetSessions finds the sessions of a user which have not expired, or only
+// the session with the provided id.
+func (sa *SessionAccess) GetSessions(ctx context.Context, userID int64,
+	id *string) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 256)
+
+	go func() {
+		defer close(ch)
+		rows, err := traceQuery(ctx, sa.DBS, `
+			SELECT
+				s.family,
+				s.user_id,
+				s.address,
+				s.user_agent,
+				s.device,
+				s.created,
+				s.last_used,
+				s.expires
+			FROM get_sessions($1, $2) AS s`,
+			userID,
+			id)
+		if err != nil {
+			ch <- dlib.Result{Err: err}
+			return
+		}
+
+		defer rows.Close()
+		for rows.Next() {
+			r := SessionRow{}
+			if err := rows.Scan(&r.ID, &r.UserID, &r.Address, &r.UserAgent,
+				&r.Device, &r.Created, &r.LastUsed,
+				&r.Expires); err != nil {
+				ch <- dlib.Result{Err: err}
+				continue
+			}
+
+			v := r.ToSession()
+			ch <- dlib.Result{Val: v, Num: 1}
+		}
+	}()
+
+	return ch
+}
+
+// SaveSession saves the client details of a session in the database.
+func (sa *SessionAccess) SaveSession(ctx context.Context,
+	s *Session) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 256)
+
+	go func() {
+		defer close(ch)
+		rows, err := traceQuery(ctx, sa.DBS,
+			"SELECT save_session($1, $2, $3, $4, $5, $6) AS num",
+			s.ID,
+			s.UserID,
+			s.Address,
+			s.UserAgent,
+			s.Device,
+			s.Created)
+		if err != nil {
+			ch <- dlib.Result{Err: err}
+			return
+		}
+
+		defer rows.Close()
+		n := 0
+		for rows.Next() {
+			r := struct{ Num int }{Num: 0}
+			if err := rows.Scan(&r.Num); err != nil {
+				ch <- dlib.Result{Err: err}
+				continue
+			}
+
+			n += r.Num
+		}
+
+		ch <- dlib.Result{Val: *s, Num: n}
+	}()
+
+	return ch
+}
+
+// TouchSession records that the session an access token was issued in was
+// used at the provided time.
+func (sa *SessionAccess) TouchSession(ctx context.Context, token string,
+	used time.Time) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 256)
+
+	go func() {
+		defer close(ch)
+		rows, err := traceQuery(ctx, sa.DBS,
+			"SELECT touch_session($1, $2) AS num",
+			token,
+			used)
+		if err != nil {
+			ch <- dlib.Result{Err: err}
+			return
+		}
+
+		defer rows.Close()
+		n := 0
+		for rows.Next() {
+			r := struct{ Num int }{Num: 0}
+			if err := rows.Scan(&r.Num); err != nil {
+				ch <- dlib.Result{Err: err}
+				continue
+			}
+
+			n += r.Num
+		}
+
+		ch <- dlib.Result{Num: n, Err: nil}
+	}()
+
+	return ch
+}
+
+// DeleteOldSessions deletes at most limit sessions created before old which
+// have no refresh token expiring after old, and returns the number deleted.
+func (sa *SessionAccess) DeleteOldSessions(ctx context.Context,
+	old time.Time,
+	limit int) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 256)
+
+	go func() {
+		defer close(ch)
+		rows, err := traceQuery(ctx, sa.DBS,
+			"SELECT delete_old_sessions($1, $2) AS num",
+			old,
+			limit)
+		if err != nil {
+			ch <- dlib.Result{Err: err}
+			return
+		}
+
+		defer rows.Close()
+		n := 0
+		for rows.Next() {
+			r := struct{ Num int }{Num: 0}
+			if err := rows.Scan(&r.Num); err != nil {
+				ch <- dlib.Result{Err: err}
+				continue
+			}
+
+			n += r.Num
+		}
+
+		ch <- dlib.Result{Num: n, Err: nil}
+	}()
+
+	return ch
+}
@@ -0,0 +1,121 @@
+package lib
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/dhaifley/dlib"
+)
+
+type MockSessionRows struct {
+	row int
+}
+
+func (m *MockSessionRows) Close() error {
+	return nil
+}
+
+func (m *MockSessionRows) Next() bool {
+	m.row++
+	if m.row > 1 {
+		return false
+	}
+
+	return true
+}
+
+func (m *MockSessionRows) Scan(dest ...interface{}) error {
+	for _, d := range dest {
+		switch v := d.(type) {
+		case *int64:
+			*v = 1
+		case *int:
+			*v = 1
+		case *string:
+			*v = "test"
+		case *dlib.NullTime:
+			dt := time.Date(2083, 2, 2, 0, 0, 0, 0, time.Local)
+			*v = dlib.NullTime{Time: dt, Valid: true}
+		default:
+			return dlib.NewError(500, "Invalid type")
+		}
+	}
+
+	return nil
+}
+
+type MockSessionDBSession struct{}
+
+func (m *MockSessionDBSession) Close() error {
+	return nil
+}
+
+func (m *MockSessionDBSession) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return nil, nil
+}
+
+func (m *MockSessionDBSession) Query(query string, args ...interface{}) (dlib.SQLRows, error) {
+	mr := MockSessionRows{}
+	return &mr, nil
+}
+
+func (m *MockSessionDBSession) Ping() error {
+	return nil
+}
+
+func (m *MockSessionDBSession) Stats() sql.DBStats {
+	return sql.DBStats{OpenConnections: 0}
+}
+
+func TestSessionAccess(t *testing.T) {
+	ctx := context.Background()
+	sa := NewSessionAccessor(&MockSessionDBSession{})
+	id := "test"
+	var a []Session
+	for r := range sa.GetSessions(ctx, 1, &id) {
+		if r.Err != nil {
+			t.Error(r.Err)
+		}
+
+		if v, ok := r.Val.(Session); ok {
+			a = append(a, v)
+		}
+	}
+
+	if len(a) != 1 || a[0].ID != "test" || a[0].UserAgent != "test" ||
+		a[0].LastUsed == nil || a[0].Expires == nil {
+		t.Errorf("Session expected: test, got: %+v", a)
+	}
+
+	for r := range sa.SaveSession(ctx, &a[0]) {
+		if r.Err != nil {
+			t.Error(r.Err)
+		}
+
+		if r.Num != 1 {
+			t.Errorf("Saved expected: 1, got: %v", r.Num)
+		}
+	}
+
+	for r := range sa.TouchSession(ctx, "test", time.Now()) {
+		if r.Err != nil {
+			t.Error(r.Err)
+		}
+
+		if r.Num != 1 {
+			t.Errorf("Touched expected: 1, got: %v", r.Num)
+		}
+	}
+
+	for r := range sa.DeleteOldSessions(ctx, time.Now(), 10) {
+		if r.Err != nil {
+			t.Error(r.Err)
+		}
+
+		if r.Num != 1 {
+			t.Errorf("Deleted expected: 1, got: %v", r.Num)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package lib
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// Default login throttling settings.
+const (
+	DefaultLoginThreshold = 5
+	DefaultLoginDelay     = time.Second
+	DefaultLoginLockout   = 15 * time.Minute
+)
+
+// LoginThrottle values limit failed login attempts. Each failed login for a
+// key doubles the time before the next attempt is allowed, starting from
+// Delay. Once Threshold failures are counted the key is locked out until
+// Lockout has passed since the last failure. Attempts are counted as failures
+// when they are allowed, and released if they succeed, so that concurrent
+// attempts can not all pass the same check.
+type LoginThrottle struct {
+	Failures  LoginFailureAccessor
+	Threshold int
+	Delay     time.Duration
+	Lockout   time.Duration
+}
+
+// NewLoginThrottle creates a new LoginThrottle value using a login failure
+// store. Zero settings are replaced by the defaults.
+func NewLoginThrottle(lfa LoginFailureAccessor, threshold int,
+	delay, lockout time.Duration) *LoginThrottle {
+	if threshold <= 0 {
+		threshold = DefaultLoginThreshold
+	}
+
+	if delay <= 0 {
+		delay = DefaultLoginDelay
+	}
+
+	if lockout <= 0 {
+		lockout = DefaultLoginLockout
+	}
+
+	lt := LoginThrottle{
+		Failures:  lfa,
+		Threshold: threshold,
+		Delay:     delay,
+		Lockout:   lockout,
+	}
+
+	return &lt
+}
+
+// Wait returns how long the caller must wait before another login attempt
+// is allowed for the provided keys, and whether any key is locked out. When
+// no wait is needed the attempt is counted as a failure for each key, and
+// must be released with Release unless it fails.
+func (lt *LoginThrottle) Wait(ctx context.Context,
+	keys ...string) (time.Duration, bool, error) {
+	var wait time.Duration
+	locked := false
+	counts := make([]int, len(keys))
+	now := time.Now()
+	for i, k := range keys {
+		for r := range lt.Failures.GetLoginFailure(ctx, k) {
+			if r.Err != nil {
+				return 0, false, r.Err
+			}
+
+			v, ok := r.Val.(LoginFailure)
+			if !ok || v.Last == nil || v.Count == 0 ||
+				now.Sub(*v.Last) > lt.Lockout {
+				continue
+			}
+
+			counts[i] = v.Count
+			d, l := lt.backoff(v.Count)
+			w := v.Last.Add(d).Sub(now)
+			if w > wait {
+				wait = w
+			}
+
+			if w > 0 && l {
+				locked = true
+			}
+		}
+	}
+
+	if wait > 0 {
+		return wait, locked, nil
+	}
+
+	for i, k := range keys {
+		n := 0
+		for r := range lt.Failures.AddLoginFailure(ctx, k, lt.Lockout) {
+			if r.Err != nil {
+				lt.Release(ctx, keys[:i]...)
+				return 0, false, r.Err
+			}
+
+			if v, ok := r.Val.(LoginFailure); ok {
+				n = v.Count
+			}
+		}
+
+		// Another attempt was counted after the failures were read, so this
+		// one must wait for it.
+		if n > counts[i]+1 {
+			if err := lt.Release(ctx, keys[:i+1]...); err != nil {
+				return 0, false, err
+			}
+
+			wait, locked = lt.backoff(n - 1)
+			return wait, locked, nil
+		}
+	}
+
+	return 0, false, nil
+}
+
+// Release uncounts an attempt allowed by Wait for the provided keys, when it
+// did not fail.
+func (lt *LoginThrottle) Release(ctx context.Context, keys ...string) error {
+	for _, k := range keys {
+		for r := range lt.Failures.RemoveLoginFailure(ctx, k) {
+			if r.Err != nil {
+				return r.Err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Reset clears the failed login attempts counted for the provided keys,
+// returning the number of keys which had failures.
+func (lt *LoginThrottle) Reset(ctx context.Context,
+	keys ...string) (int, error) {
+	n := 0
+	for _, k := range keys {
+		for r := range lt.Failures.DeleteLoginFailures(ctx, k) {
+			if r.Err != nil {
+				return n, r.Err
+			}
+
+			n += r.Num
+		}
+	}
+
+	return n, nil
+}
+
+// backoff returns the time to wait after count failures, and whether the
+// wait is a lockout.
+func (lt *LoginThrottle) backoff(count int) (time.Duration, bool) {
+	if count >= lt.Threshold {
+		return lt.Lockout, true
+	}
+
+	d := lt.Delay
+	for i := 1; i < count && d < lt.Lockout; i++ {
+		d *= 2
+	}
+
+	if d > lt.Lockout {
+		d = lt.Lockout
+	}
+
+	return d, false
+}
+
+// LoginUserKey returns the throttling key for a user name.
+func LoginUserKey(user string) string {
+	return "user:" + user
+}
+
+// LoginPeerKey returns the throttling key for a client address.
+func LoginPeerKey(addr string) string {
+	return "peer:" + addr
+}
+
+// LoginMFAKey returns the throttling key for two-factor authentication codes
+// entered for a user.
+func LoginMFAKey(userID int64) string {
+	return "mfa:" + strconv.FormatInt(userID, 10)
+}
@@ -0,0 +1,131 @@
+package lib
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLoginThrottle(t *testing.T) {
+	ctx := context.Background()
+	lt := NewLoginThrottle(NewMemLoginFailureAccessor(), 3,
+		time.Minute, time.Hour)
+	if w, _, err := lt.Wait(ctx, "user:test", "peer:test"); err != nil ||
+		w != 0 {
+		t.Fatalf("Expected no wait, got: %v, %v", w, err)
+	}
+
+	w, locked, err := lt.Wait(ctx, "user:test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if w <= 0 || w > time.Minute || locked {
+		t.Errorf("Expected backoff of up to 1m, got: %v, %v", w, locked)
+	}
+
+	for r := range lt.Failures.AddLoginFailure(ctx, "user:test", time.Hour) {
+		if r.Err != nil {
+			t.Fatal(r.Err)
+		}
+	}
+
+	if w, _, _ := lt.Wait(ctx, "user:test"); w <= time.Minute {
+		t.Errorf("Expected backoff to double, got: %v", w)
+	}
+
+	for r := range lt.Failures.AddLoginFailure(ctx, "user:test", time.Hour) {
+		if r.Err != nil {
+			t.Fatal(r.Err)
+		}
+	}
+
+	if w, locked, _ := lt.Wait(ctx, "user:test"); !locked ||
+		w <= 59*time.Minute {
+		t.Errorf("Expected lockout, got: %v, %v", w, locked)
+	}
+
+	n, err := lt.Reset(ctx, "user:test")
+	if err != nil || n != 1 {
+		t.Errorf("Reset count expected: 1, got: %v, %v", n, err)
+	}
+
+	if w, _, _ := lt.Wait(ctx, "user:test"); w != 0 {
+		t.Errorf("Expected no wait after reset, got: %v", w)
+	}
+
+	if err := lt.Release(ctx, "user:test"); err != nil {
+		t.Fatal(err)
+	}
+
+	if w, _, _ := lt.Wait(ctx, "user:test"); w != 0 {
+		t.Errorf("Expected no wait after release, got: %v", w)
+	}
+
+	if w, _, _ := lt.Wait(ctx, "user:test", "peer:test"); w <= 0 {
+		t.Errorf("Expected peer backoff to remain, got: %v", w)
+	}
+}
+
+func TestLoginThrottleLocked(t *testing.T) {
+	ctx := context.Background()
+	mfa := &MemLoginFailureAccess{failures: map[string]LoginFailure{}}
+	lt := NewLoginThrottle(mfa, 3, time.Minute, time.Hour)
+	now := time.Now()
+	last := now.Add(-59 * time.Minute)
+	mfa.failures["user:test"] = LoginFailure{
+		Key: "user:test", Count: 3, Last: &last,
+	}
+
+	mfa.failures["peer:test"] = LoginFailure{
+		Key: "peer:test", Count: 2, Last: &now,
+	}
+
+	w, locked, err := lt.Wait(ctx, "user:test", "peer:test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !locked || w <= time.Minute {
+		t.Errorf("Expected lockout and backoff over 1m, got: %v, %v",
+			w, locked)
+	}
+}
+
+func TestLoginThrottleConcurrent(t *testing.T) {
+	ctx := context.Background()
+	lt := NewLoginThrottle(NewMemLoginFailureAccessor(), 3,
+		time.Minute, time.Hour)
+	var allowed int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w, _, err := lt.Wait(ctx, "user:test", "peer:test")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			if w == 0 {
+				atomic.AddInt32(&allowed, 1)
+			}
+		}()
+	}
+
+	wg.Wait()
+	if allowed != 1 {
+		t.Errorf("Allowed attempts expected: 1, got: %v", allowed)
+	}
+
+	for _, k := range []string{"user:test", "peer:test"} {
+		for r := range lt.Failures.GetLoginFailure(ctx, k) {
+			if v := r.Val.(LoginFailure); v.Count != 1 {
+				t.Errorf("Count of %v expected: 1, got: %v", k, v.Count)
+			}
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package lib
 
 import (
+	"context"
+	"time"
+
 	"github.com/dhaifley/dlib"
 	"github.com/dhaifley/dlib/dauth"
 )
@@ -13,12 +16,15 @@ type TokenAccess struct {
 // TokenAccessor is an interface describing values capable of providing
 // access to token records in the database.
 type TokenAccessor interface {
-	GetTokens(opt *dauth.TokenFind) <-chan dlib.Result
-	GetTokenByID(id int64) <-chan dlib.Result
-	DeleteTokens(opt *dauth.TokenFind) <-chan dlib.Result
-	DeleteTokenByID(id int64) <-chan dlib.Result
-	SaveToken(t *dauth.Token) <-chan dlib.Result
-	SaveTokens(t []dauth.Token) <-chan dlib.Result
+	GetTokens(ctx context.Context, opt *dauth.TokenFind) <-chan dlib.Result
+	GetTokenByID(ctx context.Context, id int64) <-chan dlib.Result
+	DeleteTokens(ctx context.Context,
+		opt *dauth.TokenFind) <-chan dlib.Result
+	DeleteTokenByID(ctx context.Context, id int64) <-chan dlib.Result
+	DeleteOldTokens(ctx context.Context,
+		old time.Time, limit int) <-chan dlib.Result
+	SaveToken(ctx context.Context, t *dauth.Token) <-chan dlib.Result
+	SaveTokens(ctx context.Context, t []dauth.Token) <-chan dlib.Result
 }
 
 // NewTokenAccessor creates a new TokenAccess value for database access.
@@ -28,12 +34,13 @@ func NewTokenAccessor(dbs dlib.SQLExecutor) TokenAccessor {
 }
 
 // GetTokens finds token values in the database.
-func (ta *TokenAccess) GetTokens(opt *dauth.TokenFind) <-chan dlib.Result {
+func (ta *TokenAccess) GetTokens(ctx context.Context,
+	opt *dauth.TokenFind) <-chan dlib.Result {
 	ch := make(chan dlib.Result, 256)
 
 	go func() {
 		defer close(ch)
-		rows, err := ta.DBS.Query(`
+		rows, err := traceQuery(ctx, ta.DBS, `
 			SELECT
 				t.id,
 				t.token,
@@ -77,18 +84,20 @@ func (ta *TokenAccess) GetTokens(opt *dauth.TokenFind) <-chan dlib.Result {
 }
 
 // GetTokenByID finds a Token value in the database by ID.
-func (ta *TokenAccess) GetTokenByID(id int64) <-chan dlib.Result {
+func (ta *TokenAccess) GetTokenByID(ctx context.Context,
+	id int64) <-chan dlib.Result {
 	opt := dauth.TokenFind{ID: &id}
-	return ta.GetTokens(&opt)
+	return ta.GetTokens(ctx, &opt)
 }
 
 // DeleteTokens deletes Token values from the database.
-func (ta *TokenAccess) DeleteTokens(opt *dauth.TokenFind) <-chan dlib.Result {
+func (ta *TokenAccess) DeleteTokens(ctx context.Context,
+	opt *dauth.TokenFind) <-chan dlib.Result {
 	ch := make(chan dlib.Result, 256)
 
 	go func() {
 		defer close(ch)
-		rows, err := ta.DBS.Query(
+		rows, err := traceQuery(ctx, ta.DBS,
 			"SELECT delete_tokens($1, $2, $3, $4, $5, $6, $7, $8) AS num",
 			opt.ID,
 			opt.Token,
@@ -122,18 +131,55 @@ func (ta *TokenAccess) DeleteTokens(opt *dauth.TokenFind) <-chan dlib.Result {
 }
 
 // DeleteTokenByID deletes a Token value from the database by ID.
-func (ta *TokenAccess) DeleteTokenByID(id int64) <-chan dlib.Result {
+func (ta *TokenAccess) DeleteTokenByID(ctx context.Context,
+	id int64) <-chan dlib.Result {
 	opt := dauth.TokenFind{ID: &id}
-	return ta.DeleteTokens(&opt)
+	return ta.DeleteTokens(ctx, &opt)
+}
+
+// DeleteOldTokens deletes at most limit Token values which expired before
+// old from the database, so large backlogs can be removed in batches.
+func (ta *TokenAccess) DeleteOldTokens(ctx context.Context, old time.Time,
+	limit int) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 256)
+
+	go func() {
+		defer close(ch)
+		rows, err := traceQuery(ctx, ta.DBS,
+			"SELECT delete_old_tokens($1, $2) AS num",
+			old,
+			limit)
+		if err != nil {
+			ch <- dlib.Result{Err: err}
+			return
+		}
+
+		defer rows.Close()
+		n := 0
+		for rows.Next() {
+			r := struct{ Num int }{Num: 0}
+			if err := rows.Scan(&r.Num); err != nil {
+				ch <- dlib.Result{Err: err}
+				continue
+			}
+
+			n += r.Num
+		}
+
+		ch <- dlib.Result{Num: n, Err: nil}
+	}()
+
+	return ch
 }
 
 // SaveToken saves a Token value to the database.
-func (ta *TokenAccess) SaveToken(t *dauth.Token) <-chan dlib.Result {
+func (ta *TokenAccess) SaveToken(ctx context.Context,
+	t *dauth.Token) <-chan dlib.Result {
 	ch := make(chan dlib.Result, 256)
 
 	go func() {
 		defer close(ch)
-		rows, err := ta.DBS.Query(
+		rows, err := traceQuery(ctx, ta.DBS,
 			"SELECT save_token($1, $2, $3, $4, $5) AS id",
 			t.ID,
 			t.Token,
@@ -163,14 +209,15 @@ func (ta *TokenAccess) SaveToken(t *dauth.Token) <-chan dlib.Result {
 }
 
 // SaveTokens saves a slice of Token values to the database.
-func (ta *TokenAccess) SaveTokens(t []dauth.Token) <-chan dlib.Result {
+func (ta *TokenAccess) SaveTokens(ctx context.Context,
+	t []dauth.Token) <-chan dlib.Result {
 	ch := make(chan dlib.Result, 256)
 
 	go func() {
 		defer close(ch)
 		if t != nil {
 			for _, v := range t {
-				for sr := range ta.SaveToken(&v) {
+				for sr := range ta.SaveToken(ctx, &v) {
 					ch <- sr
 				}
 			}
@@ -0,0 +1,67 @@
+package lib
+
+import (
+	"context"
+	"github.com/dhaifley/dlib"
+)
+
+// TokenStats values count the tokens and sessions which have not expired.
+type TokenStats struct {
+	Tokens        int64 `json:"tokens"`
+	RefreshTokens int64 `json:"refresh_tokens"`
+	Sessions      int64 `json:"sessions"`
+}
+
+// TokenStatsAccessor is an interface describing values capable of counting
+// the active tokens in the database.
+type TokenStatsAccessor interface {
+	GetTokenStats(ctx context.Context) <-chan dlib.Result
+}
+
+// TokenStatsAccess values are used to count the active tokens in the
+// database.
+type TokenStatsAccess struct {
+	DBS dlib.SQLExecutor
+}
+
+// NewTokenStatsAccessor creates a new TokenStatsAccess value for database
+// access.
+func NewTokenStatsAccessor(dbs dlib.SQLExecutor) TokenStatsAccessor {
+	ta := TokenStatsAccess{DBS: dbs}
+	return &ta
+}
+
+// GetTokenStats counts the access tokens, unused refresh tokens and
+// sessions which have not expired.
+func (ta *TokenStatsAccess) GetTokenStats(
+	ctx context.Context) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 256)
+
+	go func() {
+		defer close(ch)
+		rows, err := traceQuery(ctx, ta.DBS, `
+			SELECT
+				s.tokens,
+				s.refresh_tokens,
+				s.sessions
+			FROM get_token_stats() AS s`)
+		if err != nil {
+			ch <- dlib.Result{Err: err}
+			return
+		}
+
+		defer rows.Close()
+		for rows.Next() {
+			v := TokenStats{}
+			if err := rows.Scan(&v.Tokens, &v.RefreshTokens,
+				&v.Sessions); err != nil {
+				ch <- dlib.Result{Err: err}
+				continue
+			}
+
+			ch <- dlib.Result{Val: v, Num: 1}
+		}
+	}()
+
+	return ch
+}
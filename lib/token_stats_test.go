@@ -0,0 +1,82 @@
+package lib
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/dhaifley/dlib"
+)
+
+type MockTokenStatsRows struct {
+	row int
+}
+
+func (m *MockTokenStatsRows) Close() error {
+	return nil
+}
+
+func (m *MockTokenStatsRows) Next() bool {
+	m.row++
+	if m.row > 1 {
+		return false
+	}
+
+	return true
+}
+
+func (m *MockTokenStatsRows) Scan(dest ...interface{}) error {
+	for i, d := range dest {
+		switch v := d.(type) {
+		case *int64:
+			*v = int64(i + 1)
+		default:
+			return dlib.NewError(500, "Invalid type")
+		}
+	}
+
+	return nil
+}
+
+type MockTokenStatsDBSession struct{}
+
+func (m *MockTokenStatsDBSession) Close() error {
+	return nil
+}
+
+func (m *MockTokenStatsDBSession) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return nil, nil
+}
+
+func (m *MockTokenStatsDBSession) Query(query string, args ...interface{}) (dlib.SQLRows, error) {
+	mr := MockTokenStatsRows{}
+	return &mr, nil
+}
+
+func (m *MockTokenStatsDBSession) Ping() error {
+	return nil
+}
+
+func (m *MockTokenStatsDBSession) Stats() sql.DBStats {
+	return sql.DBStats{OpenConnections: 0}
+}
+
+func TestTokenStatsAccess(t *testing.T) {
+	ctx := context.Background()
+	ta := NewTokenStatsAccessor(&MockTokenStatsDBSession{})
+	var a []TokenStats
+	for r := range ta.GetTokenStats(ctx) {
+		if r.Err != nil {
+			t.Error(r.Err)
+		}
+
+		if v, ok := r.Val.(TokenStats); ok {
+			a = append(a, v)
+		}
+	}
+
+	exp := TokenStats{Tokens: 1, RefreshTokens: 2, Sessions: 3}
+	if len(a) != 1 || a[0] != exp {
+		t.Errorf("Token stats expected: %+v, got: %+v", exp, a)
+	}
+}
@@ -1,7 +1,13 @@
 package lib
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -121,11 +127,12 @@ func TestNewTokenAccessor(t *testing.T) {
 }
 
 func TestTokenAccessGetTokens(t *testing.T) {
+	ctx := context.Background()
 	mdbs := MockTokenDBSession{}
 	ma := NewTokenAccessor(&mdbs)
 	var as []dauth.Token
 	id := int64(1)
-	c := ma.GetTokens(&dauth.TokenFind{ID: &id})
+	c := ma.GetTokens(ctx, &dauth.TokenFind{ID: &id})
 	for r := range c {
 		if r.Err != nil {
 			t.Error(r.Err)
@@ -146,10 +153,11 @@ func TestTokenAccessGetTokens(t *testing.T) {
 }
 
 func TestTokenAccessGetTokenByID(t *testing.T) {
+	ctx := context.Background()
 	mdbs := MockTokenDBSession{}
 	ma := NewTokenAccessor(&mdbs)
 	var a dauth.Token
-	c := ma.GetTokenByID(1)
+	c := ma.GetTokenByID(ctx, 1)
 	for r := range c {
 		if r.Err != nil {
 			t.Error(r.Err)
@@ -170,9 +178,10 @@ func TestTokenAccessGetTokenByID(t *testing.T) {
 }
 
 func TestTokenAccessDeleteTokenByID(t *testing.T) {
+	ctx := context.Background()
 	mdbs := MockTokenDBSession{}
 	ma := NewTokenAccessor(&mdbs)
-	c := ma.DeleteTokenByID(1)
+	c := ma.DeleteTokenByID(ctx, 1)
 	var n int
 	for r := range c {
 		if r.Err != nil {
@@ -189,10 +198,31 @@ func TestTokenAccessDeleteTokenByID(t *testing.T) {
 }
 
 func TestTokenAccessDeleteTokens(t *testing.T) {
+	ctx := context.Background()
 	mdbs := MockTokenDBSession{}
 	ma := NewTokenAccessor(&mdbs)
 	id := int64(1)
-	c := ma.DeleteTokens(&dauth.TokenFind{ID: &id})
+	c := ma.DeleteTokens(ctx, &dauth.TokenFind{ID: &id})
+	var n int
+	for r := range c {
+		if r.Err != nil {
+			t.Error(r.Err)
+		}
+
+		n = r.Num
+	}
+
+	expected := 1
+	if n != expected {
+		t.Errorf("Delete count expected: %v, got: %v", expected, n)
+	}
+}
+
+func TestTokenAccessDeleteOldTokens(t *testing.T) {
+	ctx := context.Background()
+	mdbs := MockTokenDBSession{}
+	ma := NewTokenAccessor(&mdbs)
+	c := ma.DeleteOldTokens(ctx, time.Now(), 100)
 	var n int
 	for r := range c {
 		if r.Err != nil {
@@ -209,10 +239,11 @@ func TestTokenAccessDeleteTokens(t *testing.T) {
 }
 
 func TestTokenAccessSaveToken(t *testing.T) {
+	ctx := context.Background()
 	a := dauth.Token{ID: 1}
 	mdbs := MockTokenDBSession{}
 	ma := NewTokenAccessor(&mdbs)
-	c := ma.SaveToken(&a)
+	c := ma.SaveToken(ctx, &a)
 	for r := range c {
 		if r.Err != nil {
 			t.Error(r.Err)
@@ -233,10 +264,11 @@ func TestTokenAccessSaveToken(t *testing.T) {
 }
 
 func TestTokenAccessSaveTokens(t *testing.T) {
+	ctx := context.Background()
 	a := []dauth.Token{dauth.Token{ID: 1}}
 	mdbs := MockTokenDBSession{}
 	ma := NewTokenAccessor(&mdbs)
-	c := ma.SaveTokens(a)
+	c := ma.SaveTokens(ctx, a)
 	for r := range c {
 		if r.Err != nil {
 			t.Error(r.Err)
@@ -248,3 +280,71 @@ func TestTokenAccessSaveTokens(t *testing.T) {
 		t.Errorf("ID expected: %v, got: %v", expected, a[0].ID)
 	}
 }
+
+// MockSchemaTokenDBSession rejects saved tokens longer than the token
+// column of the schema, as Postgres does.
+type MockSchemaTokenDBSession struct {
+	MockTokenDBSession
+	Width int
+}
+
+func (m *MockSchemaTokenDBSession) Query(query string,
+	args ...interface{}) (dlib.SQLRows, error) {
+	if ts, ok := args[1].(string); ok && m.Width > 0 && len(ts) > m.Width {
+		return nil, dlib.NewError(500, fmt.Sprintf(
+			"value too long for type character varying(%d)", m.Width))
+	}
+
+	return m.MockTokenDBSession.Query(query, args...)
+}
+
+// tokenColumnWidth returns the maximum length of the token column of the
+// token table in the schema, or zero when it is unbounded.
+func tokenColumnWidth(t *testing.T) int {
+	b, err := ioutil.ReadFile("../sql/migrations.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := string(b)
+	s = s[strings.Index(s, "CREATE TABLE public.token\n"):]
+	m := regexp.MustCompile(`\n    token character varying(\((\d+)\))?`).
+		FindStringSubmatch(s)
+	if m == nil {
+		t.Fatal("token column not found")
+	}
+
+	w, _ := strconv.Atoi(m[2])
+	return w
+}
+
+func TestSaveTokenLength(t *testing.T) {
+	kr, err := NewKeyRingFromConfig([]KeyConfig{
+		{ID: "2018-09", Alg: "RS256", Secret: testPEMKey(t, "RS256")},
+	}, "2018-09", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	tc, err := NewTokenClaims("test.user@example.com", 1234567,
+		"https://auth.example.com", "https://api.example.com", now,
+		now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts, err := kr.Sign(tc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ta := NewTokenAccessor(&MockSchemaTokenDBSession{
+		Width: tokenColumnWidth(t)})
+	for r := range ta.SaveToken(context.Background(),
+		&dauth.Token{Token: ts, UserID: 1234567}) {
+		if r.Err != nil {
+			t.Errorf("Token of length %v not saved: %v", len(ts), r.Err)
+		}
+	}
+}
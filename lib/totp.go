@@ -0,0 +1,135 @@
+package lib
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP settings, which are the defaults of RFC 6238 and are understood by
+// all common authenticator apps.
+const (
+	TOTPDigits = 6
+	TOTPPeriod = 30 * time.Second
+	TOTPSkew   = 1
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewTOTPSecret creates a new random base32 encoded TOTP secret.
+func NewTOTPSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return totpEncoding.EncodeToString(b), nil
+}
+
+// TOTPStep returns the TOTP time step containing t.
+func TOTPStep(t time.Time) int64 {
+	return t.Unix() / int64(TOTPPeriod/time.Second)
+}
+
+// TOTPCode returns the TOTP code for a base32 encoded secret at a time step.
+func TOTPCode(secret string, step int64) (string, error) {
+	key, err := totpEncoding.DecodeString(
+		strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil {
+		return "", err
+	}
+
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(step))
+	h := hmac.New(sha1.New, key)
+	h.Write(msg)
+	sum := h.Sum(nil)
+	off := sum[len(sum)-1] & 0x0f
+	v := binary.BigEndian.Uint32(sum[off:off+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < TOTPDigits; i++ {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", TOTPDigits, v%mod), nil
+}
+
+// ValidateTOTP checks a TOTP code against a secret, allowing TOTPSkew time
+// steps of clock difference either side of t. It returns the time step the
+// code matched, so that callers can refuse to accept it again.
+func ValidateTOTP(secret, code string, t time.Time) (int64, bool, error) {
+	if len(code) != TOTPDigits {
+		return 0, false, nil
+	}
+
+	now := TOTPStep(t)
+	var step int64
+	ok := false
+	for s := now - TOTPSkew; s <= now+TOTPSkew; s++ {
+		c, err := TOTPCode(secret, s)
+		if err != nil {
+			return 0, false, err
+		}
+
+		if subtle.ConstantTimeCompare([]byte(c), []byte(code)) == 1 {
+			step = s
+			ok = true
+		}
+	}
+
+	return step, ok, nil
+}
+
+// TOTPURI returns the otpauth URI used to provision a TOTP secret in an
+// authenticator app, usually by rendering it as a QR code.
+func TOTPURI(issuer, account, secret string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", issuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprint(TOTPDigits))
+	v.Set("period", fmt.Sprint(int(TOTPPeriod/time.Second)))
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: v.Encode(),
+	}
+
+	return u.String()
+}
+
+// NewRecoveryCodes creates n random single use recovery codes.
+func NewRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, n)
+	for i := range codes {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+
+		c := strings.ToLower(totpEncoding.EncodeToString(b))
+		codes[i] = c[:4] + "-" + c[4:]
+	}
+
+	return codes, nil
+}
+
+// NormalizeRecoveryCode returns a recovery code in the form in which it is
+// hashed for storage, ignoring case, spaces and dashes.
+func NormalizeRecoveryCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+
+		return r
+	}, strings.ToLower(code))
+}
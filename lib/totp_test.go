@@ -0,0 +1,89 @@
+package lib
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the base32 encoding of the RFC 6238 SHA1 test secret.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	cases := []struct {
+		time int64
+		exp  string
+	}{
+		{time: 59, exp: "287082"},
+		{time: 1111111109, exp: "081804"},
+		{time: 1234567890, exp: "005924"},
+		{time: 20000000000, exp: "353130"},
+	}
+
+	for _, c := range cases {
+		code, err := TOTPCode(rfcSecret, TOTPStep(time.Unix(c.time, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if code != c.exp {
+			t.Errorf("Code at %v expected: %v, got: %v", c.time, c.exp, code)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+	step, ok, err := ValidateTOTP(rfcSecret, "081804", now.Add(TOTPPeriod))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ok || step != TOTPStep(now) {
+		t.Errorf("Expected code to match step %v, got: %v, %v",
+			TOTPStep(now), step, ok)
+	}
+
+	if _, ok, _ := ValidateTOTP(rfcSecret, "081804",
+		now.Add(3*TOTPPeriod)); ok {
+		t.Error("Expected code outside of skew to be rejected")
+	}
+
+	if _, ok, _ := ValidateTOTP(rfcSecret, "bad", now); ok {
+		t.Error("Expected invalid code to be rejected")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	s, err := NewTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uri := TOTPURI("dauth", "test", s)
+	if !strings.HasPrefix(uri, "otpauth://totp/dauth:test?") ||
+		!strings.Contains(uri, "secret="+s) {
+		t.Errorf("Invalid provisioning URI: %v", uri)
+	}
+}
+
+func TestNewRecoveryCodes(t *testing.T) {
+	codes, err := NewRecoveryCodes(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := map[string]bool{}
+	for _, c := range codes {
+		if len(c) != 9 || seen[c] {
+			t.Errorf("Invalid recovery code: %v", c)
+		}
+
+		seen[c] = true
+	}
+
+	if NormalizeRecoveryCode("ABCD-EFGH") != "abcdefgh" {
+		t.Errorf("Invalid normalized code: %v",
+			NormalizeRecoveryCode("ABCD-EFGH"))
+	}
+}
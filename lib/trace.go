@@ -0,0 +1,80 @@
+package lib
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/dhaifley/dlib"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName is the name of the OpenTelemetry tracer of the accessors.
+const TracerName = "github.com/dhaifley/dauth/lib"
+
+// sqlFunctionRE matches the name of the SQL function called by a query.
+var sqlFunctionRE = regexp.MustCompile(`([a-z_]+)\(`)
+
+// traceQuery calls a SQL function within a span named after the function.
+// The span ends when the rows are closed, or at once when the query fails.
+func traceQuery(ctx context.Context, dbs dlib.SQLExecutor, q string,
+	args ...interface{}) (dlib.SQLRows, error) {
+	fn := SQLFunction(q)
+	_, span := otel.Tracer(TracerName).Start(ctx, fn,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemNamePostgreSQL,
+			semconv.DBStoredProcedureName(fn),
+		))
+	rows, err := dbs.Query(q, args...)
+	if err != nil {
+		SpanError(span, err)
+		span.End()
+		return nil, err
+	}
+
+	return &tracedRows{SQLRows: rows, span: span}, nil
+}
+
+// SQLFunction returns the name of the SQL function called by a query.
+func SQLFunction(q string) string {
+	m := sqlFunctionRE.FindStringSubmatch(q)
+	if m == nil {
+		return "query"
+	}
+
+	return m[1]
+}
+
+// SpanError records an error in a span and marks the span as failed.
+func SpanError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// tracedRows values end the span of a query when its rows are closed.
+type tracedRows struct {
+	dlib.SQLRows
+	span trace.Span
+}
+
+func (tr *tracedRows) Scan(dest ...interface{}) error {
+	err := tr.SQLRows.Scan(dest...)
+	if err != nil {
+		SpanError(tr.span, err)
+	}
+
+	return err
+}
+
+func (tr *tracedRows) Close() error {
+	err := tr.SQLRows.Close()
+	if err != nil {
+		SpanError(tr.span, err)
+	}
+
+	tr.span.End()
+	return err
+}
@@ -0,0 +1,90 @@
+package lib
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dhaifley/dlib"
+	"github.com/dhaifley/dlib/dauth"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+type MockTraceDBSession struct {
+	MockTokenDBSession
+	Err error
+}
+
+func (m *MockTraceDBSession) Query(query string,
+	args ...interface{}) (dlib.SQLRows, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+
+	return m.MockTokenDBSession.Query(query, args...)
+}
+
+func testSpanRecorder(t *testing.T) *tracetest.SpanRecorder {
+	sr := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(sr)))
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+	return sr
+}
+
+func TestSQLFunction(t *testing.T) {
+	cases := map[string]string{
+		"SELECT delete_tokens($1, $2) AS num":  "delete_tokens",
+		"SELECT t.id FROM get_tokens($1) AS t": "get_tokens",
+		"SELECT get_audit_head() AS hash":      "get_audit_head",
+		"SELECT 1":                             "query",
+	}
+
+	for q, exp := range cases {
+		if fn := SQLFunction(q); fn != exp {
+			t.Errorf("Function expected: %v, got: %v", exp, fn)
+		}
+	}
+}
+
+func TestTraceQuery(t *testing.T) {
+	sr := testSpanRecorder(t)
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "Auth")
+	ta := NewTokenAccessor(&MockTraceDBSession{})
+	id := int64(1)
+	for range ta.GetTokens(ctx, &dauth.TokenFind{ID: &id}) {
+	}
+
+	for range ta.DeleteTokenByID(ctx, 1) {
+	}
+
+	parent.End()
+	spans := sr.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("Spans expected: 3, got: %v", len(spans))
+	}
+
+	for i, exp := range []string{"get_tokens", "delete_tokens"} {
+		s := spans[i]
+		if s.Name() != exp || s.SpanKind() != trace.SpanKindClient ||
+			s.Parent().SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("Span expected: %v, got: %v %v %v", exp,
+				s.Name(), s.SpanKind(), s.Parent().SpanID())
+		}
+	}
+
+	ta = NewTokenAccessor(&MockTraceDBSession{
+		Err: dlib.NewError(500, "test")})
+	for range ta.GetTokens(ctx, &dauth.TokenFind{}) {
+	}
+
+	spans = sr.Ended()
+	if s := spans[len(spans)-1]; s.Status().Code != codes.Error ||
+		len(s.Events()) != 1 {
+		t.Errorf("Failed span expected, got: %+v", s.Status())
+	}
+}
@@ -1,6 +1,7 @@
 package lib
 
 import (
+	"context"
 	"github.com/dhaifley/dlib"
 	"github.com/dhaifley/dlib/dauth"
 )
@@ -13,12 +14,14 @@ type UserAccess struct {
 // UserAccessor is an interface describing values capable of providing
 // access to user records in the database.
 type UserAccessor interface {
-	GetUsers(opt *dauth.UserFind) <-chan dlib.Result
-	GetUserByID(id int64) <-chan dlib.Result
-	DeleteUsers(opt *dauth.UserFind) <-chan dlib.Result
-	DeleteUserByID(id int64) <-chan dlib.Result
-	SaveUser(t *dauth.User) <-chan dlib.Result
-	SaveUsers(t []dauth.User) <-chan dlib.Result
+	GetUsers(ctx context.Context, opt *dauth.UserFind) <-chan dlib.Result
+	GetUserByID(ctx context.Context, id int64) <-chan dlib.Result
+	DeleteUsers(ctx context.Context, opt *dauth.UserFind) <-chan dlib.Result
+	DeleteUserByID(ctx context.Context, id int64) <-chan dlib.Result
+	SaveUser(ctx context.Context, t *dauth.User) <-chan dlib.Result
+	SaveUsers(ctx context.Context, t []dauth.User) <-chan dlib.Result
+	SaveUserPass(ctx context.Context,
+		id int64, pass string) <-chan dlib.Result
 }
 
 // NewUserAccessor creates a new UserAccess instance and
@@ -29,12 +32,13 @@ func NewUserAccessor(dbs dlib.SQLExecutor) UserAccessor {
 }
 
 // GetUsers finds user values in the database.
-func (ua *UserAccess) GetUsers(opt *dauth.UserFind) <-chan dlib.Result {
+func (ua *UserAccess) GetUsers(ctx context.Context,
+	opt *dauth.UserFind) <-chan dlib.Result {
 	ch := make(chan dlib.Result, 256)
 
 	go func() {
 		defer close(ch)
-		rows, err := ua.DBS.Query(`
+		rows, err := traceQuery(ctx, ua.DBS, `
 			SELECT
 				u.id,
 				u.user,
@@ -75,18 +79,20 @@ func (ua *UserAccess) GetUsers(opt *dauth.UserFind) <-chan dlib.Result {
 }
 
 // GetUserByID finds a User value in the database by ID.
-func (ua *UserAccess) GetUserByID(id int64) <-chan dlib.Result {
+func (ua *UserAccess) GetUserByID(ctx context.Context,
+	id int64) <-chan dlib.Result {
 	opt := dauth.UserFind{ID: &id}
-	return ua.GetUsers(&opt)
+	return ua.GetUsers(ctx, &opt)
 }
 
 // DeleteUsers deletes User values from the database.
-func (ua *UserAccess) DeleteUsers(opt *dauth.UserFind) <-chan dlib.Result {
+func (ua *UserAccess) DeleteUsers(ctx context.Context,
+	opt *dauth.UserFind) <-chan dlib.Result {
 	ch := make(chan dlib.Result, 256)
 
 	go func() {
 		defer close(ch)
-		rows, err := ua.DBS.Query(
+		rows, err := traceQuery(ctx, ua.DBS,
 			"SELECT delete_users$1, $2, $3, $4, $5) AS num",
 			opt.ID,
 			opt.User,
@@ -117,18 +123,20 @@ func (ua *UserAccess) DeleteUsers(opt *dauth.UserFind) <-chan dlib.Result {
 }
 
 // DeleteUserByID deletes a User value from the database by ID.
-func (ua *UserAccess) DeleteUserByID(id int64) <-chan dlib.Result {
+func (ua *UserAccess) DeleteUserByID(ctx context.Context,
+	id int64) <-chan dlib.Result {
 	opt := dauth.UserFind{ID: &id}
-	return ua.DeleteUsers(&opt)
+	return ua.DeleteUsers(ctx, &opt)
 }
 
 // SaveUser saves a User value to the database.
-func (ua *UserAccess) SaveUser(u *dauth.User) <-chan dlib.Result {
+func (ua *UserAccess) SaveUser(ctx context.Context,
+	u *dauth.User) <-chan dlib.Result {
 	ch := make(chan dlib.Result, 256)
 
 	go func() {
 		defer close(ch)
-		rows, err := ua.DBS.Query(
+		rows, err := traceQuery(ctx, ua.DBS,
 			"SELECT save_user($1, $2, $3, $4, $5) AS id",
 			u.ID,
 			u.User,
@@ -158,14 +166,15 @@ func (ua *UserAccess) SaveUser(u *dauth.User) <-chan dlib.Result {
 }
 
 // SaveUsers saves a slice of User values to the database.
-func (ua *UserAccess) SaveUsers(u []dauth.User) <-chan dlib.Result {
+func (ua *UserAccess) SaveUsers(ctx context.Context,
+	u []dauth.User) <-chan dlib.Result {
 	ch := make(chan dlib.Result, 256)
 
 	go func() {
 		defer close(ch)
 		if u != nil {
 			for _, v := range u {
-				for sr := range ua.SaveUser(&v) {
+				for sr := range ua.SaveUser(ctx, &v) {
 					ch <- sr
 				}
 			}
@@ -174,3 +183,38 @@ func (ua *UserAccess) SaveUsers(u []dauth.User) <-chan dlib.Result {
 
 	return ch
 }
+
+// SaveUserPass replaces the stored password hash of a User in the database,
+// without otherwise changing the user.
+func (ua *UserAccess) SaveUserPass(ctx context.Context,
+	id int64, pass string) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 256)
+
+	go func() {
+		defer close(ch)
+		rows, err := traceQuery(ctx, ua.DBS,
+			"SELECT save_user_pass($1, $2) AS num",
+			id,
+			pass)
+		if err != nil {
+			ch <- dlib.Result{Err: err}
+			return
+		}
+
+		defer rows.Close()
+		n := 0
+		for rows.Next() {
+			r := struct{ Num int }{Num: 0}
+			if err := rows.Scan(&r.Num); err != nil {
+				ch <- dlib.Result{Err: err}
+				continue
+			}
+
+			n += r.Num
+		}
+
+		ch <- dlib.Result{Num: n, Err: nil}
+	}()
+
+	return ch
+}
@@ -0,0 +1,183 @@
+package lib
+
+import (
+	"context"
+	"time"
+
+	"github.com/dhaifley/dlib"
+)
+
+// UserPassword values hold the password settings of a user. MustChange is
+// set when the user must change their password on next login.
+type UserPassword struct {
+	UserID     int64      `json:"user_id"`
+	MustChange bool       `json:"must_change"`
+	Changed    *time.Time `json:"changed,omitempty"`
+}
+
+// UserPasswordRow values are used to scan user password database rows.
+type UserPasswordRow struct {
+	UserID     int64
+	MustChange bool
+	Changed    dlib.NullTime
+}
+
+// ToUserPassword converts a UserPasswordRow value into a UserPassword.
+func (r *UserPasswordRow) ToUserPassword() UserPassword {
+	v := UserPassword{
+		UserID:     r.UserID,
+		MustChange: r.MustChange,
+	}
+
+	if r.Changed.Valid {
+		v.Changed = &r.Changed.Time
+	}
+
+	return v
+}
+
+// PasswordAccessor is an interface describing values capable of providing
+// access to user password settings and password history in the database.
+type PasswordAccessor interface {
+	GetUserPassword(ctx context.Context, userID int64) <-chan dlib.Result
+	SaveUserPassword(ctx context.Context,
+		p *UserPassword) <-chan dlib.Result
+	GetPasswordHistory(ctx context.Context,
+		userID int64, limit int) <-chan dlib.Result
+	ChangeUserPass(ctx context.Context,
+		userID int64, pass string, keep int) <-chan dlib.Result
+}
+
+// PasswordAccess values are used to access user password settings and
+// password history in the database.
+type PasswordAccess struct {
+	DBS dlib.SQLExecutor
+}
+
+// NewPasswordAccessor creates a new PasswordAccess value for database
+// access.
+func NewPasswordAccessor(dbs dlib.SQLExecutor) PasswordAccessor {
+	pa := PasswordAccess{DBS: dbs}
+	return &pa
+}
+
+// GetUserPassword finds the password settings of a user.
+func (pa *PasswordAccess) GetUserPassword(ctx context.Context,
+	userID int64) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 256)
+
+	go func() {
+		defer close(ch)
+		rows, err := traceQuery(ctx, pa.DBS, `
+			SELECT
+				p.user_id,
+				p.must_change,
+				p.changed
+			FROM get_user_password($1) AS p`,
+			userID)
+		if err != nil {
+			ch <- dlib.Result{Err: err}
+			return
+		}
+
+		defer rows.Close()
+		for rows.Next() {
+			r := UserPasswordRow{}
+			if err := rows.Scan(
+				&r.UserID,
+				&r.MustChange,
+				&r.Changed,
+			); err != nil {
+				ch <- dlib.Result{Err: err}
+				continue
+			}
+
+			v := r.ToUserPassword()
+			ch <- dlib.Result{Val: v, Num: 1}
+		}
+	}()
+
+	return ch
+}
+
+// SaveUserPassword sets whether a user must change their password on next
+// login.
+func (pa *PasswordAccess) SaveUserPassword(ctx context.Context,
+	p *UserPassword) <-chan dlib.Result {
+	return pa.count(ctx, "SELECT save_user_password($1, $2) AS num",
+		p.UserID, p.MustChange)
+}
+
+// GetPasswordHistory finds at most limit of the most recent password hashes
+// of a user, newest first.
+func (pa *PasswordAccess) GetPasswordHistory(ctx context.Context, userID int64,
+	limit int) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 256)
+
+	go func() {
+		defer close(ch)
+		rows, err := traceQuery(ctx, pa.DBS, `
+			SELECT h.pass
+			FROM get_password_history($1, $2) AS h`,
+			userID,
+			limit)
+		if err != nil {
+			ch <- dlib.Result{Err: err}
+			return
+		}
+
+		defer rows.Close()
+		for rows.Next() {
+			var v string
+			if err := rows.Scan(&v); err != nil {
+				ch <- dlib.Result{Err: err}
+				continue
+			}
+
+			ch <- dlib.Result{Val: v, Num: 1}
+		}
+	}()
+
+	return ch
+}
+
+// ChangeUserPass replaces the password hash of a user, adds it to the
+// password history of the user, keeping only the keep most recent hashes,
+// and clears the must change flag of the user.
+func (pa *PasswordAccess) ChangeUserPass(ctx context.Context,
+	userID int64, pass string,
+	keep int) <-chan dlib.Result {
+	return pa.count(ctx, "SELECT change_user_pass($1, $2, $3) AS num",
+		userID, pass, keep)
+}
+
+// count runs a query returning a single count column and sends the total.
+func (pa *PasswordAccess) count(ctx context.Context, query string,
+	args ...interface{}) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 256)
+
+	go func() {
+		defer close(ch)
+		rows, err := traceQuery(ctx, pa.DBS, query, args...)
+		if err != nil {
+			ch <- dlib.Result{Err: err}
+			return
+		}
+
+		defer rows.Close()
+		n := 0
+		for rows.Next() {
+			r := struct{ Num int }{Num: 0}
+			if err := rows.Scan(&r.Num); err != nil {
+				ch <- dlib.Result{Err: err}
+				continue
+			}
+
+			n += r.Num
+		}
+
+		ch <- dlib.Result{Num: n, Err: nil}
+	}()
+
+	return ch
+}
@@ -0,0 +1,128 @@
+package lib
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/dhaifley/dlib"
+)
+
+type MockPasswordRows struct {
+	row int
+}
+
+func (m *MockPasswordRows) Close() error {
+	return nil
+}
+
+func (m *MockPasswordRows) Next() bool {
+	m.row++
+	if m.row > 1 {
+		return false
+	}
+
+	return true
+}
+
+func (m *MockPasswordRows) Scan(dest ...interface{}) error {
+	for _, d := range dest {
+		switch v := d.(type) {
+		case *int64:
+			*v = 1
+		case *int:
+			*v = 1
+		case *bool:
+			*v = true
+		case *string:
+			*v = "test"
+		case *dlib.NullTime:
+			dt := time.Date(2083, 2, 2, 0, 0, 0, 0, time.Local)
+			*v = dlib.NullTime{Time: dt, Valid: true}
+		default:
+			return dlib.NewError(500, "Invalid type")
+		}
+	}
+
+	return nil
+}
+
+type MockPasswordDBSession struct{}
+
+func (m *MockPasswordDBSession) Close() error {
+	return nil
+}
+
+func (m *MockPasswordDBSession) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return nil, nil
+}
+
+func (m *MockPasswordDBSession) Query(query string, args ...interface{}) (dlib.SQLRows, error) {
+	mr := MockPasswordRows{}
+	return &mr, nil
+}
+
+func (m *MockPasswordDBSession) Ping() error {
+	return nil
+}
+
+func (m *MockPasswordDBSession) Stats() sql.DBStats {
+	return sql.DBStats{OpenConnections: 0}
+}
+
+func TestPasswordAccess(t *testing.T) {
+	ctx := context.Background()
+	pa := NewPasswordAccessor(&MockPasswordDBSession{})
+	var a []UserPassword
+	for r := range pa.GetUserPassword(ctx, 1) {
+		if r.Err != nil {
+			t.Error(r.Err)
+		}
+
+		if v, ok := r.Val.(UserPassword); ok {
+			a = append(a, v)
+		}
+	}
+
+	if len(a) != 1 || a[0].UserID != 1 || !a[0].MustChange ||
+		a[0].Changed == nil {
+		t.Errorf("UserPassword expected for user 1, got: %+v", a)
+	}
+
+	for r := range pa.SaveUserPassword(ctx, &a[0]) {
+		if r.Err != nil {
+			t.Error(r.Err)
+		}
+
+		if r.Num != 1 {
+			t.Errorf("Saved expected: 1, got: %v", r.Num)
+		}
+	}
+
+	var h []string
+	for r := range pa.GetPasswordHistory(ctx, 1, DefaultPasswordHistory) {
+		if r.Err != nil {
+			t.Error(r.Err)
+		}
+
+		if v, ok := r.Val.(string); ok {
+			h = append(h, v)
+		}
+	}
+
+	if len(h) != 1 || h[0] != "test" {
+		t.Errorf("History expected: [test], got: %v", h)
+	}
+
+	for r := range pa.ChangeUserPass(ctx, 1, "test",
+		DefaultPasswordHistory) {
+		if r.Err != nil {
+			t.Error(r.Err)
+		}
+
+		if r.Num != 1 {
+			t.Errorf("Changed expected: 1, got: %v", r.Num)
+		}
+	}
+}
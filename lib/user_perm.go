@@ -1,6 +1,7 @@
 package lib
 
 import (
+	"context"
 	"github.com/dhaifley/dlib"
 	"github.com/dhaifley/dlib/dauth"
 )
@@ -13,12 +14,17 @@ type UserPermAccess struct {
 // UserPermAccessor is an interface describing values capable of providing
 // access to user_perm records in the database.
 type UserPermAccessor interface {
-	GetUserPerms(opt *dauth.UserPermFind) <-chan dlib.Result
-	GetUserPermByID(id int64) <-chan dlib.Result
-	DeleteUserPerms(opt *dauth.UserPermFind) <-chan dlib.Result
-	DeleteUserPermByID(id int64) <-chan dlib.Result
-	SaveUserPerm(t *dauth.UserPerm) <-chan dlib.Result
-	SaveUserPerms(t []dauth.UserPerm) <-chan dlib.Result
+	GetUserPerms(ctx context.Context,
+		opt *dauth.UserPermFind) <-chan dlib.Result
+	GetUserPermByID(ctx context.Context, id int64) <-chan dlib.Result
+	DeleteUserPerms(ctx context.Context,
+		opt *dauth.UserPermFind) <-chan dlib.Result
+	DeleteUserPermByID(ctx context.Context, id int64) <-chan dlib.Result
+	SaveUserPerm(ctx context.Context, t *dauth.UserPerm) <-chan dlib.Result
+	SaveUserPerms(ctx context.Context,
+		t []dauth.UserPerm) <-chan dlib.Result
+	GetUserEffectivePerms(ctx context.Context,
+		userID int64) <-chan dlib.Result
 }
 
 // NewUserPermAccessor creates a new UserPermAccess instance and
@@ -29,12 +35,13 @@ func NewUserPermAccessor(dbs dlib.SQLExecutor) UserPermAccessor {
 }
 
 // GetUserPerms finds user_perm values in the database.
-func (upa *UserPermAccess) GetUserPerms(opt *dauth.UserPermFind) <-chan dlib.Result {
+func (upa *UserPermAccess) GetUserPerms(ctx context.Context,
+	opt *dauth.UserPermFind) <-chan dlib.Result {
 	ch := make(chan dlib.Result, 256)
 
 	go func() {
 		defer close(ch)
-		rows, err := upa.DBS.Query(`
+		rows, err := traceQuery(ctx, upa.DBS, `
 			SELECT
 				p.id,
 				p.user_id,
@@ -69,18 +76,60 @@ func (upa *UserPermAccess) GetUserPerms(opt *dauth.UserPermFind) <-chan dlib.Res
 }
 
 // GetUserPermByID finds a user_perm value in the database by ID.
-func (upa *UserPermAccess) GetUserPermByID(id int64) <-chan dlib.Result {
+func (upa *UserPermAccess) GetUserPermByID(ctx context.Context,
+	id int64) <-chan dlib.Result {
 	opt := dauth.UserPermFind{ID: &id}
-	return upa.GetUserPerms(&opt)
+	return upa.GetUserPerms(ctx, &opt)
+}
+
+// GetUserEffectivePerms finds the perm values a user holds directly, through
+// roles and through groups, with a single query. Deny perms are sent first.
+func (upa *UserPermAccess) GetUserEffectivePerms(ctx context.Context,
+	userID int64) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 256)
+
+	go func() {
+		defer close(ch)
+		rows, err := traceQuery(ctx, upa.DBS, `
+			SELECT
+				p.id,
+				p.service,
+				p.name
+			FROM get_user_effective_perms($1) AS p`,
+			userID)
+		if err != nil {
+			ch <- dlib.Result{Err: err}
+			return
+		}
+
+		defer rows.Close()
+		for rows.Next() {
+			r := dauth.PermRow{}
+			if err := rows.Scan(
+				&r.ID,
+				&r.Service,
+				&r.Name,
+			); err != nil {
+				ch <- dlib.Result{Err: err}
+				continue
+			}
+
+			v := r.ToPerm()
+			ch <- dlib.Result{Val: v, Num: 1}
+		}
+	}()
+
+	return ch
 }
 
 // DeleteUserPerms deletes user_perm values from the database.
-func (upa *UserPermAccess) DeleteUserPerms(opt *dauth.UserPermFind) <-chan dlib.Result {
+func (upa *UserPermAccess) DeleteUserPerms(ctx context.Context,
+	opt *dauth.UserPermFind) <-chan dlib.Result {
 	ch := make(chan dlib.Result, 256)
 
 	go func() {
 		defer close(ch)
-		rows, err := upa.DBS.Query(
+		rows, err := traceQuery(ctx, upa.DBS,
 			"SELECT delete_user_perms($1, $2, $3) AS num",
 			opt.ID,
 			opt.UserID,
@@ -109,18 +158,20 @@ func (upa *UserPermAccess) DeleteUserPerms(opt *dauth.UserPermFind) <-chan dlib.
 }
 
 // DeleteUserPermByID deletes a user_perm value from the database by ID.
-func (upa *UserPermAccess) DeleteUserPermByID(id int64) <-chan dlib.Result {
+func (upa *UserPermAccess) DeleteUserPermByID(ctx context.Context,
+	id int64) <-chan dlib.Result {
 	opt := dauth.UserPermFind{ID: &id}
-	return upa.DeleteUserPerms(&opt)
+	return upa.DeleteUserPerms(ctx, &opt)
 }
 
 // SaveUserPerm saves a user_perm value to the database.
-func (upa *UserPermAccess) SaveUserPerm(u *dauth.UserPerm) <-chan dlib.Result {
+func (upa *UserPermAccess) SaveUserPerm(ctx context.Context,
+	u *dauth.UserPerm) <-chan dlib.Result {
 	ch := make(chan dlib.Result, 256)
 
 	go func() {
 		defer close(ch)
-		rows, err := upa.DBS.Query(
+		rows, err := traceQuery(ctx, upa.DBS,
 			"SELECT save_user_perm($1, $2, $3) AS id",
 			u.ID,
 			u.UserID,
@@ -148,14 +199,15 @@ func (upa *UserPermAccess) SaveUserPerm(u *dauth.UserPerm) <-chan dlib.Result {
 }
 
 // SaveUserPerms saves a slice of user_perm values to the database.
-func (upa *UserPermAccess) SaveUserPerms(u []dauth.UserPerm) <-chan dlib.Result {
+func (upa *UserPermAccess) SaveUserPerms(ctx context.Context,
+	u []dauth.UserPerm) <-chan dlib.Result {
 	ch := make(chan dlib.Result, 256)
 
 	go func() {
 		defer close(ch)
 		if u != nil {
 			for _, v := range u {
-				for sr := range upa.SaveUserPerm(&v) {
+				for sr := range upa.SaveUserPerm(ctx, &v) {
 					ch <- sr
 				}
 			}
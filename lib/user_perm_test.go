@@ -1,6 +1,7 @@
 package lib
 
 import (
+	"context"
 	"database/sql"
 	"testing"
 
@@ -49,15 +50,19 @@ func (m *MockUserPermRows) Scan(dest ...interface{}) error {
 		switch v := dest[1].(type) {
 		case *int64:
 			*v = int64(1)
+		case *string:
+			*v = "test"
 		default:
 			return dlib.NewError(500, "Invalid type")
 		}
 	}
 
 	if len(dest) > 2 {
-		switch v := dest[1].(type) {
+		switch v := dest[2].(type) {
 		case *int64:
 			*v = int64(1)
+		case *string:
+			*v = "test"
 		default:
 			return dlib.NewError(500, "Invalid type")
 		}
@@ -100,11 +105,12 @@ func TestNewUserPermAccessor(t *testing.T) {
 }
 
 func TestUserPermAccessGetUserPerms(t *testing.T) {
+	ctx := context.Background()
 	mdbs := MockUserPermDBSession{}
 	ma := NewUserPermAccessor(&mdbs)
 	var as []dauth.UserPerm
 	id := int64(1)
-	c := ma.GetUserPerms(&dauth.UserPermFind{ID: &id})
+	c := ma.GetUserPerms(ctx, &dauth.UserPermFind{ID: &id})
 	for r := range c {
 		if r.Err != nil {
 			t.Error(r.Err)
@@ -124,10 +130,11 @@ func TestUserPermAccessGetUserPerms(t *testing.T) {
 }
 
 func TestUserPermAccessGetUserPermByID(t *testing.T) {
+	ctx := context.Background()
 	mdbs := MockUserPermDBSession{}
 	ma := NewUserPermAccessor(&mdbs)
 	var a dauth.UserPerm
-	c := ma.GetUserPermByID(1)
+	c := ma.GetUserPermByID(ctx, 1)
 	for r := range c {
 		if r.Err != nil {
 			t.Error(r.Err)
@@ -146,10 +153,34 @@ func TestUserPermAccessGetUserPermByID(t *testing.T) {
 	}
 }
 
+func TestUserPermAccessGetUserEffectivePerms(t *testing.T) {
+	ctx := context.Background()
+	mdbs := MockUserPermDBSession{}
+	ma := NewUserPermAccessor(&mdbs)
+	var as []dauth.Perm
+	for r := range ma.GetUserEffectivePerms(ctx, 1) {
+		if r.Err != nil {
+			t.Error(r.Err)
+		}
+
+		switch v := r.Val.(type) {
+		case dauth.Perm:
+			as = append(as, v)
+		default:
+			t.Errorf("Invalid data type returned")
+		}
+	}
+
+	if len(as) != 1 || as[0].ID != 1 || as[0].Service != "test" {
+		t.Errorf("Perm expected: 1 test test, got: %v", as)
+	}
+}
+
 func TestUserPermAccessDeleteUserPermByID(t *testing.T) {
+	ctx := context.Background()
 	mdbs := MockUserPermDBSession{}
 	ma := NewUserPermAccessor(&mdbs)
-	c := ma.DeleteUserPermByID(1)
+	c := ma.DeleteUserPermByID(ctx, 1)
 	var n int
 	for r := range c {
 		if r.Err != nil {
@@ -166,10 +197,11 @@ func TestUserPermAccessDeleteUserPermByID(t *testing.T) {
 }
 
 func TestUserPermAccessDeleteUserPerms(t *testing.T) {
+	ctx := context.Background()
 	mdbs := MockUserPermDBSession{}
 	ma := NewUserPermAccessor(&mdbs)
 	id := int64(1)
-	c := ma.DeleteUserPerms(&dauth.UserPermFind{ID: &id})
+	c := ma.DeleteUserPerms(ctx, &dauth.UserPermFind{ID: &id})
 	var n int
 	for r := range c {
 		if r.Err != nil {
@@ -186,10 +218,11 @@ func TestUserPermAccessDeleteUserPerms(t *testing.T) {
 }
 
 func TestUserPermAccessSaveUserPerm(t *testing.T) {
+	ctx := context.Background()
 	a := dauth.UserPerm{ID: 1}
 	mdbs := MockUserPermDBSession{}
 	ma := NewUserPermAccessor(&mdbs)
-	c := ma.SaveUserPerm(&a)
+	c := ma.SaveUserPerm(ctx, &a)
 	for r := range c {
 		if r.Err != nil {
 			t.Error(r.Err)
@@ -209,10 +242,11 @@ func TestUserPermAccessSaveUserPerm(t *testing.T) {
 }
 
 func TestUserPermAccessSaveUserPerms(t *testing.T) {
+	ctx := context.Background()
 	a := []dauth.UserPerm{dauth.UserPerm{ID: 1}}
 	mdbs := MockUserPermDBSession{}
 	ma := NewUserPermAccessor(&mdbs)
-	c := ma.SaveUserPerms(a)
+	c := ma.SaveUserPerms(ctx, a)
 	for r := range c {
 		if r.Err != nil {
 			t.Error(r.Err)
@@ -1,6 +1,7 @@
 package lib
 
 import (
+	"context"
 	"database/sql"
 	"testing"
 
@@ -118,11 +119,12 @@ func TestNewUserAccessor(t *testing.T) {
 }
 
 func TestUserAccessGetUsers(t *testing.T) {
+	ctx := context.Background()
 	mdbs := MockUserDBSession{}
 	ma := NewUserAccessor(&mdbs)
 	var as []dauth.User
 	id := int64(1)
-	c := ma.GetUsers(&dauth.UserFind{ID: &id})
+	c := ma.GetUsers(ctx, &dauth.UserFind{ID: &id})
 	for r := range c {
 		if r.Err != nil {
 			t.Error(r.Err)
@@ -143,10 +145,11 @@ func TestUserAccessGetUsers(t *testing.T) {
 }
 
 func TestUserAccessGetUserByID(t *testing.T) {
+	ctx := context.Background()
 	mdbs := MockUserDBSession{}
 	ma := NewUserAccessor(&mdbs)
 	var a dauth.User
-	c := ma.GetUserByID(1)
+	c := ma.GetUserByID(ctx, 1)
 	for r := range c {
 		if r.Err != nil {
 			t.Error(r.Err)
@@ -167,9 +170,10 @@ func TestUserAccessGetUserByID(t *testing.T) {
 }
 
 func TestUserAccessDeleteUserByID(t *testing.T) {
+	ctx := context.Background()
 	mdbs := MockUserDBSession{}
 	ma := NewUserAccessor(&mdbs)
-	c := ma.DeleteUserByID(1)
+	c := ma.DeleteUserByID(ctx, 1)
 	var n int
 	for r := range c {
 		if r.Err != nil {
@@ -186,10 +190,11 @@ func TestUserAccessDeleteUserByID(t *testing.T) {
 }
 
 func TestUserAccessDeleteUsers(t *testing.T) {
+	ctx := context.Background()
 	mdbs := MockUserDBSession{}
 	ma := NewUserAccessor(&mdbs)
 	id := "test"
-	c := ma.DeleteUsers(&dauth.UserFind{User: &id})
+	c := ma.DeleteUsers(ctx, &dauth.UserFind{User: &id})
 	var n int
 	for r := range c {
 		if r.Err != nil {
@@ -206,10 +211,11 @@ func TestUserAccessDeleteUsers(t *testing.T) {
 }
 
 func TestUserAccessSaveUser(t *testing.T) {
+	ctx := context.Background()
 	a := dauth.User{User: "test"}
 	mdbs := MockUserDBSession{}
 	ma := NewUserAccessor(&mdbs)
-	c := ma.SaveUser(&a)
+	c := ma.SaveUser(ctx, &a)
 	for r := range c {
 		if r.Err != nil {
 			t.Error(r.Err)
@@ -230,10 +236,11 @@ func TestUserAccessSaveUser(t *testing.T) {
 }
 
 func TestUserAccessSaveUsers(t *testing.T) {
+	ctx := context.Background()
 	a := []dauth.User{dauth.User{User: "test"}}
 	mdbs := MockUserDBSession{}
 	ma := NewUserAccessor(&mdbs)
-	c := ma.SaveUsers(a)
+	c := ma.SaveUsers(ctx, a)
 	for r := range c {
 		if r.Err != nil {
 			t.Error(r.Err)
@@ -245,3 +252,23 @@ func TestUserAccessSaveUsers(t *testing.T) {
 		t.Errorf("User expected: %v, got: %v", expected, a[0].User)
 	}
 }
+
+func TestUserAccessSaveUserPass(t *testing.T) {
+	ctx := context.Background()
+	mdbs := MockUserDBSession{}
+	ma := NewUserAccessor(&mdbs)
+	c := ma.SaveUserPass(ctx, 1, "test")
+	var n int
+	for r := range c {
+		if r.Err != nil {
+			t.Error(r.Err)
+		}
+
+		n = r.Num
+	}
+
+	expected := 1
+	if n != expected {
+		t.Errorf("Update count expected: %v, got: %v", expected, n)
+	}
+}
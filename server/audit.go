@@ -0,0 +1,308 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/dhaifley/dauth/lib"
+	"github.com/dhaifley/dlib"
+	"github.com/dhaifley/dlib/dauth"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+)
+
+// AuditTargetLength is the longest target recorded in an audit event, in
+// bytes.
+const AuditTargetLength = 1024
+
+// auditSaveAttempts is how many times an audit event is hashed again when
+// other servers keep appending to the audit log first.
+const auditSaveAttempts = 5
+
+// auditRedactor masks the secrets of the requests recorded as targets.
+var auditRedactor = NewRedactor()
+
+// callerKey is the context key of the user whose access token authorized
+// a call.
+type callerKey struct{}
+
+// withCaller returns a context carrying the user whose access token
+// authorized a call.
+func withCaller(ctx context.Context, u *dauth.User) context.Context {
+	return context.WithValue(ctx, callerKey{}, u)
+}
+
+// callerFrom returns the user whose access token authorized a call, or nil
+// for the public RPCs.
+func callerFrom(ctx context.Context) *dauth.User {
+	u, _ := ctx.Value(callerKey{}).(*dauth.User)
+	return u
+}
+
+// callerStream passes the context carrying the caller of a streaming RPC
+// to its handler.
+type callerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (cs *callerStream) Context() context.Context { return cs.ctx }
+
+// AuthExt_QueryAuditServer is the server API for the stream of audit events
+// returned by QueryAudit.
+type AuthExt_QueryAuditServer interface {
+	Send(*lib.AuditEvent) error
+	grpc.ServerStream
+}
+
+// QueryAudit returns a stream of the audit events matching a request, in
+// the order they were recorded.
+func (s *Server) QueryAudit(req *lib.AuditFind,
+	stream AuthExt_QueryAuditServer) error {
+	ctx := stream.Context()
+	if s.Audit == nil {
+		err := dlib.NewError(http.StatusInternalServerError,
+			"audit log not configured")
+		return s.extError(ctx, "QueryAudit", req, err)
+	}
+
+	count := 0
+	ch := s.Audit.GetAuditEvents(ctx, req)
+	defer func() {
+		go func() {
+			for range ch {
+			}
+		}()
+	}()
+
+	for r := range ch {
+		if r.Err != nil {
+			return s.extError(ctx, "QueryAudit", req, r.Err)
+		}
+
+		if v, ok := r.Val.(lib.AuditEvent); ok {
+			r.Val = &v
+		}
+
+		v, ok := r.Val.(*lib.AuditEvent)
+		if !ok {
+			continue
+		}
+
+		if err := stream.Send(v); err != nil {
+			return s.extError(ctx, "QueryAudit", req, err)
+		}
+
+		count++
+	}
+
+	s.extDone(ctx, "QueryAudit", req, count)
+	return nil
+}
+
+// VerifyAudit checks the chain of hashes of the whole audit log. The chain
+// returned holds the number of events verified, and the error identifies
+// the first event which was changed, or which follows removed events.
+func (s *Server) VerifyAudit(ctx context.Context) (*lib.AuditChain, error) {
+	c := lib.AuditChain{}
+	if s.Audit == nil {
+		return &c, dlib.NewError(http.StatusInternalServerError,
+			"audit log not configured")
+	}
+
+	var err error
+	for r := range s.Audit.GetAuditEvents(ctx, &lib.AuditFind{}) {
+		if err != nil {
+			continue
+		}
+
+		if r.Err != nil {
+			err = r.Err
+			continue
+		}
+
+		switch v := r.Val.(type) {
+		case lib.AuditEvent:
+			err = c.Verify(&v)
+		case *lib.AuditEvent:
+			err = c.Verify(v)
+		}
+	}
+
+	return &c, err
+}
+
+// audit records an event in the audit log for the caller of an RPC. The
+// target is recorded as is when it is a string, and as JSON with its
+// secrets masked otherwise.
+func (s *Server) audit(ctx context.Context, action string,
+	target interface{}, err error) {
+	s.auditUser(ctx, callerFrom(ctx), action, target, err)
+}
+
+// auditUser records an event in the audit log for an action of a user.
+func (s *Server) auditUser(ctx context.Context, u *dauth.User,
+	action string, target interface{}, err error) {
+	e := lib.AuditEvent{
+		Action:  action,
+		Target:  auditTarget(target),
+		Outcome: auditOutcome(err),
+	}
+
+	if u != nil {
+		e.ActorID = u.ID
+		e.Actor = u.User
+	}
+
+	s.record(ctx, &e)
+}
+
+// record saves an audit event, with the address of the client of the call.
+// Failures are logged, but do not fail the call.
+func (s *Server) record(ctx context.Context, e *lib.AuditEvent) {
+	if s.Audit == nil {
+		return
+	}
+
+	e.Peer = peerAddr(ctx)
+	if err := s.saveAudit(ctx, e); err != nil {
+		s.Log.WithFields(logrus.Fields{
+			"rpc":     e.Action,
+			"code":    http.StatusInternalServerError,
+			"context": ctx,
+			"event":   e,
+		}).Error(err)
+	}
+}
+
+// saveAudit appends an event to the audit log, hashing it again when
+// another server appended an event first.
+func (s *Server) saveAudit(ctx context.Context, e *lib.AuditEvent) error {
+	s.auditMu.Lock()
+	defer s.auditMu.Unlock()
+	now := time.Now()
+	e.Created = &now
+	for i := 0; i < auditSaveAttempts; i++ {
+		head, err := s.auditHead(ctx)
+		if err != nil {
+			return err
+		}
+
+		e.Seal(head)
+		saved := false
+		for r := range s.Audit.SaveAuditEvent(ctx, e) {
+			if r.Err != nil {
+				return r.Err
+			}
+
+			saved = saved || r.Num > 0
+		}
+
+		if saved {
+			return nil
+		}
+	}
+
+	return dlib.NewError(http.StatusConflict, "audit log busy")
+}
+
+// auditHead returns the hash of the last event of the audit log.
+func (s *Server) auditHead(ctx context.Context) (string, error) {
+	head := ""
+	for r := range s.Audit.GetAuditHead(ctx) {
+		if r.Err != nil {
+			return "", r.Err
+		}
+
+		if v, ok := r.Val.(string); ok {
+			head = v
+		}
+	}
+
+	return head, nil
+}
+
+// auditOutcome returns the outcome of an audited call from its error.
+// Refused credentials and perms are denied, other errors are failures.
+func auditOutcome(err error) string {
+	if err == nil {
+		return lib.AuditSuccess
+	}
+
+	if e, ok := err.(*dlib.Error); ok {
+		switch e.Code {
+		case http.StatusUnauthorized, http.StatusForbidden,
+			http.StatusTooManyRequests:
+			return lib.AuditDenied
+		}
+	}
+
+	return lib.AuditFailure
+}
+
+// auditTarget returns the target of an audit event.
+func auditTarget(v interface{}) string {
+	t := ""
+	switch tv := v.(type) {
+	case nil:
+	case string:
+		t = tv
+	default:
+		b, err := json.Marshal(auditRedactor.Redact("target", v))
+		if err != nil {
+			return ""
+		}
+
+		t = string(b)
+	}
+
+	return truncate(t, AuditTargetLength)
+}
+
+// userTarget returns the audit target of a user.
+func userTarget(id int64) string {
+	return fmt.Sprintf("user:%d", id)
+}
+
+// auditLogin records a login attempt in the audit log. The actor of failed
+// attempts is the user name provided, whether or not the user exists.
+func (s *Server) auditLogin(ctx context.Context, rpc string, u *dauth.User,
+	res *TokenPair, err error) {
+	e := lib.AuditEvent{
+		ActorID: u.ID,
+		Actor:   u.User,
+		Action:  rpc,
+		Outcome: auditOutcome(err),
+	}
+
+	if res != nil && res.Token != nil {
+		if e.ActorID == 0 {
+			e.ActorID = res.Token.UserID
+		}
+
+		if res.MFAPending || res.PasswordChange {
+			e.Outcome = lib.AuditPending
+		}
+	}
+
+	if e.ActorID != 0 {
+		e.Target = userTarget(e.ActorID)
+	}
+
+	s.record(ctx, &e)
+}
+
+// tokenActor returns the user a signed token was issued to, without
+// verifying it, or nil for opaque tokens. It must only be used on tokens
+// which were found in the database.
+func tokenActor(token string) *dauth.User {
+	tc, err := lib.ParseTokenClaims(token)
+	if err != nil || tc.UserID == 0 {
+		return nil
+	}
+
+	return &dauth.User{ID: tc.UserID, User: tc.User}
+}
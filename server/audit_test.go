@@ -0,0 +1,375 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/dhaifley/dauth/lib"
+	"github.com/dhaifley/dlib"
+	"github.com/dhaifley/dlib/dauth"
+	"github.com/dhaifley/dlib/ptypes"
+	"github.com/sirupsen/logrus/hooks/test"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type MockAuditAccess struct {
+	sync.Mutex
+	Events []lib.AuditEvent
+	Moves  int
+}
+
+func (m *MockAuditAccess) GetAuditEvents(ctx context.Context,
+	opt *lib.AuditFind) <-chan dlib.Result {
+	m.Lock()
+	defer m.Unlock()
+	match := func(f *string, v string) bool { return f == nil || *f == v }
+	var vals []interface{}
+	for _, e := range m.Events {
+		if matchID(opt.ActorID, e.ActorID) && match(opt.Actor, e.Actor) &&
+			match(opt.Action, e.Action) && match(opt.Target, e.Target) &&
+			match(opt.Outcome, e.Outcome) {
+			vals = append(vals, e)
+		}
+	}
+
+	return mockResults(vals...)
+}
+
+func (m *MockAuditAccess) GetAuditHead(ctx context.Context) <-chan dlib.Result {
+	m.Lock()
+	defer m.Unlock()
+	return mockResults(m.head())
+}
+
+func (m *MockAuditAccess) head() string {
+	if len(m.Events) == 0 {
+		return ""
+	}
+
+	return m.Events[len(m.Events)-1].Hash
+}
+
+// SaveAuditEvent appends an event if its previous hash is the head. While
+// Moves is set, an event of another server is appended first.
+func (m *MockAuditAccess) SaveAuditEvent(ctx context.Context,
+	e *lib.AuditEvent) <-chan dlib.Result {
+	m.Lock()
+	defer m.Unlock()
+	if m.Moves > 0 {
+		m.Moves--
+		o := lib.AuditEvent{ID: int64(len(m.Events) + 1), Action: "Other",
+			Outcome: lib.AuditSuccess, Created: e.Created}
+		o.Seal(m.head())
+		m.Events = append(m.Events, o)
+	}
+
+	if e.PrevHash != m.head() {
+		return mockCount(0)
+	}
+
+	e.ID = int64(len(m.Events) + 1)
+	m.Events = append(m.Events, *e)
+	return mockResults(*e)
+}
+
+func TestServerAudit(t *testing.T) {
+	svr, _ := testGrantServer()
+	ph, err := lib.HashPassword("test", bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	svr.Users = &MockUserAccess{Pass: ph}
+	svr.Tokens = &MockTokenAccess{}
+	svr.RefreshTokens = &MockRefreshTokenAccess{}
+	svr.PasswordCost = bcrypt.MinCost
+	svr.Keys = testKeyRing(t)
+	maa := MockAuditAccess{}
+	svr.Audit = &maa
+	ctx := context.Background()
+	for _, pw := range []string{"bad", "test"} {
+		svr.login(ctx, &ptypes.UserRequest{User: "test",
+			Pass: dlib.EncodeBase64String(pw)})
+	}
+
+	admin := withCaller(ctx, &dauth.User{ID: 9, User: "admin"})
+	if _, err := svr.SaveGrants(admin, &GrantList{Grants: []lib.Grant{
+		{UserID: 1, PermID: 3},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := svr.DeleteGrants(admin, &lib.GrantFind{}); err != nil {
+		t.Fatal(err)
+	}
+
+	exp := []lib.AuditEvent{
+		{Actor: "test", Action: "Login", Outcome: lib.AuditDenied},
+		{ActorID: 1, Actor: "test", Action: "Login", Target: "user:1",
+			Outcome: lib.AuditSuccess},
+		{ActorID: 9, Actor: "admin", Action: "SaveGrants",
+			Target:  `{"id":1,"perm_id":3,"user_id":1}`,
+			Outcome: lib.AuditSuccess},
+		{ActorID: 9, Actor: "admin", Action: "DeleteGrants", Target: "{}",
+			Outcome: lib.AuditSuccess},
+	}
+
+	if len(maa.Events) != len(exp) {
+		t.Fatalf("Events expected: %v, got: %+v", len(exp), maa.Events)
+	}
+
+	for i, e := range exp {
+		a := maa.Events[i]
+		if a.ActorID != e.ActorID || a.Actor != e.Actor ||
+			a.Action != e.Action || a.Target != e.Target ||
+			a.Outcome != e.Outcome || a.Created == nil || a.Hash == "" {
+			t.Errorf("Event expected: %+v, got: %+v", e, a)
+		}
+	}
+
+	st := httpAuditStream{httpStream: httpStream{ctx: ctx}}
+	action := "Login"
+	if err := svr.QueryAudit(&lib.AuditFind{Action: &action},
+		&st); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(st.res) != 2 || st.res[1].Outcome != lib.AuditSuccess {
+		t.Errorf("Login events expected: 2, got: %+v", st.res)
+	}
+
+	c, err := svr.VerifyAudit(ctx)
+	if err != nil || c.Count != 4 || c.Head != maa.Events[3].Hash {
+		t.Errorf("Verified expected: 4, got: %+v, %v", c, err)
+	}
+
+	maa.Events[0].Outcome = lib.AuditSuccess
+	if c, err = svr.VerifyAudit(ctx); err == nil || c.Count != 0 {
+		t.Errorf("Expected the changed event to fail, got: %+v", c)
+	}
+
+	maa.Events = append(maa.Events[:1], maa.Events[2:]...)
+	maa.Events[0].Outcome = lib.AuditDenied
+	if c, err = svr.VerifyAudit(ctx); err == nil || c.Count != 1 {
+		t.Errorf("Expected the removed event to be found, got: %+v", c)
+	}
+}
+
+func TestServerAuditManagement(t *testing.T) {
+	lm, _ := test.NewNullLogger()
+	maa := MockAuditAccess{}
+	svr := Server{Users: &MockUserAccess{}, Perms: &MockPermAccess{},
+		Tokens: &MockTokenAccess{}, Roles: &MockRoleAccess{},
+		Groups: &MockGroupAccess{},
+		MFA:    &MockMFAAccess{Codes: map[string]bool{}},
+		Audit:  &maa, Log: lm}
+	svr.UserPerms = &MockUserPermAccess{Server: &svr}
+	ctx := withCaller(context.Background(),
+		&dauth.User{ID: 9, User: "admin"})
+	for _, err := range []error{
+		svr.SaveUsers(&MockRFAuthSaveUsersServer{}),
+		svr.SavePerms(&MockRFAuthSavePermsServer{}),
+		svr.SaveUserPerms(&MockRFAuthSaveUserPermsServer{}),
+		svr.SaveTokens(&MockRFAuthSaveTokensServer{}),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	calls := []func() error{
+		func() error {
+			_, err := svr.DeleteUsers(ctx, &ptypes.UserRequest{ID: 1})
+			return err
+		},
+		func() error {
+			_, err := svr.DeletePerms(ctx, &ptypes.PermRequest{ID: 1})
+			return err
+		},
+		func() error {
+			_, err := svr.SaveRoles(ctx,
+				&RoleList{Roles: []lib.Role{{Name: "test"}}})
+			return err
+		},
+		func() error {
+			_, err := svr.DeleteRoles(ctx, &lib.RoleFind{})
+			return err
+		},
+		func() error {
+			_, err := svr.SaveRolePerms(ctx, &RolePermList{
+				RolePerms: []lib.RolePerm{{RoleID: 1, PermID: 1}}})
+			return err
+		},
+		func() error {
+			_, err := svr.DeleteRolePerms(ctx, &lib.RolePermFind{})
+			return err
+		},
+		func() error {
+			_, err := svr.SaveGroups(ctx,
+				&GroupList{Groups: []lib.Group{{Name: "test"}}})
+			return err
+		},
+		func() error {
+			_, err := svr.DeleteGroups(ctx, &lib.GroupFind{})
+			return err
+		},
+		func() error {
+			_, err := svr.SaveGroupPerms(ctx, &GroupPermList{
+				GroupPerms: []lib.GroupPerm{{GroupID: 1, PermID: 1}}})
+			return err
+		},
+		func() error {
+			_, err := svr.DeleteGroupPerms(ctx, &lib.GroupPermFind{})
+			return err
+		},
+		func() error {
+			_, err := svr.SaveGroupGroups(ctx, &GroupGroupList{
+				GroupGroups: []lib.GroupGroup{{ParentID: 1, ChildID: 2}}})
+			return err
+		},
+		func() error {
+			_, err := svr.DeleteGroupGroups(ctx, &lib.GroupGroupFind{})
+			return err
+		},
+		func() error {
+			_, err := svr.RequireMFA(ctx,
+				&MFARequireRequest{UserID: 1, Required: true})
+			return err
+		},
+		func() error {
+			_, err := svr.ResetMFA(ctx, &MFAResetRequest{UserID: 1})
+			return err
+		},
+		func() error {
+			_, err := svr.Unlock(ctx, &UnlockRequest{User: "test"})
+			return err
+		},
+	}
+
+	for _, c := range calls {
+		if err := c(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	exp := []string{"SaveUsers", "SavePerms", "SaveUserPerms", "SaveTokens",
+		"DeleteUsers", "DeletePerms", "SaveRoles", "DeleteRoles",
+		"SaveRolePerms", "DeleteRolePerms", "SaveGroups", "DeleteGroups",
+		"SaveGroupPerms", "DeleteGroupPerms", "SaveGroupGroups",
+		"DeleteGroupGroups", "RequireMFA", "ResetMFA", "Unlock"}
+	if len(maa.Events) != len(exp) {
+		t.Fatalf("Events expected: %v, got: %+v", len(exp), maa.Events)
+	}
+
+	for i, action := range exp {
+		e := maa.Events[i]
+		if e.Action != action || e.Outcome != lib.AuditSuccess {
+			t.Errorf("Event expected: %v, got: %+v", action, e)
+		}
+
+		if i >= 4 && e.Actor != "admin" {
+			t.Errorf("Actor expected: admin, got: %+v", e)
+		}
+	}
+
+	if tg := maa.Events[0].Target; tg != "user:1" {
+		t.Errorf("Target expected: user:1, got: %v", tg)
+	}
+}
+
+func TestServerSaveAudit(t *testing.T) {
+	svr := testInterceptorServer(false)
+	maa := MockAuditAccess{Moves: auditSaveAttempts - 1}
+	svr.Audit = &maa
+	svr.audit(context.Background(), "Test", "", nil)
+	if len(maa.Events) != auditSaveAttempts {
+		t.Fatalf("Events expected: %v, got: %v", auditSaveAttempts,
+			len(maa.Events))
+	}
+
+	c, err := svr.VerifyAudit(context.Background())
+	if err != nil || c.Count != 5 {
+		t.Errorf("Verified expected: 5, got: %+v, %v", c, err)
+	}
+
+	maa.Moves = auditSaveAttempts
+	svr.audit(context.Background(), "Test", "", nil)
+	for _, e := range maa.Events {
+		if e.Action == "Test" && e.ID != auditSaveAttempts {
+			t.Errorf("Event expected not to be saved, got: %+v", e)
+		}
+	}
+}
+
+func TestServerAuditDenied(t *testing.T) {
+	svr := testInterceptorServer(false)
+	maa := MockAuditAccess{}
+	svr.Audit = &maa
+	if _, err := svr.authorizeRPC(testBearerContext("test"),
+		"/dauth.AuthExt/SaveRoles"); err == nil {
+		t.Fatal("Expected the RPC to be refused")
+	}
+
+	if len(maa.Events) != 1 || maa.Events[0].Action != "SaveRoles" ||
+		maa.Events[0].Outcome != lib.AuditDenied ||
+		maa.Events[0].Target != "dauth:roles:write" ||
+		maa.Events[0].ActorID != 1 {
+		t.Errorf("Denied event expected, got: %+v", maa.Events)
+	}
+
+	svr.Perms = &MockPermAccess{Admin: true}
+	ctx, err := svr.authorizeRPC(testBearerContext("test"),
+		"/dauth.AuthExt/SaveRoles")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if u := callerFrom(ctx); u == nil || u.ID != 1 {
+		t.Errorf("Caller expected: 1, got: %+v", u)
+	}
+}
+
+func TestAuditTarget(t *testing.T) {
+	tg := auditTarget(&ptypes.TokenRequest{Token: "secret", UserID: 2})
+	if strings.Contains(tg, "secret") || !strings.Contains(tg, RedactedValue) {
+		t.Errorf("Expected the token to be masked, got: %v", tg)
+	}
+
+	if tg = auditTarget(strings.Repeat("x", AuditTargetLength+1)); len(tg) !=
+		AuditTargetLength {
+		t.Errorf("Target length expected: %v, got: %v", AuditTargetLength,
+			len(tg))
+	}
+}
+
+func TestHTTPQueryAudit(t *testing.T) {
+	svr := testHTTPServer(t)
+	svr.Audit = &MockAuditAccess{}
+	serveHTTP(svr, "POST", "/dauth/login",
+		`{"user":"test","pass":"`+dlib.EncodeBase64String("bad")+`"}`)
+	rec := serveHTTP(svr, "GET", "/dauth/audit?action=Login&outcome=denied",
+		"", testAuthHeader...)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status expected: %v, got: %v, %v", http.StatusOK, rec.Code,
+			rec.Body)
+	}
+
+	var res []lib.AuditEvent
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res) != 1 || res[0].Actor != "test" || res[0].Peer == "" {
+		t.Errorf("Login event expected, got: %+v", res)
+	}
+
+	rec = serveHTTP(svr, "GET", "/dauth/audit?start=x", "", testAuthHeader...)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Status expected: %v, got: %v", http.StatusBadRequest,
+			rec.Code)
+	}
+}
@@ -5,11 +5,13 @@ import (
 	"net/http"
 	"time"
 
-	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/dhaifley/dauth/lib"
 	"github.com/dhaifley/dlib"
 	"github.com/dhaifley/dlib/dauth"
 	"github.com/dhaifley/dlib/ptypes"
 	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 )
 
 // Auth authenticates a provided token and returns a user value.
@@ -26,11 +28,190 @@ func (s *Server) Auth(ctx context.Context,
 		return nil, err
 	}
 
+	if req.Perm == nil || req.Perm.Service == "" || req.Perm.Name == "" {
+		err := dlib.NewError(http.StatusBadRequest, "invalid perm")
+		s.Log.WithFields(logrus.Fields{
+			"rpc":     "Auth",
+			"code":    http.StatusBadRequest,
+			"context": ctx,
+			"request": req,
+		}).Error(err)
+		return nil, err
+	}
+
+	u, err := s.tokenUser(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	s.touchSession(ctx, req.Token.Token)
+	u.Pass = ""
+	ures := u.ToResponse()
+	var pres ptypes.PermResponse
+	ar := lib.AccessRequest{
+		Service: req.Perm.Service,
+		Name:    req.Perm.Name,
+		UserID:  u.ID,
+		IP:      peerAddr(ctx),
+		Time:    time.Now(),
+	}
+
+	m, err := s.userMatcher(ctx, u.ID, &ar)
+	if err != nil {
+		s.Log.WithFields(logrus.Fields{
+			"rpc":     "Auth",
+			"code":    http.StatusInternalServerError,
+			"context": ctx,
+			"request": req,
+		}).Error(err)
+		return nil, err
+	}
+
+	d := m.Decide(&ar)
+	if d.Allowed {
+		pres = d.Perm.ToResponse()
+	}
+
+	s.setGrantHeader(ctx, d.Grant)
+	res := ptypes.AuthResponse{
+		Ok:   d.Allowed,
+		User: &ures,
+		Perm: &pres,
+	}
+
+	return &res, nil
+}
+
+// userMatcher returns a matcher for the perms a user holds directly,
+// through roles and through groups, and for the user's grants. The perms
+// are read with a single query. When r is not nil, reading stops at the
+// first perm deciding r: a matching deny, or, since deny perms are read
+// first, a matching perm without wildcards. When the Auth cache is enabled
+// all perms are read, and the matcher is cached. Perms which fail to load
+// are errors rather than skipped, since a missing deny could allow a
+// request.
+func (s *Server) userMatcher(ctx context.Context, userID int64,
+	r *lib.AccessRequest) (*lib.PermMatcher, error) {
+	if m, ok := s.Cache.matcher(userID); ok {
+		return m, nil
+	}
+
+	gen := s.Cache.generation()
+	if s.Cache != nil {
+		r = nil
+	}
+
+	m := lib.NewPermMatcher()
+	perms := map[int64]*dauth.Perm{}
+	ch := s.UserPerms.GetUserEffectivePerms(ctx, userID)
+	defer func() {
+		go func() {
+			for range ch {
+			}
+		}()
+	}()
+
+	for res := range ch {
+		if res.Err != nil {
+			if err, ok := res.Err.(*dlib.Error); ok &&
+				err.Code == http.StatusNotFound {
+				continue
+			}
+
+			return nil, res.Err
+		}
+
+		var p dauth.Perm
+		switch v := res.Val.(type) {
+		case dauth.Perm:
+			p = v
+		case *dauth.Perm:
+			p = *v
+		default:
+			continue
+		}
+
+		m.Add(p)
+		perms[p.ID] = &p
+		if r == nil {
+			continue
+		}
+
+		pp := lib.ParsePermPattern(p.Service, p.Name)
+		if pp.Match(r.Service, r.Name) && (pp.Deny || pp.Literal()) {
+			break
+		}
+	}
+
+	if err := s.addUserGrants(ctx, m, userID, perms); err != nil {
+		return nil, err
+	}
+
+	s.Cache.setMatcher(gen, userID, m)
+	return m, nil
+}
+
+// getPerm returns the perm with the provided id, or nil if it does not
+// exist.
+func (s *Server) getPerm(ctx context.Context, id int64) (*dauth.Perm, error) {
+	var p *dauth.Perm
+	qp := dauth.PermFind{ID: &id}
+	for r := range s.Perms.GetPerms(ctx, &qp) {
+		if r.Err != nil {
+			if err, ok := r.Err.(*dlib.Error); ok &&
+				err.Code == http.StatusNotFound {
+				continue
+			}
+
+			return nil, r.Err
+		}
+
+		switch v := r.Val.(type) {
+		case dauth.Perm:
+			p = &v
+		case *dauth.Perm:
+			p = v
+		}
+	}
+
+	return p, nil
+}
+
+// tokenUser returns the user of the token provided in an Auth request,
+// caching it until the token expires.
+func (s *Server) tokenUser(ctx context.Context,
+	req *ptypes.AuthRequest) (*dauth.User, error) {
+	if u, ok := s.Cache.token(req.Token.Token); ok {
+		return u, nil
+	}
+
+	gen := s.Cache.generation()
+	var u *dauth.User
+	var exp time.Time
+	var err error
+	if s.Stateless {
+		u, exp, err = s.verifyToken(ctx, req)
+	} else {
+		u, exp, err = s.lookupToken(ctx, req)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	s.Cache.setToken(gen, req.Token.Token, u, exp)
+	return u, nil
+}
+
+// lookupToken finds the token provided in an Auth request in the database
+// and returns the user it belongs to and when the token expires.
+func (s *Server) lookupToken(ctx context.Context,
+	req *ptypes.AuthRequest) (*dauth.User, time.Time, error) {
 	q := dauth.TokenFind{}
 	q.FromTokenRequest(req.Token)
 	var t []dauth.Token
 	var ch <-chan dlib.Result
-	ch = s.Tokens.GetTokens(&q)
+	ch = s.Tokens.GetTokens(ctx, &q)
 	for tr := range ch {
 		if tr.Err != nil {
 			switch err := tr.Err.(type) {
@@ -43,7 +224,7 @@ func (s *Server) Auth(ctx context.Context,
 						"context": ctx,
 						"request": req,
 					}).Warning("unauthorized token")
-					return nil, err
+					return nil, time.Time{}, err
 				}
 
 				s.Log.WithFields(logrus.Fields{
@@ -52,7 +233,7 @@ func (s *Server) Auth(ctx context.Context,
 					"context": ctx,
 					"request": req,
 				}).Error(err)
-				return nil, err
+				return nil, time.Time{}, err
 			default:
 				s.Log.WithFields(logrus.Fields{
 					"rpc":     "Auth",
@@ -60,13 +241,15 @@ func (s *Server) Auth(ctx context.Context,
 					"context": ctx,
 					"request": req,
 				}).Error(err)
-				return nil, err
+				return nil, time.Time{}, err
 			}
 		}
 
 		switch v := tr.Val.(type) {
 		case *dauth.Token:
 			t = append(t, *v)
+		case dauth.Token:
+			t = append(t, v)
 		default:
 			continue
 		}
@@ -80,7 +263,7 @@ func (s *Server) Auth(ctx context.Context,
 			"context": ctx,
 			"request": req,
 		}).Warning("unauthorized token")
-		return nil, err
+		return nil, time.Time{}, err
 	}
 
 	if t[0].Expires == nil || t[0].Expires.Unix() < time.Now().Unix() {
@@ -91,12 +274,12 @@ func (s *Server) Auth(ctx context.Context,
 			"context": ctx,
 			"request": req,
 		}).Warning("unauthorized token")
-		return nil, err
+		return nil, time.Time{}, err
 	}
 
 	qu := dauth.UserFind{ID: &t[0].UserID}
 	var u []dauth.User
-	ch = s.Users.GetUsers(&qu)
+	ch = s.Users.GetUsers(ctx, &qu)
 	for ur := range ch {
 		if ur.Err != nil {
 			switch err := ur.Err.(type) {
@@ -109,7 +292,7 @@ func (s *Server) Auth(ctx context.Context,
 						"context": ctx,
 						"request": req,
 					}).Warning("unauthorized user")
-					return nil, err
+					return nil, time.Time{}, err
 				}
 
 				s.Log.WithFields(logrus.Fields{
@@ -118,7 +301,7 @@ func (s *Server) Auth(ctx context.Context,
 					"context": ctx,
 					"request": req,
 				}).Error(err)
-				return nil, err
+				return nil, time.Time{}, err
 			default:
 				s.Log.WithFields(logrus.Fields{
 					"rpc":     "Auth",
@@ -126,13 +309,15 @@ func (s *Server) Auth(ctx context.Context,
 					"context": ctx,
 					"request": req,
 				}).Error(err)
-				return nil, err
+				return nil, time.Time{}, err
 			}
 		}
 
 		switch v := ur.Val.(type) {
 		case *dauth.User:
 			u = append(u, *v)
+		case dauth.User:
+			u = append(u, v)
 		default:
 			continue
 		}
@@ -147,95 +332,119 @@ func (s *Server) Auth(ctx context.Context,
 			"context": ctx,
 			"request": req,
 		}).Warning("Unknown user id")
-		return nil, err
+		return nil, time.Time{}, err
 	}
 
-	u[0].Pass = ""
-	ures := u[0].ToResponse()
-	var pres ptypes.PermResponse
-	qup := dauth.UserPermFind{UserID: &u[0].ID}
-	ch = s.UserPerms.GetUserPerms(&qup)
-	ok := false
-	for upr := range ch {
-		if upr.Err != nil {
-			switch err := upr.Err.(type) {
-			case *dlib.Error:
-				if err.Code == http.StatusNotFound {
-					err := dlib.NewError(http.StatusUnauthorized, "unauthorized user")
-					s.Log.WithFields(logrus.Fields{
-						"rpc":     "Auth",
-						"code":    http.StatusUnauthorized,
-						"context": ctx,
-						"request": req,
-					}).Warning("unauthorized user")
-					return nil, err
-				}
+	return &u[0], *t[0].Expires, nil
+}
 
-				s.Log.WithFields(logrus.Fields{
-					"rpc":     "Auth",
-					"code":    http.StatusInternalServerError,
-					"context": ctx,
-					"request": req,
-				}).Error(err)
-				return nil, err
-			default:
-				s.Log.WithFields(logrus.Fields{
-					"rpc":     "Auth",
-					"code":    http.StatusInternalServerError,
-					"context": ctx,
-					"request": req,
-				}).Error(err)
-				return nil, err
-			}
-		}
+// verifyToken validates the token provided in an Auth request using its
+// signature and claims, rejecting invalid tokens without querying the
+// database. The database is only consulted to check that the jti of a valid
+// token is not in the revocation list.
+func (s *Server) verifyToken(ctx context.Context,
+	req *ptypes.AuthRequest) (*dauth.User, time.Time, error) {
+	if s.Keys == nil {
+		err := dlib.NewError(http.StatusInternalServerError,
+			"token signing keys not configured")
+		s.Log.WithFields(logrus.Fields{
+			"rpc":     "Auth",
+			"code":    http.StatusInternalServerError,
+			"context": ctx,
+			"request": req,
+		}).Error(err)
+		return nil, time.Time{}, err
+	}
 
-		switch v := upr.Val.(type) {
-		case *dauth.UserPerm:
-			qp := dauth.PermFind{ID: &v.PermID}
-			chp := s.Perms.GetPerms(&qp)
-			for up := range chp {
-				if up.Err != nil {
-					s.Log.WithFields(logrus.Fields{
-						"rpc":     "Auth",
-						"code":    http.StatusInternalServerError,
-						"context": ctx,
-						"request": req,
-					}).Error(up.Err)
-					continue
-				}
+	tc, err := s.Keys.Verify(req.Token.Token, s.Issuer, s.Audience)
+	if err == nil && tc.MFAPending {
+		err = dlib.NewError(http.StatusUnauthorized,
+			"two-factor authentication pending")
+	} else if err == nil && tc.PassChange {
+		err = dlib.NewError(http.StatusUnauthorized,
+			"password change pending")
+	}
 
-				switch v := up.Val.(type) {
-				case *dauth.Perm:
-					if v.Service == "admin" || v.Service == req.Perm.Service {
-						if v.Name == "admin" || v.Name == req.Perm.Name {
-							pres = v.ToResponse()
-							ok = true
-							break
-						}
-					}
-				default:
-					continue
-				}
-			}
-		default:
-			continue
-		}
+	if err != nil {
+		s.Log.WithFields(logrus.Fields{
+			"rpc":     "Auth",
+			"code":    http.StatusUnauthorized,
+			"context": ctx,
+			"request": req,
+			"error":   err,
+		}).Warning("unauthorized token")
+		return nil, time.Time{}, dlib.NewError(http.StatusUnauthorized,
+			"unauthorized token")
 	}
 
-	res := ptypes.AuthResponse{
-		Ok:   ok,
-		User: &ures,
-		Perm: &pres,
+	revoked, err := s.tokenRevoked(ctx, tc.Id)
+	if err != nil {
+		s.Log.WithFields(logrus.Fields{
+			"rpc":     "Auth",
+			"code":    http.StatusInternalServerError,
+			"context": ctx,
+			"request": req,
+		}).Error(err)
+		return nil, time.Time{}, err
 	}
 
-	return &res, nil
+	if revoked {
+		err := dlib.NewError(http.StatusUnauthorized, "unauthorized token")
+		s.Log.WithFields(logrus.Fields{
+			"rpc":     "Auth",
+			"code":    http.StatusUnauthorized,
+			"context": ctx,
+			"request": req,
+		}).Warning("revoked token")
+		return nil, time.Time{}, err
+	}
+
+	return &dauth.User{ID: tc.UserID, User: tc.User},
+		time.Unix(tc.Expires, 0), nil
 }
 
-// Login authenticates a provided user and creates a new token.
+// Login authenticates a provided user and creates a new token. The refresh
+// token issued with it is returned in the refresh-token response header.
+// When the user must complete two-factor authentication, the token returned
+// is an MFA pending token and the mfa-pending response header is set. When
+// the user must change their password, it is a password change token and
+// the password-change response header is set.
 func (s *Server) Login(ctx context.Context,
 	req *ptypes.UserRequest) (*ptypes.TokenResponse, error) {
+	res, err := s.login(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	md := metadata.Pairs(RefreshTokenHeader, res.RefreshToken)
+	if res.MFAPending {
+		md = metadata.Pairs(MFAPendingHeader, "true")
+	} else if res.PasswordChange {
+		md = metadata.Pairs(PasswordChangeHeader, "true")
+	}
+
+	if err := grpc.SetHeader(ctx, md); err != nil {
+		s.Log.WithFields(logrus.Fields{
+			"rpc":     "Login",
+			"context": ctx,
+		}).Debug(err)
+	}
+
+	return res.Token, nil
+}
+
+// login authenticates a provided user and issues a new access and refresh
+// token pair. Every attempt is recorded in the audit log and counted in
+// the metrics.
+func (s *Server) login(ctx context.Context,
+	req *ptypes.UserRequest) (res *TokenPair, err error) {
 	uq := dauth.User{}
 	uq.FromRequest(req)
+	defer func() {
+		s.auditLogin(ctx, "Login", &dauth.User{User: uq.User}, res, err)
+		s.Metrics.login("Login", res, err)
+	}()
+
 	if uq.User == "" || uq.Pass == "" {
 		err := dlib.NewError(http.StatusUnauthorized, "unauthorized user")
 		s.Log.WithFields(logrus.Fields{
@@ -259,33 +468,27 @@ func (s *Server) Login(ctx context.Context,
 		return nil, err
 	}
 
-	pw, err = dlib.EncryptString(pw)
-	if err != nil {
-		s.Log.WithFields(logrus.Fields{
-			"rpc":     "Login",
-			"code":    http.StatusInternalServerError,
-			"context": ctx,
-			"request": req,
-		}).Error(err)
+	keys := loginKeys(ctx, uq.User)
+	if err := s.checkThrottle(ctx, "Login", req, keys); err != nil {
 		return nil, err
 	}
 
-	qu := dauth.UserFind{User: &uq.User, Pass: &pw}
+	failed := false
+	defer func() {
+		if !failed {
+			s.releaseThrottle(ctx, "Login", req, keys)
+		}
+	}()
+
+	qu := dauth.UserFind{User: &uq.User}
 	var u []dauth.User
-	ch := s.Users.GetUsers(&qu)
+	ch := s.Users.GetUsers(ctx, &qu)
 	for ur := range ch {
 		if ur.Err != nil {
 			switch err := ur.Err.(type) {
 			case *dlib.Error:
 				if err.Code == http.StatusNotFound {
-					err := dlib.NewError(http.StatusUnauthorized, "unauthorized user")
-					s.Log.WithFields(logrus.Fields{
-						"rpc":     "Login",
-						"code":    http.StatusUnauthorized,
-						"context": ctx,
-						"request": req,
-					}).Warning("unauthorized user")
-					return nil, err
+					continue
 				}
 
 				s.Log.WithFields(logrus.Fields{
@@ -317,7 +520,9 @@ func (s *Server) Login(ctx context.Context,
 	}
 
 	if len(u) == 0 {
-		dlib.NewError(http.StatusUnauthorized, "unauthorized user")
+		lib.CheckNoPassword(pw, s.PasswordCost)
+		failed = true
+		err := dlib.NewError(http.StatusUnauthorized, "unauthorized user")
 		s.Log.WithFields(logrus.Fields{
 			"rpc":     "Login",
 			"code":    http.StatusUnauthorized,
@@ -327,15 +532,7 @@ func (s *Server) Login(ctx context.Context,
 		return nil, err
 	}
 
-	ct := time.Now()
-	et := ct.Add(time.Hour * 24)
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user":    u[0].User,
-		"created": ct.Unix(),
-		"expires": et.Unix(),
-	})
-
-	ts, err := token.SignedString([]byte(">^_^<"))
+	ok, rehash, err := lib.CheckPassword(u[0].Pass, pw, s.PasswordCost)
 	if err != nil {
 		s.Log.WithFields(logrus.Fields{
 			"rpc":     "Login",
@@ -346,33 +543,52 @@ func (s *Server) Login(ctx context.Context,
 		return nil, err
 	}
 
-	t := dauth.Token{
-		Token:   ts,
-		UserID:  u[0].ID,
-		Created: &ct,
-		Expires: &et,
+	if !ok {
+		failed = true
+		err := dlib.NewError(http.StatusUnauthorized, "unauthorized user")
+		s.Log.WithFields(logrus.Fields{
+			"rpc":     "Login",
+			"code":    http.StatusUnauthorized,
+			"context": ctx,
+			"request": req,
+		}).Warning("unauthorized user")
+		return nil, err
+	}
+
+	// Failures from the client address are kept, so that a client can not
+	// clear them by logging in to an account it controls.
+	s.resetThrottle(ctx, "Login", req,
+		[]string{lib.LoginUserKey(uq.User)})
+	if rehash {
+		s.rehashPassword(ctx, req, &u[0], pw)
 	}
 
-	ch = s.Tokens.SaveToken(&t)
-	for tr := range ch {
-		if tr.Err != nil {
-			s.Log.WithFields(logrus.Fields{
-				"rpc":     "Login",
-				"code":    http.StatusInternalServerError,
-				"context": ctx,
-				"request": req,
-			}).Error(err)
-			return nil, err
-		}
+	u[0].Pass = ""
+	mfa, err := s.mfaRequired(ctx, req, &u[0])
+	if err != nil {
+		return nil, err
 	}
 
-	res := t.ToResponse()
-	return &res, nil
+	if mfa {
+		return s.issuePending(ctx, req, &u[0])
+	}
+
+	return s.completeLogin(ctx, "Login", req, &u[0])
 }
 
-// Logout destroys the provided token.
+// Logout destroys the provided token, adds it to the revocation list and
+// revokes the refresh token family it was issued with.
 func (s *Server) Logout(ctx context.Context,
-	req *ptypes.TokenRequest) (*ptypes.TokenResponse, error) {
+	req *ptypes.TokenRequest) (res *ptypes.TokenResponse, err error) {
+	defer func() {
+		var u *dauth.User
+		if err == nil {
+			u = tokenActor(req.Token)
+		}
+
+		s.auditUser(ctx, u, "Logout", "", err)
+	}()
+
 	if req.Token == "" {
 		err := dlib.NewError(http.StatusBadRequest, "invalid token value")
 		s.Log.WithFields(logrus.Fields{
@@ -385,31 +601,76 @@ func (s *Server) Logout(ctx context.Context,
 		return nil, err
 	}
 
+	defer s.Cache.InvalidateToken(req.Token)
+	rq := lib.RefreshTokenFind{AccessToken: &req.Token}
+	revoked, err := s.revokeRefreshTokens(ctx, &rq)
+	if err != nil {
+		s.Log.WithFields(logrus.Fields{
+			"rpc":     "Logout",
+			"code":    http.StatusInternalServerError,
+			"context": ctx,
+			"request": req,
+		}).Error(err)
+		return nil, err
+	}
+
 	q := dauth.TokenFind{Token: &req.Token}
-	ch := s.Tokens.DeleteTokens(&q)
-	for tr := range ch {
-		if tr.Err != nil {
-			s.Log.Error(tr.Err)
-			return nil, tr.Err
-		}
+	n, err := s.revokeTokens(ctx, &q)
+	if err != nil {
+		s.Log.Error(err)
+		return nil, err
+	}
 
-		if tr.Num == 0 {
-			err := dlib.NewError(http.StatusNotFound, "token not found")
-			s.Log.WithFields(logrus.Fields{
-				"rpc":     "Logout",
-				"code":    http.StatusNotFound,
-				"context": ctx,
-				"request": req,
-			}).Error("Token not found")
+	if n == 0 && revoked == 0 {
+		err := dlib.NewError(http.StatusNotFound, "token not found")
+		s.Log.WithFields(logrus.Fields{
+			"rpc":     "Logout",
+			"code":    http.StatusNotFound,
+			"context": ctx,
+			"request": req,
+		}).Error("Token not found")
 
-			return nil, err
-		}
+		return nil, err
 	}
 
-	res := ptypes.TokenResponse{
+	return &ptypes.TokenResponse{
 		Token:  "logout",
 		UserID: 0,
+	}, nil
+}
+
+// rehashPassword replaces an out of date password hash for a user who has
+// just logged in. Failures are logged, but do not fail the login.
+func (s *Server) rehashPassword(ctx context.Context,
+	req *ptypes.UserRequest, u *dauth.User, pw string) {
+	ph, err := lib.HashPassword(pw, s.PasswordCost)
+	if err != nil {
+		s.Log.WithFields(logrus.Fields{
+			"rpc":     "Login",
+			"code":    http.StatusInternalServerError,
+			"context": ctx,
+			"request": req,
+			"user_id": u.ID,
+		}).Warning(err)
+		return
 	}
 
-	return &res, nil
+	for r := range s.Users.SaveUserPass(ctx, u.ID, ph) {
+		if r.Err != nil {
+			s.Log.WithFields(logrus.Fields{
+				"rpc":     "Login",
+				"code":    http.StatusInternalServerError,
+				"context": ctx,
+				"request": req,
+				"user_id": u.ID,
+			}).Warning(r.Err)
+			return
+		}
+	}
+
+	s.Log.WithFields(logrus.Fields{
+		"rpc":     "Login",
+		"context": ctx,
+		"user_id": u.ID,
+	}).Info("password hash upgraded")
 }
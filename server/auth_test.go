@@ -2,11 +2,19 @@ package server
 
 import (
 	"context"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/dhaifley/dauth/lib"
 	"github.com/dhaifley/dlib"
+	"github.com/dhaifley/dlib/dauth"
 	"github.com/dhaifley/dlib/ptypes"
 	"github.com/sirupsen/logrus/hooks/test"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestServerAuth(t *testing.T) {
@@ -62,13 +70,33 @@ func TestServerAuth(t *testing.T) {
 			t.Error("Failed to correctly authenticate")
 		}
 	}
+
+	token := &ptypes.TokenRequest{ID: 1, Token: "test", UserID: 1}
+	for _, p := range []*ptypes.PermRequest{
+		nil, {Service: "test"}, {Name: "test"},
+	} {
+		_, err := svr.Auth(context.Background(),
+			&ptypes.AuthRequest{Token: token, Perm: p})
+		if e, ok := err.(*dlib.Error); !ok ||
+			e.Code != http.StatusBadRequest {
+			t.Errorf("Error expected: %v, got: %v", http.StatusBadRequest,
+				err)
+		}
+	}
 }
 
 func TestServerLogin(t *testing.T) {
-	mua := MockUserAccess{}
+	lp, err := dlib.EncryptString("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mua := MockUserAccess{Pass: lp}
 	mta := MockTokenAccess{}
 	lm, _ := test.NewNullLogger()
-	svr := Server{Users: &mua, Tokens: &mta, Log: lm}
+	mrta := MockRefreshTokenAccess{}
+	svr := Server{Users: &mua, Tokens: &mta, RefreshTokens: &mrta,
+		Keys: testKeyRing(t), PasswordCost: bcrypt.MinCost, Log: lm}
 	req := ptypes.UserRequest{
 		ID:   1,
 		User: "test",
@@ -83,13 +111,66 @@ func TestServerLogin(t *testing.T) {
 	if res.UserID != 1 {
 		t.Errorf("User id expected: 1, got: %v", res.UserID)
 	}
+
+	pair, err := svr.login(context.Background(), &req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pair.RefreshToken == "" {
+		t.Error("Expected refresh token")
+	}
+
+	if ok, rehash, err := lib.CheckPassword(mua.Hash, "test",
+		bcrypt.MinCost); err != nil || !ok || rehash {
+		t.Errorf("Expected legacy password hash to be upgraded, got: %v",
+			mua.Hash)
+	}
+
+	mua.Pass = mua.Hash
+	mua.Hash = ""
+	if _, err := svr.login(context.Background(), &req); err != nil {
+		t.Fatal(err)
+	}
+
+	if mua.Hash != "" {
+		t.Errorf("Expected current password hash to be kept, got: %v",
+			mua.Hash)
+	}
+
+	req.Pass = dlib.EncodeBase64String("wrong")
+	if _, err := svr.login(context.Background(), &req); err == nil {
+		t.Error("Expected error for wrong password")
+	}
+}
+
+func TestServerLoginNoKeys(t *testing.T) {
+	ph, err := lib.HashPassword("test", bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mua := MockUserAccess{Pass: ph}
+	mta := MockTokenAccess{}
+	lm, _ := test.NewNullLogger()
+	svr := Server{Users: &mua, Tokens: &mta, Log: lm}
+	req := ptypes.UserRequest{
+		ID:   1,
+		User: "test",
+		Pass: dlib.EncodeBase64String("test"),
+	}
+
+	if _, err := svr.Login(context.Background(), &req); err == nil {
+		t.Error("Expected error when no signing keys are configured")
+	}
 }
 
 func TestServerLogout(t *testing.T) {
 	mua := MockUserAccess{}
 	mta := MockTokenAccess{}
+	mrta := MockRefreshTokenAccess{}
 	lm, _ := test.NewNullLogger()
-	svr := Server{Users: &mua, Tokens: &mta, Log: lm}
+	svr := Server{Users: &mua, Tokens: &mta, RefreshTokens: &mrta, Log: lm}
 	req := ptypes.TokenRequest{
 		ID:     1,
 		Token:  "test",
@@ -109,3 +190,238 @@ func TestServerLogout(t *testing.T) {
 		t.Errorf("User ID expected: 0, got: %v", res.UserID)
 	}
 }
+
+type MockCountingTokenAccess struct {
+	MockTokenAccess
+	Calls int
+}
+
+func (m *MockCountingTokenAccess) GetTokens(ctx context.Context,
+	opt *dauth.TokenFind) <-chan dlib.Result {
+	m.Calls++
+	return m.MockTokenAccess.GetTokens(ctx, opt)
+}
+
+func TestServerAuthStateless(t *testing.T) {
+	mua := MockUserAccess{}
+	mta := MockCountingTokenAccess{}
+	mpa := MockPermAccess{}
+	mupa := MockUserPermAccess{}
+	mra := MockRevocationAccess{}
+	lm, _ := test.NewNullLogger()
+	svr := Server{Users: &mua, Tokens: &mta, Perms: &mpa, UserPerms: &mupa,
+		Revocations: &mra, Keys: testKeyRing(t), Stateless: true,
+		Issuer: "dauth", Log: lm}
+	now := time.Now()
+	tc, err := lib.NewTokenClaims("test", 1, "dauth", "", now,
+		now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts, err := svr.Keys.Sign(tc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	perm := ptypes.PermRequest{Service: "test", Name: "test"}
+	res, err := svr.Auth(context.Background(), &ptypes.AuthRequest{
+		Token: &ptypes.TokenRequest{Token: ts},
+		Perm:  &perm,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !res.Ok || res.User.ID != 1 {
+		t.Errorf("Expected authorized user 1, got: %v", res)
+	}
+
+	if mta.Calls != 0 || mra.Calls != 1 {
+		t.Errorf("Token and revocation queries expected: 0, 1, got: %v, %v",
+			mta.Calls, mra.Calls)
+	}
+
+	for _, bad := range []string{"test", ts + "x"} {
+		_, err := svr.Auth(context.Background(), &ptypes.AuthRequest{
+			Token: &ptypes.TokenRequest{Token: bad},
+			Perm:  &perm,
+		})
+		if err == nil {
+			t.Errorf("Expected error for token: %v", bad)
+		}
+	}
+
+	if mta.Calls != 0 || mra.Calls != 1 {
+		t.Errorf("Token and revocation queries expected: 0, 1, got: %v, %v",
+			mta.Calls, mra.Calls)
+	}
+}
+
+func TestServerAuthWildcardDeny(t *testing.T) {
+	svr, mra := testRoleServer()
+	svr.Perms.(*MockPermAccess).Perms[3] = dauth.Perm{ID: 3,
+		Service: "billing", Name: "invoices:*"}
+	svr.Perms.(*MockPermAccess).Perms[4] = dauth.Perm{ID: 4,
+		Service: "!billing", Name: "invoices:delete"}
+	mra.UserRoles = []lib.UserRole{{ID: 1, UserID: 1, RoleID: 1}}
+	mra.RolePerms = []lib.RolePerm{
+		{ID: 1, RoleID: 1, PermID: 3},
+		{ID: 2, RoleID: 1, PermID: 4},
+	}
+
+	cases := []struct {
+		name string
+		exp  bool
+	}{
+		{"invoices:read", true},
+		{"invoices:read:own", true},
+		{"invoices:delete", false},
+		{"payments:read", false},
+	}
+
+	for _, c := range cases {
+		res, err := svr.Auth(context.Background(), &ptypes.AuthRequest{
+			Token: &ptypes.TokenRequest{Token: "test"},
+			Perm:  &ptypes.PermRequest{Service: "billing", Name: c.name},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if res.Ok != c.exp {
+			t.Errorf("billing/%v expected: %v, got: %v", c.name, c.exp,
+				res.Ok)
+		}
+
+		if res.Ok && res.Perm.ID != 3 {
+			t.Errorf("Perm expected: 3, got: %v", res.Perm.ID)
+		}
+	}
+}
+
+type MockCountingRows struct {
+	rows [][]interface{}
+	row  int
+}
+
+func (m *MockCountingRows) Close() error {
+	return nil
+}
+
+func (m *MockCountingRows) Next() bool {
+	m.row++
+	return m.row <= len(m.rows)
+}
+
+func (m *MockCountingRows) Scan(dest ...interface{}) error {
+	row := m.rows[m.row-1]
+	for i, d := range dest {
+		var val interface{}
+		if i < len(row) {
+			val = row[i]
+		}
+
+		switch v := d.(type) {
+		case *int64:
+			*v = 1
+			if n, ok := val.(int64); ok {
+				*v = n
+			}
+		case *int:
+			*v = 1
+		case *string:
+			*v = "test"
+			if s, ok := val.(string); ok {
+				*v = s
+			}
+		case *sql.NullString:
+			*v = sql.NullString{String: "test", Valid: true}
+		case *bool:
+			*v = false
+		case *dlib.NullTime:
+			*v = dlib.NullTime{Time: time.Now().Add(time.Hour), Valid: true}
+		default:
+			return dlib.NewError(500, "Invalid type")
+		}
+	}
+
+	return nil
+}
+
+// MockCountingDBSession counts queries, answering token and user lookups
+// with one row and effective perm lookups with Perms rows.
+type MockCountingDBSession struct {
+	Perms   int
+	Queries int
+}
+
+func (m *MockCountingDBSession) Close() error {
+	return nil
+}
+
+func (m *MockCountingDBSession) Exec(query string,
+	args ...interface{}) (sql.Result, error) {
+	m.Queries++
+	return nil, nil
+}
+
+func (m *MockCountingDBSession) Query(query string,
+	args ...interface{}) (dlib.SQLRows, error) {
+	m.Queries++
+	rows := MockCountingRows{}
+	switch {
+	case strings.Contains(query, "get_tokens"),
+		strings.Contains(query, "get_users"):
+		rows.rows = [][]interface{}{{}}
+	case strings.Contains(query, "get_user_effective_perms"):
+		for i := 1; i <= m.Perms; i++ {
+			rows.rows = append(rows.rows, []interface{}{int64(i), "bench",
+				"perm" + strconv.Itoa(i)})
+		}
+	}
+
+	return &rows, nil
+}
+
+func (m *MockCountingDBSession) Ping() error {
+	return nil
+}
+
+func (m *MockCountingDBSession) Stats() sql.DBStats {
+	return sql.DBStats{OpenConnections: 0}
+}
+
+func BenchmarkServerAuth(b *testing.B) {
+	for _, n := range []int{1, 10, 100} {
+		b.Run("perms="+strconv.Itoa(n), func(b *testing.B) {
+			lm, _ := test.NewNullLogger()
+			dbs := MockCountingDBSession{Perms: n}
+			svr := Server{Log: lm}
+			if err := svr.ConnectSQL(&dbs); err != nil {
+				b.Fatal(err)
+			}
+
+			req := ptypes.AuthRequest{
+				Token: &ptypes.TokenRequest{Token: "test"},
+				Perm: &ptypes.PermRequest{Service: "bench",
+					Name: "perm" + strconv.Itoa(n)},
+			}
+
+			dbs.Queries = 0
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				res, err := svr.Auth(context.Background(), &req)
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				if !res.Ok {
+					b.Fatal("Auth expected to allow the request")
+				}
+			}
+
+			b.ReportMetric(float64(dbs.Queries)/float64(b.N), "queries/op")
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/dhaifley/dauth/lib"
+	"github.com/dhaifley/dlib"
+	"github.com/dhaifley/dlib/ptypes"
+	"github.com/sirupsen/logrus"
+)
+
+// MaxBatchChecks is the maximum number of checks in a BatchAuth request.
+const MaxBatchChecks = 100
+
+// BatchAuthRequest values request several perms with one token. IP and Time
+// apply to every check, as in Authorize requests.
+type BatchAuthRequest struct {
+	Token  string      `json:"token"`
+	Checks []AuthCheck `json:"checks"`
+	IP     string      `json:"ip,omitempty"`
+	Time   *time.Time  `json:"time,omitempty"`
+}
+
+// BatchAuthResponse values hold the decisions of BatchAuth requests, in the
+// order of the checks.
+type BatchAuthResponse struct {
+	User      *ptypes.UserResponse `json:"user"`
+	Decisions []AuthDecision       `json:"decisions"`
+}
+
+// EffectivePermsRequest values request the perms held by a token holder.
+type EffectivePermsRequest struct {
+	Token string `json:"token"`
+}
+
+// EffectivePerm values are perms held by a user. Grant is empty when the
+// perm was granted without a resource or conditions.
+type EffectivePerm struct {
+	Perm  *ptypes.PermResponse `json:"perm"`
+	Deny  bool                 `json:"deny,omitempty"`
+	Grant *lib.Grant           `json:"grant,omitempty"`
+}
+
+// EffectivePermsResponse values list the perms held by a token holder.
+type EffectivePermsResponse struct {
+	User  *ptypes.UserResponse `json:"user"`
+	Perms []EffectivePerm      `json:"perms"`
+}
+
+// BatchAuth authenticates a provided token once and decides a list of
+// perms requested for resources.
+func (s *Server) BatchAuth(ctx context.Context,
+	req *BatchAuthRequest) (*BatchAuthResponse, error) {
+	if len(req.Checks) == 0 || len(req.Checks) > MaxBatchChecks {
+		err := dlib.NewError(http.StatusBadRequest, "invalid number of checks")
+		return nil, s.extError(ctx, "BatchAuth", req, err)
+	}
+
+	for i := range req.Checks {
+		if !validCheck(&req.Checks[i]) {
+			err := dlib.NewError(http.StatusBadRequest, "invalid perm")
+			return nil, s.extError(ctx, "BatchAuth", req, err)
+		}
+	}
+
+	u, m, err := s.authorizer(ctx, "BatchAuth", req, req.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	ip, t, err := s.requestValues(ctx, "BatchAuth", req, m, req.IP,
+		req.Time)
+	if err != nil {
+		return nil, err
+	}
+
+	res := BatchAuthResponse{
+		User:      userResponse(u),
+		Decisions: make([]AuthDecision, 0, len(req.Checks)),
+	}
+
+	allowed := 0
+	for i := range req.Checks {
+		c := &req.Checks[i]
+		d := authDecision(c, m.Decide(c.accessRequest(u.ID, ip, t)))
+		if d.Ok {
+			allowed++
+		}
+
+		res.Decisions = append(res.Decisions, d)
+	}
+
+	s.Log.WithFields(logrus.Fields{
+		"rpc":     "BatchAuth",
+		"code":    http.StatusOK,
+		"context": ctx,
+		"request": req,
+		"user_id": u.ID,
+		"count":   len(res.Decisions),
+		"allowed": allowed,
+	}).Info("BatchAuth request processed")
+	return &res, nil
+}
+
+// EffectivePerms authenticates a provided token and returns the perms its
+// user holds directly, through roles and through groups, including deny
+// grants and the grants limiting perms to resources. Each perm is listed
+// once per grant.
+func (s *Server) EffectivePerms(ctx context.Context,
+	req *EffectivePermsRequest) (*EffectivePermsResponse, error) {
+	u, m, err := s.authorizer(ctx, "EffectivePerms", req, req.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	type key struct{ perm, grant int64 }
+	seen := map[key]bool{}
+	res := EffectivePermsResponse{
+		User:  userResponse(u),
+		Perms: []EffectivePerm{},
+	}
+
+	for _, d := range m.Grants() {
+		k := key{perm: d.Perm.ID, grant: grantID(d.Grant)}
+		if seen[k] {
+			continue
+		}
+
+		seen[k] = true
+		pres := d.Perm.ToResponse()
+		res.Perms = append(res.Perms, EffectivePerm{
+			Perm:  &pres,
+			Deny:  d.Denied,
+			Grant: d.Grant,
+		})
+	}
+
+	s.Log.WithFields(logrus.Fields{
+		"rpc":     "EffectivePerms",
+		"code":    http.StatusOK,
+		"context": ctx,
+		"user_id": u.ID,
+		"count":   len(res.Perms),
+	}).Info("EffectivePerms request processed")
+	return &res, nil
+}
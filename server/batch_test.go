@@ -0,0 +1,134 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/dhaifley/dauth/lib"
+	"github.com/dhaifley/dlib"
+)
+
+func TestServerBatchAuth(t *testing.T) {
+	svr, mga := testGrantServer()
+	mga.Grants = []lib.Grant{
+		{ID: 1, UserID: 1, PermID: 3, Resource: "project:*"},
+		{ID: 2, UserID: 1, PermID: 4, Resource: "project:7"},
+	}
+
+	res, err := svr.BatchAuth(context.Background(), &BatchAuthRequest{
+		Token: "test",
+		Checks: []AuthCheck{
+			{Service: "test", Name: "test"},
+			{Service: "projects", Name: "write", Resource: "project:1"},
+			{Service: "projects", Name: "write", Resource: "project:7"},
+			{Service: "billing", Name: "read"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := []struct {
+		ok, denied bool
+		grant      int64
+	}{
+		{true, false, 0},
+		{true, false, 1},
+		{false, true, 2},
+		{false, false, 0},
+	}
+
+	if len(res.Decisions) != len(exp) {
+		t.Fatalf("Decisions expected: %v, got: %v", len(exp),
+			len(res.Decisions))
+	}
+
+	for i, e := range exp {
+		d := res.Decisions[i]
+		if d.Ok != e.ok || d.Denied != e.denied || grantID(d.Grant) != e.grant {
+			t.Errorf("Decision %v expected: %v, got: %v", i, e, d)
+		}
+	}
+
+	if res.User == nil || res.User.ID != 1 {
+		t.Errorf("User expected: 1, got: %v", res.User)
+	}
+
+	_, err = svr.BatchAuth(context.Background(),
+		&BatchAuthRequest{Token: "test"})
+	if e, ok := err.(*dlib.Error); !ok || e.Code != http.StatusBadRequest {
+		t.Errorf("Error expected: 400, got: %v", err)
+	}
+
+	_, err = svr.BatchAuth(context.Background(), &BatchAuthRequest{
+		Token:  "test",
+		Checks: make([]AuthCheck, MaxBatchChecks+1),
+	})
+	if e, ok := err.(*dlib.Error); !ok || e.Code != http.StatusBadRequest {
+		t.Errorf("Error expected: 400, got: %v", err)
+	}
+
+	_, err = svr.BatchAuth(context.Background(), &BatchAuthRequest{
+		Token:  "test",
+		Checks: []AuthCheck{{Service: "test", Name: "test"}},
+		IP:     "10.1.2.3",
+	})
+	if e, ok := err.(*dlib.Error); !ok || e.Code != http.StatusForbidden {
+		t.Errorf("Error expected: 403, got: %v", err)
+	}
+}
+
+func TestServerEffectivePerms(t *testing.T) {
+	svr, mga := testGrantServer()
+	mga.Grants = []lib.Grant{
+		{ID: 1, UserID: 1, PermID: 3, Resource: "project:*"},
+		{ID: 2, UserID: 1, PermID: 4, Resource: "project:7"},
+	}
+
+	res, err := svr.EffectivePerms(context.Background(),
+		&EffectivePermsRequest{Token: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Perms) != 3 {
+		t.Fatalf("Perms expected: 3, got: %v", res.Perms)
+	}
+
+	if res.Perms[0].Perm.ID != 1 || res.Perms[0].Grant != nil {
+		t.Errorf("Perm expected: 1, got: %v", res.Perms[0])
+	}
+
+	if !res.Perms[2].Deny || grantID(res.Perms[2].Grant) != 2 {
+		t.Errorf("Deny grant expected: 2, got: %v", res.Perms[2])
+	}
+}
+
+func TestHTTPBatchAuth(t *testing.T) {
+	svr, _ := testGrantServer()
+	rec := serveHTTP(svr, "POST", "/dauth/authorize/batch",
+		`{"checks":[{"service":"test","name":"test"},`+
+			`{"service":"billing","name":"read"}]}`,
+		"Authorization", "Bearer test")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status expected: 200, got: %v %v", rec.Code, rec.Body)
+	}
+
+	res := BatchAuthResponse{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Decisions) != 2 || !res.Decisions[0].Ok ||
+		res.Decisions[1].Ok {
+		t.Errorf("Decisions expected: true false, got: %v", res.Decisions)
+	}
+
+	rec = serveHTTP(svr, "GET", "/dauth/effective_perms", "",
+		"Authorization", "Bearer test")
+	if rec.Code != http.StatusOK {
+		t.Errorf("Status expected: 200, got: %v %v", rec.Code, rec.Body)
+	}
+}
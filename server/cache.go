@@ -0,0 +1,245 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/dhaifley/dauth/lib"
+	"github.com/dhaifley/dlib/dauth"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// AuthCache values cache the users of tokens and the perm matchers of users
+// for Auth requests. Entries are removed when the rows they were read from
+// change. All methods may be called on a nil AuthCache, which caches
+// nothing.
+type AuthCache struct {
+	Tokens   *lib.Cache
+	Perms    *lib.Cache
+	Fallback time.Duration
+	ttl      time.Duration
+	gen      uint64
+}
+
+// AuthCacheStats values report the lookups of an AuthCache.
+type AuthCacheStats struct {
+	Tokens lib.CacheStats `json:"tokens"`
+	Perms  lib.CacheStats `json:"perms"`
+}
+
+// CacheStatsRequest values request the statistics of the Auth cache.
+type CacheStatsRequest struct{}
+
+// cachedUser values are the token cache entries, keyed by the hash of the
+// token returned by lib.HashToken, as in the token invalidations announced by
+// the database. They hold the id of the user, so that the tokens of a user
+// can be removed.
+type cachedUser struct {
+	user dauth.User
+}
+
+// NewAuthCache creates a new AuthCache holding up to size tokens and size
+// users for up to ttl.
+func NewAuthCache(size int, ttl time.Duration) *AuthCache {
+	ac := AuthCache{
+		Tokens:   lib.NewCache(size, ttl),
+		Perms:    lib.NewCache(size, ttl),
+		Fallback: DefaultCacheFallbackTTL,
+	}
+
+	ac.ttl = ac.Tokens.TTL
+
+	return &ac
+}
+
+// LoadCache configures the Auth cache from the auth_cache_size and
+// auth_cache_ttl settings. A size of zero disables the cache.
+func (s *Server) LoadCache() {
+	size := viper.GetInt("auth_cache_size")
+	if size <= 0 {
+		s.Cache = nil
+		return
+	}
+
+	s.Cache = NewAuthCache(size, viper.GetDuration("auth_cache_ttl"))
+	if s.Log != nil {
+		s.Log.WithFields(logrus.Fields{
+			"size": s.Cache.Tokens.Size,
+			"ttl":  s.Cache.Tokens.TTL,
+		}).Info("Auth cache configured")
+	}
+}
+
+// CacheStats returns the statistics of the Auth cache.
+func (s *Server) CacheStats(ctx context.Context,
+	req *CacheStatsRequest) (*AuthCacheStats, error) {
+	res := s.Cache.Stats()
+	s.Log.WithFields(logrus.Fields{
+		"rpc":     "CacheStats",
+		"code":    http.StatusOK,
+		"context": ctx,
+	}).Debug("CacheStats request processed")
+	return &res, nil
+}
+
+// Stats returns the statistics of the cache.
+func (ac *AuthCache) Stats() AuthCacheStats {
+	if ac == nil {
+		return AuthCacheStats{}
+	}
+
+	return AuthCacheStats{
+		Tokens: ac.Tokens.Stats(),
+		Perms:  ac.Perms.Stats(),
+	}
+}
+
+// generation returns a value which changes whenever entries are removed.
+// Values read before a removal are not cached after it, so that a lookup
+// racing with a change can not cache stale rows.
+func (ac *AuthCache) generation() uint64 {
+	if ac == nil {
+		return 0
+	}
+
+	return atomic.LoadUint64(&ac.gen)
+}
+
+// changed advances the generation of the cache.
+func (ac *AuthCache) changed() {
+	atomic.AddUint64(&ac.gen, 1)
+}
+
+// token returns the cached user of a token.
+func (ac *AuthCache) token(token string) (*dauth.User, bool) {
+	if ac == nil {
+		return nil, false
+	}
+
+	v, ok := ac.Tokens.Get(lib.HashToken(token))
+	if !ok {
+		return nil, false
+	}
+
+	u := v.(cachedUser).user
+	return &u, true
+}
+
+// setToken caches the user of a token until the token expires, unless
+// entries were removed since gen.
+func (ac *AuthCache) setToken(gen uint64, token string, u *dauth.User,
+	expires time.Time) {
+	if ac == nil || ac.generation() != gen {
+		return
+	}
+
+	ac.Tokens.SetTTL(lib.HashToken(token), cachedUser{user: *u},
+		time.Until(expires))
+}
+
+// matcher returns the cached perm matcher of a user.
+func (ac *AuthCache) matcher(userID int64) (*lib.PermMatcher, bool) {
+	if ac == nil {
+		return nil, false
+	}
+
+	v, ok := ac.Perms.Get(userID)
+	if !ok {
+		return nil, false
+	}
+
+	return v.(*lib.PermMatcher), true
+}
+
+// setMatcher caches the perm matcher of a user, unless entries were removed
+// since gen.
+func (ac *AuthCache) setMatcher(gen uint64, userID int64,
+	m *lib.PermMatcher) {
+	if ac == nil || ac.generation() != gen {
+		return
+	}
+
+	ac.Perms.Set(userID, m)
+}
+
+// InvalidateToken removes the cached user of tokens.
+func (ac *AuthCache) InvalidateToken(tokens ...string) {
+	hashes := make([]string, len(tokens))
+	for i, t := range tokens {
+		hashes[i] = lib.HashToken(t)
+	}
+
+	ac.invalidateTokenHash(hashes...)
+}
+
+// invalidateTokenHash removes the cached user of tokens by their hashes.
+func (ac *AuthCache) invalidateTokenHash(hashes ...string) {
+	if ac == nil {
+		return
+	}
+
+	ac.changed()
+	for _, h := range hashes {
+		ac.Tokens.Delete(h)
+	}
+}
+
+// InvalidateTokens removes the cached users of all tokens.
+func (ac *AuthCache) InvalidateTokens() {
+	if ac == nil {
+		return
+	}
+
+	ac.changed()
+	ac.Tokens.Purge()
+}
+
+// InvalidateUser removes the cached tokens and perm matchers of users.
+func (ac *AuthCache) InvalidateUser(ids ...int64) {
+	if ac == nil {
+		return
+	}
+
+	ac.changed()
+	in := map[int64]bool{}
+	for _, id := range ids {
+		in[id] = true
+		ac.Perms.Delete(id)
+	}
+
+	ac.Tokens.DeleteFunc(func(k, v interface{}) bool {
+		return in[v.(cachedUser).user.ID]
+	})
+}
+
+// InvalidatePerms removes the perm matchers of users, or of all users when
+// no ids are provided.
+func (ac *AuthCache) InvalidatePerms(ids ...int64) {
+	if ac == nil {
+		return
+	}
+
+	ac.changed()
+	if len(ids) == 0 {
+		ac.Perms.Purge()
+		return
+	}
+
+	for _, id := range ids {
+		ac.Perms.Delete(id)
+	}
+}
+
+// InvalidateAll removes all entries.
+func (ac *AuthCache) InvalidateAll() {
+	if ac == nil {
+		return
+	}
+
+	ac.changed()
+	ac.Tokens.Purge()
+	ac.Perms.Purge()
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dhaifley/dauth/lib"
+	"github.com/dhaifley/dlib/dauth"
+	"github.com/dhaifley/dlib/ptypes"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestServerAuthCache(t *testing.T) {
+	mta := MockCountingTokenAccess{}
+	lm, _ := test.NewNullLogger()
+	svr := Server{Users: &MockUserAccess{}, Tokens: &mta,
+		RefreshTokens: &MockRefreshTokenAccess{}, Perms: &MockPermAccess{},
+		UserPerms: &MockUserPermAccess{}, Cache: NewAuthCache(10, time.Minute),
+		Log: lm}
+	req := ptypes.AuthRequest{
+		Token: &ptypes.TokenRequest{Token: "test"},
+		Perm:  &ptypes.PermRequest{Service: "test", Name: "test"},
+	}
+
+	for i := 0; i < 2; i++ {
+		res, err := svr.Auth(context.Background(), &req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !res.Ok {
+			t.Error("Auth expected to allow the request")
+		}
+	}
+
+	if mta.Calls != 1 {
+		t.Errorf("Token lookups expected: 1, got: %v", mta.Calls)
+	}
+
+	st, err := svr.CacheStats(context.Background(), &CacheStatsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if st.Tokens.Hits != 1 || st.Tokens.Misses != 1 || st.Perms.Hits != 1 {
+		t.Errorf("Stats expected: 1 hit and 1 miss, got: %+v", st)
+	}
+
+	if _, err := svr.Logout(context.Background(),
+		&ptypes.TokenRequest{Token: "test"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := svr.Auth(context.Background(), &req); err != nil {
+		t.Fatal(err)
+	}
+
+	if mta.Calls != 2 {
+		t.Errorf("Token lookups expected after logout: 2, got: %v", mta.Calls)
+	}
+}
+
+func TestServerAuthCacheInvalidation(t *testing.T) {
+	svr, mga := testGrantServer()
+	svr.Cache = NewAuthCache(10, time.Minute)
+	req := ptypes.AuthRequest{
+		Token: &ptypes.TokenRequest{Token: "test"},
+		Perm:  &ptypes.PermRequest{Service: "projects", Name: "write"},
+	}
+
+	res, err := svr.Auth(context.Background(), &req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Ok {
+		t.Error("Auth expected to refuse the request")
+	}
+
+	mga.Grants = []lib.Grant{{ID: 1, UserID: 1, PermID: 3}}
+	if res, _ = svr.Auth(context.Background(), &req); res.Ok {
+		t.Error("Cached perms expected before invalidation")
+	}
+
+	if _, err := svr.SaveGrants(context.Background(), &GrantList{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if res, _ = svr.Auth(context.Background(), &req); !res.Ok {
+		t.Error("Auth expected to allow the request after invalidation")
+	}
+
+	if _, err := svr.DeleteUserPerms(context.Background(),
+		&ptypes.UserPermRequest{UserID: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	if st := svr.Cache.Stats(); st.Perms.Entries != 0 {
+		t.Errorf("Perm entries expected: 0, got: %v", st.Perms.Entries)
+	}
+}
+
+func TestAuthCacheGeneration(t *testing.T) {
+	ac := NewAuthCache(10, time.Minute)
+	u := dauth.User{ID: 1, User: "test"}
+	gen := ac.generation()
+	ac.InvalidateUser(2)
+	ac.setToken(gen, "stale", &u, time.Now().Add(time.Hour))
+	if _, ok := ac.token("stale"); ok {
+		t.Error("Expected a lookup racing with a change not to be cached")
+	}
+
+	ac.setToken(ac.generation(), "test", &u, time.Now().Add(time.Hour))
+	if _, ok := ac.token("test"); !ok {
+		t.Error("Expected the token to be cached")
+	}
+
+	if _, ok := ac.Tokens.Get("test"); ok {
+		t.Error("Expected the token to be cached by its hash")
+	}
+
+	ac.InvalidateUser(1)
+	if _, ok := ac.token("test"); ok {
+		t.Error("Expected the tokens of the user to be removed")
+	}
+
+	var nc *AuthCache
+	nc.InvalidateAll()
+	if _, ok := nc.token("test"); ok {
+		t.Error("Expected a nil cache to cache nothing")
+	}
+}
@@ -0,0 +1,650 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/dhaifley/dauth/lib"
+	"github.com/dhaifley/dlib"
+	"github.com/dhaifley/dlib/ptypes"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+)
+
+// The AuthExt service carries the RPCs which are not part of the Auth
+// service defined in the dlib ptypes package. Its messages are plain Go
+// values encoded as JSON, so clients must call it with the json content
+// subtype, for example by using grpc.CallContentSubtype("json").
+
+// JSONCodecName is the gRPC content subtype used by the AuthExt service.
+const JSONCodecName = "json"
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (jsonCodec) Name() string {
+	return JSONCodecName
+}
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+// AuthExtServer is the server API for the AuthExt service.
+type AuthExtServer interface {
+	JWKS(context.Context, *JWKSRequest) (*lib.JWKSet, error)
+	Refresh(context.Context, *RefreshRequest) (*TokenPair, error)
+	Unlock(context.Context, *UnlockRequest) (*UnlockResponse, error)
+	EnrollMFA(context.Context, *MFAEnrollRequest) (*MFAEnrollResponse, error)
+	VerifyMFA(context.Context, *MFAVerifyRequest) (*TokenPair, error)
+	RequireMFA(context.Context, *MFARequireRequest) (*UserMFAResponse, error)
+	ResetMFA(context.Context, *MFAResetRequest) (*UserMFAResponse, error)
+	GetRoles(context.Context, *lib.RoleFind) (*RoleList, error)
+	SaveRoles(context.Context, *RoleList) (*RoleList, error)
+	DeleteRoles(context.Context, *lib.RoleFind) (*ptypes.DeleteResponse, error)
+	GetRolePerms(context.Context, *lib.RolePermFind) (*RolePermList, error)
+	SaveRolePerms(context.Context, *RolePermList) (*RolePermList, error)
+	DeleteRolePerms(context.Context,
+		*lib.RolePermFind) (*ptypes.DeleteResponse, error)
+	GetUserRoles(context.Context, *lib.UserRoleFind) (*UserRoleList, error)
+	SaveUserRoles(context.Context, *UserRoleList) (*UserRoleList, error)
+	DeleteUserRoles(context.Context,
+		*lib.UserRoleFind) (*ptypes.DeleteResponse, error)
+	GetGroups(context.Context, *lib.GroupFind) (*GroupList, error)
+	SaveGroups(context.Context, *GroupList) (*GroupList, error)
+	DeleteGroups(context.Context,
+		*lib.GroupFind) (*ptypes.DeleteResponse, error)
+	GetGroupPerms(context.Context, *lib.GroupPermFind) (*GroupPermList, error)
+	SaveGroupPerms(context.Context, *GroupPermList) (*GroupPermList, error)
+	DeleteGroupPerms(context.Context,
+		*lib.GroupPermFind) (*ptypes.DeleteResponse, error)
+	GetUserGroups(context.Context, *lib.UserGroupFind) (*UserGroupList, error)
+	SaveUserGroups(context.Context, *UserGroupList) (*UserGroupList, error)
+	DeleteUserGroups(context.Context,
+		*lib.UserGroupFind) (*ptypes.DeleteResponse, error)
+	GetGroupGroups(context.Context,
+		*lib.GroupGroupFind) (*GroupGroupList, error)
+	SaveGroupGroups(context.Context, *GroupGroupList) (*GroupGroupList, error)
+	DeleteGroupGroups(context.Context,
+		*lib.GroupGroupFind) (*ptypes.DeleteResponse, error)
+	GetGrants(context.Context, *lib.GrantFind) (*GrantList, error)
+	SaveGrants(context.Context, *GrantList) (*GrantList, error)
+	DeleteGrants(context.Context,
+		*lib.GrantFind) (*ptypes.DeleteResponse, error)
+	Authorize(context.Context, *AuthorizeRequest) (*AuthorizeResponse, error)
+	BatchAuth(context.Context, *BatchAuthRequest) (*BatchAuthResponse, error)
+	EffectivePerms(context.Context,
+		*EffectivePermsRequest) (*EffectivePermsResponse, error)
+	CacheStats(context.Context, *CacheStatsRequest) (*AuthCacheStats, error)
+	LogoutAll(context.Context,
+		*LogoutAllRequest) (*RevokeSessionsResponse, error)
+	RevokeUserSessions(context.Context,
+		*RevokeSessionsRequest) (*RevokeSessionsResponse, error)
+	ListSessions(context.Context, *SessionsRequest) (*SessionList, error)
+	RevokeSessions(context.Context,
+		*RevokeSessionRequest) (*RevokeSessionsResponse, error)
+	ChangePassword(context.Context,
+		*ChangePasswordRequest) (*ChangePasswordResponse, error)
+	ForcePasswordReset(context.Context,
+		*ForcePasswordResetRequest) (*ForcePasswordResetResponse, error)
+	QueryAudit(*lib.AuditFind, AuthExt_QueryAuditServer) error
+}
+
+// RegisterAuthExtServer registers an AuthExtServer with a gRPC server.
+func RegisterAuthExtServer(s *grpc.Server, srv AuthExtServer) {
+	s.RegisterService(&authExtServiceDesc, srv)
+}
+
+// authExtHandler returns the gRPC handler of a unary AuthExt method. The
+// request value created by newReq is decoded and passed to call.
+func authExtHandler(method string, newReq func() interface{},
+	call func(AuthExtServer, context.Context,
+		interface{}) (interface{}, error)) grpc.MethodHandler {
+	return func(srv interface{}, ctx context.Context,
+		dec func(interface{}) error,
+		interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		in := newReq()
+		if err := dec(in); err != nil {
+			return nil, err
+		}
+
+		if interceptor == nil {
+			return call(srv.(AuthExtServer), ctx, in)
+		}
+
+		info := &grpc.UnaryServerInfo{
+			Server:     srv,
+			FullMethod: "/dauth.AuthExt/" + method,
+		}
+
+		handler := func(ctx context.Context,
+			req interface{}) (interface{}, error) {
+			return call(srv.(AuthExtServer), ctx, req)
+		}
+
+		return interceptor(ctx, in, info, handler)
+	}
+}
+
+var authExtJWKSHandler = authExtHandler("JWKS",
+	func() interface{} { return new(JWKSRequest) },
+	func(srv AuthExtServer, ctx context.Context,
+		req interface{}) (interface{}, error) {
+		return srv.JWKS(ctx, req.(*JWKSRequest))
+	})
+
+var authExtRefreshHandler = authExtHandler("Refresh",
+	func() interface{} { return new(RefreshRequest) },
+	func(srv AuthExtServer, ctx context.Context,
+		req interface{}) (interface{}, error) {
+		return srv.Refresh(ctx, req.(*RefreshRequest))
+	})
+
+var authExtUnlockHandler = authExtHandler("Unlock",
+	func() interface{} { return new(UnlockRequest) },
+	func(srv AuthExtServer, ctx context.Context,
+		req interface{}) (interface{}, error) {
+		return srv.Unlock(ctx, req.(*UnlockRequest))
+	})
+
+var authExtEnrollMFAHandler = authExtHandler("EnrollMFA",
+	func() interface{} { return new(MFAEnrollRequest) },
+	func(srv AuthExtServer, ctx context.Context,
+		req interface{}) (interface{}, error) {
+		return srv.EnrollMFA(ctx, req.(*MFAEnrollRequest))
+	})
+
+var authExtVerifyMFAHandler = authExtHandler("VerifyMFA",
+	func() interface{} { return new(MFAVerifyRequest) },
+	func(srv AuthExtServer, ctx context.Context,
+		req interface{}) (interface{}, error) {
+		return srv.VerifyMFA(ctx, req.(*MFAVerifyRequest))
+	})
+
+var authExtRequireMFAHandler = authExtHandler("RequireMFA",
+	func() interface{} { return new(MFARequireRequest) },
+	func(srv AuthExtServer, ctx context.Context,
+		req interface{}) (interface{}, error) {
+		return srv.RequireMFA(ctx, req.(*MFARequireRequest))
+	})
+
+var authExtResetMFAHandler = authExtHandler("ResetMFA",
+	func() interface{} { return new(MFAResetRequest) },
+	func(srv AuthExtServer, ctx context.Context,
+		req interface{}) (interface{}, error) {
+		return srv.ResetMFA(ctx, req.(*MFAResetRequest))
+	})
+
+var authExtGetRolesHandler = authExtHandler("GetRoles",
+	func() interface{} { return new(lib.RoleFind) },
+	func(srv AuthExtServer, ctx context.Context,
+		req interface{}) (interface{}, error) {
+		return srv.GetRoles(ctx, req.(*lib.RoleFind))
+	})
+
+var authExtSaveRolesHandler = authExtHandler("SaveRoles",
+	func() interface{} { return new(RoleList) },
+	func(srv AuthExtServer, ctx context.Context,
+		req interface{}) (interface{}, error) {
+		return srv.SaveRoles(ctx, req.(*RoleList))
+	})
+
+var authExtDeleteRolesHandler = authExtHandler("DeleteRoles",
+	func() interface{} { return new(lib.RoleFind) },
+	func(srv AuthExtServer, ctx context.Context,
+		req interface{}) (interface{}, error) {
+		return srv.DeleteRoles(ctx, req.(*lib.RoleFind))
+	})
+
+var authExtGetRolePermsHandler = authExtHandler("GetRolePerms",
+	func() interface{} { return new(lib.RolePermFind) },
+	func(srv AuthExtServer, ctx context.Context,
+		req interface{}) (interface{}, error) {
+		return srv.GetRolePerms(ctx, req.(*lib.RolePermFind))
+	})
+
+var authExtSaveRolePermsHandler = authExtHandler("SaveRolePerms",
+	func() interface{} { return new(RolePermList) },
+	func(srv AuthExtServer, ctx context.Context,
+		req interface{}) (interface{}, error) {
+		return srv.SaveRolePerms(ctx, req.(*RolePermList))
+	})
+
+var authExtDeleteRolePermsHandler = authExtHandler("DeleteRolePerms",
+	func() interface{} { return new(lib.RolePermFind) },
+	func(srv AuthExtServer, ctx context.Context,
+		req interface{}) (interface{}, error) {
+		return srv.DeleteRolePerms(ctx, req.(*lib.RolePermFind))
+	})
+
+var authExtGetUserRolesHandler = authExtHandler("GetUserRoles",
+	func() interface{} { return new(lib.UserRoleFind) },
+	func(srv AuthExtServer, ctx context.Context,
+		req interface{}) (interface{}, error) {
+		return srv.GetUserRoles(ctx, req.(*lib.UserRoleFind))
+	})
+
+var authExtSaveUserRolesHandler = authExtHandler("SaveUserRoles",
+	func() interface{} { return new(UserRoleList) },
+	func(srv AuthExtServer, ctx context.Context,
+		req interface{}) (interface{}, error) {
+		return srv.SaveUserRoles(ctx, req.(*UserRoleList))
+	})
+
+var authExtDeleteUserRolesHandler = authExtHandler("DeleteUserRoles",
+	func() interface{} { return new(lib.UserRoleFind) },
+	func(srv AuthExtServer, ctx context.Context,
+		req interface{}) (interface{}, error) {
+		return srv.DeleteUserRoles(ctx, req.(*lib.UserRoleFind))
+	})
+
+var authExtGetGroupsHandler = authExtHandler("GetGroups",
+	func() interface{} { return new(lib.GroupFind) },
+	func(srv AuthExtServer, ctx context.Context,
+		req interface{}) (interface{}, error) {
+		return srv.GetGroups(ctx, req.(*lib.GroupFind))
+	})
+
+var authExtSaveGroupsHandler = authExtHandler("SaveGroups",
+	func() interface{} { return new(GroupList) },
+	func(srv AuthExtServer, ctx context.Context,
+		req interface{}) (interface{}, error) {
+		return srv.SaveGroups(ctx, req.(*GroupList))
+	})
+
+var authExtDeleteGroupsHandler = authExtHandler("DeleteGroups",
+	func() interface{} { return new(lib.GroupFind) },
+	func(srv AuthExtServer, ctx context.Context,
+		req interface{}) (interface{}, error) {
+		return srv.DeleteGroups(ctx, req.(*lib.GroupFind))
+	})
+
+var authExtGetGroupPermsHandler = authExtHandler("GetGroupPerms",
+	func() interface{} { return new(lib.GroupPermFind) },
+	func(srv AuthExtServer, ctx context.Context,
+		req interface{}) (interface{}, error) {
+		return srv.GetGroupPerms(ctx, req.(*lib.GroupPermFind))
+	})
+
+var authExtSaveGroupPermsHandler = authExtHandler("SaveGroupPerms",
+	func() interface{} { return new(GroupPermList) },
+	func(srv AuthExtServer, ctx context.Context,
+		req interface{}) (interface{}, error) {
+		return srv.SaveGroupPerms(ctx, req.(*GroupPermList))
+	})
+
+var authExtDeleteGroupPermsHandler = authExtHandler("DeleteGroupPerms",
+	func() interface{} { return new(lib.GroupPermFind) },
+	func(srv AuthExtServer, ctx context.Context,
+		req interface{}) (interface{}, error) {
+		return srv.DeleteGroupPerms(ctx, req.(*lib.GroupPermFind))
+	})
+
+var authExtGetUserGroupsHandler = authExtHandler("GetUserGroups",
+	func() interface{} { return new(lib.UserGroupFind) },
+	func(srv AuthExtServer, ctx context.Context,
+		req interface{}) (interface{}, error) {
+		return srv.GetUserGroups(ctx, req.(*lib.UserGroupFind))
+	})
+
+var authExtSaveUserGroupsHandler = authExtHandler("SaveUserGroups",
+	func() interface{} { return new(UserGroupList) },
+	func(srv AuthExtServer, ctx context.Context,
+		req interface{}) (interface{}, error) {
+		return srv.SaveUserGroups(ctx, req.(*UserGroupList))
+	})
+
+var authExtDeleteUserGroupsHandler = authExtHandler("DeleteUserGroups",
+	func() interface{} { return new(lib.UserGroupFind) },
+	func(srv AuthExtServer, ctx context.Context,
+		req interface{}) (interface{}, error) {
+		return srv.DeleteUserGroups(ctx, req.(*lib.UserGroupFind))
+	})
+
+var authExtGetGroupGroupsHandler = authExtHandler("GetGroupGroups",
+	func() interface{} { return new(lib.GroupGroupFind) },
+	func(srv AuthExtServer, ctx context.Context,
+		req interface{}) (interface{}, error) {
+		return srv.GetGroupGroups(ctx, req.(*lib.GroupGroupFind))
+	})
+
+var authExtSaveGroupGroupsHandler = authExtHandler("SaveGroupGroups",
+	func() interface{} { return new(GroupGroupList) },
+	func(srv AuthExtServer, ctx context.Context,
+		req interface{}) (interface{}, error) {
+		return srv.SaveGroupGroups(ctx, req.(*GroupGroupList))
+	})
+
+var authExtDeleteGroupGroupsHandler = authExtHandler("DeleteGroupGroups",
+	func() interface{} { return new(lib.GroupGroupFind) },
+	func(srv AuthExtServer, ctx context.Context,
+		req interface{}) (interface{}, error) {
+		return srv.DeleteGroupGroups(ctx, req.(*lib.GroupGroupFind))
+	})
+
+var authExtGetGrantsHandler = authExtHandler("GetGrants",
+	func() interface{} { return new(lib.GrantFind) },
+	func(srv AuthExtServer, ctx context.Context,
+		req interface{}) (interface{}, error) {
+		return srv.GetGrants(ctx, req.(*lib.GrantFind))
+	})
+
+var authExtSaveGrantsHandler = authExtHandler("SaveGrants",
+	func() interface{} { return new(GrantList) },
+	func(srv AuthExtServer, ctx context.Context,
+		req interface{}) (interface{}, error) {
+		return srv.SaveGrants(ctx, req.(*GrantList))
+	})
+
+var authExtDeleteGrantsHandler = authExtHandler("DeleteGrants",
+	func() interface{} { return new(lib.GrantFind) },
+	func(srv AuthExtServer, ctx context.Context,
+		req interface{}) (interface{}, error) {
+		return srv.DeleteGrants(ctx, req.(*lib.GrantFind))
+	})
+
+var authExtAuthorizeHandler = authExtHandler("Authorize",
+	func() interface{} { return new(AuthorizeRequest) },
+	func(srv AuthExtServer, ctx context.Context,
+		req interface{}) (interface{}, error) {
+		return srv.Authorize(ctx, req.(*AuthorizeRequest))
+	})
+
+var authExtBatchAuthHandler = authExtHandler("BatchAuth",
+	func() interface{} { return new(BatchAuthRequest) },
+	func(srv AuthExtServer, ctx context.Context,
+		req interface{}) (interface{}, error) {
+		return srv.BatchAuth(ctx, req.(*BatchAuthRequest))
+	})
+
+var authExtEffectivePermsHandler = authExtHandler("EffectivePerms",
+	func() interface{} { return new(EffectivePermsRequest) },
+	func(srv AuthExtServer, ctx context.Context,
+		req interface{}) (interface{}, error) {
+		return srv.EffectivePerms(ctx, req.(*EffectivePermsRequest))
+	})
+
+var authExtCacheStatsHandler = authExtHandler("CacheStats",
+	func() interface{} { return new(CacheStatsRequest) },
+	func(srv AuthExtServer, ctx context.Context,
+		req interface{}) (interface{}, error) {
+		return srv.CacheStats(ctx, req.(*CacheStatsRequest))
+	})
+
+var authExtLogoutAllHandler = authExtHandler("LogoutAll",
+	func() interface{} { return new(LogoutAllRequest) },
+	func(srv AuthExtServer, ctx context.Context,
+		req interface{}) (interface{}, error) {
+		return srv.LogoutAll(ctx, req.(*LogoutAllRequest))
+	})
+
+var authExtRevokeUserSessionsHandler = authExtHandler("RevokeUserSessions",
+	func() interface{} { return new(RevokeSessionsRequest) },
+	func(srv AuthExtServer, ctx context.Context,
+		req interface{}) (interface{}, error) {
+		return srv.RevokeUserSessions(ctx, req.(*RevokeSessionsRequest))
+	})
+
+var authExtListSessionsHandler = authExtHandler("ListSessions",
+	func() interface{} { return new(SessionsRequest) },
+	func(srv AuthExtServer, ctx context.Context,
+		req interface{}) (interface{}, error) {
+		return srv.ListSessions(ctx, req.(*SessionsRequest))
+	})
+
+var authExtRevokeSessionsHandler = authExtHandler("RevokeSessions",
+	func() interface{} { return new(RevokeSessionRequest) },
+	func(srv AuthExtServer, ctx context.Context,
+		req interface{}) (interface{}, error) {
+		return srv.RevokeSessions(ctx, req.(*RevokeSessionRequest))
+	})
+
+var authExtChangePasswordHandler = authExtHandler("ChangePassword",
+	func() interface{} { return new(ChangePasswordRequest) },
+	func(srv AuthExtServer, ctx context.Context,
+		req interface{}) (interface{}, error) {
+		return srv.ChangePassword(ctx, req.(*ChangePasswordRequest))
+	})
+
+var authExtForcePasswordResetHandler = authExtHandler("ForcePasswordReset",
+	func() interface{} { return new(ForcePasswordResetRequest) },
+	func(srv AuthExtServer, ctx context.Context,
+		req interface{}) (interface{}, error) {
+		return srv.ForcePasswordReset(ctx, req.(*ForcePasswordResetRequest))
+	})
+
+var authExtServiceDesc = grpc.ServiceDesc{
+	ServiceName: "dauth.AuthExt",
+	HandlerType: (*AuthExtServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "JWKS",
+			Handler:    authExtJWKSHandler,
+		},
+		{
+			MethodName: "Refresh",
+			Handler:    authExtRefreshHandler,
+		},
+		{
+			MethodName: "Unlock",
+			Handler:    authExtUnlockHandler,
+		},
+		{
+			MethodName: "EnrollMFA",
+			Handler:    authExtEnrollMFAHandler,
+		},
+		{
+			MethodName: "VerifyMFA",
+			Handler:    authExtVerifyMFAHandler,
+		},
+		{
+			MethodName: "RequireMFA",
+			Handler:    authExtRequireMFAHandler,
+		},
+		{
+			MethodName: "ResetMFA",
+			Handler:    authExtResetMFAHandler,
+		},
+		{
+			MethodName: "GetRoles",
+			Handler:    authExtGetRolesHandler,
+		},
+		{
+			MethodName: "SaveRoles",
+			Handler:    authExtSaveRolesHandler,
+		},
+		{
+			MethodName: "DeleteRoles",
+			Handler:    authExtDeleteRolesHandler,
+		},
+		{
+			MethodName: "GetRolePerms",
+			Handler:    authExtGetRolePermsHandler,
+		},
+		{
+			MethodName: "SaveRolePerms",
+			Handler:    authExtSaveRolePermsHandler,
+		},
+		{
+			MethodName: "DeleteRolePerms",
+			Handler:    authExtDeleteRolePermsHandler,
+		},
+		{
+			MethodName: "GetUserRoles",
+			Handler:    authExtGetUserRolesHandler,
+		},
+		{
+			MethodName: "SaveUserRoles",
+			Handler:    authExtSaveUserRolesHandler,
+		},
+		{
+			MethodName: "DeleteUserRoles",
+			Handler:    authExtDeleteUserRolesHandler,
+		},
+		{
+			MethodName: "GetGroups",
+			Handler:    authExtGetGroupsHandler,
+		},
+		{
+			MethodName: "SaveGroups",
+			Handler:    authExtSaveGroupsHandler,
+		},
+		{
+			MethodName: "DeleteGroups",
+			Handler:    authExtDeleteGroupsHandler,
+		},
+		{
+			MethodName: "GetGroupPerms",
+			Handler:    authExtGetGroupPermsHandler,
+		},
+		{
+			MethodName: "SaveGroupPerms",
+			Handler:    authExtSaveGroupPermsHandler,
+		},
+		{
+			MethodName: "DeleteGroupPerms",
+			Handler:    authExtDeleteGroupPermsHandler,
+		},
+		{
+			MethodName: "GetUserGroups",
+			Handler:    authExtGetUserGroupsHandler,
+		},
+		{
+			MethodName: "SaveUserGroups",
+			Handler:    authExtSaveUserGroupsHandler,
+		},
+		{
+			MethodName: "DeleteUserGroups",
+			Handler:    authExtDeleteUserGroupsHandler,
+		},
+		{
+			MethodName: "GetGroupGroups",
+			Handler:    authExtGetGroupGroupsHandler,
+		},
+		{
+			MethodName: "SaveGroupGroups",
+			Handler:    authExtSaveGroupGroupsHandler,
+		},
+		{
+			MethodName: "DeleteGroupGroups",
+			Handler:    authExtDeleteGroupGroupsHandler,
+		},
+		{
+			MethodName: "GetGrants",
+			Handler:    authExtGetGrantsHandler,
+		},
+		{
+			MethodName: "SaveGrants",
+			Handler:    authExtSaveGrantsHandler,
+		},
+		{
+			MethodName: "DeleteGrants",
+			Handler:    authExtDeleteGrantsHandler,
+		},
+		{
+			MethodName: "Authorize",
+			Handler:    authExtAuthorizeHandler,
+		},
+		{
+			MethodName: "BatchAuth",
+			Handler:    authExtBatchAuthHandler,
+		},
+		{
+			MethodName: "EffectivePerms",
+			Handler:    authExtEffectivePermsHandler,
+		},
+		{
+			MethodName: "CacheStats",
+			Handler:    authExtCacheStatsHandler,
+		},
+		{
+			MethodName: "LogoutAll",
+			Handler:    authExtLogoutAllHandler,
+		},
+		{
+			MethodName: "RevokeUserSessions",
+			Handler:    authExtRevokeUserSessionsHandler,
+		},
+		{
+			MethodName: "ListSessions",
+			Handler:    authExtListSessionsHandler,
+		},
+		{
+			MethodName: "RevokeSessions",
+			Handler:    authExtRevokeSessionsHandler,
+		},
+		{
+			MethodName: "ChangePassword",
+			Handler:    authExtChangePasswordHandler,
+		},
+		{
+			MethodName: "ForcePasswordReset",
+			Handler:    authExtForcePasswordResetHandler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "QueryAudit",
+			Handler:       authExtQueryAuditHandler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "dauth_ext",
+}
+
+func authExtQueryAuditHandler(srv interface{},
+	stream grpc.ServerStream) error {
+	m := new(lib.AuditFind)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+
+	return srv.(AuthExtServer).QueryAudit(m,
+		&authExtQueryAuditServer{stream})
+}
+
+type authExtQueryAuditServer struct {
+	grpc.ServerStream
+}
+
+func (x *authExtQueryAuditServer) Send(m *lib.AuditEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// extError logs a failed AuthExt RPC and returns the error.
+func (s *Server) extError(ctx context.Context, rpc string, req interface{},
+	err error) error {
+	code := http.StatusInternalServerError
+	if e, ok := err.(*dlib.Error); ok {
+		code = e.Code
+	}
+
+	s.Log.WithFields(logrus.Fields{
+		"rpc":     rpc,
+		"code":    code,
+		"context": ctx,
+		"request": req,
+	}).Error(err)
+	return err
+}
+
+// extDone logs a processed AuthExt RPC.
+func (s *Server) extDone(ctx context.Context, rpc string, req interface{},
+	count int) {
+	s.Log.WithFields(logrus.Fields{
+		"rpc":     rpc,
+		"code":    http.StatusOK,
+		"context": ctx,
+		"request": req,
+		"count":   count,
+	}).Info(rpc + " request processed")
+}
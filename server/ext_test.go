@@ -0,0 +1,48 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sirupsen/logrus/hooks/test"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+)
+
+func TestJSONCodec(t *testing.T) {
+	c := encoding.GetCodec(JSONCodecName)
+	if c == nil {
+		t.Fatal("JSON codec not registered")
+	}
+
+	b, err := c.Marshal(&JWKSRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Unmarshal(b, &JWKSRequest{}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAuthExtJWKSHandler(t *testing.T) {
+	lm, _ := test.NewNullLogger()
+	svr := Server{Keys: testKeyRing(t), Log: lm}
+	called := ""
+	ic := func(ctx context.Context, req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+		called = info.FullMethod
+		return handler(ctx, req)
+	}
+
+	dec := func(v interface{}) error { return nil }
+	if _, err := authExtJWKSHandler(&svr, context.Background(), dec,
+		ic); err != nil {
+		t.Error(err)
+	}
+
+	if called != "/dauth.AuthExt/JWKS" {
+		t.Errorf("Method expected: /dauth.AuthExt/JWKS, got: %v", called)
+	}
+}
@@ -0,0 +1,404 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dhaifley/dauth/lib"
+	"github.com/dhaifley/dlib"
+	"github.com/dhaifley/dlib/dauth"
+	"github.com/dhaifley/dlib/ptypes"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// GrantHeader is the response header naming the grant which allowed or
+// denied an Auth request, when the perm was granted for a resource or with
+// conditions.
+const GrantHeader = "grant-id"
+
+// GrantList values carry grants in AuthExt requests and responses.
+type GrantList struct {
+	Grants []lib.Grant `json:"grants"`
+}
+
+// AuthCheck values name a perm requested for a resource. Owner, Tenant and
+// Attributes are available to grant conditions as request attributes.
+type AuthCheck struct {
+	Service    string            `json:"service"`
+	Name       string            `json:"name"`
+	Resource   string            `json:"resource,omitempty"`
+	Owner      string            `json:"owner,omitempty"`
+	Tenant     string            `json:"tenant,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// AuthDecision values are the decisions of AuthChecks. Perm and Grant hold
+// the deciding grant. Grant is empty when the perm was granted without a
+// resource or conditions.
+type AuthDecision struct {
+	Service  string               `json:"service"`
+	Name     string               `json:"name"`
+	Resource string               `json:"resource,omitempty"`
+	Ok       bool                 `json:"ok"`
+	Denied   bool                 `json:"denied,omitempty"`
+	Perm     *ptypes.PermResponse `json:"perm,omitempty"`
+	Grant    *lib.Grant           `json:"grant,omitempty"`
+}
+
+// AuthorizeRequest values request a perm for a resource. The request is
+// decided with the address of the client and the current time. IP and Time
+// replace them only for callers holding a perm of PermService.
+type AuthorizeRequest struct {
+	Token string `json:"token"`
+	AuthCheck
+	IP   string     `json:"ip,omitempty"`
+	Time *time.Time `json:"time,omitempty"`
+}
+
+// AuthorizeResponse values are the decisions of Authorize requests.
+type AuthorizeResponse struct {
+	AuthDecision
+	User *ptypes.UserResponse `json:"user"`
+}
+
+// Authorize authenticates a provided token and decides a perm requested for
+// a resource, returning the grant which decided it.
+func (s *Server) Authorize(ctx context.Context,
+	req *AuthorizeRequest) (*AuthorizeResponse, error) {
+	if !validCheck(&req.AuthCheck) {
+		err := dlib.NewError(http.StatusBadRequest, "invalid perm")
+		return nil, s.extError(ctx, "Authorize", req, err)
+	}
+
+	u, m, err := s.authorizer(ctx, "Authorize", req, req.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	ip, t, err := s.requestValues(ctx, "Authorize", req, m, req.IP,
+		req.Time)
+	if err != nil {
+		return nil, err
+	}
+
+	ar := req.accessRequest(u.ID, ip, t)
+	res := AuthorizeResponse{
+		AuthDecision: authDecision(&req.AuthCheck, m.Decide(ar)),
+		User:         userResponse(u),
+	}
+
+	s.Log.WithFields(logrus.Fields{
+		"rpc":      "Authorize",
+		"code":     http.StatusOK,
+		"context":  ctx,
+		"request":  req,
+		"user_id":  u.ID,
+		"ok":       res.Ok,
+		"denied":   res.Denied,
+		"grant_id": grantID(res.Grant),
+	}).Info("Authorize request processed")
+	return &res, nil
+}
+
+// authorizer authenticates a provided token and returns its user, with a
+// matcher for all of the perms and grants the user holds.
+func (s *Server) authorizer(ctx context.Context, rpc string,
+	req interface{}, token string) (*dauth.User, *lib.PermMatcher, error) {
+	if token == "" {
+		err := dlib.NewError(http.StatusBadRequest, "invalid token value")
+		return nil, nil, s.extError(ctx, rpc, req, err)
+	}
+
+	u, err := s.tokenUser(ctx, &ptypes.AuthRequest{
+		Token: &ptypes.TokenRequest{Token: token},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	m, err := s.userMatcher(ctx, u.ID, nil)
+	if err != nil {
+		return nil, nil, s.extError(ctx, rpc, req, err)
+	}
+
+	return u, m, nil
+}
+
+// accessRequest returns the access request of a check made by a user.
+func (c *AuthCheck) accessRequest(userID int64, ip string,
+	t time.Time) *lib.AccessRequest {
+	ar := lib.AccessRequest{
+		Service:    c.Service,
+		Name:       c.Name,
+		Resource:   c.Resource,
+		UserID:     userID,
+		IP:         ip,
+		Time:       t,
+		Attributes: map[string]string{},
+	}
+
+	for k, v := range c.Attributes {
+		ar.Attributes[k] = v
+	}
+
+	if c.Owner != "" {
+		ar.Attributes["owner"] = c.Owner
+	}
+
+	if c.Tenant != "" {
+		ar.Attributes["tenant"] = c.Tenant
+	}
+
+	return &ar
+}
+
+// validCheck returns whether a check names a perm.
+func validCheck(c *AuthCheck) bool {
+	return c.Service != "" && c.Name != ""
+}
+
+// authDecision returns the decision of a check.
+func authDecision(c *AuthCheck, d lib.Decision) AuthDecision {
+	res := AuthDecision{
+		Service:  c.Service,
+		Name:     c.Name,
+		Resource: c.Resource,
+		Ok:       d.Allowed,
+		Denied:   d.Denied,
+		Grant:    d.Grant,
+	}
+
+	if d.Perm != nil {
+		pres := d.Perm.ToResponse()
+		res.Perm = &pres
+	}
+
+	return res
+}
+
+// userResponse returns the response value of a user, without the password.
+func userResponse(u *dauth.User) *ptypes.UserResponse {
+	u.Pass = ""
+	res := u.ToResponse()
+	return &res
+}
+
+// requestValues returns the client address and time to decide a request
+// with. Those given in the request are used only if the caller holds a perm
+// of PermService, so that clients can not satisfy ip and time conditions
+// with values of their own. The caller is the holder of the bearer token of
+// the call, or the holder of the checked token, matched by m, without one.
+func (s *Server) requestValues(ctx context.Context, rpc string,
+	req interface{}, m *lib.PermMatcher, ip string,
+	t *time.Time) (string, time.Time, error) {
+	if ip == "" && t == nil {
+		return peerAddr(ctx), time.Now(), nil
+	}
+
+	if token := callerToken(ctx); token != "" {
+		_, cm, err := s.authorizer(ctx, rpc, req, token)
+		if err != nil {
+			return "", time.Time{}, err
+		}
+
+		m = cm
+	}
+
+	if !matchesAny(m, rpcPermNames("")) {
+		err := dlib.NewError(http.StatusForbidden,
+			"ip and time require a "+PermService+" perm")
+		return "", time.Time{}, s.extError(ctx, rpc, req, err)
+	}
+
+	return requestIP(ctx, ip), requestTime(t), nil
+}
+
+// requestIP returns the client address given in a request, or the address
+// of the client when none is given.
+func requestIP(ctx context.Context, ip string) string {
+	if ip != "" {
+		return ip
+	}
+
+	return peerAddr(ctx)
+}
+
+// requestTime returns the time given in a request, or the current time when
+// none is given.
+func requestTime(t *time.Time) time.Time {
+	if t != nil {
+		return *t
+	}
+
+	return time.Now()
+}
+
+// GetGrants returns the grants matching a request.
+func (s *Server) GetGrants(ctx context.Context,
+	req *lib.GrantFind) (*GrantList, error) {
+	res := GrantList{Grants: []lib.Grant{}}
+	for r := range s.Grants.GetGrants(ctx, req) {
+		if r.Err != nil {
+			return nil, s.extError(ctx, "GetGrants", req, r.Err)
+		}
+
+		if v, ok := r.Val.(lib.Grant); ok {
+			res.Grants = append(res.Grants, v)
+		}
+	}
+
+	s.extDone(ctx, "GetGrants", req, len(res.Grants))
+	return &res, nil
+}
+
+// SaveGrants saves grants and returns them with their assigned ids. Each
+// grant must give a perm to exactly one user, role or group.
+func (s *Server) SaveGrants(ctx context.Context,
+	req *GrantList) (*GrantList, error) {
+	res := GrantList{Grants: []lib.Grant{}}
+	for i := range req.Grants {
+		if !validGrant(&req.Grants[i]) {
+			err := dlib.NewError(http.StatusBadRequest, "invalid grant")
+			return nil, s.extError(ctx, "SaveGrants", req, err)
+		}
+	}
+
+	for i := range req.Grants {
+		for r := range s.Grants.SaveGrant(ctx, &req.Grants[i]) {
+			if r.Err != nil {
+				s.audit(ctx, "SaveGrants", &req.Grants[i], r.Err)
+				return nil, s.extError(ctx, "SaveGrants", req, r.Err)
+			}
+
+			if v, ok := r.Val.(lib.Grant); ok {
+				s.audit(ctx, "SaveGrants", &v, nil)
+				res.Grants = append(res.Grants, v)
+			}
+		}
+	}
+
+	s.Cache.InvalidatePerms()
+	s.extDone(ctx, "SaveGrants", req, len(res.Grants))
+	return &res, nil
+}
+
+// DeleteGrants deletes the grants matching a request.
+func (s *Server) DeleteGrants(ctx context.Context,
+	req *lib.GrantFind) (res *ptypes.DeleteResponse, err error) {
+	defer func() { s.audit(ctx, "DeleteGrants", req, err) }()
+	count := int64(0)
+	for r := range s.Grants.DeleteGrants(ctx, req) {
+		if r.Err != nil {
+			return nil, s.extError(ctx, "DeleteGrants", req, r.Err)
+		}
+
+		count += int64(r.Num)
+	}
+
+	s.Cache.InvalidatePerms()
+	s.extDone(ctx, "DeleteGrants", req, int(count))
+	return &ptypes.DeleteResponse{Num: count}, nil
+}
+
+// validGrant returns whether a grant gives a perm to exactly one user, role
+// or group, using known condition operators.
+func validGrant(g *lib.Grant) bool {
+	holders := 0
+	for _, id := range []int64{g.UserID, g.RoleID, g.GroupID} {
+		if id != 0 {
+			holders++
+		}
+	}
+
+	if holders != 1 || g.PermID == 0 {
+		return false
+	}
+
+	for _, c := range g.Conditions {
+		switch c.Op {
+		case lib.ConditionEq, lib.ConditionNe, lib.ConditionIn,
+			lib.ConditionCIDR, lib.ConditionBetween:
+		default:
+			return false
+		}
+
+		if c.Attr == "" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// grantID returns the id of a grant, or zero for perms granted without a
+// grant.
+func grantID(g *lib.Grant) int64 {
+	if g == nil {
+		return 0
+	}
+
+	return g.ID
+}
+
+// setGrantHeader sets the response header naming the grant which decided
+// an Auth request.
+func (s *Server) setGrantHeader(ctx context.Context, g *lib.Grant) {
+	if g == nil {
+		return
+	}
+
+	md := metadata.Pairs(GrantHeader, strconv.FormatInt(g.ID, 10))
+	if err := grpc.SetHeader(ctx, md); err != nil {
+		s.Log.WithFields(logrus.Fields{
+			"rpc":     "Auth",
+			"context": ctx,
+		}).Debug(err)
+	}
+}
+
+// addUserGrants adds the grants given to a user directly, through roles and
+// through groups to a matcher. The perms of the grants are looked up in
+// perms first, and loaded only when missing from it.
+func (s *Server) addUserGrants(ctx context.Context,
+	m *lib.PermMatcher, userID int64,
+	perms map[int64]*dauth.Perm) error {
+	if s.Grants == nil {
+		return nil
+	}
+
+	for r := range s.Grants.GetUserGrants(ctx, userID) {
+		if r.Err != nil {
+			if err, ok := r.Err.(*dlib.Error); ok &&
+				err.Code == http.StatusNotFound {
+				continue
+			}
+
+			return r.Err
+		}
+
+		g, ok := r.Val.(lib.Grant)
+		if !ok {
+			continue
+		}
+
+		p, ok := perms[g.PermID]
+		if !ok {
+			var err error
+			if p, err = s.getPerm(ctx, g.PermID); err != nil {
+				return err
+			}
+
+			perms[g.PermID] = p
+		}
+
+		if p != nil {
+			m.AddGrant(*p, &g)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,297 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dhaifley/dauth/lib"
+	"github.com/dhaifley/dlib"
+	"github.com/dhaifley/dlib/dauth"
+	"github.com/dhaifley/dlib/ptypes"
+	"google.golang.org/grpc/peer"
+)
+
+type MockGrantAccess struct {
+	sync.Mutex
+	Grants    []lib.Grant
+	UserRoles []lib.UserRole
+}
+
+func (m *MockGrantAccess) GetGrants(ctx context.Context,
+	opt *lib.GrantFind) <-chan dlib.Result {
+	m.Lock()
+	defer m.Unlock()
+	var vals []interface{}
+	for _, g := range m.Grants {
+		if matchID(opt.ID, g.ID) && matchID(opt.UserID, g.UserID) &&
+			matchID(opt.RoleID, g.RoleID) &&
+			matchID(opt.GroupID, g.GroupID) &&
+			matchID(opt.PermID, g.PermID) {
+			vals = append(vals, g)
+		}
+	}
+
+	return mockResults(vals...)
+}
+
+func (m *MockGrantAccess) DeleteGrants(ctx context.Context,
+	opt *lib.GrantFind) <-chan dlib.Result {
+	m.Lock()
+	defer m.Unlock()
+	var keep []lib.Grant
+	for _, g := range m.Grants {
+		if !matchID(opt.ID, g.ID) || !matchID(opt.UserID, g.UserID) ||
+			!matchID(opt.RoleID, g.RoleID) ||
+			!matchID(opt.GroupID, g.GroupID) ||
+			!matchID(opt.PermID, g.PermID) {
+			keep = append(keep, g)
+		}
+	}
+
+	n := len(m.Grants) - len(keep)
+	m.Grants = keep
+	return mockCount(n)
+}
+
+func (m *MockGrantAccess) SaveGrant(ctx context.Context,
+	g *lib.Grant) <-chan dlib.Result {
+	m.Lock()
+	defer m.Unlock()
+	g.ID = int64(len(m.Grants) + 1)
+	m.Grants = append(m.Grants, *g)
+	return mockResults(*g)
+}
+
+func (m *MockGrantAccess) GetUserGrants(ctx context.Context,
+	userID int64) <-chan dlib.Result {
+	m.Lock()
+	defer m.Unlock()
+	var vals []interface{}
+	for _, g := range m.Grants {
+		if g.UserID == userID {
+			vals = append(vals, g)
+			continue
+		}
+
+		for _, ur := range m.UserRoles {
+			if ur.UserID == userID && g.RoleID != 0 && ur.RoleID == g.RoleID {
+				vals = append(vals, g)
+			}
+		}
+	}
+
+	return mockResults(vals...)
+}
+
+func testGrantServer() (*Server, *MockGrantAccess) {
+	svr, _ := testRoleServer()
+	mpa := svr.Perms.(*MockPermAccess)
+	mpa.Perms[3] = dauth.Perm{ID: 3, Service: "projects", Name: "write"}
+	mpa.Perms[4] = dauth.Perm{ID: 4, Service: "!projects", Name: "write"}
+	mga := MockGrantAccess{}
+	svr.Grants = &mga
+	return svr, &mga
+}
+
+func TestServerGrants(t *testing.T) {
+	svr, _ := testGrantServer()
+	ctx := context.Background()
+	_, err := svr.SaveGrants(ctx, &GrantList{Grants: []lib.Grant{
+		{UserID: 1, RoleID: 1, PermID: 3},
+	}})
+	if e, ok := err.(*dlib.Error); !ok || e.Code != http.StatusBadRequest {
+		t.Errorf("Error expected: 400, got: %v", err)
+	}
+
+	_, err = svr.SaveGrants(ctx, &GrantList{Grants: []lib.Grant{
+		{UserID: 1, PermID: 3, Conditions: []lib.Condition{
+			{Attr: "tenant", Op: "like", Value: "acme"},
+		}},
+	}})
+	if e, ok := err.(*dlib.Error); !ok || e.Code != http.StatusBadRequest {
+		t.Errorf("Error expected: 400, got: %v", err)
+	}
+
+	saved, err := svr.SaveGrants(ctx, &GrantList{Grants: []lib.Grant{
+		{UserID: 1, PermID: 3, Resource: "project:42"},
+		{RoleID: 1, PermID: 3, Resource: "project:*"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(saved.Grants) != 2 || saved.Grants[1].ID != 2 {
+		t.Errorf("Grants expected: 2, got: %v", saved.Grants)
+	}
+
+	uid := int64(1)
+	res, err := svr.GetGrants(ctx, &lib.GrantFind{UserID: &uid})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Grants) != 1 || res.Grants[0].Resource != "project:42" {
+		t.Errorf("Grant expected: project:42, got: %v", res.Grants)
+	}
+
+	del, err := svr.DeleteGrants(ctx, &lib.GrantFind{UserID: &uid})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if del.Num != 1 {
+		t.Errorf("Num expected: 1, got: %v", del.Num)
+	}
+}
+
+func TestServerAuthorize(t *testing.T) {
+	svr, mga := testGrantServer()
+	mpa := svr.Perms.(*MockPermAccess)
+	mpa.Perms[5] = dauth.Perm{ID: 5, Service: PermService,
+		Name: "grants:read"}
+	mga.UserRoles = []lib.UserRole{{ID: 1, UserID: 1, RoleID: 1}}
+	mga.Grants = []lib.Grant{
+		{ID: 1, RoleID: 1, PermID: 3, Resource: "project:*",
+			Conditions: []lib.Condition{
+				{Attr: "tenant", Op: "eq", Value: "acme"},
+			}},
+		{ID: 2, UserID: 1, PermID: 3, Resource: "project:*",
+			Conditions: []lib.Condition{
+				{Attr: "owner", Op: "eq", Value: "$user"},
+			}},
+		{ID: 3, UserID: 1, PermID: 4, Resource: "project:7"},
+		{ID: 4, UserID: 1, PermID: 3, Resource: "project:9",
+			Conditions: []lib.Condition{
+				{Attr: "ip", Op: "cidr", Value: "10.0.0.0/8"},
+				{Attr: "time", Op: "between", Value: "09:00-17:00"},
+			}},
+		{ID: 5, UserID: 1, PermID: 5},
+		{ID: 6, UserID: 1, PermID: 3, Resource: "project:11",
+			Conditions: []lib.Condition{
+				{Attr: "ip", Op: "cidr", Value: "10.0.0.0/8"},
+			}},
+	}
+
+	day := time.Date(2018, 9, 4, 10, 0, 0, 0, time.UTC)
+	night := time.Date(2018, 9, 4, 22, 0, 0, 0, time.UTC)
+	cases := []struct {
+		check  AuthCheck
+		ip     string
+		tm     *time.Time
+		ok     bool
+		denied bool
+		grant  int64
+	}{
+		{AuthCheck{Resource: "project:1", Tenant: "acme"}, "", nil,
+			true, false, 1},
+		{AuthCheck{Resource: "project:1", Tenant: "other"}, "", nil,
+			false, false, 0},
+		{AuthCheck{Resource: "project:1", Owner: "1"}, "", nil,
+			true, false, 2},
+		{AuthCheck{Resource: "project:7", Tenant: "acme"}, "", nil,
+			false, true, 3},
+		{AuthCheck{Resource: "project:9"}, "10.1.2.3", &day,
+			true, false, 4},
+		{AuthCheck{Resource: "project:9"}, "10.1.2.3", &night,
+			false, false, 0},
+		{AuthCheck{Resource: "project:9"}, "192.168.1.1", &day,
+			false, false, 0},
+	}
+
+	for i, c := range cases {
+		c.check.Service = "projects"
+		c.check.Name = "write"
+		res, err := svr.Authorize(context.Background(), &AuthorizeRequest{
+			Token: "test", AuthCheck: c.check, IP: c.ip, Time: c.tm})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if res.Ok != c.ok || res.Denied != c.denied {
+			t.Errorf("Case %v expected: %v/%v, got: %v/%v", i, c.ok,
+				c.denied, res.Ok, res.Denied)
+		}
+
+		if grantID(res.Grant) != c.grant {
+			t.Errorf("Case %v grant expected: %v, got: %v", i, c.grant,
+				res.Grant)
+		}
+	}
+
+	res, err := svr.Authorize(context.Background(), &AuthorizeRequest{
+		Token: "test", AuthCheck: AuthCheck{Service: "test", Name: "test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !res.Ok || res.Grant != nil || res.Perm.ID != 1 {
+		t.Errorf("Plain perm expected, got: %v", res)
+	}
+
+	mga.Grants = append(mga.Grants[:4], mga.Grants[5])
+	check := AuthCheck{Service: "projects", Name: "write",
+		Resource: "project:11"}
+	_, err = svr.Authorize(context.Background(), &AuthorizeRequest{
+		Token: "test", AuthCheck: check, IP: "10.1.2.3"})
+	if e, ok := err.(*dlib.Error); !ok || e.Code != http.StatusForbidden {
+		t.Errorf("Error expected: 403, got: %v", err)
+	}
+
+	_, err = svr.Authorize(testBearerContext("test"), &AuthorizeRequest{
+		Token: "test", AuthCheck: check, Time: &day})
+	if e, ok := err.(*dlib.Error); !ok || e.Code != http.StatusForbidden {
+		t.Errorf("Error expected: 403, got: %v", err)
+	}
+
+	for _, c := range []struct {
+		ip string
+		ok bool
+	}{{"10.1.2.3", true}, {"192.168.1.1", false}} {
+		ctx := peer.NewContext(context.Background(), &peer.Peer{
+			Addr: &net.TCPAddr{IP: net.ParseIP(c.ip), Port: 1234},
+		})
+		res, err = svr.Authorize(ctx, &AuthorizeRequest{
+			Token: "test", AuthCheck: check})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if res.Ok != c.ok {
+			t.Errorf("Peer %v expected: %v, got: %v", c.ip, c.ok,
+				res.Ok)
+		}
+	}
+}
+
+func TestServerAuthGrants(t *testing.T) {
+	svr, mga := testGrantServer()
+	mga.Grants = []lib.Grant{{ID: 1, UserID: 1, PermID: 3}}
+	res, err := svr.Auth(context.Background(), &ptypes.AuthRequest{
+		Token: &ptypes.TokenRequest{Token: "test"},
+		Perm:  &ptypes.PermRequest{Service: "projects", Name: "write"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !res.Ok || res.Perm.ID != 3 {
+		t.Errorf("Perm expected: 3, got: %v", res.Perm)
+	}
+
+	mga.Grants[0].Resource = "project:*"
+	res, err = svr.Auth(context.Background(), &ptypes.AuthRequest{
+		Token: &ptypes.TokenRequest{Token: "test"},
+		Perm:  &ptypes.PermRequest{Service: "projects", Name: "write"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Ok {
+		t.Error("Resource grant expected to need a resource")
+	}
+}
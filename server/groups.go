@@ -0,0 +1,333 @@
+package server
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/dhaifley/dauth/lib"
+	"github.com/dhaifley/dlib"
+	"github.com/dhaifley/dlib/ptypes"
+)
+
+// GroupList values carry groups in AuthExt requests and responses.
+type GroupList struct {
+	Groups []lib.Group `json:"groups"`
+}
+
+// GroupPermList values carry group_perm grants in AuthExt requests and
+// responses.
+type GroupPermList struct {
+	GroupPerms []lib.GroupPerm `json:"group_perms"`
+}
+
+// UserGroupList values carry user_group memberships in AuthExt requests and
+// responses.
+type UserGroupList struct {
+	UserGroups []lib.UserGroup `json:"user_groups"`
+}
+
+// GroupGroupList values carry group_group nestings in AuthExt requests and
+// responses.
+type GroupGroupList struct {
+	GroupGroups []lib.GroupGroup `json:"group_groups"`
+}
+
+// GetGroups returns the groups matching a request.
+func (s *Server) GetGroups(ctx context.Context,
+	req *lib.GroupFind) (*GroupList, error) {
+	res := GroupList{Groups: []lib.Group{}}
+	for r := range s.Groups.GetGroups(ctx, req) {
+		if r.Err != nil {
+			return nil, s.extError(ctx, "GetGroups", req, r.Err)
+		}
+
+		if v, ok := r.Val.(lib.Group); ok {
+			res.Groups = append(res.Groups, v)
+		}
+	}
+
+	s.extDone(ctx, "GetGroups", req, len(res.Groups))
+	return &res, nil
+}
+
+// SaveGroups saves groups and returns them with their assigned ids.
+func (s *Server) SaveGroups(ctx context.Context,
+	req *GroupList) (*GroupList, error) {
+	res := GroupList{Groups: []lib.Group{}}
+	for i := range req.Groups {
+		if req.Groups[i].Name == "" {
+			err := dlib.NewError(http.StatusBadRequest, "invalid group name")
+			return nil, s.extError(ctx, "SaveGroups", req, err)
+		}
+	}
+
+	for r := range s.Groups.SaveGroups(ctx, req.Groups) {
+		if r.Err != nil {
+			s.audit(ctx, "SaveGroups", req, r.Err)
+			return nil, s.extError(ctx, "SaveGroups", req, r.Err)
+		}
+
+		if v, ok := r.Val.(lib.Group); ok {
+			s.audit(ctx, "SaveGroups", &v, nil)
+			res.Groups = append(res.Groups, v)
+		}
+	}
+
+	s.extDone(ctx, "SaveGroups", req, len(res.Groups))
+	return &res, nil
+}
+
+// DeleteGroups deletes the groups matching a request, along with their
+// grants, memberships and nestings.
+func (s *Server) DeleteGroups(ctx context.Context,
+	req *lib.GroupFind) (res *ptypes.DeleteResponse, err error) {
+	defer func() { s.audit(ctx, "DeleteGroups", req, err) }()
+	count := int64(0)
+	for r := range s.Groups.DeleteGroups(ctx, req) {
+		if r.Err != nil {
+			return nil, s.extError(ctx, "DeleteGroups", req, r.Err)
+		}
+
+		count += int64(r.Num)
+	}
+
+	s.Cache.InvalidatePerms()
+	s.extDone(ctx, "DeleteGroups", req, int(count))
+	return &ptypes.DeleteResponse{Num: count}, nil
+}
+
+// GetGroupPerms returns the group_perm grants matching a request.
+func (s *Server) GetGroupPerms(ctx context.Context,
+	req *lib.GroupPermFind) (*GroupPermList, error) {
+	res := GroupPermList{GroupPerms: []lib.GroupPerm{}}
+	for r := range s.Groups.GetGroupPerms(ctx, req) {
+		if r.Err != nil {
+			return nil, s.extError(ctx, "GetGroupPerms", req, r.Err)
+		}
+
+		if v, ok := r.Val.(lib.GroupPerm); ok {
+			res.GroupPerms = append(res.GroupPerms, v)
+		}
+	}
+
+	s.extDone(ctx, "GetGroupPerms", req, len(res.GroupPerms))
+	return &res, nil
+}
+
+// SaveGroupPerms grants perms to groups.
+func (s *Server) SaveGroupPerms(ctx context.Context,
+	req *GroupPermList) (*GroupPermList, error) {
+	res := GroupPermList{GroupPerms: []lib.GroupPerm{}}
+	for i := range req.GroupPerms {
+		gp := &req.GroupPerms[i]
+		if gp.GroupID == 0 || gp.PermID == 0 {
+			err := dlib.NewError(http.StatusBadRequest,
+				"invalid group or perm id")
+			return nil, s.extError(ctx, "SaveGroupPerms", req, err)
+		}
+
+		for r := range s.Groups.SaveGroupPerm(ctx, gp) {
+			if r.Err != nil {
+				s.audit(ctx, "SaveGroupPerms", gp, r.Err)
+				return nil, s.extError(ctx, "SaveGroupPerms", req, r.Err)
+			}
+		}
+
+		s.audit(ctx, "SaveGroupPerms", gp, nil)
+		res.GroupPerms = append(res.GroupPerms, *gp)
+	}
+
+	s.Cache.InvalidatePerms()
+	s.extDone(ctx, "SaveGroupPerms", req, len(res.GroupPerms))
+	return &res, nil
+}
+
+// DeleteGroupPerms revokes perms from groups.
+func (s *Server) DeleteGroupPerms(ctx context.Context,
+	req *lib.GroupPermFind) (res *ptypes.DeleteResponse, err error) {
+	defer func() { s.audit(ctx, "DeleteGroupPerms", req, err) }()
+	count := int64(0)
+	for r := range s.Groups.DeleteGroupPerms(ctx, req) {
+		if r.Err != nil {
+			return nil, s.extError(ctx, "DeleteGroupPerms", req, r.Err)
+		}
+
+		count += int64(r.Num)
+	}
+
+	s.Cache.InvalidatePerms()
+	s.extDone(ctx, "DeleteGroupPerms", req, int(count))
+	return &ptypes.DeleteResponse{Num: count}, nil
+}
+
+// GetUserGroups returns the user_group memberships matching a request.
+func (s *Server) GetUserGroups(ctx context.Context,
+	req *lib.UserGroupFind) (*UserGroupList, error) {
+	res := UserGroupList{UserGroups: []lib.UserGroup{}}
+	for r := range s.Groups.GetUserGroups(ctx, req) {
+		if r.Err != nil {
+			return nil, s.extError(ctx, "GetUserGroups", req, r.Err)
+		}
+
+		if v, ok := r.Val.(lib.UserGroup); ok {
+			res.UserGroups = append(res.UserGroups, v)
+		}
+	}
+
+	s.extDone(ctx, "GetUserGroups", req, len(res.UserGroups))
+	return &res, nil
+}
+
+// SaveUserGroups adds users to groups.
+func (s *Server) SaveUserGroups(ctx context.Context,
+	req *UserGroupList) (*UserGroupList, error) {
+	res := UserGroupList{UserGroups: []lib.UserGroup{}}
+	for i := range req.UserGroups {
+		ug := &req.UserGroups[i]
+		if ug.UserID == 0 || ug.GroupID == 0 {
+			err := dlib.NewError(http.StatusBadRequest,
+				"invalid user or group id")
+			return nil, s.extError(ctx, "SaveUserGroups", req, err)
+		}
+
+		for r := range s.Groups.SaveUserGroup(ctx, ug) {
+			if r.Err != nil {
+				s.audit(ctx, "SaveUserGroups", ug, r.Err)
+				return nil, s.extError(ctx, "SaveUserGroups", req, r.Err)
+			}
+		}
+
+		s.audit(ctx, "SaveUserGroups", ug, nil)
+		res.UserGroups = append(res.UserGroups, *ug)
+	}
+
+	s.Cache.InvalidatePerms()
+	s.extDone(ctx, "SaveUserGroups", req, len(res.UserGroups))
+	return &res, nil
+}
+
+// DeleteUserGroups removes users from groups.
+func (s *Server) DeleteUserGroups(ctx context.Context,
+	req *lib.UserGroupFind) (res *ptypes.DeleteResponse, err error) {
+	defer func() { s.audit(ctx, "DeleteUserGroups", req, err) }()
+	count := int64(0)
+	for r := range s.Groups.DeleteUserGroups(ctx, req) {
+		if r.Err != nil {
+			return nil, s.extError(ctx, "DeleteUserGroups", req, r.Err)
+		}
+
+		count += int64(r.Num)
+	}
+
+	s.Cache.InvalidatePerms()
+	s.extDone(ctx, "DeleteUserGroups", req, int(count))
+	return &ptypes.DeleteResponse{Num: count}, nil
+}
+
+// GetGroupGroups returns the group_group nestings matching a request.
+func (s *Server) GetGroupGroups(ctx context.Context,
+	req *lib.GroupGroupFind) (*GroupGroupList, error) {
+	res := GroupGroupList{GroupGroups: []lib.GroupGroup{}}
+	for r := range s.Groups.GetGroupGroups(ctx, req) {
+		if r.Err != nil {
+			return nil, s.extError(ctx, "GetGroupGroups", req, r.Err)
+		}
+
+		if v, ok := r.Val.(lib.GroupGroup); ok {
+			res.GroupGroups = append(res.GroupGroups, v)
+		}
+	}
+
+	s.extDone(ctx, "GetGroupGroups", req, len(res.GroupGroups))
+	return &res, nil
+}
+
+// SaveGroupGroups nests groups in other groups. Nestings which would make a
+// group its own ancestor are refused.
+func (s *Server) SaveGroupGroups(ctx context.Context,
+	req *GroupGroupList) (*GroupGroupList, error) {
+	res := GroupGroupList{GroupGroups: []lib.GroupGroup{}}
+	for i := range req.GroupGroups {
+		gg := &req.GroupGroups[i]
+		if gg.ParentID == 0 || gg.ChildID == 0 {
+			err := dlib.NewError(http.StatusBadRequest, "invalid group id")
+			return nil, s.extError(ctx, "SaveGroupGroups", req, err)
+		}
+
+		cycle, err := s.isAncestorGroup(ctx, gg.ChildID, gg.ParentID)
+		if err != nil {
+			return nil, s.extError(ctx, "SaveGroupGroups", req, err)
+		}
+
+		if cycle {
+			err := dlib.NewError(http.StatusConflict, "group nesting cycle")
+			return nil, s.extError(ctx, "SaveGroupGroups", req, err)
+		}
+
+		for r := range s.Groups.SaveGroupGroup(ctx, gg) {
+			if r.Err != nil {
+				s.audit(ctx, "SaveGroupGroups", gg, r.Err)
+				return nil, s.extError(ctx, "SaveGroupGroups", req, r.Err)
+			}
+		}
+
+		s.audit(ctx, "SaveGroupGroups", gg, nil)
+		res.GroupGroups = append(res.GroupGroups, *gg)
+	}
+
+	s.Cache.InvalidatePerms()
+	s.extDone(ctx, "SaveGroupGroups", req, len(res.GroupGroups))
+	return &res, nil
+}
+
+// DeleteGroupGroups removes group nestings.
+func (s *Server) DeleteGroupGroups(ctx context.Context,
+	req *lib.GroupGroupFind) (res *ptypes.DeleteResponse, err error) {
+	defer func() { s.audit(ctx, "DeleteGroupGroups", req, err) }()
+	count := int64(0)
+	for r := range s.Groups.DeleteGroupGroups(ctx, req) {
+		if r.Err != nil {
+			return nil, s.extError(ctx, "DeleteGroupGroups", req, r.Err)
+		}
+
+		count += int64(r.Num)
+	}
+
+	s.Cache.InvalidatePerms()
+	s.extDone(ctx, "DeleteGroupGroups", req, int(count))
+	return &ptypes.DeleteResponse{Num: count}, nil
+}
+
+// isAncestorGroup returns whether a group is the same as, or an ancestor
+// of, another group. Groups already visited are skipped, so existing
+// nesting cycles do not loop forever.
+func (s *Server) isAncestorGroup(ctx context.Context,
+	ancestor, id int64) (bool, error) {
+	seen := map[int64]bool{}
+	next := []int64{id}
+	for len(next) > 0 {
+		id, next = next[0], next[1:]
+		if id == ancestor {
+			return true, nil
+		}
+
+		if seen[id] {
+			continue
+		}
+
+		seen[id] = true
+		child := id
+		for r := range s.Groups.GetGroupGroups(ctx,
+			&lib.GroupGroupFind{ChildID: &child}) {
+			if r.Err != nil {
+				return false, r.Err
+			}
+
+			if v, ok := r.Val.(lib.GroupGroup); ok {
+				next = append(next, v.ParentID)
+			}
+		}
+	}
+
+	return false, nil
+}
@@ -0,0 +1,363 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/dhaifley/dauth/lib"
+	"github.com/dhaifley/dlib"
+	"github.com/dhaifley/dlib/ptypes"
+)
+
+type MockGroupAccess struct {
+	sync.Mutex
+	Groups      []lib.Group
+	GroupPerms  []lib.GroupPerm
+	UserGroups  []lib.UserGroup
+	GroupGroups []lib.GroupGroup
+}
+
+func (m *MockGroupAccess) GetGroups(ctx context.Context,
+	opt *lib.GroupFind) <-chan dlib.Result {
+	m.Lock()
+	defer m.Unlock()
+	var vals []interface{}
+	for _, g := range m.Groups {
+		if matchID(opt.ID, g.ID) && (opt.Name == nil || *opt.Name == g.Name) {
+			vals = append(vals, g)
+		}
+	}
+
+	return mockResults(vals...)
+}
+
+func (m *MockGroupAccess) GetGroupByID(ctx context.Context,
+	id int64) <-chan dlib.Result {
+	return m.GetGroups(ctx, &lib.GroupFind{ID: &id})
+}
+
+func (m *MockGroupAccess) DeleteGroups(ctx context.Context,
+	opt *lib.GroupFind) <-chan dlib.Result {
+	m.Lock()
+	defer m.Unlock()
+	var keep []lib.Group
+	for _, g := range m.Groups {
+		if !matchID(opt.ID, g.ID) ||
+			(opt.Name != nil && *opt.Name != g.Name) {
+			keep = append(keep, g)
+		}
+	}
+
+	n := len(m.Groups) - len(keep)
+	m.Groups = keep
+	return mockCount(n)
+}
+
+func (m *MockGroupAccess) DeleteGroupByID(ctx context.Context,
+	id int64) <-chan dlib.Result {
+	return m.DeleteGroups(ctx, &lib.GroupFind{ID: &id})
+}
+
+func (m *MockGroupAccess) SaveGroup(ctx context.Context,
+	g *lib.Group) <-chan dlib.Result {
+	m.Lock()
+	defer m.Unlock()
+	g.ID = int64(len(m.Groups) + 1)
+	m.Groups = append(m.Groups, *g)
+	return mockResults(*g)
+}
+
+func (m *MockGroupAccess) SaveGroups(ctx context.Context,
+	g []lib.Group) <-chan dlib.Result {
+	var vals []interface{}
+	for i := range g {
+		for res := range m.SaveGroup(ctx, &g[i]) {
+			vals = append(vals, res.Val)
+		}
+	}
+
+	return mockResults(vals...)
+}
+
+func (m *MockGroupAccess) GetGroupPerms(ctx context.Context,
+	opt *lib.GroupPermFind) <-chan dlib.Result {
+	m.Lock()
+	defer m.Unlock()
+	var vals []interface{}
+	for _, gp := range m.GroupPerms {
+		if matchID(opt.ID, gp.ID) && matchID(opt.GroupID, gp.GroupID) &&
+			matchID(opt.PermID, gp.PermID) {
+			vals = append(vals, gp)
+		}
+	}
+
+	return mockResults(vals...)
+}
+
+func (m *MockGroupAccess) DeleteGroupPerms(ctx context.Context,
+	opt *lib.GroupPermFind) <-chan dlib.Result {
+	m.Lock()
+	defer m.Unlock()
+	var keep []lib.GroupPerm
+	for _, gp := range m.GroupPerms {
+		if !matchID(opt.ID, gp.ID) || !matchID(opt.GroupID, gp.GroupID) ||
+			!matchID(opt.PermID, gp.PermID) {
+			keep = append(keep, gp)
+		}
+	}
+
+	n := len(m.GroupPerms) - len(keep)
+	m.GroupPerms = keep
+	return mockCount(n)
+}
+
+func (m *MockGroupAccess) SaveGroupPerm(ctx context.Context,
+	gp *lib.GroupPerm) <-chan dlib.Result {
+	m.Lock()
+	defer m.Unlock()
+	gp.ID = int64(len(m.GroupPerms) + 1)
+	m.GroupPerms = append(m.GroupPerms, *gp)
+	return mockResults(*gp)
+}
+
+func (m *MockGroupAccess) GetUserGroups(ctx context.Context,
+	opt *lib.UserGroupFind) <-chan dlib.Result {
+	m.Lock()
+	defer m.Unlock()
+	var vals []interface{}
+	for _, ug := range m.UserGroups {
+		if matchID(opt.ID, ug.ID) && matchID(opt.UserID, ug.UserID) &&
+			matchID(opt.GroupID, ug.GroupID) {
+			vals = append(vals, ug)
+		}
+	}
+
+	return mockResults(vals...)
+}
+
+func (m *MockGroupAccess) DeleteUserGroups(ctx context.Context,
+	opt *lib.UserGroupFind) <-chan dlib.Result {
+	m.Lock()
+	defer m.Unlock()
+	var keep []lib.UserGroup
+	for _, ug := range m.UserGroups {
+		if !matchID(opt.ID, ug.ID) || !matchID(opt.UserID, ug.UserID) ||
+			!matchID(opt.GroupID, ug.GroupID) {
+			keep = append(keep, ug)
+		}
+	}
+
+	n := len(m.UserGroups) - len(keep)
+	m.UserGroups = keep
+	return mockCount(n)
+}
+
+func (m *MockGroupAccess) SaveUserGroup(ctx context.Context,
+	ug *lib.UserGroup) <-chan dlib.Result {
+	m.Lock()
+	defer m.Unlock()
+	ug.ID = int64(len(m.UserGroups) + 1)
+	m.UserGroups = append(m.UserGroups, *ug)
+	return mockResults(*ug)
+}
+
+func (m *MockGroupAccess) GetGroupGroups(ctx context.Context,
+	opt *lib.GroupGroupFind) <-chan dlib.Result {
+	m.Lock()
+	defer m.Unlock()
+	var vals []interface{}
+	for _, gg := range m.GroupGroups {
+		if matchID(opt.ID, gg.ID) && matchID(opt.ParentID, gg.ParentID) &&
+			matchID(opt.ChildID, gg.ChildID) {
+			vals = append(vals, gg)
+		}
+	}
+
+	return mockResults(vals...)
+}
+
+func (m *MockGroupAccess) DeleteGroupGroups(ctx context.Context,
+	opt *lib.GroupGroupFind) <-chan dlib.Result {
+	m.Lock()
+	defer m.Unlock()
+	var keep []lib.GroupGroup
+	for _, gg := range m.GroupGroups {
+		if !matchID(opt.ID, gg.ID) || !matchID(opt.ParentID, gg.ParentID) ||
+			!matchID(opt.ChildID, gg.ChildID) {
+			keep = append(keep, gg)
+		}
+	}
+
+	n := len(m.GroupGroups) - len(keep)
+	m.GroupGroups = keep
+	return mockCount(n)
+}
+
+func (m *MockGroupAccess) SaveGroupGroup(ctx context.Context,
+	gg *lib.GroupGroup) <-chan dlib.Result {
+	m.Lock()
+	defer m.Unlock()
+	gg.ID = int64(len(m.GroupGroups) + 1)
+	m.GroupGroups = append(m.GroupGroups, *gg)
+	return mockResults(*gg)
+}
+
+func (m *MockGroupAccess) GetUserGroupPerms(ctx context.Context,
+	userID int64) <-chan dlib.Result {
+	m.Lock()
+	defer m.Unlock()
+	seen := map[int64]bool{}
+	var next []int64
+	for _, ug := range m.UserGroups {
+		if ug.UserID == userID {
+			next = append(next, ug.GroupID)
+		}
+	}
+
+	for len(next) > 0 {
+		id := next[0]
+		next = next[1:]
+		if seen[id] {
+			continue
+		}
+
+		seen[id] = true
+		for _, gg := range m.GroupGroups {
+			if gg.ChildID == id {
+				next = append(next, gg.ParentID)
+			}
+		}
+	}
+
+	var vals []interface{}
+	for _, gp := range m.GroupPerms {
+		if seen[gp.GroupID] {
+			vals = append(vals, gp)
+		}
+	}
+
+	return mockResults(vals...)
+}
+
+func TestServerGroups(t *testing.T) {
+	svr, _ := testRoleServer()
+	svr.Groups = &MockGroupAccess{}
+	ctx := context.Background()
+	gl, err := svr.SaveGroups(ctx, &GroupList{Groups: []lib.Group{
+		{Name: "eng"}, {Name: "platform"}, {Name: "oncall"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(gl.Groups) != 3 || gl.Groups[2].ID != 3 {
+		t.Errorf("Saved groups expected with ids 1 to 3, got: %v", gl.Groups)
+	}
+
+	if _, err := svr.SaveGroups(ctx,
+		&GroupList{Groups: []lib.Group{{}}}); err == nil {
+		t.Error("Expected error saving group without name")
+	}
+
+	name := "platform"
+	gl, err = svr.GetGroups(ctx, &lib.GroupFind{Name: &name})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(gl.Groups) != 1 || gl.Groups[0].ID != 2 {
+		t.Errorf("Group expected: platform, got: %v", gl.Groups)
+	}
+
+	if _, err := svr.SaveGroupGroups(ctx, &GroupGroupList{
+		GroupGroups: []lib.GroupGroup{
+			{ParentID: 1, ChildID: 2},
+			{ParentID: 2, ChildID: 3},
+		}}); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []lib.GroupGroup{
+		{ParentID: 3, ChildID: 1},
+		{ParentID: 3, ChildID: 3},
+	}
+
+	for _, c := range cases {
+		_, err := svr.SaveGroupGroups(ctx, &GroupGroupList{
+			GroupGroups: []lib.GroupGroup{c}})
+		if e, ok := err.(*dlib.Error); !ok || e.Code != http.StatusConflict {
+			t.Errorf("Expected conflict nesting %v, got: %v", c, err)
+		}
+	}
+
+	dr, err := svr.DeleteGroups(ctx, &lib.GroupFind{Name: &name})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if dr.Num != 1 {
+		t.Errorf("Delete count expected: 1, got: %v", dr.Num)
+	}
+}
+
+func TestServerAuthGroups(t *testing.T) {
+	svr, _ := testRoleServer()
+	mga := MockGroupAccess{
+		GroupGroups: []lib.GroupGroup{
+			{ID: 1, ParentID: 1, ChildID: 2},
+			{ID: 2, ParentID: 2, ChildID: 3},
+			{ID: 3, ParentID: 3, ChildID: 2},
+		},
+	}
+
+	svr.Groups = &mga
+	ctx := context.Background()
+	if _, err := svr.SaveGroupPerms(ctx, &GroupPermList{
+		GroupPerms: []lib.GroupPerm{{GroupID: 1, PermID: 2}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	req := ptypes.AuthRequest{
+		Token: &ptypes.TokenRequest{Token: "test"},
+		Perm:  &ptypes.PermRequest{Service: "billing", Name: "read"},
+	}
+
+	res, err := svr.Auth(ctx, &req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Ok {
+		t.Error("Expected unauthorized before joining a group")
+	}
+
+	if _, err := svr.SaveUserGroups(ctx, &UserGroupList{
+		UserGroups: []lib.UserGroup{{UserID: 1, GroupID: 3}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err = svr.Auth(ctx, &req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !res.Ok || res.Perm.ID != 2 {
+		t.Errorf("Expected authorized through nested group, got: %v", res)
+	}
+
+	userID := int64(1)
+	if _, err := svr.DeleteUserGroups(ctx,
+		&lib.UserGroupFind{UserID: &userID}); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err = svr.Auth(ctx, &req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Ok {
+		t.Error("Expected unauthorized after leaving the group")
+	}
+}
@@ -0,0 +1,1130 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dhaifley/dauth/lib"
+	"github.com/dhaifley/dlib"
+	"github.com/dhaifley/dlib/ptypes"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// Routes creates the HTTP router for the server if needed, registers the
+// HTTP routes and returns the router. The /dauth routes are a JSON gateway
+// to the gRPC methods of the server, and share their error codes and the
+// perms they require.
+func (s *Server) Routes() *mux.Router {
+	if s.Router == nil {
+		s.Router = mux.NewRouter()
+	}
+
+	s.route("/.well-known/jwks.json", "JWKS", s.handleJWKS, "GET")
+	s.route("/dauth/jwks", "JWKS", s.handleJWKS, "GET")
+	s.route("/dauth/login", "Login", s.handleLogin, "POST")
+	s.route("/dauth/logout", "Logout", s.handleLogout, "POST")
+	s.route("/dauth/logout/all", "LogoutAll", s.handleLogoutAll, "POST")
+	s.route("/dauth/users/{id:[0-9]+}/sessions", "RevokeUserSessions",
+		s.handleRevokeUserSessions, "DELETE")
+	s.route("/dauth/sessions", "ListSessions", s.handleListSessions, "GET")
+	s.route("/dauth/sessions", "RevokeSessions", s.handleRevokeSessions,
+		"DELETE")
+	s.route("/dauth/sessions/{sid:[0-9a-f]+}", "RevokeSessions",
+		s.handleRevokeSessions, "DELETE")
+	s.route("/dauth/password", "ChangePassword", s.handleChangePassword,
+		"POST")
+	s.route("/dauth/users/{id:[0-9]+}/password_reset", "ForcePasswordReset",
+		s.handleForcePasswordReset, "POST")
+	s.route("/dauth/refresh", "Refresh", s.handleRefresh, "POST")
+	s.route("/dauth/auth", "Auth", s.handleAuth, "GET", "POST")
+	s.route("/dauth/authorize", "Authorize", s.handleAuthorize, "POST")
+	s.route("/dauth/authorize/batch", "BatchAuth", s.handleBatchAuth, "POST")
+	s.route("/dauth/effective_perms", "EffectivePerms",
+		s.handleEffectivePerms, "GET")
+	s.route("/dauth/cache/stats", "CacheStats", s.handleCacheStats, "GET")
+	s.route("/dauth/audit", "QueryAudit", s.handleQueryAudit, "GET")
+	s.route("/dauth/mfa/enroll", "EnrollMFA", s.handleEnrollMFA, "POST")
+	s.route("/dauth/mfa/verify", "VerifyMFA", s.handleVerifyMFA, "POST")
+	s.route("/dauth/tokens/old", "DeleteTokens", s.handleDeleteOldTokens,
+		"DELETE")
+	for _, p := range []string{"", "/{id:[0-9]+}"} {
+		s.route("/dauth/tokens"+p, "GetTokens", s.handleGetTokens, "GET")
+		s.route("/dauth/tokens"+p, "DeleteTokens", s.handleDeleteTokens,
+			"DELETE")
+		s.route("/dauth/users"+p, "GetUsers", s.handleGetUsers, "GET")
+		s.route("/dauth/users"+p, "DeleteUsers", s.handleDeleteUsers,
+			"DELETE")
+		s.route("/dauth/perms"+p, "GetPerms", s.handleGetPerms, "GET")
+		s.route("/dauth/perms"+p, "DeletePerms", s.handleDeletePerms,
+			"DELETE")
+		s.route("/dauth/user_perms"+p, "GetUserPerms", s.handleGetUserPerms,
+			"GET")
+		s.route("/dauth/user_perms"+p, "DeleteUserPerms",
+			s.handleDeleteUserPerms, "DELETE")
+	}
+
+	s.route("/dauth/tokens", "SaveTokens", s.handleSaveTokens, "POST")
+	s.route("/dauth/tokens/{id:[0-9]+}", "SaveTokens", s.handleSaveTokens,
+		"PUT")
+	s.route("/dauth/users", "SaveUsers", s.handleSaveUsers, "POST")
+	s.route("/dauth/users/{id:[0-9]+}", "SaveUsers", s.handleSaveUsers, "PUT")
+	s.route("/dauth/perms", "SavePerms", s.handleSavePerms, "POST")
+	s.route("/dauth/perms/{id:[0-9]+}", "SavePerms", s.handleSavePerms, "PUT")
+	s.route("/dauth/user_perms", "SaveUserPerms", s.handleSaveUserPerms,
+		"POST")
+	s.route("/dauth/user_perms/{id:[0-9]+}", "SaveUserPerms",
+		s.handleSaveUserPerms, "PUT")
+	if s.Metrics != nil {
+		s.Router.HandleFunc(MetricsPath, s.handleMetrics).Methods("GET")
+	}
+
+	return s.Router
+}
+
+// route registers the HTTP handler of the gateway to an RPC for a path and
+// methods. The handler is only called if the bearer token holds the perm
+// the RPC requires, and its requests are counted in the metrics.
+func (s *Server) route(path, rpc string, h http.HandlerFunc,
+	methods ...string) {
+	s.Router.HandleFunc(path,
+		s.instrumented(rpc, s.authorized(rpc, h))).Methods(methods...)
+}
+
+// httpError is the body of HTTP error responses.
+type httpError struct {
+	Error string `json:"error"`
+}
+
+// writeJSON writes a JSON encoded HTTP response.
+func (s *Server) writeJSON(w http.ResponseWriter, r *http.Request,
+	code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		s.Log.WithFields(logrus.Fields{
+			"route": r.URL.Path,
+			"code":  http.StatusInternalServerError,
+		}).Error(err)
+	}
+}
+
+// writeError writes an HTTP error response, using the code of dlib errors
+// as the status code.
+func (s *Server) writeError(w http.ResponseWriter, r *http.Request,
+	err error) {
+	code := http.StatusInternalServerError
+	if e, ok := err.(*dlib.Error); ok && e.Code >= 400 && e.Code < 600 {
+		code = e.Code
+	}
+
+	s.writeJSON(w, r, code, httpError{Error: err.Error()})
+}
+
+// readJSON decodes a JSON request body, writing a bad request response if
+// it can not be decoded.
+func (s *Server) readJSON(w http.ResponseWriter, r *http.Request,
+	v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil && err != io.EOF {
+		s.writeError(w, r, dlib.NewError(http.StatusBadRequest,
+			"invalid request body: "+err.Error()))
+		return false
+	}
+
+	return true
+}
+
+// httpContext returns the context for a gRPC method called by an HTTP
+// handler. The Authorization, User-Agent and device label headers are
+// passed on as incoming metadata, and the client address as the peer.
+func httpContext(r *http.Request) context.Context {
+	ctx := r.Context()
+	md := metadata.MD{}
+	if a := r.Header.Get("Authorization"); a != "" {
+		md.Set("authorization", a)
+	}
+
+	if ua := r.UserAgent(); ua != "" {
+		md.Set("user-agent", ua)
+	}
+
+	if d := r.Header.Get(DeviceHeader); d != "" {
+		md.Set(DeviceHeader, d)
+	}
+
+	if md.Len() > 0 {
+		ctx = metadata.NewIncomingContext(ctx, md)
+	}
+
+	if addr, err := net.ResolveTCPAddr("tcp", r.RemoteAddr); err == nil {
+		ctx = peer.NewContext(ctx, &peer.Peer{Addr: addr})
+	}
+
+	return ctx
+}
+
+// bearerToken returns the bearer token from the Authorization header of an
+// HTTP request.
+func bearerToken(r *http.Request) string {
+	return parseBearer(r.Header.Get("Authorization"))
+}
+
+// pathID returns the id route variable of an HTTP request, if present.
+func pathID(r *http.Request) (int64, bool) {
+	v, ok := mux.Vars(r)["id"]
+	if !ok {
+		return 0, false
+	}
+
+	id, err := strconv.ParseInt(v, 10, 64)
+	return id, err == nil
+}
+
+// queryInt parses an integer query parameter, which is zero when missing.
+func queryInt(r *http.Request, name string) (int64, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return 0, nil
+	}
+
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, dlib.NewError(http.StatusBadRequest,
+			"invalid "+name+" parameter")
+	}
+
+	return n, nil
+}
+
+// queryInts parses integer query parameters into the provided values.
+func queryInts(r *http.Request, vals map[string]*int64) error {
+	for k, v := range vals {
+		n, err := queryInt(r, k)
+		if err != nil {
+			return err
+		}
+
+		if n != 0 {
+			*v = n
+		}
+	}
+
+	return nil
+}
+
+// httpStream implements grpc.ServerStream for HTTP requests, so that the
+// streaming gRPC methods can be shared by the HTTP handlers.
+type httpStream struct {
+	ctx context.Context
+}
+
+func (hs *httpStream) SetHeader(metadata.MD) error  { return nil }
+func (hs *httpStream) SendHeader(metadata.MD) error { return nil }
+func (hs *httpStream) SetTrailer(metadata.MD)       {}
+func (hs *httpStream) Context() context.Context     { return hs.ctx }
+func (hs *httpStream) SendMsg(m interface{}) error  { return nil }
+func (hs *httpStream) RecvMsg(m interface{}) error  { return nil }
+
+// handleLogin logs in a user, returning an access and refresh token pair,
+// or an MFA pending token.
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	req := ptypes.UserRequest{}
+	if !s.readJSON(w, r, &req) {
+		return
+	}
+
+	res, err := s.login(httpContext(r), &req)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	s.writeJSON(w, r, http.StatusOK, res)
+}
+
+// handleLogout destroys the token in the request body, or the bearer token.
+func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	req := ptypes.TokenRequest{}
+	if !s.readJSON(w, r, &req) {
+		return
+	}
+
+	if req.Token == "" {
+		req.Token = bearerToken(r)
+	}
+
+	res, err := s.Logout(httpContext(r), &req)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	s.writeJSON(w, r, http.StatusOK, res)
+}
+
+// handleLogoutAll ends every session of the holder of the bearer token.
+func (s *Server) handleLogoutAll(w http.ResponseWriter, r *http.Request) {
+	req := LogoutAllRequest{Token: bearerToken(r)}
+	res, err := s.LogoutAll(httpContext(r), &req)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	s.writeJSON(w, r, http.StatusOK, res)
+}
+
+// handleRevokeUserSessions ends every session of a user.
+func (s *Server) handleRevokeUserSessions(w http.ResponseWriter,
+	r *http.Request) {
+	id, _ := pathID(r)
+	res, err := s.RevokeUserSessions(httpContext(r),
+		&RevokeSessionsRequest{UserID: id})
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	s.writeJSON(w, r, http.StatusOK, res)
+}
+
+// handleChangePassword changes the password of the holder of the token in
+// the request body, or the bearer token.
+func (s *Server) handleChangePassword(w http.ResponseWriter,
+	r *http.Request) {
+	req := ChangePasswordRequest{}
+	if !s.readJSON(w, r, &req) {
+		return
+	}
+
+	if req.Token == "" {
+		req.Token = bearerToken(r)
+	}
+
+	res, err := s.ChangePassword(httpContext(r), &req)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	s.writeJSON(w, r, http.StatusOK, res)
+}
+
+// handleForcePasswordReset requires a user to change their password on next
+// login.
+func (s *Server) handleForcePasswordReset(w http.ResponseWriter,
+	r *http.Request) {
+	req := ForcePasswordResetRequest{}
+	if !s.readJSON(w, r, &req) {
+		return
+	}
+
+	req.UserID, _ = pathID(r)
+	res, err := s.ForcePasswordReset(httpContext(r), &req)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	s.writeJSON(w, r, http.StatusOK, res)
+}
+
+// handleListSessions returns the sessions of the holder of the bearer
+// token.
+func (s *Server) handleListSessions(w http.ResponseWriter, r *http.Request) {
+	req := SessionsRequest{Token: bearerToken(r)}
+	res, err := s.ListSessions(httpContext(r), &req)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	s.writeJSON(w, r, http.StatusOK, res)
+}
+
+// handleRevokeSessions ends the session named in the path, or the sessions
+// listed in the request body, of the holder of the bearer token.
+func (s *Server) handleRevokeSessions(w http.ResponseWriter,
+	r *http.Request) {
+	req := RevokeSessionRequest{}
+	if sid, ok := mux.Vars(r)["sid"]; ok {
+		req.IDs = []string{sid}
+	} else if !s.readJSON(w, r, &req) {
+		return
+	}
+
+	req.Token = bearerToken(r)
+	res, err := s.RevokeSessions(httpContext(r), &req)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	s.writeJSON(w, r, http.StatusOK, res)
+}
+
+// handleRefresh exchanges a refresh token for a new token pair.
+func (s *Server) handleRefresh(w http.ResponseWriter, r *http.Request) {
+	req := RefreshRequest{}
+	if !s.readJSON(w, r, &req) {
+		return
+	}
+
+	res, err := s.Refresh(httpContext(r), &req)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	s.writeJSON(w, r, http.StatusOK, res)
+}
+
+// handleAuth checks a token and perm. GET requests use the bearer token and
+// the service and name query parameters.
+func (s *Server) handleAuth(w http.ResponseWriter, r *http.Request) {
+	req := ptypes.AuthRequest{}
+	if r.Method == http.MethodPost && !s.readJSON(w, r, &req) {
+		return
+	}
+
+	if req.Token == nil {
+		req.Token = &ptypes.TokenRequest{Token: bearerToken(r)}
+	}
+
+	if req.Perm == nil {
+		req.Perm = &ptypes.PermRequest{
+			Service: r.URL.Query().Get("service"),
+			Name:    r.URL.Query().Get("name"),
+		}
+	}
+
+	if req.Token.Token == "" {
+		s.writeError(w, r, dlib.NewError(http.StatusUnauthorized,
+			"unauthorized token"))
+		return
+	}
+
+	res, err := s.Auth(httpContext(r), &req)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	s.writeJSON(w, r, http.StatusOK, res)
+}
+
+// handleAuthorize decides a perm requested for a resource. The bearer token
+// is used unless one is given in the request.
+func (s *Server) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	req := AuthorizeRequest{}
+	if !s.readJSON(w, r, &req) {
+		return
+	}
+
+	if req.Token == "" {
+		req.Token = bearerToken(r)
+	}
+
+	res, err := s.Authorize(httpContext(r), &req)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	s.writeJSON(w, r, http.StatusOK, res)
+}
+
+// handleBatchAuth decides several perms with one token.
+func (s *Server) handleBatchAuth(w http.ResponseWriter, r *http.Request) {
+	req := BatchAuthRequest{}
+	if !s.readJSON(w, r, &req) {
+		return
+	}
+
+	if req.Token == "" {
+		req.Token = bearerToken(r)
+	}
+
+	res, err := s.BatchAuth(httpContext(r), &req)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	s.writeJSON(w, r, http.StatusOK, res)
+}
+
+// handleEffectivePerms lists the perms held by the bearer of a token.
+func (s *Server) handleEffectivePerms(w http.ResponseWriter,
+	r *http.Request) {
+	req := EffectivePermsRequest{Token: bearerToken(r)}
+	res, err := s.EffectivePerms(httpContext(r), &req)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	s.writeJSON(w, r, http.StatusOK, res)
+}
+
+// handleCacheStats returns the statistics of the Auth cache.
+func (s *Server) handleCacheStats(w http.ResponseWriter, r *http.Request) {
+	res, err := s.CacheStats(httpContext(r), &CacheStatsRequest{})
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	s.writeJSON(w, r, http.StatusOK, res)
+}
+
+// httpAuditStream adapts HTTP requests to the QueryAudit streaming method.
+type httpAuditStream struct {
+	httpStream
+	res []*lib.AuditEvent
+}
+
+func (as *httpAuditStream) Send(res *lib.AuditEvent) error {
+	as.res = append(as.res, res)
+	return nil
+}
+
+// auditQuery builds an audit query from the query parameters. The start
+// and end parameters are Unix times.
+func auditQuery(r *http.Request) (*lib.AuditFind, error) {
+	var actorID, start, end, limit int64
+	if err := queryInts(r, map[string]*int64{
+		"actor_id": &actorID,
+		"start":    &start,
+		"end":      &end,
+		"limit":    &limit,
+	}); err != nil {
+		return nil, err
+	}
+
+	req := lib.AuditFind{}
+	if actorID != 0 {
+		req.ActorID = &actorID
+	}
+
+	if start != 0 {
+		t := time.Unix(start, 0)
+		req.Start = &t
+	}
+
+	if end != 0 {
+		t := time.Unix(end, 0)
+		req.End = &t
+	}
+
+	if limit != 0 {
+		req.Limit = &limit
+	}
+
+	q := r.URL.Query()
+	for k, v := range map[string]**string{
+		"actor":   &req.Actor,
+		"action":  &req.Action,
+		"target":  &req.Target,
+		"outcome": &req.Outcome,
+	} {
+		if qv := q.Get(k); qv != "" {
+			*v = &qv
+		}
+	}
+
+	return &req, nil
+}
+
+// handleQueryAudit lists the audit events matching the query parameters.
+func (s *Server) handleQueryAudit(w http.ResponseWriter, r *http.Request) {
+	req, err := auditQuery(r)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	st := httpAuditStream{httpStream: httpStream{ctx: httpContext(r)}}
+	if err := s.QueryAudit(req, &st); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	if st.res == nil {
+		st.res = []*lib.AuditEvent{}
+	}
+
+	s.writeJSON(w, r, http.StatusOK, st.res)
+}
+
+// handleEnrollMFA enrolls the user of a token in two-factor authentication.
+func (s *Server) handleEnrollMFA(w http.ResponseWriter, r *http.Request) {
+	req := MFAEnrollRequest{}
+	if !s.readJSON(w, r, &req) {
+		return
+	}
+
+	if req.Token == "" {
+		req.Token = bearerToken(r)
+	}
+
+	res, err := s.EnrollMFA(httpContext(r), &req)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	s.writeJSON(w, r, http.StatusOK, res)
+}
+
+// handleVerifyMFA completes a login with a two-factor code.
+func (s *Server) handleVerifyMFA(w http.ResponseWriter, r *http.Request) {
+	req := MFAVerifyRequest{}
+	if !s.readJSON(w, r, &req) {
+		return
+	}
+
+	if req.Token == "" {
+		req.Token = bearerToken(r)
+	}
+
+	res, err := s.VerifyMFA(httpContext(r), &req)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	s.writeJSON(w, r, http.StatusOK, res)
+}
+
+// httpTokensStream adapts HTTP requests to the token streaming methods.
+type httpTokensStream struct {
+	httpStream
+	reqs []*ptypes.TokenRequest
+	res  []*ptypes.TokenResponse
+}
+
+func (ts *httpTokensStream) Send(res *ptypes.TokenResponse) error {
+	ts.res = append(ts.res, res)
+	return nil
+}
+
+func (ts *httpTokensStream) Recv() (*ptypes.TokenRequest, error) {
+	if len(ts.reqs) == 0 {
+		return nil, io.EOF
+	}
+
+	req := ts.reqs[0]
+	ts.reqs = ts.reqs[1:]
+	return req, nil
+}
+
+// tokenQuery builds a token request from the route and query parameters.
+func tokenQuery(r *http.Request) (*ptypes.TokenRequest, error) {
+	req := ptypes.TokenRequest{Token: r.URL.Query().Get("token")}
+	if err := queryInts(r, map[string]*int64{
+		"id":      &req.ID,
+		"user_id": &req.UserID,
+		"start":   &req.Start,
+		"end":     &req.End,
+		"old":     &req.Old,
+	}); err != nil {
+		return nil, err
+	}
+
+	if id, ok := pathID(r); ok {
+		req.ID = id
+	}
+
+	return &req, nil
+}
+
+// handleGetTokens lists tokens, or returns a single token by id.
+func (s *Server) handleGetTokens(w http.ResponseWriter, r *http.Request) {
+	req, err := tokenQuery(r)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	st := httpTokensStream{httpStream: httpStream{ctx: httpContext(r)}}
+	if err := s.GetTokens(req, &st); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	if _, ok := pathID(r); ok {
+		if len(st.res) == 0 {
+			s.writeError(w, r, dlib.NewError(http.StatusNotFound,
+				"token not found"))
+			return
+		}
+
+		s.writeJSON(w, r, http.StatusOK, st.res[0])
+		return
+	}
+
+	if st.res == nil {
+		st.res = []*ptypes.TokenResponse{}
+	}
+
+	s.writeJSON(w, r, http.StatusOK, st.res)
+}
+
+// handleSaveTokens saves a list of tokens, or a single token by id.
+func (s *Server) handleSaveTokens(w http.ResponseWriter, r *http.Request) {
+	st := httpTokensStream{httpStream: httpStream{ctx: httpContext(r)}}
+	id, one := pathID(r)
+	if one {
+		req := ptypes.TokenRequest{}
+		if !s.readJSON(w, r, &req) {
+			return
+		}
+
+		req.ID = id
+		st.reqs = append(st.reqs, &req)
+	} else if !s.readJSON(w, r, &st.reqs) {
+		return
+	}
+
+	if err := s.SaveTokens(&st); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	if one && len(st.res) > 0 {
+		s.writeJSON(w, r, http.StatusOK, st.res[0])
+		return
+	}
+
+	s.writeJSON(w, r, http.StatusOK, st.res)
+}
+
+// handleDeleteTokens deletes tokens matching the route and query
+// parameters. At least one parameter is required.
+func (s *Server) handleDeleteTokens(w http.ResponseWriter, r *http.Request) {
+	req, err := tokenQuery(r)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	if req.ID == 0 && req.Token == "" && req.UserID == 0 &&
+		req.Start == 0 && req.End == 0 && req.Old == 0 {
+		s.writeError(w, r, dlib.NewError(http.StatusBadRequest,
+			"delete requires a filter"))
+		return
+	}
+
+	res, err := s.DeleteTokens(httpContext(r), req)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	s.writeJSON(w, r, http.StatusOK, res)
+}
+
+// handleDeleteOldTokens deletes every token which has expired.
+func (s *Server) handleDeleteOldTokens(w http.ResponseWriter,
+	r *http.Request) {
+	req := ptypes.TokenRequest{Old: time.Now().Unix()}
+	res, err := s.DeleteTokens(httpContext(r), &req)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	s.writeJSON(w, r, http.StatusOK, res)
+}
+
+// httpUsersStream adapts HTTP requests to the user streaming methods.
+type httpUsersStream struct {
+	httpStream
+	reqs []*ptypes.UserRequest
+	res  []*ptypes.UserResponse
+}
+
+func (us *httpUsersStream) Send(res *ptypes.UserResponse) error {
+	us.res = append(us.res, res)
+	return nil
+}
+
+func (us *httpUsersStream) Recv() (*ptypes.UserRequest, error) {
+	if len(us.reqs) == 0 {
+		return nil, io.EOF
+	}
+
+	req := us.reqs[0]
+	us.reqs = us.reqs[1:]
+	return req, nil
+}
+
+// userQuery builds a user request from the route and query parameters.
+func userQuery(r *http.Request) (*ptypes.UserRequest, error) {
+	q := r.URL.Query()
+	req := ptypes.UserRequest{
+		User:  q.Get("user"),
+		Name:  q.Get("name"),
+		Email: q.Get("email"),
+	}
+
+	if err := queryInts(r, map[string]*int64{"id": &req.ID}); err != nil {
+		return nil, err
+	}
+
+	if id, ok := pathID(r); ok {
+		req.ID = id
+	}
+
+	return &req, nil
+}
+
+// handleGetUsers lists users, or returns a single user by id.
+func (s *Server) handleGetUsers(w http.ResponseWriter, r *http.Request) {
+	req, err := userQuery(r)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	st := httpUsersStream{httpStream: httpStream{ctx: httpContext(r)}}
+	if err := s.GetUsers(req, &st); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	if _, ok := pathID(r); ok {
+		if len(st.res) == 0 {
+			s.writeError(w, r, dlib.NewError(http.StatusNotFound,
+				"user not found"))
+			return
+		}
+
+		s.writeJSON(w, r, http.StatusOK, st.res[0])
+		return
+	}
+
+	if st.res == nil {
+		st.res = []*ptypes.UserResponse{}
+	}
+
+	s.writeJSON(w, r, http.StatusOK, st.res)
+}
+
+// handleSaveUsers saves a list of users, or a single user by id.
+func (s *Server) handleSaveUsers(w http.ResponseWriter, r *http.Request) {
+	st := httpUsersStream{httpStream: httpStream{ctx: httpContext(r)}}
+	id, one := pathID(r)
+	if one {
+		req := ptypes.UserRequest{}
+		if !s.readJSON(w, r, &req) {
+			return
+		}
+
+		req.ID = id
+		st.reqs = append(st.reqs, &req)
+	} else if !s.readJSON(w, r, &st.reqs) {
+		return
+	}
+
+	if err := s.SaveUsers(&st); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	if one && len(st.res) > 0 {
+		s.writeJSON(w, r, http.StatusOK, st.res[0])
+		return
+	}
+
+	s.writeJSON(w, r, http.StatusOK, st.res)
+}
+
+// handleDeleteUsers deletes users matching the route and query parameters.
+// At least one parameter is required.
+func (s *Server) handleDeleteUsers(w http.ResponseWriter, r *http.Request) {
+	req, err := userQuery(r)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	if req.ID == 0 && req.User == "" && req.Name == "" &&
+		req.Email == "" {
+		s.writeError(w, r, dlib.NewError(http.StatusBadRequest,
+			"delete requires a filter"))
+		return
+	}
+
+	res, err := s.DeleteUsers(httpContext(r), req)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	s.writeJSON(w, r, http.StatusOK, res)
+}
+
+// httpPermsStream adapts HTTP requests to the perm streaming methods.
+type httpPermsStream struct {
+	httpStream
+	reqs []*ptypes.PermRequest
+	res  []*ptypes.PermResponse
+}
+
+func (ps *httpPermsStream) Send(res *ptypes.PermResponse) error {
+	ps.res = append(ps.res, res)
+	return nil
+}
+
+func (ps *httpPermsStream) Recv() (*ptypes.PermRequest, error) {
+	if len(ps.reqs) == 0 {
+		return nil, io.EOF
+	}
+
+	req := ps.reqs[0]
+	ps.reqs = ps.reqs[1:]
+	return req, nil
+}
+
+// permQuery builds a perm request from the route and query parameters.
+func permQuery(r *http.Request) (*ptypes.PermRequest, error) {
+	q := r.URL.Query()
+	req := ptypes.PermRequest{
+		Service: q.Get("service"),
+		Name:    q.Get("name"),
+	}
+
+	if err := queryInts(r, map[string]*int64{"id": &req.ID}); err != nil {
+		return nil, err
+	}
+
+	if id, ok := pathID(r); ok {
+		req.ID = id
+	}
+
+	return &req, nil
+}
+
+// handleGetPerms lists perms, or returns a single perm by id.
+func (s *Server) handleGetPerms(w http.ResponseWriter, r *http.Request) {
+	req, err := permQuery(r)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	st := httpPermsStream{httpStream: httpStream{ctx: httpContext(r)}}
+	if err := s.GetPerms(req, &st); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	if _, ok := pathID(r); ok {
+		if len(st.res) == 0 {
+			s.writeError(w, r, dlib.NewError(http.StatusNotFound,
+				"perm not found"))
+			return
+		}
+
+		s.writeJSON(w, r, http.StatusOK, st.res[0])
+		return
+	}
+
+	if st.res == nil {
+		st.res = []*ptypes.PermResponse{}
+	}
+
+	s.writeJSON(w, r, http.StatusOK, st.res)
+}
+
+// handleSavePerms saves a list of perms, or a single perm by id.
+func (s *Server) handleSavePerms(w http.ResponseWriter, r *http.Request) {
+	st := httpPermsStream{httpStream: httpStream{ctx: httpContext(r)}}
+	id, one := pathID(r)
+	if one {
+		req := ptypes.PermRequest{}
+		if !s.readJSON(w, r, &req) {
+			return
+		}
+
+		req.ID = id
+		st.reqs = append(st.reqs, &req)
+	} else if !s.readJSON(w, r, &st.reqs) {
+		return
+	}
+
+	if err := s.SavePerms(&st); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	if one && len(st.res) > 0 {
+		s.writeJSON(w, r, http.StatusOK, st.res[0])
+		return
+	}
+
+	s.writeJSON(w, r, http.StatusOK, st.res)
+}
+
+// handleDeletePerms deletes perms matching the route and query parameters.
+// At least one parameter is required.
+func (s *Server) handleDeletePerms(w http.ResponseWriter, r *http.Request) {
+	req, err := permQuery(r)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	if req.ID == 0 && req.Service == "" && req.Name == "" {
+		s.writeError(w, r, dlib.NewError(http.StatusBadRequest,
+			"delete requires a filter"))
+		return
+	}
+
+	res, err := s.DeletePerms(httpContext(r), req)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	s.writeJSON(w, r, http.StatusOK, res)
+}
+
+// httpUserPermsStream adapts HTTP requests to the user perm streaming
+// methods.
+type httpUserPermsStream struct {
+	httpStream
+	reqs []*ptypes.UserPermRequest
+	res  []*ptypes.UserPermResponse
+}
+
+func (us *httpUserPermsStream) Send(res *ptypes.UserPermResponse) error {
+	us.res = append(us.res, res)
+	return nil
+}
+
+func (us *httpUserPermsStream) Recv() (*ptypes.UserPermRequest, error) {
+	if len(us.reqs) == 0 {
+		return nil, io.EOF
+	}
+
+	req := us.reqs[0]
+	us.reqs = us.reqs[1:]
+	return req, nil
+}
+
+// userPermQuery builds a user perm request from the route and query
+// parameters.
+func userPermQuery(r *http.Request) (*ptypes.UserPermRequest, error) {
+	req := ptypes.UserPermRequest{}
+	if err := queryInts(r, map[string]*int64{
+		"id":      &req.ID,
+		"user_id": &req.UserID,
+		"perm_id": &req.PermID,
+	}); err != nil {
+		return nil, err
+	}
+
+	if id, ok := pathID(r); ok {
+		req.ID = id
+	}
+
+	return &req, nil
+}
+
+// handleGetUserPerms lists user perms, or returns a single user perm by id.
+func (s *Server) handleGetUserPerms(w http.ResponseWriter, r *http.Request) {
+	req, err := userPermQuery(r)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	st := httpUserPermsStream{httpStream: httpStream{ctx: httpContext(r)}}
+	if err := s.GetUserPerms(req, &st); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	if _, ok := pathID(r); ok {
+		if len(st.res) == 0 {
+			s.writeError(w, r, dlib.NewError(http.StatusNotFound,
+				"user perm not found"))
+			return
+		}
+
+		s.writeJSON(w, r, http.StatusOK, st.res[0])
+		return
+	}
+
+	if st.res == nil {
+		st.res = []*ptypes.UserPermResponse{}
+	}
+
+	s.writeJSON(w, r, http.StatusOK, st.res)
+}
+
+// handleSaveUserPerms saves a list of user perms, or a single user perm by
+// id.
+func (s *Server) handleSaveUserPerms(w http.ResponseWriter,
+	r *http.Request) {
+	st := httpUserPermsStream{httpStream: httpStream{ctx: httpContext(r)}}
+	id, one := pathID(r)
+	if one {
+		req := ptypes.UserPermRequest{}
+		if !s.readJSON(w, r, &req) {
+			return
+		}
+
+		req.ID = id
+		st.reqs = append(st.reqs, &req)
+	} else if !s.readJSON(w, r, &st.reqs) {
+		return
+	}
+
+	if err := s.SaveUserPerms(&st); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	if one && len(st.res) > 0 {
+		s.writeJSON(w, r, http.StatusOK, st.res[0])
+		return
+	}
+
+	s.writeJSON(w, r, http.StatusOK, st.res)
+}
+
+// handleDeleteUserPerms deletes user perms matching the route and query
+// parameters. At least one parameter is required.
+func (s *Server) handleDeleteUserPerms(w http.ResponseWriter,
+	r *http.Request) {
+	req, err := userPermQuery(r)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	if req.ID == 0 && req.UserID == 0 && req.PermID == 0 {
+		s.writeError(w, r, dlib.NewError(http.StatusBadRequest,
+			"delete requires a filter"))
+		return
+	}
+
+	res, err := s.DeleteUserPerms(httpContext(r), req)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	s.writeJSON(w, r, http.StatusOK, res)
+}
@@ -0,0 +1,200 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dhaifley/dauth/lib"
+	"github.com/dhaifley/dlib"
+	"github.com/dhaifley/dlib/ptypes"
+	"github.com/sirupsen/logrus/hooks/test"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func testHTTPServer(t *testing.T) *Server {
+	ph, err := lib.HashPassword("test", bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lm, _ := test.NewNullLogger()
+	svr := Server{Users: &MockUserAccess{Pass: ph}, Tokens: &MockTokenAccess{},
+		RefreshTokens: &MockRefreshTokenAccess{},
+		Perms:         &MockPermAccess{Admin: true}, Keys: testKeyRing(t),
+		PasswordCost: bcrypt.MinCost, Log: lm}
+	svr.UserPerms = &MockUserPermAccess{Server: &svr}
+	return &svr
+}
+
+// testAuthHeader is the authorization header of an admin access token.
+var testAuthHeader = []string{"Authorization", "Bearer test"}
+
+func serveHTTP(svr *Server, method, path, body string,
+	hdr ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	for i := 0; i+1 < len(hdr); i += 2 {
+		req.Header.Set(hdr[i], hdr[i+1])
+	}
+
+	rec := httptest.NewRecorder()
+	svr.Routes().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHTTPLogin(t *testing.T) {
+	svr := testHTTPServer(t)
+	rec := serveHTTP(svr, "POST", "/dauth/login",
+		`{"user":"test","pass":"`+dlib.EncodeBase64String("test")+`"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status expected: %v, got: %v, %v", http.StatusOK, rec.Code,
+			rec.Body)
+	}
+
+	var res TokenPair
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Token == nil || res.Token.Token == "" || res.RefreshToken == "" {
+		t.Errorf("Expected token pair, got: %v", res)
+	}
+
+	rec = serveHTTP(svr, "POST", "/dauth/login",
+		`{"user":"test","pass":"`+dlib.EncodeBase64String("bad")+`"}`)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Status expected: %v, got: %v", http.StatusUnauthorized,
+			rec.Code)
+	}
+
+	rec = serveHTTP(svr, "POST", "/dauth/login", `{`)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Status expected: %v, got: %v", http.StatusBadRequest,
+			rec.Code)
+	}
+}
+
+func TestHTTPAuth(t *testing.T) {
+	svr := testHTTPServer(t)
+	rec := serveHTTP(svr, "GET", "/dauth/auth?service=test&name=test", "",
+		"Authorization", "Bearer test")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status expected: %v, got: %v, %v", http.StatusOK, rec.Code,
+			rec.Body)
+	}
+
+	var res ptypes.AuthResponse
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+
+	if !res.Ok {
+		t.Errorf("Expected authorized, got: %v", res)
+	}
+
+	rec = serveHTTP(svr, "GET", "/dauth/auth", "")
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Status expected: %v, got: %v", http.StatusUnauthorized,
+			rec.Code)
+	}
+}
+
+func TestHTTPUsers(t *testing.T) {
+	svr := testHTTPServer(t)
+	rec := serveHTTP(svr, "GET", "/dauth/users?user=test", "",
+		testAuthHeader...)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status expected: %v, got: %v", http.StatusOK, rec.Code)
+	}
+
+	var list []ptypes.UserResponse
+	if err := json.NewDecoder(rec.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(list) != 1 || list[0].User != "test" || list[0].Pass != "" {
+		t.Errorf("Users expected: [test], got: %v", list)
+	}
+
+	rec = serveHTTP(svr, "GET", "/dauth/users/1", "", testAuthHeader...)
+	var one ptypes.UserResponse
+	if err := json.NewDecoder(rec.Body).Decode(&one); err != nil {
+		t.Fatal(err)
+	}
+
+	if one.ID != 1 {
+		t.Errorf("User id expected: 1, got: %v", one.ID)
+	}
+
+	rec = serveHTTP(svr, "POST", "/dauth/users", `[{"user":"test"}]`,
+		testAuthHeader...)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Status expected: %v, got: %v", http.StatusOK, rec.Code)
+	}
+
+	rec = serveHTTP(svr, "PUT", "/dauth/users/1", `{"user":"test"}`,
+		testAuthHeader...)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Status expected: %v, got: %v", http.StatusOK, rec.Code)
+	}
+
+	rec = serveHTTP(svr, "GET", "/dauth/users?id=x", "", testAuthHeader...)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Status expected: %v, got: %v", http.StatusBadRequest,
+			rec.Code)
+	}
+
+	rec = serveHTTP(svr, "DELETE", "/dauth/users", "", testAuthHeader...)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Status expected: %v, got: %v", http.StatusBadRequest,
+			rec.Code)
+	}
+
+	rec = serveHTTP(svr, "DELETE", "/dauth/users/1", "", testAuthHeader...)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Status expected: %v, got: %v", http.StatusOK, rec.Code)
+	}
+}
+
+func TestHTTPDeleteOldTokens(t *testing.T) {
+	svr := testHTTPServer(t)
+	rec := serveHTTP(svr, "DELETE", "/dauth/tokens/old", "", testAuthHeader...)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status expected: %v, got: %v", http.StatusOK, rec.Code)
+	}
+
+	var res ptypes.DeleteResponse
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Num != 1 {
+		t.Errorf("Delete count expected: 1, got: %v", res.Num)
+	}
+}
+
+func TestHTTPPermsAndUserPerms(t *testing.T) {
+	svr := testHTTPServer(t)
+	for _, p := range []string{"/dauth/perms", "/dauth/user_perms",
+		"/dauth/tokens"} {
+		rec := serveHTTP(svr, "GET", p, "", testAuthHeader...)
+		if rec.Code != http.StatusOK {
+			t.Errorf("%v status expected: %v, got: %v", p, http.StatusOK,
+				rec.Code)
+		}
+
+		rec = serveHTTP(svr, "POST", p, `[{"id":1}]`, testAuthHeader...)
+		if rec.Code != http.StatusOK {
+			t.Errorf("%v status expected: %v, got: %v", p, http.StatusOK,
+				rec.Code)
+		}
+
+		rec = serveHTTP(svr, "DELETE", p+"/1", "", testAuthHeader...)
+		if rec.Code != http.StatusOK {
+			t.Errorf("%v status expected: %v, got: %v", p, http.StatusOK,
+				rec.Code)
+		}
+	}
+}
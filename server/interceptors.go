@@ -0,0 +1,256 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dhaifley/dauth/lib"
+	"github.com/dhaifley/dlib"
+	"github.com/dhaifley/dlib/dauth"
+	"github.com/dhaifley/dlib/ptypes"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// PermService is the perm Service of the perms required to call the
+// management RPCs.
+const PermService = "dauth"
+
+// RPCPerm values describe who may call an RPC. Public RPCs need no access
+// token, either because they issue one or because they check the token in
+// their request themselves. Other RPCs need an access token in the
+// authorization metadata whose user holds the perm Name of PermService.
+type RPCPerm struct {
+	Public bool
+	Name   string
+}
+
+// RPCPerms is the perm required to call each RPC, by method name. RPCs
+// which are not listed may not be called.
+var RPCPerms = map[string]RPCPerm{
+	"Auth":               {Public: true},
+	"Authorize":          {Public: true},
+	"BatchAuth":          {Public: true},
+	"EffectivePerms":     {Public: true},
+	"JWKS":               {Public: true},
+	"Login":              {Public: true},
+	"Logout":             {Public: true},
+	"LogoutAll":          {Public: true},
+	"Refresh":            {Public: true},
+	"EnrollMFA":          {Public: true},
+	"VerifyMFA":          {Public: true},
+	"ListSessions":       {Public: true},
+	"RevokeSessions":     {Public: true},
+	"ChangePassword":     {Public: true},
+	"GetTokens":          {Name: "tokens:read"},
+	"SaveTokens":         {Name: "tokens:write"},
+	"DeleteTokens":       {Name: "tokens:write"},
+	"GetUsers":           {Name: "users:read"},
+	"SaveUsers":          {Name: "users:write"},
+	"DeleteUsers":        {Name: "users:write"},
+	"Unlock":             {Name: "users:write"},
+	"RequireMFA":         {Name: "users:write"},
+	"ResetMFA":           {Name: "users:write"},
+	"ForcePasswordReset": {Name: "users:write"},
+	"RevokeUserSessions": {Name: "sessions:write"},
+	"GetPerms":           {Name: "perms:read"},
+	"SavePerms":          {Name: "perms:write"},
+	"DeletePerms":        {Name: "perms:write"},
+	"GetUserPerms":       {Name: "perms:read"},
+	"SaveUserPerms":      {Name: "perms:write"},
+	"DeleteUserPerms":    {Name: "perms:write"},
+	"GetRoles":           {Name: "roles:read"},
+	"SaveRoles":          {Name: "roles:write"},
+	"DeleteRoles":        {Name: "roles:write"},
+	"GetRolePerms":       {Name: "roles:read"},
+	"SaveRolePerms":      {Name: "roles:write"},
+	"DeleteRolePerms":    {Name: "roles:write"},
+	"GetUserRoles":       {Name: "roles:read"},
+	"SaveUserRoles":      {Name: "roles:write"},
+	"DeleteUserRoles":    {Name: "roles:write"},
+	"GetGroups":          {Name: "groups:read"},
+	"SaveGroups":         {Name: "groups:write"},
+	"DeleteGroups":       {Name: "groups:write"},
+	"GetGroupPerms":      {Name: "groups:read"},
+	"SaveGroupPerms":     {Name: "groups:write"},
+	"DeleteGroupPerms":   {Name: "groups:write"},
+	"GetUserGroups":      {Name: "groups:read"},
+	"SaveUserGroups":     {Name: "groups:write"},
+	"DeleteUserGroups":   {Name: "groups:write"},
+	"GetGroupGroups":     {Name: "groups:read"},
+	"SaveGroupGroups":    {Name: "groups:write"},
+	"DeleteGroupGroups":  {Name: "groups:write"},
+	"GetGrants":          {Name: "grants:read"},
+	"SaveGrants":         {Name: "grants:write"},
+	"DeleteGrants":       {Name: "grants:write"},
+	"CacheStats":         {Name: "cache:read"},
+	"QueryAudit":         {Name: "audit:read"},
+}
+
+// UnaryInterceptor checks that the caller of a unary RPC holds the perm it
+// requires, counts the call in the metrics of the server, and traces it.
+func (s *Server) UnaryInterceptor(ctx context.Context, req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (res interface{}, err error) {
+	defer s.observeRPC(info.FullMethod, time.Now(), &err)
+	ctx, span := startRPCSpan(ctx, info.FullMethod)
+	defer func() { endRPCSpan(span, err) }()
+	ctx, err = s.authorizeRPC(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+
+	return handler(ctx, req)
+}
+
+// StreamInterceptor checks that the caller of a streaming RPC holds the
+// perm it requires, counts the call in the metrics of the server, and
+// traces it.
+func (s *Server) StreamInterceptor(srv interface{}, ss grpc.ServerStream,
+	info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer s.observeRPC(info.FullMethod, time.Now(), &err)
+	ctx, span := startRPCSpan(ss.Context(), info.FullMethod)
+	defer func() { endRPCSpan(span, err) }()
+	ctx, err = s.authorizeRPC(ctx, info.FullMethod)
+	if err != nil {
+		return err
+	}
+
+	return handler(srv, &callerStream{ServerStream: ss, ctx: ctx})
+}
+
+// authorizeRPC checks that the access token in the authorization metadata
+// of a call holds the perm required by the RPC, using the same check as
+// Auth. The RPC may be a full gRPC method name or a method name. The context
+// returned carries the user of the token, who is the actor of the audit
+// events recorded by the call.
+func (s *Server) authorizeRPC(ctx context.Context,
+	method string) (context.Context, error) {
+	rpc := method[strings.LastIndex(method, "/")+1:]
+	rp, ok := RPCPerms[rpc]
+	if !ok {
+		err := dlib.NewError(http.StatusForbidden, "rpc not allowed")
+		s.Log.WithFields(logrus.Fields{
+			"rpc":     rpc,
+			"method":  method,
+			"code":    http.StatusForbidden,
+			"context": ctx,
+		}).Error(err)
+		return ctx, err
+	}
+
+	if rp.Public {
+		return ctx, nil
+	}
+
+	token := callerToken(ctx)
+	if token == "" {
+		err := dlib.NewError(http.StatusUnauthorized, "unauthorized token")
+		s.Log.WithFields(logrus.Fields{
+			"rpc":     rpc,
+			"code":    http.StatusUnauthorized,
+			"context": ctx,
+		}).Warning("missing token")
+		return ctx, err
+	}
+
+	res, err := s.Auth(ctx, &ptypes.AuthRequest{
+		Token: &ptypes.TokenRequest{Token: token},
+		Perm:  &ptypes.PermRequest{Service: PermService, Name: rp.Name},
+	})
+	if err != nil {
+		return ctx, err
+	}
+
+	u := &dauth.User{}
+	if res.User != nil {
+		u.ID, u.User = res.User.ID, res.User.User
+	}
+
+	if !res.Ok {
+		err := dlib.NewError(http.StatusForbidden, "permission denied")
+		s.Log.WithFields(logrus.Fields{
+			"rpc":     rpc,
+			"code":    http.StatusForbidden,
+			"context": ctx,
+			"user_id": u.ID,
+			"perm":    PermService + ":" + rp.Name,
+		}).Warning(err)
+		s.auditUser(ctx, u, rpc, PermService+":"+rp.Name, err)
+		return ctx, err
+	}
+
+	return withCaller(ctx, u), nil
+}
+
+// authorized wraps an HTTP handler of the gateway to an RPC, checking that
+// the bearer token holds the perm the RPC requires.
+func (s *Server) authorized(rpc string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, err := s.authorizeRPC(httpContext(r), rpc)
+		if err != nil {
+			s.writeError(w, r, err)
+			return
+		}
+
+		if u := callerFrom(ctx); u != nil {
+			r = r.WithContext(withCaller(r.Context(), u))
+		}
+
+		h(w, r)
+	}
+}
+
+// callerToken returns the bearer token in the authorization metadata of a
+// call, if present.
+func callerToken(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		return parseBearer(firstValue(md, "authorization"))
+	}
+
+	return ""
+}
+
+// rpcPermNames returns the sorted names of the perms of PermService
+// required by RPCs, which end with a suffix.
+func rpcPermNames(suffix string) []string {
+	seen := map[string]bool{}
+	names := []string{}
+	for _, rp := range RPCPerms {
+		if rp.Name == "" || seen[rp.Name] ||
+			!strings.HasSuffix(rp.Name, suffix) {
+			continue
+		}
+
+		seen[rp.Name] = true
+		names = append(names, rp.Name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// matchesAny returns whether a matcher matches any of the named perms of
+// PermService.
+func matchesAny(m *lib.PermMatcher, names []string) bool {
+	for _, name := range names {
+		if _, ok := m.Match(PermService, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseBearer returns the token of a bearer authorization value.
+func parseBearer(a string) string {
+	if len(a) > 7 && strings.EqualFold(a[:7], "bearer ") {
+		return strings.TrimSpace(a[7:])
+	}
+
+	return ""
+}
@@ -0,0 +1,138 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/dhaifley/dlib"
+	"github.com/dhaifley/dlib/ptypes"
+	"github.com/sirupsen/logrus/hooks/test"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func testInterceptorServer(admin bool) *Server {
+	lm, _ := test.NewNullLogger()
+	svr := Server{Users: &MockUserAccess{}, Tokens: &MockTokenAccess{},
+		RefreshTokens: &MockRefreshTokenAccess{},
+		Perms:         &MockPermAccess{Admin: admin}, Log: lm}
+	svr.UserPerms = &MockUserPermAccess{Server: &svr}
+	return &svr
+}
+
+func testBearerContext(token string) context.Context {
+	return metadata.NewIncomingContext(context.Background(),
+		metadata.Pairs("authorization", "Bearer "+token))
+}
+
+func TestRPCPermsComplete(t *testing.T) {
+	for _, it := range []reflect.Type{
+		reflect.TypeOf((*ptypes.AuthServer)(nil)).Elem(),
+		reflect.TypeOf((*AuthExtServer)(nil)).Elem(),
+	} {
+		for i := 0; i < it.NumMethod(); i++ {
+			if _, ok := RPCPerms[it.Method(i).Name]; !ok {
+				t.Errorf("No perm listed for RPC %v", it.Method(i).Name)
+			}
+		}
+	}
+}
+
+func TestServerAuthorizeRPC(t *testing.T) {
+	cases := []struct {
+		admin  bool
+		ctx    context.Context
+		method string
+		code   int
+	}{
+		{ctx: context.Background(), method: "/ptypes.Auth/Login"},
+		{ctx: context.Background(), method: "/dauth.AuthExt/SaveRoles",
+			code: http.StatusUnauthorized},
+		{ctx: testBearerContext("test"), method: "/dauth.AuthExt/SaveRoles",
+			code: http.StatusForbidden},
+		{admin: true, ctx: testBearerContext("test"),
+			method: "/dauth.AuthExt/SaveRoles"},
+		{admin: true, ctx: testBearerContext("test"),
+			method: "/grpc.health.v1.Health/Check",
+			code:   http.StatusForbidden},
+	}
+
+	for _, c := range cases {
+		_, err := testInterceptorServer(c.admin).authorizeRPC(c.ctx,
+			c.method)
+		if c.code == 0 && err != nil {
+			t.Errorf("%v expected to be allowed, got: %v", c.method, err)
+		} else if c.code != 0 {
+			if e, ok := err.(*dlib.Error); !ok || e.Code != c.code {
+				t.Errorf("%v expected code %v, got: %v", c.method, c.code,
+					err)
+			}
+		}
+	}
+}
+
+func TestServerInterceptors(t *testing.T) {
+	svr := testInterceptorServer(false)
+	called := false
+	handler := func(ctx context.Context, req interface{}) (interface{},
+		error) {
+		called = true
+		return nil, nil
+	}
+
+	if _, err := svr.UnaryInterceptor(testBearerContext("test"), nil,
+		&grpc.UnaryServerInfo{FullMethod: "/ptypes.Auth/DeleteUsers"},
+		handler); err == nil || called {
+		t.Error("Expected the unary RPC to be refused")
+	}
+
+	if _, err := svr.UnaryInterceptor(context.Background(), nil,
+		&grpc.UnaryServerInfo{FullMethod: "/dauth.AuthExt/Refresh"},
+		handler); err != nil || !called {
+		t.Errorf("Expected the unary RPC to be called, got: %v", err)
+	}
+
+	called = false
+	stream := func(srv interface{}, ss grpc.ServerStream) error {
+		called = true
+		return nil
+	}
+
+	if err := svr.StreamInterceptor(nil,
+		&httpStream{ctx: testBearerContext("test")},
+		&grpc.StreamServerInfo{FullMethod: "/ptypes.Auth/SaveUsers"},
+		stream); err == nil || called {
+		t.Error("Expected the streaming RPC to be refused")
+	}
+
+	svr = testInterceptorServer(true)
+	if err := svr.StreamInterceptor(nil,
+		&httpStream{ctx: testBearerContext("test")},
+		&grpc.StreamServerInfo{FullMethod: "/ptypes.Auth/SaveUsers"},
+		stream); err != nil || !called {
+		t.Errorf("Expected the streaming RPC to be called, got: %v", err)
+	}
+}
+
+func TestHTTPAuthorized(t *testing.T) {
+	svr := testHTTPServer(t)
+	svr.Perms = &MockPermAccess{}
+	rec := serveHTTP(svr, "GET", "/dauth/users", "")
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Status expected: %v, got: %v", http.StatusUnauthorized,
+			rec.Code)
+	}
+
+	rec = serveHTTP(svr, "GET", "/dauth/users", "", testAuthHeader...)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Status expected: %v, got: %v", http.StatusForbidden,
+			rec.Code)
+	}
+
+	rec = serveHTTP(svr, "GET", "/dauth/jwks", "")
+	if rec.Code != http.StatusOK {
+		t.Errorf("Status expected: %v, got: %v", http.StatusOK, rec.Code)
+	}
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/dhaifley/dauth/lib"
+	"github.com/dhaifley/dlib"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// LoadKeys loads the token signing key ring from configuration.
+func (s *Server) LoadKeys() error {
+	var cfg []lib.KeyConfig
+	if err := viper.UnmarshalKey("signing_keys", &cfg); err != nil {
+		return err
+	}
+
+	for i := range cfg {
+		if cfg[i].Alg == "" {
+			cfg[i].Alg = viper.GetString("signing_alg")
+		}
+	}
+
+	kr, err := lib.NewKeyRingFromConfig(cfg,
+		viper.GetString("signing_key_id"),
+		viper.GetDuration("signing_key_grace"))
+	if err != nil {
+		return err
+	}
+
+	s.Keys = kr
+	if s.Log != nil {
+		s.Log.WithField("signing_key_id", kr.Signing).
+			Info("Token signing keys loaded")
+	}
+
+	return nil
+}
+
+// JWKSRequest values are requests for the token verification keys.
+type JWKSRequest struct{}
+
+// JWKS returns the public keys which may be used to verify tokens.
+func (s *Server) JWKS(ctx context.Context,
+	req *JWKSRequest) (*lib.JWKSet, error) {
+	if s.Keys == nil {
+		err := dlib.NewError(http.StatusInternalServerError,
+			"token signing keys not configured")
+		s.Log.WithFields(logrus.Fields{
+			"rpc":     "JWKS",
+			"code":    http.StatusInternalServerError,
+			"context": ctx,
+		}).Error(err)
+		return nil, err
+	}
+
+	res := s.Keys.JWKS()
+	return &res, nil
+}
+
+// handleJWKS publishes the token verification keys over HTTP.
+func (s *Server) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	res, err := s.JWKS(r.Context(), &JWKSRequest{})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		s.Log.WithFields(logrus.Fields{
+			"route": r.URL.Path,
+			"code":  http.StatusInternalServerError,
+		}).Error(err)
+	}
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dhaifley/dauth/lib"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/spf13/viper"
+)
+
+func testKeyRing(t *testing.T) *lib.KeyRing {
+	kr, err := lib.NewKeyRingFromConfig([]lib.KeyConfig{
+		{ID: "test", Secret: "test"},
+	}, "test", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return kr
+}
+
+func TestServerLoadKeys(t *testing.T) {
+	defer viper.Reset()
+	viper.Set("signing_keys", []map[string]interface{}{
+		{"id": "new", "secret": "new"},
+		{"id": "old", "secret": "old", "retired": "2018-08-01T00:00:00Z"},
+	})
+
+	viper.Set("signing_key_id", "new")
+	viper.Set("signing_key_grace", "24h")
+	lm, _ := test.NewNullLogger()
+	svr := Server{Log: lm}
+	if err := svr.LoadKeys(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := svr.Keys.Key("old"); !ok {
+		t.Error("Expected retired key to remain in key ring")
+	}
+
+	if svr.Keys.Grace != 24*time.Hour {
+		t.Errorf("Grace expected: 24h, got: %v", svr.Keys.Grace)
+	}
+
+	viper.Set("signing_key_id", "old")
+	if err := svr.LoadKeys(); err == nil {
+		t.Error("Expected error for retired signing key")
+	}
+}
+
+func TestServerJWKS(t *testing.T) {
+	lm, _ := test.NewNullLogger()
+	svr := Server{Log: lm}
+	if _, err := svr.JWKS(context.Background(), &JWKSRequest{}); err == nil {
+		t.Error("Expected error when no signing keys are configured")
+	}
+
+	kr, err := lib.NewKeyRing("ed", 0, testEd25519Key(t, "ed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	svr.Keys = kr
+	res, err := svr.JWKS(context.Background(), &JWKSRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Keys) != 1 || res.Keys[0].Kid != "ed" {
+		t.Errorf("Keys expected: [ed], got: %v", res.Keys)
+	}
+
+	rec := httptest.NewRecorder()
+	svr.Routes().ServeHTTP(rec,
+		httptest.NewRequest("GET", "/.well-known/jwks.json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status expected: %v, got: %v", http.StatusOK, rec.Code)
+	}
+
+	var set lib.JWKSet
+	if err := json.NewDecoder(rec.Body).Decode(&set); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(set.Keys) != 1 || set.Keys[0].Alg != "EdDSA" {
+		t.Errorf("Keys expected: [EdDSA], got: %v", set.Keys)
+	}
+}
+
+func testEd25519Key(t *testing.T, id string) *lib.Key {
+	_, pk, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &lib.Key{ID: id, Method: lib.SigningMethodEd25519, Private: pk}
+}
@@ -0,0 +1,319 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dhaifley/dauth/lib"
+	"github.com/dhaifley/dlib"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// MetricsPath is the HTTP path of the Prometheus metrics of the server.
+const MetricsPath = "/metrics"
+
+// DefaultTokenStatsInterval is how long the counts of active tokens are
+// kept before the database is queried again.
+const DefaultTokenStatsInterval = time.Minute
+
+// Metrics values hold the Prometheus metrics of a server. Their labels
+// never hold user names or tokens, only RPC names, codes and outcomes.
+type Metrics struct {
+	Registry      *lib.MetricRegistry
+	Requests      *lib.CounterVec
+	Latency       *lib.HistogramVec
+	Logins        *lib.CounterVec
+	StatsInterval time.Duration
+	mu            sync.Mutex
+	stats         *lib.TokenStats
+	statsAt       time.Time
+}
+
+// NewMetrics creates a new Metrics value with no observations.
+func NewMetrics() *Metrics {
+	m := Metrics{
+		Registry: lib.NewMetricRegistry(),
+		Requests: lib.NewCounterVec("dauth_requests_total",
+			"Requests processed, by RPC, transport and status code.",
+			"rpc", "transport", "code"),
+		Latency: lib.NewHistogramVec("dauth_request_duration_seconds",
+			"Request latency in seconds, by RPC and transport.",
+			lib.DefaultLatencyBuckets, "rpc", "transport"),
+		Logins: lib.NewCounterVec("dauth_logins_total",
+			"Login attempts, by RPC, outcome and reason.",
+			"rpc", "outcome", "reason"),
+		StatsInterval: DefaultTokenStatsInterval,
+	}
+
+	m.Registry.Register(m.Requests, m.Latency, m.Logins)
+	return &m
+}
+
+// LoadMetrics enables the Prometheus metrics of the server, unless the
+// metrics setting is false. Active tokens are counted at most once every
+// metrics_token_stats_interval.
+func (s *Server) LoadMetrics() {
+	s.Metrics = nil
+	if !viper.GetBool("metrics") {
+		return
+	}
+
+	m := NewMetrics()
+	if d := viper.GetDuration("metrics_token_stats_interval"); d > 0 {
+		m.StatsInterval = d
+	}
+
+	m.Registry.Register(
+		lib.CollectorFunc(s.collectCache),
+		lib.CollectorFunc(s.collectReaper),
+		lib.CollectorFunc(s.collectSQL),
+		lib.CollectorFunc(s.collectTokens),
+	)
+
+	s.Metrics = m
+	if s.Log != nil {
+		s.Log.WithFields(logrus.Fields{
+			"path":           MetricsPath,
+			"stats_interval": m.StatsInterval,
+		}).Info("Metrics configured")
+	}
+}
+
+// observe counts a processed request and its latency.
+func (m *Metrics) observe(rpc, transport string, code int,
+	d time.Duration) {
+	if m == nil {
+		return
+	}
+
+	m.Requests.Inc(rpc, transport, strconv.Itoa(code))
+	m.Latency.Observe(d.Seconds(), rpc, transport)
+}
+
+// observeRPC counts a gRPC call and its latency. It is deferred, so the
+// error of the call is passed by reference.
+func (s *Server) observeRPC(method string, start time.Time, err *error) {
+	rpc := method[strings.LastIndex(method, "/")+1:]
+	s.Metrics.observe(rpc, "grpc", errorCode(*err), time.Since(start))
+}
+
+// login counts a login attempt by its outcome and reason.
+func (m *Metrics) login(rpc string, res *TokenPair, err error) {
+	if m == nil {
+		return
+	}
+
+	outcome, reason := auditOutcome(err), "ok"
+	switch {
+	case err != nil:
+		switch errorCode(err) {
+		case http.StatusBadRequest:
+			reason = "bad_request"
+		case http.StatusUnauthorized:
+			reason = "invalid_credentials"
+		case http.StatusTooManyRequests:
+			reason = "throttled"
+		default:
+			reason = "error"
+		}
+	case res != nil && res.MFAPending:
+		outcome, reason = lib.AuditPending, "mfa_required"
+	case res != nil && res.PasswordChange:
+		outcome, reason = lib.AuditPending, "password_change"
+	}
+
+	m.Logins.Inc(rpc, outcome, reason)
+}
+
+// errorCode returns the status code of the error of a request.
+func errorCode(err error) int {
+	if err == nil {
+		return http.StatusOK
+	}
+
+	if e, ok := err.(*dlib.Error); ok && e.Code >= 400 && e.Code < 600 {
+		return e.Code
+	}
+
+	return http.StatusInternalServerError
+}
+
+// statusWriter records the status code of an HTTP response.
+type statusWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+func (sw *statusWriter) WriteHeader(code int) {
+	sw.code = code
+	sw.ResponseWriter.WriteHeader(code)
+}
+
+// instrumented wraps an HTTP handler of the gateway to an RPC, counting
+// its requests and latency, and tracing them.
+func (s *Server) instrumented(rpc string,
+	h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		r, span := startHTTPSpan(r)
+		sw := statusWriter{ResponseWriter: w, code: http.StatusOK}
+		h(&sw, r)
+		endHTTPSpan(span, sw.code)
+		s.Metrics.observe(rpc, "http", sw.code, time.Since(start))
+	}
+}
+
+// handleMetrics writes the metrics of the server in the Prometheus text
+// format.
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", lib.MetricsContentType)
+	if err := s.Metrics.Registry.WriteText(w); err != nil {
+		s.Log.WithFields(logrus.Fields{
+			"route": r.URL.Path,
+			"code":  http.StatusInternalServerError,
+		}).Error(err)
+	}
+}
+
+// collectCache returns the statistics of the Auth cache.
+func (s *Server) collectCache() []lib.MetricFamily {
+	if s.Cache == nil {
+		return nil
+	}
+
+	st := s.Cache.Stats()
+	hits := lib.NewMetricFamily("dauth_cache_hits_total",
+		"Auth cache hits.", lib.MetricCounter)
+	misses := lib.NewMetricFamily("dauth_cache_misses_total",
+		"Auth cache misses.", lib.MetricCounter)
+	evictions := lib.NewMetricFamily("dauth_cache_evictions_total",
+		"Auth cache evictions.", lib.MetricCounter)
+	entries := lib.NewMetricFamily("dauth_cache_entries",
+		"Auth cache entries.", lib.MetricGauge)
+	for _, c := range []struct {
+		name string
+		st   lib.CacheStats
+	}{{"tokens", st.Tokens}, {"perms", st.Perms}} {
+		hits.Add(float64(c.st.Hits), "cache", c.name)
+		misses.Add(float64(c.st.Misses), "cache", c.name)
+		evictions.Add(float64(c.st.Evictions), "cache", c.name)
+		entries.Add(float64(c.st.Entries), "cache", c.name)
+	}
+
+	return []lib.MetricFamily{*hits, *misses, *evictions, *entries}
+}
+
+// collectReaper returns the statistics of the expired token reaper.
+func (s *Server) collectReaper() []lib.MetricFamily {
+	if s.Reaper == nil {
+		return nil
+	}
+
+	runs, total := s.Reaper.Stats()
+	return []lib.MetricFamily{
+		*lib.NewMetricFamily("dauth_reaper_runs_total",
+			"Completed expired token reaper runs.", lib.MetricCounter).
+			Add(float64(runs)),
+		*lib.NewMetricFamily("dauth_reaper_removed_total",
+			"Expired records removed by the reaper.",
+			lib.MetricCounter).
+			Add(float64(total.Tokens), "kind", "token").
+			Add(float64(total.RefreshTokens), "kind", "refresh_token").
+			Add(float64(total.Sessions), "kind", "session").
+			Add(float64(total.Revocations), "kind", "revocation"),
+	}
+}
+
+// collectSQL returns the statistics of the database connection pool.
+func (s *Server) collectSQL() []lib.MetricFamily {
+	if s.SQL == nil {
+		return nil
+	}
+
+	st := s.SQL.Stats()
+	gauge := func(name, help string, v float64) lib.MetricFamily {
+		return *lib.NewMetricFamily(name, help, lib.MetricGauge).Add(v)
+	}
+
+	counter := func(name, help string, v float64) lib.MetricFamily {
+		return *lib.NewMetricFamily(name, help, lib.MetricCounter).Add(v)
+	}
+
+	return []lib.MetricFamily{
+		gauge("dauth_sql_max_open_connections",
+			"Maximum open database connections.",
+			float64(st.MaxOpenConnections)),
+		gauge("dauth_sql_open_connections", "Open database connections.",
+			float64(st.OpenConnections)),
+		gauge("dauth_sql_in_use_connections",
+			"Database connections in use.", float64(st.InUse)),
+		gauge("dauth_sql_idle_connections", "Idle database connections.",
+			float64(st.Idle)),
+		counter("dauth_sql_wait_count_total",
+			"Waits for a database connection.", float64(st.WaitCount)),
+		counter("dauth_sql_wait_duration_seconds_total",
+			"Time spent waiting for a database connection.",
+			st.WaitDuration.Seconds()),
+		counter("dauth_sql_max_idle_closed_total",
+			"Database connections closed because the pool was full.",
+			float64(st.MaxIdleClosed)),
+		counter("dauth_sql_max_lifetime_closed_total",
+			"Database connections closed at their maximum lifetime.",
+			float64(st.MaxLifetimeClosed)),
+	}
+}
+
+// collectTokens returns the counts of active tokens and sessions, which are
+// queried from the database at most once every StatsInterval.
+func (s *Server) collectTokens() []lib.MetricFamily {
+	st := s.tokenStats(context.Background())
+	if st == nil {
+		return nil
+	}
+
+	f := lib.NewMetricFamily("dauth_active_tokens",
+		"Tokens which have not expired, by kind.", lib.MetricGauge)
+	f.Add(float64(st.Tokens), "kind", "access")
+	f.Add(float64(st.RefreshTokens), "kind", "refresh")
+	return []lib.MetricFamily{
+		*f,
+		*lib.NewMetricFamily("dauth_active_sessions",
+			"Sessions which have not expired.", lib.MetricGauge).
+			Add(float64(st.Sessions)),
+	}
+}
+
+// tokenStats returns the counts of active tokens, or the last counts when
+// they were queried less than StatsInterval ago. Failures are logged and
+// the last counts are kept.
+func (s *Server) tokenStats(ctx context.Context) *lib.TokenStats {
+	m := s.Metrics
+	if m == nil || s.TokenStats == nil {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stats != nil && time.Since(m.statsAt) < m.StatsInterval {
+		return m.stats
+	}
+
+	for r := range s.TokenStats.GetTokenStats(ctx) {
+		if r.Err != nil {
+			s.Log.WithField("code", http.StatusInternalServerError).
+				Error(r.Err)
+			return m.stats
+		}
+
+		if v, ok := r.Val.(lib.TokenStats); ok {
+			m.stats, m.statsAt = &v, time.Now()
+		}
+	}
+
+	return m.stats
+}
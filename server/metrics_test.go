@@ -0,0 +1,149 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dhaifley/dauth/lib"
+	"github.com/dhaifley/dlib"
+	"github.com/dhaifley/dlib/ptypes"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc"
+)
+
+type MockTokenStatsAccess struct {
+	Calls int64
+}
+
+func (m *MockTokenStatsAccess) GetTokenStats(
+	ctx context.Context) <-chan dlib.Result {
+	atomic.AddInt64(&m.Calls, 1)
+	return mockResults(lib.TokenStats{Tokens: 3, RefreshTokens: 2,
+		Sessions: 1})
+}
+
+func testMetricsServer(t *testing.T) (*Server, *MockTokenStatsAccess) {
+	svr := testHTTPServer(t)
+	mtsa := MockTokenStatsAccess{}
+	svr.TokenStats = &mtsa
+	svr.SQL = &MockDBSession{}
+	svr.Cache = NewAuthCache(10, time.Minute)
+	viper.Set("metrics", true)
+	viper.Set("metrics_token_stats_interval", "1h")
+	svr.LoadMetrics()
+	return svr, &mtsa
+}
+
+func TestServerMetricsInterceptor(t *testing.T) {
+	svr, _ := testMetricsServer(t)
+	handler := func(ctx context.Context, req interface{}) (interface{},
+		error) {
+		return nil, nil
+	}
+
+	for _, ctx := range []context.Context{
+		context.Background(), testBearerContext("test"),
+	} {
+		svr.UnaryInterceptor(ctx, nil, &grpc.UnaryServerInfo{
+			FullMethod: "/dauth.AuthExt/SaveRoles"}, handler)
+	}
+
+	m := svr.Metrics
+	if v := m.Requests.Value("SaveRoles", "grpc", "401"); v != 1 {
+		t.Errorf("Unauthorized expected: 1, got: %v", v)
+	}
+
+	if v := m.Requests.Value("SaveRoles", "grpc", "200"); v != 1 {
+		t.Errorf("OK expected: 1, got: %v", v)
+	}
+
+	if c := m.Latency.Count("SaveRoles", "grpc"); c != 2 {
+		t.Errorf("Latency observations expected: 2, got: %v", c)
+	}
+}
+
+func TestServerMetricsLogin(t *testing.T) {
+	svr, _ := testMetricsServer(t)
+	for _, pw := range []string{"test", "bad"} {
+		svr.login(context.Background(), &ptypes.UserRequest{User: "test",
+			Pass: dlib.EncodeBase64String(pw)})
+	}
+
+	svr.login(context.Background(), &ptypes.UserRequest{})
+	m := svr.Metrics
+	if v := m.Logins.Value("Login", lib.AuditSuccess, "ok"); v != 1 {
+		t.Errorf("Successful logins expected: 1, got: %v", v)
+	}
+
+	if v := m.Logins.Value("Login", lib.AuditDenied,
+		"invalid_credentials"); v != 2 {
+		t.Errorf("Invalid logins expected: 2, got: %v", v)
+	}
+
+	var nm *Metrics
+	nm.login("Login", nil, nil)
+	nm.observe("Login", "grpc", http.StatusOK, time.Second)
+}
+
+func TestHTTPMetrics(t *testing.T) {
+	svr, mtsa := testMetricsServer(t)
+	svr.Reaper = NewReaper(&MockTokenAccess{Old: 2}, 0, 10, 0, nil)
+	if _, err := svr.Reaper.Prune(context.Background(),
+		time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	serveHTTP(svr, "POST", "/dauth/login",
+		`{"user":"test","pass":"`+dlib.EncodeBase64String("bad")+`"}`)
+	rec := serveHTTP(svr, "GET", MetricsPath, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status expected: %v, got: %v", http.StatusOK, rec.Code)
+	}
+
+	if ct := rec.Header().Get("Content-Type"); ct != lib.MetricsContentType {
+		t.Errorf("Content type expected: %v, got: %v", lib.MetricsContentType,
+			ct)
+	}
+
+	body := rec.Body.String()
+	for _, exp := range []string{
+		`dauth_requests_total{rpc="Login",transport="http",code="401"} 1`,
+		`dauth_logins_total{rpc="Login",outcome="denied",` +
+			`reason="invalid_credentials"} 1`,
+		`dauth_request_duration_seconds_count{rpc="Login",transport="http"} 1`,
+		`dauth_cache_entries{cache="tokens"} 0`,
+		`dauth_reaper_removed_total{kind="token"} 2`,
+		`dauth_reaper_removed_total{kind="session"} 0`,
+		`dauth_reaper_removed_total{kind="revocation"} 0`,
+		`dauth_active_tokens{kind="access"} 3`,
+		`dauth_active_sessions 1`,
+		`dauth_sql_open_connections 1`,
+	} {
+		if !strings.Contains(body, exp) {
+			t.Errorf("Metric expected: %v, got: %v", exp, body)
+		}
+	}
+
+	if strings.Contains(body, `"test"`) {
+		t.Errorf("Expected no user names in labels, got: %v", body)
+	}
+
+	serveHTTP(svr, "GET", MetricsPath, "")
+	if c := atomic.LoadInt64(&mtsa.Calls); c != 1 {
+		t.Errorf("Token stats queries expected: 1, got: %v", c)
+	}
+
+	viper.Set("metrics", false)
+	defer viper.Set("metrics", true)
+	svr.LoadMetrics()
+	svr.Router = nil
+	if rec = serveHTTP(svr, "GET", MetricsPath, ""); rec.Code !=
+		http.StatusNotFound {
+		t.Errorf("Status expected: %v, got: %v", http.StatusNotFound,
+			rec.Code)
+	}
+}
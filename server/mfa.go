@@ -0,0 +1,705 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/dhaifley/dauth/lib"
+	"github.com/dhaifley/dlib"
+	"github.com/dhaifley/dlib/dauth"
+	"github.com/dhaifley/dlib/ptypes"
+	"github.com/sirupsen/logrus"
+)
+
+// MFAPendingHeader is the response header set by Login when the returned
+// token is an MFA pending token.
+const MFAPendingHeader = "mfa-pending"
+
+// MFAPendingLifetime is the lifetime of MFA pending tokens.
+const MFAPendingLifetime = 5 * time.Minute
+
+// RecoveryCodeCount is the number of recovery codes issued on enrollment.
+const RecoveryCodeCount = 10
+
+// MFAEnrollRequest values are requests to enroll a user in two-factor
+// authentication. Token may be an access token or an MFA pending token.
+type MFAEnrollRequest struct {
+	Token string `json:"token"`
+}
+
+// MFAEnrollResponse values contain a new TOTP secret, the URI used to
+// provision it in an authenticator app, and single use recovery codes.
+type MFAEnrollResponse struct {
+	Secret        string   `json:"secret"`
+	URI           string   `json:"uri"`
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// MFAVerifyRequest values are requests to complete a login with a TOTP code
+// or a recovery code.
+type MFAVerifyRequest struct {
+	Token string `json:"token"`
+	Code  string `json:"code"`
+}
+
+// MFARequireRequest values are requests to set whether a user must use
+// two-factor authentication.
+type MFARequireRequest struct {
+	UserID   int64 `json:"user_id"`
+	Required bool  `json:"required"`
+}
+
+// MFAResetRequest values are requests to remove the two-factor
+// authentication secret and recovery codes of a user.
+type MFAResetRequest struct {
+	UserID int64 `json:"user_id"`
+}
+
+// UserMFAResponse values report the two-factor authentication settings of
+// a user.
+type UserMFAResponse struct {
+	UserID   int64 `json:"user_id"`
+	Enabled  bool  `json:"enabled"`
+	Required bool  `json:"required"`
+}
+
+// getUserMFA returns the two-factor authentication settings of a user, or
+// nil if the user has none.
+func (s *Server) getUserMFA(ctx context.Context,
+	userID int64) (*lib.UserMFA, error) {
+	var m *lib.UserMFA
+	for r := range s.MFA.GetUserMFA(ctx, userID) {
+		if r.Err != nil {
+			if err, ok := r.Err.(*dlib.Error); ok &&
+				err.Code == http.StatusNotFound {
+				continue
+			}
+
+			return nil, r.Err
+		}
+
+		switch v := r.Val.(type) {
+		case lib.UserMFA:
+			m = &v
+		case *lib.UserMFA:
+			m = v
+		}
+	}
+
+	return m, nil
+}
+
+// mfaPerms returns the perms whose holders must use two-factor
+// authentication: the perms of PermService required by the RPCs which
+// change data.
+func mfaPerms() []string {
+	return rpcPermNames(":write")
+}
+
+// holdsMFAPerm returns whether a user is granted any of the mfaPerms,
+// directly, through a wildcard such as admin/admin, or through a role or
+// group.
+func (s *Server) holdsMFAPerm(ctx context.Context,
+	userID int64) (bool, error) {
+	m, err := s.userMatcher(ctx, userID, nil)
+	if err != nil {
+		return false, err
+	}
+
+	return matchesAny(m, mfaPerms()), nil
+}
+
+// mfaRequired returns whether a user must complete two-factor
+// authentication to log in. It is required for users who have enabled it,
+// users for whom it is marked required and users holding a perm allowing
+// them to change data through the management RPCs.
+func (s *Server) mfaRequired(ctx context.Context, req interface{},
+	u *dauth.User) (bool, error) {
+	if s.MFA == nil {
+		return false, nil
+	}
+
+	m, err := s.getUserMFA(ctx, u.ID)
+	if err == nil && m != nil && (m.Enabled || m.Required) {
+		return true, nil
+	}
+
+	priv := false
+	if err == nil {
+		priv, err = s.holdsMFAPerm(ctx, u.ID)
+	}
+
+	if err != nil {
+		s.Log.WithFields(logrus.Fields{
+			"rpc":     "Login",
+			"code":    http.StatusInternalServerError,
+			"context": ctx,
+			"request": req,
+		}).Error(err)
+		return false, err
+	}
+
+	return priv, nil
+}
+
+// issuePending creates an MFA pending token for a user. It can only be used
+// to enroll in and complete two-factor authentication.
+func (s *Server) issuePending(ctx context.Context, req interface{},
+	u *dauth.User) (*TokenPair, error) {
+	res, err := s.issueLimited(ctx, "Login", req, u, MFAPendingLifetime,
+		func(tc *lib.TokenClaims) { tc.MFAPending = true })
+	if err != nil {
+		return nil, err
+	}
+
+	s.Log.WithFields(logrus.Fields{
+		"rpc":     "Login",
+		"context": ctx,
+		"user_id": u.ID,
+	}).Info("two-factor authentication required")
+	res.MFAPending = true
+	return res, nil
+}
+
+// issueLimited creates a short lived token for a user, which mark restricts
+// to a single step of logging in. Limited tokens are not stored and have no
+// refresh token.
+func (s *Server) issueLimited(ctx context.Context, rpc string,
+	req interface{}, u *dauth.User, lifetime time.Duration,
+	mark func(tc *lib.TokenClaims)) (*TokenPair, error) {
+	if s.Keys == nil {
+		err := dlib.NewError(http.StatusInternalServerError,
+			"token signing keys not configured")
+		s.Log.WithFields(logrus.Fields{
+			"rpc":     rpc,
+			"code":    http.StatusInternalServerError,
+			"context": ctx,
+			"request": req,
+		}).Error(err)
+		return nil, err
+	}
+
+	ct := time.Now()
+	et := ct.Add(lifetime)
+	tc, err := lib.NewTokenClaims(u.User, u.ID, s.Issuer, s.Audience, ct, et)
+	if err != nil {
+		s.Log.WithFields(logrus.Fields{
+			"rpc":     rpc,
+			"code":    http.StatusInternalServerError,
+			"context": ctx,
+			"request": req,
+		}).Error(err)
+		return nil, err
+	}
+
+	mark(tc)
+	ts, err := s.Keys.Sign(tc)
+	if err != nil {
+		s.Log.WithFields(logrus.Fields{
+			"rpc":     rpc,
+			"code":    http.StatusInternalServerError,
+			"context": ctx,
+			"request": req,
+		}).Error(err)
+		return nil, err
+	}
+
+	res := TokenPair{
+		Token: &ptypes.TokenResponse{
+			Token:   ts,
+			UserID:  u.ID,
+			Created: ct.Unix(),
+			Expires: et.Unix(),
+		},
+	}
+
+	return &res, nil
+}
+
+// limitedRevoked returns whether a limited token has already been used and
+// added to the revocation list.
+func (s *Server) limitedRevoked(ctx context.Context,
+	tc *lib.TokenClaims) (bool, error) {
+	if s.Revocations == nil {
+		return false, nil
+	}
+
+	return s.tokenRevoked(ctx, tc.Id)
+}
+
+// revokeLimited adds a limited token to the revocation list once it has
+// been used, so that it can not be used again.
+func (s *Server) revokeLimited(ctx context.Context, ts string) error {
+	if s.Revocations == nil {
+		return nil
+	}
+
+	tc, err := lib.ParseTokenClaims(ts)
+	if err != nil {
+		return err
+	}
+
+	rt := lib.NewRevokedToken(tc)
+	for r := range s.Revocations.RevokeToken(ctx, &rt) {
+		if r.Err != nil {
+			return r.Err
+		}
+	}
+
+	return nil
+}
+
+// mfaToken verifies an access token or MFA pending token and returns the
+// user it was issued to, and whether it is an MFA pending token.
+func (s *Server) mfaToken(ctx context.Context, rpc string,
+	ts string) (*dauth.User, bool, error) {
+	if s.MFA == nil || s.Keys == nil {
+		err := dlib.NewError(http.StatusInternalServerError,
+			"two-factor authentication not configured")
+		s.Log.WithFields(logrus.Fields{
+			"rpc":     rpc,
+			"code":    http.StatusInternalServerError,
+			"context": ctx,
+		}).Error(err)
+		return nil, false, err
+	}
+
+	tc, err := s.Keys.Verify(ts, s.Issuer, s.Audience)
+	if err != nil {
+		s.Log.WithFields(logrus.Fields{
+			"rpc":     rpc,
+			"code":    http.StatusUnauthorized,
+			"context": ctx,
+			"error":   err,
+		}).Warning("unauthorized token")
+		return nil, false, dlib.NewError(http.StatusUnauthorized,
+			"unauthorized token")
+	}
+
+	if tc.MFAPending {
+		revoked, err := s.limitedRevoked(ctx, tc)
+		if err != nil {
+			s.Log.WithFields(logrus.Fields{
+				"rpc":     rpc,
+				"code":    http.StatusInternalServerError,
+				"context": ctx,
+			}).Error(err)
+			return nil, false, err
+		}
+
+		if revoked {
+			s.Log.WithFields(logrus.Fields{
+				"rpc":     rpc,
+				"code":    http.StatusUnauthorized,
+				"context": ctx,
+				"user_id": tc.UserID,
+			}).Warning("revoked token")
+			return nil, false, dlib.NewError(http.StatusUnauthorized,
+				"unauthorized token")
+		}
+
+		return &dauth.User{ID: tc.UserID, User: tc.User}, true, nil
+	}
+
+	u, _, err := s.verifyToken(ctx, &ptypes.AuthRequest{
+		Token: &ptypes.TokenRequest{Token: ts},
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	return u, false, nil
+}
+
+// EnrollMFA creates a new TOTP secret and recovery codes for a user. The
+// secret is not used until it is confirmed by a successful VerifyMFA call.
+func (s *Server) EnrollMFA(ctx context.Context,
+	req *MFAEnrollRequest) (*MFAEnrollResponse, error) {
+	u, _, err := s.mfaToken(ctx, "EnrollMFA", req.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := s.getUserMFA(ctx, u.ID)
+	if err != nil {
+		s.Log.WithFields(logrus.Fields{
+			"rpc":     "EnrollMFA",
+			"code":    http.StatusInternalServerError,
+			"context": ctx,
+			"user_id": u.ID,
+		}).Error(err)
+		return nil, err
+	}
+
+	if m != nil && m.Enabled {
+		err := dlib.NewError(http.StatusConflict,
+			"two-factor authentication already enabled")
+		s.Log.WithFields(logrus.Fields{
+			"rpc":     "EnrollMFA",
+			"code":    http.StatusConflict,
+			"context": ctx,
+			"user_id": u.ID,
+		}).Warning(err)
+		return nil, err
+	}
+
+	secret, err := lib.NewTOTPSecret()
+	if err != nil {
+		s.Log.WithFields(logrus.Fields{
+			"rpc":     "EnrollMFA",
+			"code":    http.StatusInternalServerError,
+			"context": ctx,
+			"user_id": u.ID,
+		}).Error(err)
+		return nil, err
+	}
+
+	codes, err := lib.NewRecoveryCodes(RecoveryCodeCount)
+	if err != nil {
+		s.Log.WithFields(logrus.Fields{
+			"rpc":     "EnrollMFA",
+			"code":    http.StatusInternalServerError,
+			"context": ctx,
+			"user_id": u.ID,
+		}).Error(err)
+		return nil, err
+	}
+
+	nm := lib.UserMFA{UserID: u.ID, Secret: secret}
+	if m != nil {
+		nm.Required = m.Required
+		nm.LastStep = m.LastStep
+	}
+
+	hashes := make([]string, len(codes))
+	for i, c := range codes {
+		hashes[i] = lib.HashToken(lib.NormalizeRecoveryCode(c))
+	}
+
+	if err := s.saveUserMFA(ctx, &nm, hashes); err != nil {
+		s.Log.WithFields(logrus.Fields{
+			"rpc":     "EnrollMFA",
+			"code":    http.StatusInternalServerError,
+			"context": ctx,
+			"user_id": u.ID,
+		}).Error(err)
+		return nil, err
+	}
+
+	iss := s.Issuer
+	if iss == "" {
+		iss = lib.ServiceInfo.Name
+	}
+
+	s.Log.WithFields(logrus.Fields{
+		"rpc":     "EnrollMFA",
+		"code":    http.StatusOK,
+		"context": ctx,
+		"user_id": u.ID,
+	}).Info("EnrollMFA request processed")
+	res := MFAEnrollResponse{
+		Secret:        secret,
+		URI:           lib.TOTPURI(iss, u.User, secret),
+		RecoveryCodes: codes,
+	}
+
+	return &res, nil
+}
+
+// saveUserMFA saves the two-factor authentication settings of a user and
+// replaces their recovery codes with the provided hashes.
+func (s *Server) saveUserMFA(ctx context.Context,
+	m *lib.UserMFA, hashes []string) error {
+	for r := range s.MFA.SaveUserMFA(ctx, m) {
+		if r.Err != nil {
+			return r.Err
+		}
+	}
+
+	for r := range s.MFA.DeleteRecoveryCodes(ctx, m.UserID) {
+		if r.Err != nil {
+			return r.Err
+		}
+	}
+
+	for _, h := range hashes {
+		for r := range s.MFA.SaveRecoveryCode(ctx, m.UserID, h) {
+			if r.Err != nil {
+				return r.Err
+			}
+		}
+	}
+
+	return nil
+}
+
+// VerifyMFA completes a login by checking a TOTP code or a recovery code for
+// the user of an MFA pending token, and issues a new access and refresh
+// token pair. The first successful call after enrollment enables two-factor
+// authentication for the user.
+func (s *Server) VerifyMFA(ctx context.Context,
+	req *MFAVerifyRequest) (res *TokenPair, err error) {
+	defer func() { s.Metrics.login("VerifyMFA", res, err) }()
+	u, pending, err := s.mfaToken(ctx, "VerifyMFA", req.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() { s.auditLogin(ctx, "VerifyMFA", u, res, err) }()
+
+	if !pending {
+		err := dlib.NewError(http.StatusBadRequest,
+			"MFA pending token required")
+		s.Log.WithFields(logrus.Fields{
+			"rpc":     "VerifyMFA",
+			"code":    http.StatusBadRequest,
+			"context": ctx,
+			"user_id": u.ID,
+		}).Error(err)
+		return nil, err
+	}
+
+	keys := []string{lib.LoginMFAKey(u.ID)}
+	if err := s.checkThrottle(ctx, "VerifyMFA", req, keys); err != nil {
+		return nil, err
+	}
+
+	failed := false
+	defer func() {
+		if !failed {
+			s.releaseThrottle(ctx, "VerifyMFA", req, keys)
+		}
+	}()
+
+	m, err := s.getUserMFA(ctx, u.ID)
+	if err != nil {
+		s.Log.WithFields(logrus.Fields{
+			"rpc":     "VerifyMFA",
+			"code":    http.StatusInternalServerError,
+			"context": ctx,
+			"user_id": u.ID,
+		}).Error(err)
+		return nil, err
+	}
+
+	if m == nil || m.Secret == "" {
+		err := dlib.NewError(http.StatusPreconditionFailed,
+			"two-factor authentication not enrolled")
+		s.Log.WithFields(logrus.Fields{
+			"rpc":     "VerifyMFA",
+			"code":    http.StatusPreconditionFailed,
+			"context": ctx,
+			"user_id": u.ID,
+		}).Warning(err)
+		return nil, err
+	}
+
+	ok, err := s.checkMFACode(ctx, m, req.Code)
+	if err != nil {
+		s.Log.WithFields(logrus.Fields{
+			"rpc":     "VerifyMFA",
+			"code":    http.StatusInternalServerError,
+			"context": ctx,
+			"user_id": u.ID,
+		}).Error(err)
+		return nil, err
+	}
+
+	if !ok {
+		failed = true
+		err := dlib.NewError(http.StatusUnauthorized,
+			"invalid two-factor code")
+		s.Log.WithFields(logrus.Fields{
+			"rpc":     "VerifyMFA",
+			"code":    http.StatusUnauthorized,
+			"context": ctx,
+			"user_id": u.ID,
+		}).Warning(err)
+		return nil, err
+	}
+
+	s.resetThrottle(ctx, "VerifyMFA", req, keys)
+	if err := s.revokeLimited(ctx, req.Token); err != nil {
+		s.Log.WithFields(logrus.Fields{
+			"rpc":     "VerifyMFA",
+			"code":    http.StatusInternalServerError,
+			"context": ctx,
+			"user_id": u.ID,
+		}).Error(err)
+		return nil, err
+	}
+
+	if !m.Enabled {
+		m.Enabled = true
+		for r := range s.MFA.SaveUserMFA(ctx, m) {
+			if r.Err != nil {
+				s.Log.WithFields(logrus.Fields{
+					"rpc":     "VerifyMFA",
+					"code":    http.StatusInternalServerError,
+					"context": ctx,
+					"user_id": u.ID,
+				}).Error(r.Err)
+				return nil, r.Err
+			}
+		}
+	}
+
+	res, err = s.completeLogin(ctx, "VerifyMFA", req, u)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Log.WithFields(logrus.Fields{
+		"rpc":     "VerifyMFA",
+		"code":    http.StatusOK,
+		"context": ctx,
+		"user_id": u.ID,
+	}).Info("VerifyMFA request processed")
+	return res, nil
+}
+
+// checkMFACode checks a TOTP code, or a recovery code once two-factor
+// authentication is enabled, and marks it as used. On success, m is updated
+// with the accepted time step.
+func (s *Server) checkMFACode(ctx context.Context,
+	m *lib.UserMFA, code string) (bool, error) {
+	step, ok, err := lib.ValidateTOTP(m.Secret, code, time.Now())
+	if err != nil {
+		return false, err
+	}
+
+	var ch <-chan dlib.Result
+	if ok {
+		ch = s.MFA.UseTOTPStep(ctx, m.UserID, step)
+	} else if m.Enabled {
+		ch = s.MFA.UseRecoveryCode(ctx, m.UserID,
+			lib.HashToken(lib.NormalizeRecoveryCode(code)))
+	} else {
+		return false, nil
+	}
+
+	n := 0
+	for r := range ch {
+		if r.Err != nil {
+			return false, r.Err
+		}
+
+		n += r.Num
+	}
+
+	if ok && n > 0 {
+		m.LastStep = step
+	}
+
+	return n > 0, nil
+}
+
+// RequireMFA sets whether a user must use two-factor authentication.
+func (s *Server) RequireMFA(ctx context.Context,
+	req *MFARequireRequest) (res *UserMFAResponse, err error) {
+	defer func() { s.audit(ctx, "RequireMFA", req, err) }()
+	return s.updateUserMFA(ctx, "RequireMFA", req, req.UserID,
+		func(m *lib.UserMFA) { m.Required = req.Required })
+}
+
+// ResetMFA removes the TOTP secret and recovery codes of a user, for
+// example after the user has lost their authenticator. A user for whom
+// two-factor authentication is required must enroll again on next login.
+func (s *Server) ResetMFA(ctx context.Context,
+	req *MFAResetRequest) (res *UserMFAResponse, err error) {
+	defer func() { s.audit(ctx, "ResetMFA", req, err) }()
+	res, err = s.updateUserMFA(ctx, "ResetMFA", req, req.UserID,
+		func(m *lib.UserMFA) {
+			m.Secret = ""
+			m.Enabled = false
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	for r := range s.MFA.DeleteRecoveryCodes(ctx, req.UserID) {
+		if r.Err != nil {
+			s.Log.WithFields(logrus.Fields{
+				"rpc":     "ResetMFA",
+				"code":    http.StatusInternalServerError,
+				"context": ctx,
+				"request": req,
+			}).Error(r.Err)
+			return nil, r.Err
+		}
+	}
+
+	return res, nil
+}
+
+// updateUserMFA applies a change to the two-factor authentication settings
+// of a user and saves them.
+func (s *Server) updateUserMFA(ctx context.Context, rpc string,
+	req interface{}, userID int64,
+	update func(m *lib.UserMFA)) (*UserMFAResponse, error) {
+	if s.MFA == nil {
+		err := dlib.NewError(http.StatusInternalServerError,
+			"two-factor authentication not configured")
+		s.Log.WithFields(logrus.Fields{
+			"rpc":     rpc,
+			"code":    http.StatusInternalServerError,
+			"context": ctx,
+			"request": req,
+		}).Error(err)
+		return nil, err
+	}
+
+	if userID == 0 {
+		err := dlib.NewError(http.StatusBadRequest, "invalid user id")
+		s.Log.WithFields(logrus.Fields{
+			"rpc":     rpc,
+			"code":    http.StatusBadRequest,
+			"context": ctx,
+			"request": req,
+		}).Error(err)
+		return nil, err
+	}
+
+	m, err := s.getUserMFA(ctx, userID)
+	if err != nil {
+		s.Log.WithFields(logrus.Fields{
+			"rpc":     rpc,
+			"code":    http.StatusInternalServerError,
+			"context": ctx,
+			"request": req,
+		}).Error(err)
+		return nil, err
+	}
+
+	if m == nil {
+		m = &lib.UserMFA{UserID: userID}
+	}
+
+	update(m)
+	for r := range s.MFA.SaveUserMFA(ctx, m) {
+		if r.Err != nil {
+			s.Log.WithFields(logrus.Fields{
+				"rpc":     rpc,
+				"code":    http.StatusInternalServerError,
+				"context": ctx,
+				"request": req,
+			}).Error(r.Err)
+			return nil, r.Err
+		}
+	}
+
+	s.Log.WithFields(logrus.Fields{
+		"rpc":     rpc,
+		"code":    http.StatusOK,
+		"context": ctx,
+		"request": req,
+	}).Info(rpc + " request processed")
+	res := UserMFAResponse{
+		UserID:   m.UserID,
+		Enabled:  m.Enabled,
+		Required: m.Required,
+	}
+
+	return &res, nil
+}
@@ -0,0 +1,253 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dhaifley/dauth/lib"
+	"github.com/dhaifley/dlib"
+	"github.com/dhaifley/dlib/dauth"
+	"github.com/dhaifley/dlib/ptypes"
+	"github.com/sirupsen/logrus/hooks/test"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type MockMFAAccess struct {
+	MFA   *lib.UserMFA
+	Codes map[string]bool
+}
+
+func (m *MockMFAAccess) result(v dlib.Result) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 1)
+	ch <- v
+	close(ch)
+	return ch
+}
+
+func (m *MockMFAAccess) GetUserMFA(ctx context.Context,
+	userID int64) <-chan dlib.Result {
+	if m.MFA == nil {
+		ch := make(chan dlib.Result)
+		close(ch)
+		return ch
+	}
+
+	return m.result(dlib.Result{Val: *m.MFA, Num: 1})
+}
+
+func (m *MockMFAAccess) SaveUserMFA(ctx context.Context,
+	a *lib.UserMFA) <-chan dlib.Result {
+	v := *a
+	m.MFA = &v
+	return m.result(dlib.Result{Num: 1})
+}
+
+func (m *MockMFAAccess) UseTOTPStep(ctx context.Context,
+	userID, step int64) <-chan dlib.Result {
+	if m.MFA == nil || m.MFA.LastStep >= step {
+		return m.result(dlib.Result{Num: 0})
+	}
+
+	m.MFA.LastStep = step
+	return m.result(dlib.Result{Num: 1})
+}
+
+func (m *MockMFAAccess) DeleteRecoveryCodes(ctx context.Context,
+	userID int64) <-chan dlib.Result {
+	n := len(m.Codes)
+	m.Codes = map[string]bool{}
+	return m.result(dlib.Result{Num: n})
+}
+
+func (m *MockMFAAccess) SaveRecoveryCode(ctx context.Context, userID int64,
+	code string) <-chan dlib.Result {
+	m.Codes[code] = false
+	return m.result(dlib.Result{Num: 1})
+}
+
+func (m *MockMFAAccess) UseRecoveryCode(ctx context.Context, userID int64,
+	code string) <-chan dlib.Result {
+	if used, ok := m.Codes[code]; !ok || used {
+		return m.result(dlib.Result{Num: 0})
+	}
+
+	m.Codes[code] = true
+	return m.result(dlib.Result{Num: 1})
+}
+
+func testMFAServer(t *testing.T, admin bool) (*Server, *MockMFAAccess) {
+	ph, err := lib.HashPassword("test", bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mma := MockMFAAccess{Codes: map[string]bool{}}
+	lm, _ := test.NewNullLogger()
+	svr := Server{Users: &MockUserAccess{Pass: ph}, Tokens: &MockTokenAccess{},
+		RefreshTokens: &MockRefreshTokenAccess{}, MFA: &mma,
+		Revocations: &MockRevocationAccess{}, Keys: testKeyRing(t),
+		Perms: &MockPermAccess{Admin: admin}, PasswordCost: bcrypt.MinCost,
+		Stateless: true, Log: lm}
+	svr.UserPerms = &MockUserPermAccess{Server: &svr}
+	return &svr, &mma
+}
+
+func TestServerLoginMFA(t *testing.T) {
+	svr, mma := testMFAServer(t, true)
+	req := ptypes.UserRequest{
+		User: "test",
+		Pass: dlib.EncodeBase64String("test"),
+	}
+
+	res, err := svr.login(context.Background(), &req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !res.MFAPending || res.RefreshToken != "" {
+		t.Fatalf("Expected MFA pending token for admin, got: %v", res)
+	}
+
+	if _, err := svr.Auth(context.Background(), &ptypes.AuthRequest{
+		Token: &ptypes.TokenRequest{Token: res.Token.Token},
+		Perm:  &ptypes.PermRequest{Service: "test", Name: "test"},
+	}); err == nil {
+		t.Error("Expected MFA pending token to be refused by Auth")
+	}
+
+	if _, err := svr.VerifyMFA(context.Background(), &MFAVerifyRequest{
+		Token: res.Token.Token,
+		Code:  "000000",
+	}); err == nil {
+		t.Error("Expected error before enrollment")
+	}
+
+	enr, err := svr.EnrollMFA(context.Background(),
+		&MFAEnrollRequest{Token: res.Token.Token})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(enr.RecoveryCodes) != RecoveryCodeCount || enr.URI == "" {
+		t.Errorf("Invalid enrollment: %v", enr)
+	}
+
+	code, err := lib.TOTPCode(enr.Secret, lib.TOTPStep(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pair, err := svr.VerifyMFA(context.Background(), &MFAVerifyRequest{
+		Token: res.Token.Token,
+		Code:  code,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pair.MFAPending || pair.RefreshToken == "" || !mma.MFA.Enabled {
+		t.Errorf("Expected token pair and enabled MFA, got: %v", pair)
+	}
+
+	if _, err := svr.VerifyMFA(context.Background(), &MFAVerifyRequest{
+		Token: res.Token.Token,
+		Code:  enr.RecoveryCodes[0],
+	}); err == nil {
+		t.Error("Expected used MFA pending token to be refused")
+	}
+
+	if res, err = svr.login(context.Background(), &req); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := svr.VerifyMFA(context.Background(), &MFAVerifyRequest{
+		Token: res.Token.Token,
+		Code:  code,
+	}); err == nil {
+		t.Error("Expected replayed code to be refused")
+	}
+
+	if _, err := svr.VerifyMFA(context.Background(), &MFAVerifyRequest{
+		Token: res.Token.Token,
+		Code:  enr.RecoveryCodes[0],
+	}); err != nil {
+		t.Errorf("Expected recovery code to be accepted, got: %v", err)
+	}
+
+	if _, err := svr.EnrollMFA(context.Background(),
+		&MFAEnrollRequest{Token: res.Token.Token}); err == nil {
+		t.Error("Expected error enrolling when MFA is enabled")
+	}
+}
+
+func TestServerRequireMFA(t *testing.T) {
+	svr, mma := testMFAServer(t, false)
+	req := ptypes.UserRequest{
+		User: "test",
+		Pass: dlib.EncodeBase64String("test"),
+	}
+
+	res, err := svr.login(context.Background(), &req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.MFAPending {
+		t.Error("Expected MFA not to be required")
+	}
+
+	if _, err := svr.RequireMFA(context.Background(),
+		&MFARequireRequest{UserID: 1, Required: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if res, err = svr.login(context.Background(), &req); err != nil {
+		t.Fatal(err)
+	}
+
+	if !res.MFAPending {
+		t.Error("Expected MFA to be required")
+	}
+
+	mma.MFA.Secret = "test"
+	mma.MFA.Enabled = true
+	mres, err := svr.ResetMFA(context.Background(),
+		&MFAResetRequest{UserID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if mres.Enabled || !mres.Required || mma.MFA.Secret != "" {
+		t.Errorf("Expected reset MFA to stay required, got: %v", mres)
+	}
+}
+
+func TestServerLoginMFAWritePerm(t *testing.T) {
+	req := ptypes.UserRequest{
+		User: "test",
+		Pass: dlib.EncodeBase64String("test"),
+	}
+
+	for name, exp := range map[string]bool{
+		"users:write": true,
+		"perms:write": true,
+		"*":           true,
+		"users:read":  false,
+	} {
+		svr, _ := testMFAServer(t, false)
+		svr.Perms = &MockPermAccess{Perms: map[int64]dauth.Perm{
+			1: {ID: 1, Service: PermService, Name: name},
+		}}
+
+		res, err := svr.login(context.Background(), &req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if res.MFAPending != exp {
+			t.Errorf("MFA required for %v expected: %v, got: %v", name,
+				exp, res.MFAPending)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/dhaifley/dauth/lib"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// DefaultCacheFallbackTTL is the time to live of Auth cache entries while
+// invalidations can not be received.
+const DefaultCacheFallbackTTL = 5 * time.Second
+
+// LoadNotifier starts listening for the invalidations announced by the SQL
+// functions of the database, when the Auth cache is enabled and the
+// auth_cache_listen setting is set.
+func (s *Server) LoadNotifier() error {
+	s.Notifier = nil
+	if s.Cache == nil || !viper.GetBool("auth_cache_listen") {
+		return nil
+	}
+
+	s.Cache.Fallback = viper.GetDuration("auth_cache_fallback_ttl")
+	n, err := lib.NewPQNotifier(viper.GetString("sql"), func(err error) {
+		if s.Log != nil {
+			s.Log.WithField("error", err).Warn("Invalidation listener error")
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	s.Notifier = n
+	if s.Log != nil {
+		s.Log.WithFields(logrus.Fields{
+			"channel":      lib.InvalidateChannel,
+			"fallback_ttl": s.Cache.Fallback,
+		}).Info("Auth cache invalidation listener configured")
+	}
+
+	return nil
+}
+
+// ListenInvalidations removes the Auth cache entries named by the
+// invalidations of the notifier until the context is done. Until the
+// notifier is connected, entries are cached only for the fallback time to
+// live of the cache, since invalidations may be missed.
+func (s *Server) ListenInvalidations(ctx context.Context) {
+	if s.Notifier == nil || s.Cache == nil {
+		return
+	}
+
+	s.Cache.SetConnected(false)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case inv := <-s.Notifier.Invalidations():
+			if err := s.Cache.Invalidate(inv); err != nil {
+				s.Log.WithFields(logrus.Fields{
+					"invalidation": inv.String(),
+					"error":        err,
+				}).Warn("Invalid cache invalidation")
+			}
+		case connected := <-s.Notifier.States():
+			s.Cache.SetConnected(connected)
+			s.Log.WithField("connected", connected).
+				Info("Auth cache invalidation listener state changed")
+		}
+	}
+}
+
+// Invalidate removes the entries named by an invalidation.
+func (ac *AuthCache) Invalidate(inv lib.Invalidation) error {
+	if ac == nil {
+		return nil
+	}
+
+	switch inv.Kind {
+	case lib.InvalidateToken:
+		ac.invalidateTokenHash(inv.Key)
+	case lib.InvalidateUser:
+		id, err := strconv.ParseInt(inv.Key, 10, 64)
+		if err != nil {
+			return err
+		}
+
+		ac.InvalidateUser(id)
+	case lib.InvalidatePerms:
+		if inv.Key == "" {
+			ac.InvalidatePerms()
+			return nil
+		}
+
+		id, err := strconv.ParseInt(inv.Key, 10, 64)
+		if err != nil {
+			return err
+		}
+
+		ac.InvalidatePerms(id)
+	}
+
+	return nil
+}
+
+// SetConnected removes all entries, since invalidations may have been
+// missed, and sets the time to live of the cache to the fallback time to
+// live while invalidations can not be received, or back to the configured
+// time to live when they can. A fallback of zero disables the cache while
+// invalidations can not be received.
+func (ac *AuthCache) SetConnected(connected bool) {
+	if ac == nil {
+		return
+	}
+
+	ttl := ac.ttl
+	if !connected && ac.Fallback < ttl {
+		ttl = ac.Fallback
+	}
+
+	ac.Tokens.SetMaxTTL(ttl)
+	ac.Perms.SetMaxTTL(ttl)
+	ac.InvalidateAll()
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dhaifley/dauth/lib"
+	"github.com/dhaifley/dlib/ptypes"
+)
+
+func waitFor(t *testing.T, msg string, f func() bool) {
+	t.Helper()
+	for end := time.Now().Add(time.Second); time.Now().Before(end); {
+		if f() {
+			return
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	t.Fatal(msg)
+}
+
+func testNotifyServer(t *testing.T) (*Server, *MockGrantAccess,
+	*lib.MemNotifier, context.CancelFunc) {
+	svr, mga := testGrantServer()
+	svr.Cache = NewAuthCache(10, time.Minute)
+	svr.Cache.Fallback = 0
+	n := lib.NewMemNotifier()
+	svr.Notifier = n
+	ctx, cancel := context.WithCancel(context.Background())
+	svr.Cache.SetConnected(false)
+	go svr.ListenInvalidations(ctx)
+	waitFor(t, "Expected the listener to connect", func() bool {
+		return svr.Cache.Perms.MaxTTL() == time.Minute
+	})
+
+	return svr, mga, n, cancel
+}
+
+func TestServerListenInvalidations(t *testing.T) {
+	svr, mga, n, cancel := testNotifyServer(t)
+	defer cancel()
+	req := ptypes.AuthRequest{
+		Token: &ptypes.TokenRequest{Token: "test"},
+		Perm:  &ptypes.PermRequest{Service: "projects", Name: "write"},
+	}
+
+	if res, err := svr.Auth(context.Background(), &req); err != nil {
+		t.Fatal(err)
+	} else if res.Ok {
+		t.Error("Auth expected to refuse the request")
+	}
+
+	mga.Grants = []lib.Grant{{ID: 1, UserID: 1, PermID: 3}}
+	if res, _ := svr.Auth(context.Background(), &req); res.Ok {
+		t.Error("Cached perms expected before invalidation")
+	}
+
+	n.Notify(lib.InvalidatePerms, "")
+	waitFor(t, "Auth expected to allow the request after invalidation",
+		func() bool {
+			res, _ := svr.Auth(context.Background(), &req)
+			return res.Ok
+		})
+
+	n.Notify(lib.InvalidateToken, lib.HashToken("test"))
+	waitFor(t, "Expected the token to be removed", func() bool {
+		return svr.Cache.Stats().Tokens.Entries == 0
+	})
+
+	svr.Auth(context.Background(), &req)
+	n.Notify(lib.InvalidateUser, "1")
+	waitFor(t, "Expected the entries of the user to be removed", func() bool {
+		st := svr.Cache.Stats()
+		return st.Tokens.Entries == 0 && st.Perms.Entries == 0
+	})
+
+	if err := svr.Cache.Invalidate(lib.Invalidation{
+		Kind: lib.InvalidateUser, Key: "test"}); err == nil {
+		t.Error("Expected an error for an invalid user id")
+	}
+}
+
+func TestServerListenInvalidationsFallback(t *testing.T) {
+	svr, _, n, cancel := testNotifyServer(t)
+	defer cancel()
+	req := ptypes.AuthRequest{
+		Token: &ptypes.TokenRequest{Token: "test"},
+		Perm:  &ptypes.PermRequest{Service: "projects", Name: "write"},
+	}
+
+	svr.Auth(context.Background(), &req)
+	n.SetConnected(false)
+	waitFor(t, "Expected the fallback time to live", func() bool {
+		return svr.Cache.Tokens.MaxTTL() == 0
+	})
+
+	if _, err := svr.Auth(context.Background(), &req); err != nil {
+		t.Fatal(err)
+	}
+
+	if st := svr.Cache.Stats(); st.Tokens.Entries != 0 ||
+		st.Perms.Entries != 0 {
+		t.Errorf("Entries expected while disconnected: 0, got: %+v", st)
+	}
+
+	n.SetConnected(true)
+	waitFor(t, "Expected the configured time to live", func() bool {
+		return svr.Cache.Tokens.MaxTTL() == time.Minute
+	})
+
+	svr.Auth(context.Background(), &req)
+	if st := svr.Cache.Stats(); st.Tokens.Entries != 1 {
+		t.Errorf("Token entries expected: 1, got: %v", st.Tokens.Entries)
+	}
+}
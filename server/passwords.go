@@ -0,0 +1,502 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/dhaifley/dauth/lib"
+	"github.com/dhaifley/dlib"
+	"github.com/dhaifley/dlib/dauth"
+	"github.com/dhaifley/dlib/ptypes"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// PasswordChangeHeader is the response header set by Login when the
+// returned token is a password change token.
+const PasswordChangeHeader = "password-change"
+
+// PasswordChangeLifetime is the lifetime of password change tokens.
+const PasswordChangeLifetime = 10 * time.Minute
+
+// ChangePasswordRequest values are requests to change the password of the
+// holder of a token. Token may be an access token or a password change
+// token. Pass and NewPass are base64 encoded, as in Login requests.
+type ChangePasswordRequest struct {
+	Token   string `json:"token"`
+	Pass    string `json:"pass"`
+	NewPass string `json:"new_pass"`
+}
+
+// ChangePasswordResponse values count the other sessions of a user which
+// were revoked by a password change. When the change was made with a
+// password change token, Tokens completes the login.
+type ChangePasswordResponse struct {
+	RevokeSessionsResponse
+	Tokens *TokenPair `json:"tokens,omitempty"`
+}
+
+// ForcePasswordResetRequest values are requests that a user must change
+// their password on next login. When RevokeSessions is set, every session
+// of the user is also ended.
+type ForcePasswordResetRequest struct {
+	UserID         int64 `json:"user_id"`
+	RevokeSessions bool  `json:"revoke_sessions,omitempty"`
+}
+
+// ForcePasswordResetResponse values report the password settings of a
+// user, and the sessions revoked, if requested.
+type ForcePasswordResetResponse struct {
+	lib.UserPassword
+	Revoked *RevokeSessionsResponse `json:"revoked,omitempty"`
+}
+
+// LoadPasswordPolicy configures the passwords users may choose from the
+// password_min_length and password_history settings, and reads the
+// breached password list named by password_breached_file, if set.
+func (s *Server) LoadPasswordPolicy() error {
+	pp := lib.NewPasswordPolicy(viper.GetInt("password_min_length"),
+		viper.GetInt("password_history"))
+	n := 0
+	if path := viper.GetString("password_breached_file"); path != "" {
+		var err error
+		if n, err = pp.LoadBreached(path); err != nil {
+			return err
+		}
+	}
+
+	s.Policy = pp
+	if s.Log != nil {
+		s.Log.WithFields(logrus.Fields{
+			"min_length": pp.MinLength,
+			"history":    pp.History,
+			"breached":   n,
+		}).Info("Password policy configured")
+	}
+
+	return nil
+}
+
+// passwordPolicy returns the configured password policy, or the default
+// policy if none is configured.
+func (s *Server) passwordPolicy() *lib.PasswordPolicy {
+	if s.Policy == nil {
+		return lib.NewPasswordPolicy(lib.DefaultPasswordMinLength,
+			lib.DefaultPasswordHistory)
+	}
+
+	return s.Policy
+}
+
+// completeLogin finishes a login once the password, and a two-factor code
+// if required, have been checked. Users who must change their password are
+// issued a password change token, and other users a new access and refresh
+// token pair.
+func (s *Server) completeLogin(ctx context.Context, rpc string,
+	req interface{}, u *dauth.User) (*TokenPair, error) {
+	up, err := s.getUserPassword(ctx, u.ID)
+	if err != nil {
+		s.Log.WithFields(logrus.Fields{
+			"rpc":     rpc,
+			"code":    http.StatusInternalServerError,
+			"context": ctx,
+			"user_id": u.ID,
+		}).Error(err)
+		return nil, err
+	}
+
+	if up == nil || !up.MustChange {
+		return s.issueTokens(ctx, rpc, req, u, "")
+	}
+
+	res, err := s.issueLimited(ctx, rpc, req, u, PasswordChangeLifetime,
+		func(tc *lib.TokenClaims) { tc.PassChange = true })
+	if err != nil {
+		return nil, err
+	}
+
+	s.Log.WithFields(logrus.Fields{
+		"rpc":     rpc,
+		"context": ctx,
+		"user_id": u.ID,
+	}).Info("password change required")
+	res.PasswordChange = true
+	return res, nil
+}
+
+// getUserPassword returns the password settings of a user, or nil if the
+// user has none, or password settings are not configured.
+func (s *Server) getUserPassword(ctx context.Context,
+	userID int64) (*lib.UserPassword, error) {
+	if s.Passwords == nil {
+		return nil, nil
+	}
+
+	var p *lib.UserPassword
+	for r := range s.Passwords.GetUserPassword(ctx, userID) {
+		if r.Err != nil {
+			if err, ok := r.Err.(*dlib.Error); ok &&
+				err.Code == http.StatusNotFound {
+				continue
+			}
+
+			return nil, r.Err
+		}
+
+		switch v := r.Val.(type) {
+		case lib.UserPassword:
+			p = &v
+		case *lib.UserPassword:
+			p = v
+		}
+	}
+
+	return p, nil
+}
+
+// passwordToken verifies an access token or password change token and
+// returns the user it was issued to, and whether it is a password change
+// token.
+func (s *Server) passwordToken(ctx context.Context,
+	ts string) (*dauth.User, bool, error) {
+	if ts == "" {
+		err := dlib.NewError(http.StatusBadRequest, "invalid token value")
+		s.Log.WithFields(logrus.Fields{
+			"rpc":     "ChangePassword",
+			"code":    http.StatusBadRequest,
+			"context": ctx,
+		}).Error(err)
+		return nil, false, err
+	}
+
+	if s.Keys != nil {
+		tc, err := s.Keys.Verify(ts, s.Issuer, s.Audience)
+		if err == nil && tc.PassChange {
+			revoked, err := s.limitedRevoked(ctx, tc)
+			if err != nil {
+				return nil, false, s.passwordError(ctx, "ChangePassword",
+					tc.UserID, err)
+			}
+
+			if revoked {
+				err := dlib.NewError(http.StatusUnauthorized,
+					"unauthorized token")
+				return nil, false, s.passwordError(ctx, "ChangePassword",
+					tc.UserID, err)
+			}
+
+			return &dauth.User{ID: tc.UserID, User: tc.User}, true, nil
+		}
+	}
+
+	u, err := s.tokenUser(ctx, &ptypes.AuthRequest{
+		Token: &ptypes.TokenRequest{Token: ts},
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	return u, false, nil
+}
+
+// ChangePassword changes the password of the holder of a token, after
+// checking their current password and the password policy. Changing the
+// password ends every other session of the user. When the token is a
+// password change token, every session is ended and the login is completed
+// with a new access and refresh token pair.
+func (s *Server) ChangePassword(ctx context.Context,
+	req *ChangePasswordRequest) (res *ChangePasswordResponse, err error) {
+	if s.Passwords == nil {
+		err := dlib.NewError(http.StatusInternalServerError,
+			"passwords not configured")
+		return nil, s.passwordError(ctx, "ChangePassword", 0, err)
+	}
+
+	u, pending, err := s.passwordToken(ctx, req.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		s.auditUser(ctx, u, "ChangePassword", userTarget(u.ID), err)
+	}()
+
+	pw, err := dlib.DecodeBase64String(req.Pass)
+	if err != nil {
+		err := dlib.NewError(http.StatusBadRequest, "invalid password value")
+		return nil, s.passwordError(ctx, "ChangePassword", u.ID, err)
+	}
+
+	npw, err := dlib.DecodeBase64String(req.NewPass)
+	if err != nil || npw == "" {
+		err := dlib.NewError(http.StatusBadRequest, "invalid password value")
+		return nil, s.passwordError(ctx, "ChangePassword", u.ID, err)
+	}
+
+	keys := loginKeys(ctx, u.User)
+	if err := s.checkThrottle(ctx, "ChangePassword", nil, keys); err != nil {
+		return nil, err
+	}
+
+	failed := false
+	defer func() {
+		if !failed {
+			s.releaseThrottle(ctx, "ChangePassword", nil, keys)
+		}
+	}()
+
+	hash, err := s.userPass(ctx, u.ID)
+	if err != nil {
+		return nil, s.passwordError(ctx, "ChangePassword", u.ID, err)
+	}
+
+	ok, _, err := lib.CheckPassword(hash, pw, s.PasswordCost)
+	if err != nil {
+		return nil, s.passwordError(ctx, "ChangePassword", u.ID, err)
+	}
+
+	if !ok {
+		failed = true
+		err := dlib.NewError(http.StatusUnauthorized, "unauthorized user")
+		return nil, s.passwordError(ctx, "ChangePassword", u.ID, err)
+	}
+
+	s.resetThrottle(ctx, "ChangePassword", nil,
+		[]string{lib.LoginUserKey(u.User)})
+	pp := s.passwordPolicy()
+	previous, err := s.passwordHistory(ctx, u.ID, pp.History)
+	if err != nil {
+		return nil, s.passwordError(ctx, "ChangePassword", u.ID, err)
+	}
+
+	if err := pp.Check(npw, append(previous, hash)); err != nil {
+		return nil, s.passwordError(ctx, "ChangePassword", u.ID, err)
+	}
+
+	nh, err := lib.HashPassword(npw, s.PasswordCost)
+	if err != nil {
+		return nil, s.passwordError(ctx, "ChangePassword", u.ID, err)
+	}
+
+	n := 0
+	for r := range s.Passwords.ChangeUserPass(ctx, u.ID, nh, pp.History) {
+		if r.Err != nil {
+			return nil, s.passwordError(ctx, "ChangePassword", u.ID, r.Err)
+		}
+
+		n += r.Num
+	}
+
+	if n == 0 {
+		err := dlib.NewError(http.StatusNotFound, "user not found")
+		return nil, s.passwordError(ctx, "ChangePassword", u.ID, err)
+	}
+
+	if pending {
+		if err := s.revokeLimited(ctx, req.Token); err != nil {
+			return nil, s.passwordError(ctx, "ChangePassword", u.ID, err)
+		}
+	}
+
+	current := ""
+	if !pending {
+		rts, err := s.refreshTokens(ctx,
+			&lib.RefreshTokenFind{AccessToken: &req.Token})
+		if err != nil {
+			return nil, s.passwordError(ctx, "ChangePassword", u.ID, err)
+		}
+
+		if len(rts) > 0 {
+			current = rts[0].Family
+		}
+	}
+
+	revoked, err := s.revokeOtherSessions(ctx, u.ID, current)
+	if err != nil {
+		return nil, s.passwordError(ctx, "ChangePassword", u.ID, err)
+	}
+
+	res = &ChangePasswordResponse{RevokeSessionsResponse: *revoked}
+	if pending {
+		if res.Tokens, err = s.issueTokens(ctx, "ChangePassword", nil, u,
+			""); err != nil {
+			return nil, err
+		}
+	}
+
+	s.Log.WithFields(logrus.Fields{
+		"rpc":      "ChangePassword",
+		"code":     http.StatusOK,
+		"context":  ctx,
+		"user_id":  u.ID,
+		"sessions": res.Sessions,
+	}).Info("ChangePassword request processed")
+	return res, nil
+}
+
+// ForcePasswordReset marks a user so that their next login must set a new
+// password, for example after their password was found in a breach.
+func (s *Server) ForcePasswordReset(ctx context.Context,
+	req *ForcePasswordResetRequest) (res *ForcePasswordResetResponse,
+	err error) {
+	defer func() {
+		s.audit(ctx, "ForcePasswordReset", userTarget(req.UserID), err)
+	}()
+
+	if s.Passwords == nil {
+		err := dlib.NewError(http.StatusInternalServerError,
+			"passwords not configured")
+		return nil, s.extError(ctx, "ForcePasswordReset", req, err)
+	}
+
+	if req.UserID == 0 {
+		err := dlib.NewError(http.StatusBadRequest, "invalid user id")
+		return nil, s.extError(ctx, "ForcePasswordReset", req, err)
+	}
+
+	if _, err := s.userPass(ctx, req.UserID); err != nil {
+		return nil, s.extError(ctx, "ForcePasswordReset", req, err)
+	}
+
+	up := lib.UserPassword{UserID: req.UserID, MustChange: true}
+	for r := range s.Passwords.SaveUserPassword(ctx, &up) {
+		if r.Err != nil {
+			return nil, s.extError(ctx, "ForcePasswordReset", req, r.Err)
+		}
+	}
+
+	res = &ForcePasswordResetResponse{UserPassword: up}
+	if req.RevokeSessions {
+		revoked, err := s.revokeOtherSessions(ctx, req.UserID, "")
+		if err != nil {
+			return nil, s.extError(ctx, "ForcePasswordReset", req, err)
+		}
+
+		res.Revoked = revoked
+	}
+
+	s.extDone(ctx, "ForcePasswordReset", req, 1)
+	return res, nil
+}
+
+// userPass returns the password hash of a user.
+func (s *Server) userPass(ctx context.Context, userID int64) (string, error) {
+	var u *dauth.User
+	for ur := range s.Users.GetUserByID(ctx, userID) {
+		if ur.Err != nil {
+			if err, ok := ur.Err.(*dlib.Error); ok &&
+				err.Code == http.StatusNotFound {
+				continue
+			}
+
+			return "", ur.Err
+		}
+
+		switch v := ur.Val.(type) {
+		case *dauth.User:
+			u = v
+		case dauth.User:
+			u = &v
+		}
+	}
+
+	if u == nil {
+		return "", dlib.NewError(http.StatusNotFound, "user not found")
+	}
+
+	return u.Pass, nil
+}
+
+// passwordHistory returns at most limit of the previous password hashes of
+// a user.
+func (s *Server) passwordHistory(ctx context.Context,
+	userID int64, limit int) ([]string, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+
+	var hs []string
+	var err error
+	for r := range s.Passwords.GetPasswordHistory(ctx, userID, limit) {
+		if r.Err != nil {
+			if e, ok := r.Err.(*dlib.Error); !ok ||
+				e.Code != http.StatusNotFound {
+				err = r.Err
+			}
+
+			continue
+		}
+
+		if v, ok := r.Val.(string); ok {
+			hs = append(hs, v)
+		}
+	}
+
+	return hs, err
+}
+
+// revokeOtherSessions revokes the refresh token families of a user other
+// than current. When current is empty, every token of the user is also
+// revoked.
+func (s *Server) revokeOtherSessions(ctx context.Context, userID int64,
+	current string) (*RevokeSessionsResponse, error) {
+	defer s.Cache.InvalidateUser(userID)
+	res := RevokeSessionsResponse{UserID: userID}
+	rts, err := s.refreshTokens(ctx, &lib.RefreshTokenFind{UserID: &userID})
+	if err != nil {
+		return nil, err
+	}
+
+	families := map[string]bool{}
+	for _, rt := range rts {
+		if rt.Family != current {
+			families[rt.Family] = true
+		}
+	}
+
+	for f := range families {
+		family := f
+		n, err := s.revokeRefreshTokens(ctx,
+			&lib.RefreshTokenFind{Family: &family})
+		if err != nil {
+			return nil, err
+		}
+
+		res.Sessions++
+		res.RefreshTokens += n
+	}
+
+	if current == "" {
+		if res.Tokens, err = s.revokeTokens(ctx,
+			&dauth.TokenFind{UserID: &userID}); err != nil {
+			return nil, err
+		}
+	}
+
+	return &res, nil
+}
+
+// passwordError logs a failed password RPC without its request, which holds
+// passwords, and returns the error.
+func (s *Server) passwordError(ctx context.Context, rpc string,
+	userID int64, err error) error {
+	code := http.StatusInternalServerError
+	if e, ok := err.(*dlib.Error); ok {
+		code = e.Code
+	}
+
+	l := s.Log.WithFields(logrus.Fields{
+		"rpc":     rpc,
+		"code":    code,
+		"context": ctx,
+		"user_id": userID,
+	})
+	if code >= http.StatusInternalServerError {
+		l.Error(err)
+	} else {
+		l.Warning(err)
+	}
+
+	return err
+}
@@ -0,0 +1,207 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/dhaifley/dauth/lib"
+	"github.com/dhaifley/dlib"
+	"github.com/dhaifley/dlib/ptypes"
+)
+
+type MockPasswordAccess struct {
+	Users    *MockUserAccess
+	Password *lib.UserPassword
+	History  []string
+}
+
+func (m *MockPasswordAccess) result(v dlib.Result) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 1)
+	ch <- v
+	close(ch)
+	return ch
+}
+
+func (m *MockPasswordAccess) GetUserPassword(ctx context.Context,
+	userID int64) <-chan dlib.Result {
+	if m.Password == nil {
+		ch := make(chan dlib.Result)
+		close(ch)
+		return ch
+	}
+
+	return m.result(dlib.Result{Val: *m.Password, Num: 1})
+}
+
+func (m *MockPasswordAccess) SaveUserPassword(ctx context.Context,
+	p *lib.UserPassword) <-chan dlib.Result {
+	v := *p
+	m.Password = &v
+	return m.result(dlib.Result{Num: 1})
+}
+
+func (m *MockPasswordAccess) GetPasswordHistory(ctx context.Context,
+	userID int64,
+	limit int) <-chan dlib.Result {
+	ch := make(chan dlib.Result, len(m.History))
+	for i := len(m.History) - 1; i >= 0 && len(m.History)-i <= limit; i-- {
+		ch <- dlib.Result{Val: m.History[i], Num: 1}
+	}
+
+	close(ch)
+	return ch
+}
+
+func (m *MockPasswordAccess) ChangeUserPass(ctx context.Context,
+	userID int64, pass string,
+	keep int) <-chan dlib.Result {
+	m.Users.Pass = pass
+	m.History = append(m.History, pass)
+	if len(m.History) > keep {
+		m.History = m.History[len(m.History)-keep:]
+	}
+
+	m.Password = &lib.UserPassword{UserID: userID}
+	return m.result(dlib.Result{Num: 1})
+}
+
+func testPasswordServer(t *testing.T) (*Server, *MockPasswordAccess) {
+	svr, _ := testMFAServer(t, false)
+	mpa := MockPasswordAccess{Users: svr.Users.(*MockUserAccess)}
+	svr.Passwords = &mpa
+	svr.Policy = lib.NewPasswordPolicy(8, 2)
+	return svr, &mpa
+}
+
+func testPasswordLogin(svr *Server, pw string) (*TokenPair, error) {
+	return svr.login(context.Background(), &ptypes.UserRequest{
+		User: "test",
+		Pass: dlib.EncodeBase64String(pw),
+	})
+}
+
+func TestServerChangePassword(t *testing.T) {
+	svr, mpa := testPasswordServer(t)
+	pair, err := testPasswordLogin(svr, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	change := func(pw, npw string) error {
+		_, err := svr.ChangePassword(context.Background(),
+			&ChangePasswordRequest{
+				Token:   pair.Token.Token,
+				Pass:    dlib.EncodeBase64String(pw),
+				NewPass: dlib.EncodeBase64String(npw),
+			})
+		return err
+	}
+
+	cases := []struct {
+		pw   string
+		npw  string
+		code int
+	}{
+		{pw: "wrong", npw: "new password 1", code: 401},
+		{pw: "test", npw: "short", code: 400},
+		{pw: "test", npw: "new password 1", code: 0},
+		{pw: "new password 1", npw: "new password 1", code: 400},
+		{pw: "new password 1", npw: "new password 2", code: 0},
+		{pw: "new password 2", npw: "new password 3", code: 0},
+		{pw: "new password 3", npw: "new password 2", code: 400},
+		{pw: "new password 3", npw: "new password 1", code: 0},
+	}
+
+	for _, c := range cases {
+		err := change(c.pw, c.npw)
+		if c.code == 0 && err != nil {
+			t.Errorf("Change to %q expected to succeed, got: %v", c.npw, err)
+		} else if c.code != 0 {
+			if e, ok := err.(*dlib.Error); !ok || e.Code != c.code {
+				t.Errorf("Change to %q expected code %v, got: %v", c.npw,
+					c.code, err)
+			}
+		}
+	}
+
+	if len(mpa.History) != 2 {
+		t.Errorf("History expected: 2, got: %v", len(mpa.History))
+	}
+
+	if _, err := testPasswordLogin(svr, "test"); err == nil {
+		t.Error("Expected the old password to be refused")
+	}
+
+	if _, err := testPasswordLogin(svr, "new password 1"); err != nil {
+		t.Errorf("Expected the new password to be accepted, got: %v", err)
+	}
+}
+
+func TestServerForcePasswordReset(t *testing.T) {
+	svr, mpa := testPasswordServer(t)
+	if _, err := svr.ForcePasswordReset(context.Background(),
+		&ForcePasswordResetRequest{}); err == nil {
+		t.Error("Expected an error without a user id")
+	}
+
+	res, err := svr.ForcePasswordReset(context.Background(),
+		&ForcePasswordResetRequest{UserID: 1, RevokeSessions: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !res.MustChange || res.Revoked == nil || !mpa.Password.MustChange {
+		t.Errorf("Expected the user to be marked, got: %+v", res)
+	}
+
+	pair, err := testPasswordLogin(svr, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !pair.PasswordChange || pair.RefreshToken != "" {
+		t.Fatalf("Expected a password change token, got: %+v", pair)
+	}
+
+	if _, err := svr.Auth(context.Background(), &ptypes.AuthRequest{
+		Token: &ptypes.TokenRequest{Token: pair.Token.Token},
+		Perm:  &ptypes.PermRequest{Service: "test", Name: "test"},
+	}); err == nil {
+		t.Error("Expected the password change token to be refused by Auth")
+	}
+
+	cres, err := svr.ChangePassword(context.Background(),
+		&ChangePasswordRequest{
+			Token:   pair.Token.Token,
+			Pass:    dlib.EncodeBase64String("test"),
+			NewPass: dlib.EncodeBase64String("new password"),
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cres.Tokens == nil || cres.Tokens.RefreshToken == "" {
+		t.Errorf("Expected the login to be completed, got: %+v", cres)
+	}
+
+	_, err = svr.ChangePassword(context.Background(),
+		&ChangePasswordRequest{
+			Token:   pair.Token.Token,
+			Pass:    dlib.EncodeBase64String("new password"),
+			NewPass: dlib.EncodeBase64String("other password"),
+		})
+	if e, ok := err.(*dlib.Error); !ok || e.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the used password change token to be refused, "+
+			"got: %v", err)
+	}
+
+	if pair, err = testPasswordLogin(svr, "new password"); err != nil {
+		t.Fatal(err)
+	}
+
+	if pair.PasswordChange || pair.RefreshToken == "" {
+		t.Errorf("Expected an access token after the change, got: %+v",
+			pair)
+	}
+}
@@ -13,6 +13,7 @@ import (
 // GetPerms returns a stream of perms from the database.
 func (s *Server) GetPerms(req *ptypes.PermRequest,
 	stream ptypes.Auth_GetPermsServer) error {
+	ctx := stream.Context()
 	q := dauth.PermFind{}
 	if err := q.FromPermRequest(req); err != nil {
 		s.Log.WithFields(logrus.Fields{
@@ -23,7 +24,7 @@ func (s *Server) GetPerms(req *ptypes.PermRequest,
 		return err
 	}
 
-	ch := s.Perms.GetPerms(&q)
+	ch := s.Perms.GetPerms(ctx, &q)
 	for r := range ch {
 		if r.Err != nil {
 			s.Log.WithFields(logrus.Fields{
@@ -34,6 +35,10 @@ func (s *Server) GetPerms(req *ptypes.PermRequest,
 			return r.Err
 		}
 
+		if v, ok := r.Val.(dauth.Perm); ok {
+			r.Val = &v
+		}
+
 		switch v := r.Val.(type) {
 		case *dauth.Perm:
 			res := v.ToResponse()
@@ -62,6 +67,7 @@ func (s *Server) GetPerms(req *ptypes.PermRequest,
 // SavePerms serializes a stream of perms to the database.
 func (s *Server) SavePerms(
 	stream ptypes.Auth_SavePermsServer) error {
+	ctx := stream.Context()
 	count := 0
 	for {
 		req, err := stream.Recv()
@@ -87,19 +93,23 @@ func (s *Server) SavePerms(
 
 		v := dauth.Perm{}
 		v.FromRequest(req)
-		ch := s.Perms.SavePerm(&v)
+		ch := s.Perms.SavePerm(ctx, &v)
 		for r := range ch {
 			if r.Err != nil {
+				s.audit(ctx, "SavePerms", req, r.Err)
 				s.Log.WithFields(logrus.Fields{
 					"rpc":     "SavePerms",
 					"code":    http.StatusInternalServerError,
 					"request": req,
 					"count":   count,
-				}).Error(err)
-				return err
+				}).Error(r.Err)
+				return r.Err
 			}
 		}
 
+		s.Cache.InvalidatePerms()
+		s.audit(ctx, "SavePerms", &v, nil)
+
 		res := v.ToResponse()
 		if err := stream.Send(&res); err != nil {
 			s.Log.WithFields(logrus.Fields{
@@ -117,7 +127,9 @@ func (s *Server) SavePerms(
 }
 
 // DeletePerms deletes perms from the database.
-func (s *Server) DeletePerms(ctx context.Context, req *ptypes.PermRequest) (*ptypes.DeleteResponse, error) {
+func (s *Server) DeletePerms(ctx context.Context,
+	req *ptypes.PermRequest) (res *ptypes.DeleteResponse, err error) {
+	defer func() { s.audit(ctx, "DeletePerms", req, err) }()
 	q := dauth.PermFind{}
 	if err := q.FromPermRequest(req); err != nil {
 		s.Log.WithFields(logrus.Fields{
@@ -128,7 +140,7 @@ func (s *Server) DeletePerms(ctx context.Context, req *ptypes.PermRequest) (*pty
 		return nil, err
 	}
 
-	ch := s.Perms.DeletePerms(&q)
+	ch := s.Perms.DeletePerms(ctx, &q)
 	count := int64(0)
 	for r := range ch {
 		if r.Err != nil {
@@ -143,6 +155,7 @@ func (s *Server) DeletePerms(ctx context.Context, req *ptypes.PermRequest) (*pty
 		count += int64(r.Num)
 	}
 
+	s.Cache.InvalidatePerms()
 	s.Log.WithFields(logrus.Fields{
 		"rpc":     "DeletePerms",
 		"code":    http.StatusOK,
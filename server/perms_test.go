@@ -6,21 +6,37 @@ import (
 	"testing"
 
 	"github.com/dhaifley/dlib"
-	"github.com/dhaifley/dlib/ptypes"
 	"github.com/dhaifley/dlib/dauth"
+	"github.com/dhaifley/dlib/ptypes"
 	"github.com/sirupsen/logrus/hooks/test"
 	"google.golang.org/grpc"
 )
 
 type MockPermAccess struct {
-	DBS dlib.SQLExecutor
+	DBS   dlib.SQLExecutor
+	Admin bool
+	Perms map[int64]dauth.Perm
 }
 
-func (m *MockPermAccess) GetPerms(opt *dauth.PermFind) <-chan dlib.Result {
+func (m *MockPermAccess) GetPerms(ctx context.Context,
+	opt *dauth.PermFind) <-chan dlib.Result {
 	ch := make(chan dlib.Result, 256)
 	go func() {
 		defer close(ch)
 		perm := dauth.Perm{ID: 1, Service: "test", Name: "test"}
+		if m.Admin {
+			perm = dauth.Perm{ID: 1, Service: "admin", Name: "admin"}
+		}
+
+		if m.Perms != nil {
+			p, ok := m.Perms[*opt.ID]
+			if !ok {
+				return
+			}
+
+			perm = p
+		}
+
 		r := dlib.Result{Val: &perm}
 		ch <- r
 	}()
@@ -28,11 +44,13 @@ func (m *MockPermAccess) GetPerms(opt *dauth.PermFind) <-chan dlib.Result {
 	return ch
 }
 
-func (m *MockPermAccess) GetPermByID(id int64) <-chan dlib.Result {
-	return m.GetPerms(nil)
+func (m *MockPermAccess) GetPermByID(ctx context.Context,
+	id int64) <-chan dlib.Result {
+	return m.GetPerms(ctx, nil)
 }
 
-func (m *MockPermAccess) DeletePerms(opt *dauth.PermFind) <-chan dlib.Result {
+func (m *MockPermAccess) DeletePerms(ctx context.Context,
+	opt *dauth.PermFind) <-chan dlib.Result {
 	ch := make(chan dlib.Result, 256)
 	go func() {
 		defer close(ch)
@@ -43,11 +61,13 @@ func (m *MockPermAccess) DeletePerms(opt *dauth.PermFind) <-chan dlib.Result {
 	return ch
 }
 
-func (m *MockPermAccess) DeletePermByID(id int64) <-chan dlib.Result {
-	return m.DeletePerms(nil)
+func (m *MockPermAccess) DeletePermByID(ctx context.Context,
+	id int64) <-chan dlib.Result {
+	return m.DeletePerms(ctx, nil)
 }
 
-func (m *MockPermAccess) SavePerm(a *dauth.Perm) <-chan dlib.Result {
+func (m *MockPermAccess) SavePerm(ctx context.Context,
+	a *dauth.Perm) <-chan dlib.Result {
 	ch := make(chan dlib.Result, 256)
 	go func() {
 		defer close(ch)
@@ -59,8 +79,9 @@ func (m *MockPermAccess) SavePerm(a *dauth.Perm) <-chan dlib.Result {
 	return ch
 }
 
-func (m *MockPermAccess) SavePerms(a []dauth.Perm) <-chan dlib.Result {
-	return m.SavePerm(nil)
+func (m *MockPermAccess) SavePerms(ctx context.Context,
+	a []dauth.Perm) <-chan dlib.Result {
+	return m.SavePerm(ctx, nil)
 }
 
 type MockRFAuthGetPermsServer struct {
@@ -73,6 +94,10 @@ func (m *MockRFAuthGetPermsServer) Send(msg *ptypes.PermResponse) error {
 	return nil
 }
 
+func (m *MockRFAuthGetPermsServer) Context() context.Context {
+	return context.Background()
+}
+
 type MockRFAuthSavePermsServer struct {
 	grpc.ServerStream
 	Results []ptypes.PermResponse
@@ -84,6 +109,10 @@ func (m *MockRFAuthSavePermsServer) Send(msg *ptypes.PermResponse) error {
 	return nil
 }
 
+func (m *MockRFAuthSavePermsServer) Context() context.Context {
+	return context.Background()
+}
+
 func (m *MockRFAuthSavePermsServer) Recv() (*ptypes.PermRequest, error) {
 	if m.Count < 1 {
 		msg := ptypes.PermRequest{ID: 1, Service: "test", Name: "test"}
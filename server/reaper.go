@@ -0,0 +1,222 @@
+package server
+
+import (
+	"context"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"github.com/dhaifley/dauth/lib"
+	"github.com/dhaifley/dlib"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// Token reaper defaults.
+const (
+	DefaultReapInterval  = time.Hour
+	DefaultReapBatchSize = 1000
+	DefaultReapJitter    = 5 * time.Minute
+)
+
+// SessionReapDelay is how long a session is kept after it was created before
+// it may be pruned, so that a new session is not pruned before the first
+// refresh token of its login is saved.
+const SessionReapDelay = time.Hour
+
+// ReapCounts values count the records deleted by the reaper, by kind.
+type ReapCounts struct {
+	Tokens        int64
+	RefreshTokens int64
+	Sessions      int64
+	Revocations   int64
+}
+
+// Reaper values periodically delete expired tokens and refresh tokens, the
+// sessions of expired refresh tokens, and the revocation records of expired
+// tokens, from the database.
+type Reaper struct {
+	Tokens        lib.TokenAccessor
+	RefreshTokens lib.RefreshTokenAccessor
+	Sessions      lib.SessionAccessor
+	Revocations   lib.RevocationAccessor
+	Interval      time.Duration
+	BatchSize     int
+	Jitter        time.Duration
+	Log           logrus.FieldLogger
+	runs          int64
+	total         ReapCounts
+}
+
+// NewReaper creates a new Reaper value. Zero values are replaced by the
+// defaults.
+func NewReaper(ta lib.TokenAccessor, interval time.Duration, batch int,
+	jitter time.Duration, log logrus.FieldLogger) *Reaper {
+	if interval <= 0 {
+		interval = DefaultReapInterval
+	}
+
+	if batch <= 0 {
+		batch = DefaultReapBatchSize
+	}
+
+	if jitter < 0 {
+		jitter = 0
+	}
+
+	return &Reaper{
+		Tokens:    ta,
+		Interval:  interval,
+		BatchSize: batch,
+		Jitter:    jitter,
+		Log:       log,
+	}
+}
+
+// LoadReaper configures the expired token reaper from the token_reap_*
+// settings.
+func (s *Server) LoadReaper() {
+	s.Reaper = NewReaper(s.Tokens,
+		viper.GetDuration("token_reap_interval"),
+		viper.GetInt("token_reap_batch_size"),
+		viper.GetDuration("token_reap_jitter"),
+		s.Log)
+	s.Reaper.RefreshTokens = s.RefreshTokens
+	s.Reaper.Sessions = s.Sessions
+	s.Reaper.Revocations = s.Revocations
+	if s.Log != nil {
+		s.Log.WithFields(logrus.Fields{
+			"interval":   s.Reaper.Interval,
+			"batch_size": s.Reaper.BatchSize,
+			"jitter":     s.Reaper.Jitter,
+		}).Info("Token reaper configured")
+	}
+}
+
+// Prune deletes all tokens and refresh tokens which expired before old, the
+// sessions with no refresh token left, and the revocation records of expired
+// tokens, in batches of BatchSize, and returns the numbers deleted. Sessions
+// created less than SessionReapDelay before old are kept.
+func (r *Reaper) Prune(ctx context.Context,
+	old time.Time) (ReapCounts, error) {
+	var c ReapCounts
+	var err error
+	c.Tokens, err = r.prune(func() <-chan dlib.Result {
+		return r.Tokens.DeleteOldTokens(ctx, old, r.BatchSize)
+	})
+	if err == nil && r.RefreshTokens != nil {
+		c.RefreshTokens, err = r.prune(func() <-chan dlib.Result {
+			return r.RefreshTokens.DeleteOldRefreshTokens(ctx, old,
+				r.BatchSize)
+		})
+	}
+
+	if err == nil && r.Sessions != nil {
+		c.Sessions, err = r.prune(func() <-chan dlib.Result {
+			return r.Sessions.DeleteOldSessions(ctx,
+				old.Add(-SessionReapDelay), r.BatchSize)
+		})
+	}
+
+	if err == nil && r.Revocations != nil {
+		c.Revocations, err = r.prune(func() <-chan dlib.Result {
+			return r.Revocations.DeleteOldRevokedTokens(ctx, old,
+				r.BatchSize)
+		})
+	}
+
+	if err == nil {
+		atomic.AddInt64(&r.runs, 1)
+	}
+
+	atomic.AddInt64(&r.total.Tokens, c.Tokens)
+	atomic.AddInt64(&r.total.RefreshTokens, c.RefreshTokens)
+	atomic.AddInt64(&r.total.Sessions, c.Sessions)
+	atomic.AddInt64(&r.total.Revocations, c.Revocations)
+	return c, err
+}
+
+// prune calls del until it deletes fewer than BatchSize records, and returns
+// the number deleted.
+func (r *Reaper) prune(del func() <-chan dlib.Result) (int64, error) {
+	count := int64(0)
+	for {
+		n := 0
+		for res := range del() {
+			if res.Err != nil {
+				return count, res.Err
+			}
+
+			n += res.Num
+		}
+
+		count += int64(n)
+		if n < r.BatchSize {
+			return count, nil
+		}
+	}
+}
+
+// Run prunes expired tokens every Interval, plus a random delay of up to
+// Jitter so that several servers do not prune at the same time. It returns
+// when ctx is done.
+func (r *Reaper) Run(ctx context.Context) {
+	for {
+		wait := r.Interval
+		if r.Jitter > 0 {
+			wait += time.Duration(rand.Int63n(int64(r.Jitter)))
+		}
+
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			if r.Log != nil {
+				r.Log.Info("Token reaper stopped")
+			}
+
+			return
+		case <-t.C:
+		}
+
+		c, err := r.Prune(ctx, time.Now())
+		if r.Log == nil {
+			continue
+		}
+
+		if err != nil {
+			r.Log.WithFields(logrus.Fields{
+				"job":            "ReapTokens",
+				"removed":        c.Tokens,
+				"refresh_tokens": c.RefreshTokens,
+				"sessions":       c.Sessions,
+				"revocations":    c.Revocations,
+			}).Error(err)
+			continue
+		}
+
+		_, total := r.Stats()
+		r.Log.WithFields(logrus.Fields{
+			"job":                  "ReapTokens",
+			"removed":              c.Tokens,
+			"refresh_tokens":       c.RefreshTokens,
+			"sessions":             c.Sessions,
+			"revocations":          c.Revocations,
+			"total":                total.Tokens,
+			"total_refresh_tokens": total.RefreshTokens,
+			"total_sessions":       total.Sessions,
+			"total_revocations":    total.Revocations,
+		}).Info("Expired tokens reaped")
+	}
+}
+
+// Stats returns the number of completed prune runs and the total numbers of
+// records removed by the reaper.
+func (r *Reaper) Stats() (int64, ReapCounts) {
+	return atomic.LoadInt64(&r.runs), ReapCounts{
+		Tokens:        atomic.LoadInt64(&r.total.Tokens),
+		RefreshTokens: atomic.LoadInt64(&r.total.RefreshTokens),
+		Sessions:      atomic.LoadInt64(&r.total.Sessions),
+		Revocations:   atomic.LoadInt64(&r.total.Revocations),
+	}
+}
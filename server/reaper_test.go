@@ -0,0 +1,63 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestReaperPrune(t *testing.T) {
+	mta := MockTokenAccess{Old: 25}
+	r := NewReaper(&mta, 0, 10, 0, nil)
+	c, err := r.Prune(context.Background(), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c != (ReapCounts{Tokens: 25}) {
+		t.Errorf("Removed expected: 25 tokens, got: %+v", c)
+	}
+
+	if mta.Old != 0 {
+		t.Errorf("Remaining expected: 0, got: %v", mta.Old)
+	}
+
+	runs, total := r.Stats()
+	if runs != 1 || total != c {
+		t.Errorf("Stats expected: 1, %+v, got: %v, %+v", c, runs, total)
+	}
+}
+
+func TestReaperRun(t *testing.T) {
+	lm, _ := test.NewNullLogger()
+	mta := MockTokenAccess{Old: 3}
+	r := NewReaper(&mta, time.Millisecond, 2, time.Millisecond, lm)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		r.Run(ctx)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, total := r.Stats(); total.Tokens == 3 {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("Expired tokens not reaped")
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("Reaper did not stop")
+	}
+}
@@ -0,0 +1,173 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// RedactedValue replaces the values of secret fields in log entries.
+const RedactedValue = "[REDACTED]"
+
+// DefaultRedactFields are the names of the fields whose values are secrets.
+// Names are matched ignoring case and underscores, so pass matches the Pass
+// field of a ptypes.UserRequest.
+var DefaultRedactFields = []string{
+	"pass",
+	"password",
+	"new_pass",
+	"token",
+	"refresh_token",
+	"access_token",
+	"secret",
+	"recovery_codes",
+	"code",
+	"recovery_code",
+	"authorization",
+}
+
+// Redactor values are logrus hooks which mask secrets in log entries. The
+// values of fields with secret names are replaced, at the top level of an
+// entry and within the requests and responses logged in it.
+type Redactor struct {
+	fields map[string]bool
+}
+
+// NewRedactor creates a new Redactor masking the DefaultRedactFields and
+// the provided fields.
+func NewRedactor(fields ...string) *Redactor {
+	r := Redactor{fields: map[string]bool{}}
+	for _, f := range append(DefaultRedactFields, fields...) {
+		if f = redactKey(f); f != "" {
+			r.fields[f] = true
+		}
+	}
+
+	return &r
+}
+
+// LoadRedaction masks secrets in the entries of the server log, including
+// the fields named in the log_redact_fields setting.
+func (s *Server) LoadRedaction() {
+	var fields []string
+	for _, v := range viper.GetStringSlice("log_redact_fields") {
+		fields = append(fields, strings.Split(v, ",")...)
+	}
+
+	r := NewRedactor(fields...)
+	switch l := s.Log.(type) {
+	case *logrus.Logger:
+		l.AddHook(r)
+	case *logrus.Entry:
+		l.Logger.AddHook(r)
+	default:
+		return
+	}
+
+	s.Log.WithField("fields", len(r.fields)).Info("Log redaction configured")
+}
+
+// Levels returns the levels of the entries redacted, which is all of them.
+func (r *Redactor) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire masks the secrets in a log entry.
+func (r *Redactor) Fire(e *logrus.Entry) error {
+	for k, v := range e.Data {
+		e.Data[k] = r.Redact(k, v)
+	}
+
+	return nil
+}
+
+// Redact returns a log field value with secrets masked. Requests, responses
+// and other composite values are returned as their JSON representation with
+// the values of secret fields replaced.
+func (r *Redactor) Redact(key string, v interface{}) interface{} {
+	if r.fields[redactKey(key)] {
+		return redactValue(v)
+	}
+
+	switch v.(type) {
+	case nil, error, context.Context, time.Time, time.Duration, string,
+		bool, int, int32, int64, uint, uint32, uint64, float32, float64:
+		return v
+	}
+
+	switch reflect.ValueOf(v).Kind() {
+	case reflect.Ptr, reflect.Struct, reflect.Map, reflect.Slice,
+		reflect.Array, reflect.Interface:
+	default:
+		return v
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return RedactedValue
+	}
+
+	var jv interface{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&jv); err != nil {
+		return RedactedValue
+	}
+
+	return r.redactJSON(jv)
+}
+
+// redactJSON masks the values of secret fields in a decoded JSON value.
+func (r *Redactor) redactJSON(v interface{}) interface{} {
+	switch jv := v.(type) {
+	case map[string]interface{}:
+		for k, fv := range jv {
+			if r.fields[redactKey(k)] {
+				if m, ok := fv.(map[string]interface{}); ok {
+					jv[k] = r.redactJSON(m)
+				} else {
+					jv[k] = redactValue(fv)
+				}
+
+				continue
+			}
+
+			jv[k] = r.redactJSON(fv)
+		}
+	case []interface{}:
+		for i := range jv {
+			jv[i] = r.redactJSON(jv[i])
+		}
+	}
+
+	return v
+}
+
+// redactValue returns the mask of a secret value. Empty values are kept, so
+// that the log shows a secret was missing. Numbers and booleans are kept,
+// since secrets are strings, and the code field of a log entry is the status
+// code of the RPC while the code of an MFA request is a TOTP code.
+func redactValue(v interface{}) interface{} {
+	switch sv := v.(type) {
+	case nil, json.Number, bool, int, int32, int64, uint, uint32, uint64,
+		float32, float64:
+		return v
+	case string:
+		if sv == "" {
+			return sv
+		}
+	}
+
+	return RedactedValue
+}
+
+// redactKey normalizes a field name for matching.
+func redactKey(k string) string {
+	return strings.ToLower(strings.Replace(strings.TrimSpace(k), "_", "", -1))
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dhaifley/dauth/lib"
+	"github.com/dhaifley/dlib"
+	"github.com/dhaifley/dlib/ptypes"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc/metadata"
+)
+
+func testRedactLogger(f logrus.Formatter) (*logrus.Logger, *bytes.Buffer) {
+	var buf bytes.Buffer
+	l := logrus.New()
+	l.Out = &buf
+	l.Formatter = f
+	l.Level = logrus.DebugLevel
+	return l, &buf
+}
+
+func TestRedactor(t *testing.T) {
+	r := NewRedactor("email")
+	cases := []struct {
+		key  string
+		val  interface{}
+		want string
+	}{
+		{key: "token", val: "secret-token", want: RedactedValue},
+		{key: "Refresh_Token", val: "secret-refresh", want: RedactedValue},
+		{key: "token", val: "", want: ""},
+		{key: "email", val: "test@example.com", want: RedactedValue},
+		{key: "user_id", val: int64(1), want: "1"},
+		{key: "code", val: 401, want: "401"},
+		{key: "code", val: "123456", want: RedactedValue},
+		{key: "rpc", val: "Login", want: "Login"},
+	}
+
+	for _, c := range cases {
+		if v := r.Redact(c.key, c.val); fmt.Sprint(v) != c.want {
+			t.Errorf("Redact(%q) expected: %q, got: %v", c.key, c.want, v)
+		}
+	}
+
+	v := r.Redact("request", &ptypes.AuthRequest{
+		Token: &ptypes.TokenRequest{Token: "secret-token", UserID: 1},
+		Perm:  &ptypes.PermRequest{Service: "test", Name: "test"},
+	})
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected a map, got: %T", v)
+	}
+
+	tm, ok := m["Token"].(map[string]interface{})
+	if !ok || tm["Token"] != RedactedValue || tm["UserID"] == nil {
+		t.Errorf("Expected the nested token to be masked, got: %v", m)
+	}
+}
+
+func TestServerLogRedaction(t *testing.T) {
+	secrets := []string{
+		"secret-pass",
+		dlib.EncodeBase64String("secret-pass"),
+		"secret-token",
+	}
+
+	for _, f := range []logrus.Formatter{
+		new(logrus.JSONFormatter),
+		&logrus.TextFormatter{DisableColors: true},
+	} {
+		l, buf := testRedactLogger(f)
+		svr := testHTTPServer(t)
+		svr.Log = l
+		viper.Set("log_redact_fields", "")
+		svr.LoadRedaction()
+		ctx := metadata.NewIncomingContext(context.Background(),
+			metadata.Pairs("authorization", "Bearer secret-token"))
+		svr.Login(ctx, &ptypes.UserRequest{
+			User: "test",
+			Pass: dlib.EncodeBase64String("secret-pass"),
+		})
+		svr.Logout(ctx, &ptypes.TokenRequest{})
+		svr.Auth(ctx, &ptypes.AuthRequest{})
+		svr.Log.WithFields(logrus.Fields{
+			"rpc":     "Test",
+			"context": ctx,
+			"request": &ptypes.UserRequest{User: "test", Pass: "secret-pass"},
+			"token":   &ptypes.TokenRequest{Token: "secret-token"},
+			"response": &ChangePasswordRequest{Token: "secret-token",
+				Pass: "secret-pass", NewPass: "secret-pass"},
+		}).Error("test")
+		out := buf.String()
+		if !strings.Contains(out, "test") {
+			t.Fatalf("Expected log output, got: %q", out)
+		}
+
+		for _, s := range secrets {
+			if strings.Contains(out, s) {
+				t.Errorf("Secret %q found in %T log output: %v", s, f, out)
+			}
+		}
+	}
+}
+
+func TestServerMFALogRedaction(t *testing.T) {
+	l, buf := testRedactLogger(new(logrus.JSONFormatter))
+	svr, _ := testMFAServer(t, true)
+	svr.Log = l
+	viper.Set("log_redact_fields", "")
+	svr.LoadRedaction()
+	res, err := svr.login(context.Background(), &ptypes.UserRequest{
+		User: "test",
+		Pass: dlib.EncodeBase64String("test"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := svr.EnrollMFA(context.Background(),
+		&MFAEnrollRequest{Token: res.Token.Token}); err != nil {
+		t.Fatal(err)
+	}
+
+	svr.Throttle = lib.NewLoginThrottle(lib.NewMemLoginFailureAccessor(), 1,
+		time.Minute, time.Hour)
+	for i := 0; i < 2; i++ {
+		if _, err := svr.VerifyMFA(context.Background(), &MFAVerifyRequest{
+			Token: res.Token.Token,
+			Code:  "918273",
+		}); err == nil {
+			t.Fatal("Expected VerifyMFA to fail")
+		}
+	}
+
+	out := buf.String()
+	if !strings.Contains(out, `"rpc":"VerifyMFA"`) {
+		t.Fatalf("Expected VerifyMFA log output, got: %q", out)
+	}
+
+	if strings.Contains(out, "918273") {
+		t.Errorf("MFA code found in log output: %v", out)
+	}
+
+	if !strings.Contains(out, `"code":401`) {
+		t.Errorf("Expected status codes to be kept, got: %v", out)
+	}
+}
@@ -0,0 +1,302 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/dhaifley/dauth/lib"
+	"github.com/dhaifley/dlib"
+	"github.com/dhaifley/dlib/dauth"
+	"github.com/dhaifley/dlib/ptypes"
+	"github.com/sirupsen/logrus"
+)
+
+// RefreshTokenHeader is the response header used by Login to return the
+// refresh token issued with the access token.
+const RefreshTokenHeader = "refresh-token"
+
+// DefaultRefreshLifetime is the lifetime of refresh tokens when the server
+// does not specify one.
+const DefaultRefreshLifetime = 30 * 24 * time.Hour
+
+// TokenPair values contain an access token and the refresh token which may
+// be exchanged for a new pair. When MFAPending is set, Token is an MFA
+// pending token, and when PasswordChange is set, Token is a password change
+// token. Neither has a refresh token.
+type TokenPair struct {
+	Token          *ptypes.TokenResponse `json:"token"`
+	RefreshToken   string                `json:"refresh_token,omitempty"`
+	RefreshExpires int64                 `json:"refresh_expires,omitempty"`
+	MFAPending     bool                  `json:"mfa_pending,omitempty"`
+	PasswordChange bool                  `json:"password_change,omitempty"`
+}
+
+// RefreshRequest values are requests to exchange a refresh token.
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// issueTokens creates and saves a new access and refresh token pair for a
+// user. The refresh token joins the provided family, or starts a new family,
+// and records a new session, if none is provided.
+func (s *Server) issueTokens(ctx context.Context, rpc string,
+	req interface{}, u *dauth.User, family string) (*TokenPair, error) {
+	if s.Keys == nil {
+		err := dlib.NewError(http.StatusInternalServerError,
+			"token signing keys not configured")
+		s.Log.WithFields(logrus.Fields{
+			"rpc":     rpc,
+			"code":    http.StatusInternalServerError,
+			"context": ctx,
+			"request": req,
+		}).Error(err)
+		return nil, err
+	}
+
+	ct := time.Now()
+	et := ct.Add(time.Hour * 24)
+	tc, err := lib.NewTokenClaims(u.User, u.ID, s.Issuer, s.Audience, ct, et)
+	if err != nil {
+		s.Log.WithFields(logrus.Fields{
+			"rpc":     rpc,
+			"code":    http.StatusInternalServerError,
+			"context": ctx,
+			"request": req,
+		}).Error(err)
+		return nil, err
+	}
+
+	ts, err := s.Keys.Sign(tc)
+	if err != nil {
+		s.Log.WithFields(logrus.Fields{
+			"rpc":     rpc,
+			"code":    http.StatusInternalServerError,
+			"context": ctx,
+			"request": req,
+		}).Error(err)
+		return nil, err
+	}
+
+	t := dauth.Token{
+		Token:   ts,
+		UserID:  u.ID,
+		Created: &ct,
+		Expires: &et,
+	}
+
+	for tr := range s.Tokens.SaveToken(ctx, &t) {
+		if tr.Err != nil {
+			s.Log.WithFields(logrus.Fields{
+				"rpc":     rpc,
+				"code":    http.StatusInternalServerError,
+				"context": ctx,
+				"request": req,
+			}).Error(tr.Err)
+			return nil, tr.Err
+		}
+	}
+
+	if family == "" {
+		if family, err = lib.NewTokenID(); err != nil {
+			s.Log.WithFields(logrus.Fields{
+				"rpc":     rpc,
+				"code":    http.StatusInternalServerError,
+				"context": ctx,
+				"request": req,
+			}).Error(err)
+			return nil, err
+		}
+
+		if err := s.saveSession(ctx, u.ID, family, ct); err != nil {
+			s.Log.WithFields(logrus.Fields{
+				"rpc":     rpc,
+				"code":    http.StatusInternalServerError,
+				"context": ctx,
+				"request": req,
+			}).Error(err)
+			return nil, err
+		}
+	}
+
+	rts, err := lib.NewRefreshToken()
+	if err != nil {
+		s.Log.WithFields(logrus.Fields{
+			"rpc":     rpc,
+			"code":    http.StatusInternalServerError,
+			"context": ctx,
+			"request": req,
+		}).Error(err)
+		return nil, err
+	}
+
+	rl := s.RefreshLifetime
+	if rl == 0 {
+		rl = DefaultRefreshLifetime
+	}
+
+	ret := ct.Add(rl)
+	rt := lib.RefreshToken{
+		Token:   lib.HashToken(rts),
+		Family:  family,
+		UserID:  u.ID,
+		TokenID: t.ID,
+		Created: &ct,
+		Expires: &ret,
+	}
+
+	for rr := range s.RefreshTokens.SaveRefreshToken(ctx, &rt) {
+		if rr.Err != nil {
+			s.Log.WithFields(logrus.Fields{
+				"rpc":     rpc,
+				"code":    http.StatusInternalServerError,
+				"context": ctx,
+				"request": req,
+			}).Error(rr.Err)
+			return nil, rr.Err
+		}
+	}
+
+	tres := t.ToResponse()
+	res := TokenPair{
+		Token:          &tres,
+		RefreshToken:   rts,
+		RefreshExpires: ret.Unix(),
+	}
+
+	return &res, nil
+}
+
+// Refresh exchanges a refresh token for a new access and refresh token
+// pair. Each refresh token may only be used once. If a used refresh token
+// is presented again, every token in its family is revoked.
+func (s *Server) Refresh(ctx context.Context,
+	req *RefreshRequest) (*TokenPair, error) {
+	if req.RefreshToken == "" {
+		err := dlib.NewError(http.StatusBadRequest, "invalid refresh token")
+		s.Log.WithFields(logrus.Fields{
+			"rpc":     "Refresh",
+			"code":    http.StatusBadRequest,
+			"context": ctx,
+		}).Error(err)
+		return nil, err
+	}
+
+	var rt *lib.RefreshToken
+	for rr := range s.RefreshTokens.UseRefreshToken(ctx,
+		lib.HashToken(req.RefreshToken)) {
+		if rr.Err != nil {
+			if err, ok := rr.Err.(*dlib.Error); ok &&
+				err.Code == http.StatusNotFound {
+				continue
+			}
+
+			s.Log.WithFields(logrus.Fields{
+				"rpc":     "Refresh",
+				"code":    http.StatusInternalServerError,
+				"context": ctx,
+			}).Error(rr.Err)
+			return nil, rr.Err
+		}
+
+		switch v := rr.Val.(type) {
+		case lib.RefreshToken:
+			rt = &v
+		case *lib.RefreshToken:
+			rt = v
+		}
+	}
+
+	if rt == nil {
+		err := dlib.NewError(http.StatusUnauthorized, "unauthorized token")
+		s.Log.WithFields(logrus.Fields{
+			"rpc":     "Refresh",
+			"code":    http.StatusUnauthorized,
+			"context": ctx,
+		}).Warning("unknown refresh token")
+		return nil, err
+	}
+
+	if rt.Used != nil {
+		q := lib.RefreshTokenFind{Family: &rt.Family}
+		if _, err := s.revokeRefreshTokens(ctx, &q); err != nil {
+			s.Log.WithFields(logrus.Fields{
+				"rpc":     "Refresh",
+				"code":    http.StatusInternalServerError,
+				"context": ctx,
+				"user_id": rt.UserID,
+			}).Error(err)
+			return nil, err
+		}
+
+		err := dlib.NewError(http.StatusUnauthorized, "unauthorized token")
+		s.Log.WithFields(logrus.Fields{
+			"rpc":     "Refresh",
+			"code":    http.StatusUnauthorized,
+			"context": ctx,
+			"user_id": rt.UserID,
+			"used":    rt.Used,
+		}).Warning("refresh token reused, token family revoked")
+		return nil, err
+	}
+
+	if rt.Expires == nil || rt.Expires.Before(time.Now()) {
+		err := dlib.NewError(http.StatusUnauthorized, "unauthorized token")
+		s.Log.WithFields(logrus.Fields{
+			"rpc":     "Refresh",
+			"code":    http.StatusUnauthorized,
+			"context": ctx,
+			"user_id": rt.UserID,
+		}).Warning("expired refresh token")
+		return nil, err
+	}
+
+	var u *dauth.User
+	for ur := range s.Users.GetUserByID(ctx, rt.UserID) {
+		if ur.Err != nil {
+			if err, ok := ur.Err.(*dlib.Error); ok &&
+				err.Code == http.StatusNotFound {
+				continue
+			}
+
+			s.Log.WithFields(logrus.Fields{
+				"rpc":     "Refresh",
+				"code":    http.StatusInternalServerError,
+				"context": ctx,
+				"user_id": rt.UserID,
+			}).Error(ur.Err)
+			return nil, ur.Err
+		}
+
+		switch v := ur.Val.(type) {
+		case *dauth.User:
+			u = v
+		case dauth.User:
+			u = &v
+		}
+	}
+
+	if u == nil {
+		err := dlib.NewError(http.StatusUnauthorized, "unauthorized user")
+		s.Log.WithFields(logrus.Fields{
+			"rpc":     "Refresh",
+			"code":    http.StatusUnauthorized,
+			"context": ctx,
+			"user_id": rt.UserID,
+		}).Warning("unknown user id")
+		return nil, err
+	}
+
+	res, err := s.issueTokens(ctx, "Refresh", nil, u, rt.Family)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Log.WithFields(logrus.Fields{
+		"rpc":     "Refresh",
+		"code":    http.StatusOK,
+		"context": ctx,
+		"user_id": u.ID,
+	}).Info("Refresh request processed")
+	return res, nil
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dhaifley/dauth/lib"
+	"github.com/dhaifley/dlib"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+type MockRefreshTokenAccess struct {
+	Used    *time.Time
+	Deleted []string
+}
+
+func (m *MockRefreshTokenAccess) GetRefreshTokens(ctx context.Context,
+	opt *lib.RefreshTokenFind) <-chan dlib.Result {
+	return m.UseRefreshToken(ctx, "")
+}
+
+func (m *MockRefreshTokenAccess) UseRefreshToken(ctx context.Context,
+	token string) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 256)
+	go func() {
+		defer close(ch)
+		ct := time.Date(1983, 2, 2, 0, 0, 0, 0, time.Local)
+		et := time.Date(2083, 2, 2, 0, 0, 0, 0, time.Local)
+		rt := lib.RefreshToken{
+			ID:      1,
+			Token:   token,
+			Family:  "test",
+			UserID:  1,
+			TokenID: 1,
+			Created: &ct,
+			Expires: &et,
+			Used:    m.Used,
+		}
+
+		ch <- dlib.Result{Val: rt, Num: 1}
+	}()
+
+	return ch
+}
+
+func (m *MockRefreshTokenAccess) DeleteRefreshTokens(ctx context.Context,
+	opt *lib.RefreshTokenFind) <-chan dlib.Result {
+	if opt.Family != nil {
+		m.Deleted = append(m.Deleted, *opt.Family)
+	}
+
+	ch := make(chan dlib.Result, 256)
+	go func() {
+		defer close(ch)
+		ch <- dlib.Result{Num: 1}
+	}()
+
+	return ch
+}
+
+func (m *MockRefreshTokenAccess) DeleteOldRefreshTokens(ctx context.Context,
+	old time.Time, limit int) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 1)
+	ch <- dlib.Result{Num: 0}
+	close(ch)
+	return ch
+}
+
+func (m *MockRefreshTokenAccess) SaveRefreshToken(ctx context.Context,
+	a *lib.RefreshToken) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 256)
+	go func() {
+		defer close(ch)
+		a.ID = 1
+		ch <- dlib.Result{Val: *a}
+	}()
+
+	return ch
+}
+
+func TestServerRefresh(t *testing.T) {
+	mua := MockUserAccess{}
+	mta := MockTokenAccess{}
+	mrta := MockRefreshTokenAccess{}
+	lm, _ := test.NewNullLogger()
+	svr := Server{Users: &mua, Tokens: &mta, RefreshTokens: &mrta,
+		Keys: testKeyRing(t), Log: lm}
+	res, err := svr.Refresh(context.Background(),
+		&RefreshRequest{RefreshToken: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.RefreshToken == "" || res.RefreshToken == "test" {
+		t.Errorf("Expected new refresh token, got: %v", res.RefreshToken)
+	}
+
+	if res.Token == nil || res.Token.UserID != 1 {
+		t.Errorf("Expected access token for user 1, got: %v", res.Token)
+	}
+
+	if len(mrta.Deleted) != 0 {
+		t.Errorf("Expected no revoked families, got: %v", mrta.Deleted)
+	}
+}
+
+func TestServerRefreshReuse(t *testing.T) {
+	mua := MockUserAccess{}
+	mta := MockTokenAccess{}
+	ut := time.Now().Add(-time.Minute)
+	mrta := MockRefreshTokenAccess{Used: &ut}
+	lm, hook := test.NewNullLogger()
+	svr := Server{Users: &mua, Tokens: &mta, RefreshTokens: &mrta,
+		Keys: testKeyRing(t), Log: lm}
+	if _, err := svr.Refresh(context.Background(),
+		&RefreshRequest{RefreshToken: "test"}); err == nil {
+		t.Fatal("Expected error for reused refresh token")
+	}
+
+	if len(mrta.Deleted) != 1 || mrta.Deleted[0] != "test" {
+		t.Errorf("Revoked families expected: [test], got: %v", mrta.Deleted)
+	}
+
+	if hook.LastEntry() == nil ||
+		hook.LastEntry().Message != "refresh token reused, token family revoked" {
+		t.Errorf("Expected reuse warning, got: %v", hook.LastEntry())
+	}
+
+	if _, err := svr.Refresh(context.Background(),
+		&RefreshRequest{}); err == nil {
+		t.Error("Expected error for empty refresh token")
+	}
+}
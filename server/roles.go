@@ -0,0 +1,220 @@
+package server
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/dhaifley/dauth/lib"
+	"github.com/dhaifley/dlib"
+	"github.com/dhaifley/dlib/ptypes"
+)
+
+// RoleList values carry roles in AuthExt requests and responses.
+type RoleList struct {
+	Roles []lib.Role `json:"roles"`
+}
+
+// RolePermList values carry role_perm assignments in AuthExt requests and
+// responses.
+type RolePermList struct {
+	RolePerms []lib.RolePerm `json:"role_perms"`
+}
+
+// UserRoleList values carry user_role assignments in AuthExt requests and
+// responses.
+type UserRoleList struct {
+	UserRoles []lib.UserRole `json:"user_roles"`
+}
+
+// GetRoles returns the roles matching a request.
+func (s *Server) GetRoles(ctx context.Context,
+	req *lib.RoleFind) (*RoleList, error) {
+	res := RoleList{Roles: []lib.Role{}}
+	for r := range s.Roles.GetRoles(ctx, req) {
+		if r.Err != nil {
+			return nil, s.extError(ctx, "GetRoles", req, r.Err)
+		}
+
+		if v, ok := r.Val.(lib.Role); ok {
+			res.Roles = append(res.Roles, v)
+		}
+	}
+
+	s.extDone(ctx, "GetRoles", req, len(res.Roles))
+	return &res, nil
+}
+
+// SaveRoles saves roles and returns them with their assigned ids.
+func (s *Server) SaveRoles(ctx context.Context,
+	req *RoleList) (*RoleList, error) {
+	res := RoleList{Roles: []lib.Role{}}
+	for i := range req.Roles {
+		if req.Roles[i].Name == "" {
+			err := dlib.NewError(http.StatusBadRequest, "invalid role name")
+			return nil, s.extError(ctx, "SaveRoles", req, err)
+		}
+	}
+
+	for r := range s.Roles.SaveRoles(ctx, req.Roles) {
+		if r.Err != nil {
+			s.audit(ctx, "SaveRoles", req, r.Err)
+			return nil, s.extError(ctx, "SaveRoles", req, r.Err)
+		}
+
+		if v, ok := r.Val.(lib.Role); ok {
+			s.audit(ctx, "SaveRoles", &v, nil)
+			res.Roles = append(res.Roles, v)
+		}
+	}
+
+	s.extDone(ctx, "SaveRoles", req, len(res.Roles))
+	return &res, nil
+}
+
+// DeleteRoles deletes the roles matching a request. Users holding a deleted
+// role lose its perms.
+func (s *Server) DeleteRoles(ctx context.Context,
+	req *lib.RoleFind) (res *ptypes.DeleteResponse, err error) {
+	defer func() { s.audit(ctx, "DeleteRoles", req, err) }()
+	count := int64(0)
+	for r := range s.Roles.DeleteRoles(ctx, req) {
+		if r.Err != nil {
+			return nil, s.extError(ctx, "DeleteRoles", req, r.Err)
+		}
+
+		count += int64(r.Num)
+	}
+
+	s.Cache.InvalidatePerms()
+	s.extDone(ctx, "DeleteRoles", req, int(count))
+	return &ptypes.DeleteResponse{Num: count}, nil
+}
+
+// GetRolePerms returns the role_perm assignments matching a request.
+func (s *Server) GetRolePerms(ctx context.Context,
+	req *lib.RolePermFind) (*RolePermList, error) {
+	res := RolePermList{RolePerms: []lib.RolePerm{}}
+	for r := range s.Roles.GetRolePerms(ctx, req) {
+		if r.Err != nil {
+			return nil, s.extError(ctx, "GetRolePerms", req, r.Err)
+		}
+
+		if v, ok := r.Val.(lib.RolePerm); ok {
+			res.RolePerms = append(res.RolePerms, v)
+		}
+	}
+
+	s.extDone(ctx, "GetRolePerms", req, len(res.RolePerms))
+	return &res, nil
+}
+
+// SaveRolePerms assigns perms to roles.
+func (s *Server) SaveRolePerms(ctx context.Context,
+	req *RolePermList) (*RolePermList, error) {
+	res := RolePermList{RolePerms: []lib.RolePerm{}}
+	for i := range req.RolePerms {
+		rp := &req.RolePerms[i]
+		if rp.RoleID == 0 || rp.PermID == 0 {
+			err := dlib.NewError(http.StatusBadRequest,
+				"invalid role or perm id")
+			return nil, s.extError(ctx, "SaveRolePerms", req, err)
+		}
+
+		for r := range s.Roles.SaveRolePerm(ctx, rp) {
+			if r.Err != nil {
+				s.audit(ctx, "SaveRolePerms", rp, r.Err)
+				return nil, s.extError(ctx, "SaveRolePerms", req, r.Err)
+			}
+		}
+
+		s.audit(ctx, "SaveRolePerms", rp, nil)
+		res.RolePerms = append(res.RolePerms, *rp)
+	}
+
+	s.Cache.InvalidatePerms()
+	s.extDone(ctx, "SaveRolePerms", req, len(res.RolePerms))
+	return &res, nil
+}
+
+// DeleteRolePerms removes perms from roles. The change applies to all users
+// holding the roles on their next Auth request.
+func (s *Server) DeleteRolePerms(ctx context.Context,
+	req *lib.RolePermFind) (res *ptypes.DeleteResponse, err error) {
+	defer func() { s.audit(ctx, "DeleteRolePerms", req, err) }()
+	count := int64(0)
+	for r := range s.Roles.DeleteRolePerms(ctx, req) {
+		if r.Err != nil {
+			return nil, s.extError(ctx, "DeleteRolePerms", req, r.Err)
+		}
+
+		count += int64(r.Num)
+	}
+
+	s.Cache.InvalidatePerms()
+	s.extDone(ctx, "DeleteRolePerms", req, int(count))
+	return &ptypes.DeleteResponse{Num: count}, nil
+}
+
+// GetUserRoles returns the user_role assignments matching a request.
+func (s *Server) GetUserRoles(ctx context.Context,
+	req *lib.UserRoleFind) (*UserRoleList, error) {
+	res := UserRoleList{UserRoles: []lib.UserRole{}}
+	for r := range s.Roles.GetUserRoles(ctx, req) {
+		if r.Err != nil {
+			return nil, s.extError(ctx, "GetUserRoles", req, r.Err)
+		}
+
+		if v, ok := r.Val.(lib.UserRole); ok {
+			res.UserRoles = append(res.UserRoles, v)
+		}
+	}
+
+	s.extDone(ctx, "GetUserRoles", req, len(res.UserRoles))
+	return &res, nil
+}
+
+// SaveUserRoles assigns roles to users.
+func (s *Server) SaveUserRoles(ctx context.Context,
+	req *UserRoleList) (*UserRoleList, error) {
+	res := UserRoleList{UserRoles: []lib.UserRole{}}
+	for i := range req.UserRoles {
+		ur := &req.UserRoles[i]
+		if ur.UserID == 0 || ur.RoleID == 0 {
+			err := dlib.NewError(http.StatusBadRequest,
+				"invalid user or role id")
+			return nil, s.extError(ctx, "SaveUserRoles", req, err)
+		}
+
+		for r := range s.Roles.SaveUserRole(ctx, ur) {
+			if r.Err != nil {
+				s.audit(ctx, "SaveUserRoles", ur, r.Err)
+				return nil, s.extError(ctx, "SaveUserRoles", req, r.Err)
+			}
+		}
+
+		s.audit(ctx, "SaveUserRoles", ur, nil)
+		res.UserRoles = append(res.UserRoles, *ur)
+	}
+
+	s.Cache.InvalidatePerms()
+	s.extDone(ctx, "SaveUserRoles", req, len(res.UserRoles))
+	return &res, nil
+}
+
+// DeleteUserRoles removes roles from users.
+func (s *Server) DeleteUserRoles(ctx context.Context,
+	req *lib.UserRoleFind) (res *ptypes.DeleteResponse, err error) {
+	defer func() { s.audit(ctx, "DeleteUserRoles", req, err) }()
+	count := int64(0)
+	for r := range s.Roles.DeleteUserRoles(ctx, req) {
+		if r.Err != nil {
+			return nil, s.extError(ctx, "DeleteUserRoles", req, r.Err)
+		}
+
+		count += int64(r.Num)
+	}
+
+	s.Cache.InvalidatePerms()
+	s.extDone(ctx, "DeleteUserRoles", req, int(count))
+	return &ptypes.DeleteResponse{Num: count}, nil
+}
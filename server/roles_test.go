@@ -0,0 +1,324 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/dhaifley/dauth/lib"
+	"github.com/dhaifley/dlib"
+	"github.com/dhaifley/dlib/dauth"
+	"github.com/dhaifley/dlib/ptypes"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+type MockRoleAccess struct {
+	sync.Mutex
+	Roles     []lib.Role
+	RolePerms []lib.RolePerm
+	UserRoles []lib.UserRole
+}
+
+func matchID(f *int64, v int64) bool {
+	return f == nil || *f == v
+}
+
+func mockResults(vals ...interface{}) <-chan dlib.Result {
+	ch := make(chan dlib.Result, len(vals)+1)
+	for _, v := range vals {
+		ch <- dlib.Result{Val: v, Num: 1}
+	}
+
+	close(ch)
+	return ch
+}
+
+func mockCount(n int) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 1)
+	ch <- dlib.Result{Num: n}
+	close(ch)
+	return ch
+}
+
+func mockError(err error) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 1)
+	ch <- dlib.Result{Err: err}
+	close(ch)
+	return ch
+}
+
+func (m *MockRoleAccess) GetRoles(ctx context.Context,
+	opt *lib.RoleFind) <-chan dlib.Result {
+	m.Lock()
+	defer m.Unlock()
+	var vals []interface{}
+	for _, r := range m.Roles {
+		if matchID(opt.ID, r.ID) && (opt.Name == nil || *opt.Name == r.Name) {
+			vals = append(vals, r)
+		}
+	}
+
+	return mockResults(vals...)
+}
+
+func (m *MockRoleAccess) GetRoleByID(ctx context.Context,
+	id int64) <-chan dlib.Result {
+	return m.GetRoles(ctx, &lib.RoleFind{ID: &id})
+}
+
+func (m *MockRoleAccess) DeleteRoles(ctx context.Context,
+	opt *lib.RoleFind) <-chan dlib.Result {
+	m.Lock()
+	defer m.Unlock()
+	var keep []lib.Role
+	for _, r := range m.Roles {
+		if !matchID(opt.ID, r.ID) ||
+			(opt.Name != nil && *opt.Name != r.Name) {
+			keep = append(keep, r)
+		}
+	}
+
+	n := len(m.Roles) - len(keep)
+	m.Roles = keep
+	return mockCount(n)
+}
+
+func (m *MockRoleAccess) DeleteRoleByID(ctx context.Context,
+	id int64) <-chan dlib.Result {
+	return m.DeleteRoles(ctx, &lib.RoleFind{ID: &id})
+}
+
+func (m *MockRoleAccess) SaveRole(ctx context.Context,
+	r *lib.Role) <-chan dlib.Result {
+	m.Lock()
+	defer m.Unlock()
+	r.ID = int64(len(m.Roles) + 1)
+	m.Roles = append(m.Roles, *r)
+	return mockResults(*r)
+}
+
+func (m *MockRoleAccess) SaveRoles(ctx context.Context,
+	r []lib.Role) <-chan dlib.Result {
+	var vals []interface{}
+	for i := range r {
+		for res := range m.SaveRole(ctx, &r[i]) {
+			vals = append(vals, res.Val)
+		}
+	}
+
+	return mockResults(vals...)
+}
+
+func (m *MockRoleAccess) GetRolePerms(ctx context.Context,
+	opt *lib.RolePermFind) <-chan dlib.Result {
+	m.Lock()
+	defer m.Unlock()
+	var vals []interface{}
+	for _, rp := range m.RolePerms {
+		if matchID(opt.ID, rp.ID) && matchID(opt.RoleID, rp.RoleID) &&
+			matchID(opt.PermID, rp.PermID) {
+			vals = append(vals, rp)
+		}
+	}
+
+	return mockResults(vals...)
+}
+
+func (m *MockRoleAccess) DeleteRolePerms(ctx context.Context,
+	opt *lib.RolePermFind) <-chan dlib.Result {
+	m.Lock()
+	defer m.Unlock()
+	var keep []lib.RolePerm
+	for _, rp := range m.RolePerms {
+		if !matchID(opt.ID, rp.ID) || !matchID(opt.RoleID, rp.RoleID) ||
+			!matchID(opt.PermID, rp.PermID) {
+			keep = append(keep, rp)
+		}
+	}
+
+	n := len(m.RolePerms) - len(keep)
+	m.RolePerms = keep
+	return mockCount(n)
+}
+
+func (m *MockRoleAccess) SaveRolePerm(ctx context.Context,
+	rp *lib.RolePerm) <-chan dlib.Result {
+	m.Lock()
+	defer m.Unlock()
+	rp.ID = int64(len(m.RolePerms) + 1)
+	m.RolePerms = append(m.RolePerms, *rp)
+	return mockResults(*rp)
+}
+
+func (m *MockRoleAccess) GetUserRoles(ctx context.Context,
+	opt *lib.UserRoleFind) <-chan dlib.Result {
+	m.Lock()
+	defer m.Unlock()
+	var vals []interface{}
+	for _, ur := range m.UserRoles {
+		if matchID(opt.ID, ur.ID) && matchID(opt.UserID, ur.UserID) &&
+			matchID(opt.RoleID, ur.RoleID) {
+			vals = append(vals, ur)
+		}
+	}
+
+	return mockResults(vals...)
+}
+
+func (m *MockRoleAccess) DeleteUserRoles(ctx context.Context,
+	opt *lib.UserRoleFind) <-chan dlib.Result {
+	m.Lock()
+	defer m.Unlock()
+	var keep []lib.UserRole
+	for _, ur := range m.UserRoles {
+		if !matchID(opt.ID, ur.ID) || !matchID(opt.UserID, ur.UserID) ||
+			!matchID(opt.RoleID, ur.RoleID) {
+			keep = append(keep, ur)
+		}
+	}
+
+	n := len(m.UserRoles) - len(keep)
+	m.UserRoles = keep
+	return mockCount(n)
+}
+
+func (m *MockRoleAccess) SaveUserRole(ctx context.Context,
+	ur *lib.UserRole) <-chan dlib.Result {
+	m.Lock()
+	defer m.Unlock()
+	ur.ID = int64(len(m.UserRoles) + 1)
+	m.UserRoles = append(m.UserRoles, *ur)
+	return mockResults(*ur)
+}
+
+func (m *MockRoleAccess) GetUserRolePerms(ctx context.Context,
+	userID int64) <-chan dlib.Result {
+	m.Lock()
+	defer m.Unlock()
+	var vals []interface{}
+	for _, ur := range m.UserRoles {
+		if ur.UserID != userID {
+			continue
+		}
+
+		for _, rp := range m.RolePerms {
+			if rp.RoleID == ur.RoleID {
+				vals = append(vals, rp)
+			}
+		}
+	}
+
+	return mockResults(vals...)
+}
+
+func testRoleServer() (*Server, *MockRoleAccess) {
+	lm, _ := test.NewNullLogger()
+	mra := MockRoleAccess{}
+	mpa := MockPermAccess{Perms: map[int64]dauth.Perm{
+		1: {ID: 1, Service: "test", Name: "test"},
+		2: {ID: 2, Service: "billing", Name: "read"},
+	}}
+
+	svr := Server{Users: &MockUserAccess{}, Tokens: &MockTokenAccess{},
+		Perms: &mpa, Roles: &mra, Log: lm}
+	svr.UserPerms = &MockUserPermAccess{Server: &svr}
+	return &svr, &mra
+}
+
+func TestServerRoles(t *testing.T) {
+	svr, _ := testRoleServer()
+	ctx := context.Background()
+	rl, err := svr.SaveRoles(ctx, &RoleList{Roles: []lib.Role{
+		{Name: "billing"}, {Name: "ops"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rl.Roles) != 2 || rl.Roles[0].ID != 1 || rl.Roles[1].ID != 2 {
+		t.Errorf("Saved roles expected with ids 1 and 2, got: %v", rl.Roles)
+	}
+
+	if _, err := svr.SaveRoles(ctx, &RoleList{Roles: []lib.Role{{}}}); err == nil {
+		t.Error("Expected error saving role without name")
+	}
+
+	name := "ops"
+	rl, err = svr.GetRoles(ctx, &lib.RoleFind{Name: &name})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rl.Roles) != 1 || rl.Roles[0].ID != 2 {
+		t.Errorf("Role expected: ops, got: %v", rl.Roles)
+	}
+
+	dr, err := svr.DeleteRoles(ctx, &lib.RoleFind{Name: &name})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if dr.Num != 1 {
+		t.Errorf("Delete count expected: 1, got: %v", dr.Num)
+	}
+}
+
+func TestServerAuthRoles(t *testing.T) {
+	svr, mra := testRoleServer()
+	ctx := context.Background()
+	if _, err := svr.SaveRolePerms(ctx, &RolePermList{
+		RolePerms: []lib.RolePerm{{RoleID: 1, PermID: 2}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	req := ptypes.AuthRequest{
+		Token: &ptypes.TokenRequest{Token: "test"},
+		Perm:  &ptypes.PermRequest{Service: "billing", Name: "read"},
+	}
+
+	res, err := svr.Auth(ctx, &req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Ok {
+		t.Error("Expected unauthorized before the role is assigned")
+	}
+
+	urs, err := svr.SaveUserRoles(ctx, &UserRoleList{
+		UserRoles: []lib.UserRole{{UserID: 1, RoleID: 1}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(urs.UserRoles) != 1 || urs.UserRoles[0].ID != 1 {
+		t.Errorf("User role expected with id 1, got: %v", urs.UserRoles)
+	}
+
+	res, err = svr.Auth(ctx, &req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !res.Ok || res.Perm.ID != 2 {
+		t.Errorf("Expected authorized through role, got: %v", res)
+	}
+
+	roleID := int64(1)
+	if _, err := svr.DeleteRolePerms(ctx,
+		&lib.RolePermFind{RoleID: &roleID}); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err = svr.Auth(ctx, &req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Ok {
+		t.Error("Expected unauthorized after the perm is removed from the role")
+	}
+
+	if len(mra.UserRoles) != 1 {
+		t.Errorf("User roles expected: 1, got: %v", len(mra.UserRoles))
+	}
+}
@@ -2,24 +2,53 @@
 package server
 
 import (
+	"context"
 	"database/sql"
+	"sync"
+	"time"
 
 	"github.com/dhaifley/dauth/lib"
 	"github.com/dhaifley/dlib"
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 )
 
 // Server values implement API server functionality.
 type Server struct {
-	SQL       dlib.SQLExecutor
-	Tokens    lib.TokenAccessor
-	Users     lib.UserAccessor
-	Perms     lib.PermAccessor
-	UserPerms lib.UserPermAccessor
-	Log       logrus.FieldLogger
-	Router    *mux.Router
+	SQL             dlib.SQLExecutor
+	Tokens          lib.TokenAccessor
+	Revocations     lib.RevocationAccessor
+	RefreshTokens   lib.RefreshTokenAccessor
+	Sessions        lib.SessionAccessor
+	Touches         *lib.Cache
+	Users           lib.UserAccessor
+	Perms           lib.PermAccessor
+	UserPerms       lib.UserPermAccessor
+	Roles           lib.RoleAccessor
+	Groups          lib.GroupAccessor
+	Grants          lib.GrantAccessor
+	Keys            *lib.KeyRing
+	Stateless       bool
+	Issuer          string
+	Audience        string
+	RefreshLifetime time.Duration
+	PasswordCost    int
+	Passwords       lib.PasswordAccessor
+	Policy          *lib.PasswordPolicy
+	Throttle        *lib.LoginThrottle
+	Cache           *AuthCache
+	Notifier        lib.Notifier
+	MFA             lib.MFAAccessor
+	Audit           lib.AuditAccessor
+	Reaper          *Reaper
+	TokenStats      lib.TokenStatsAccessor
+	Metrics         *Metrics
+	Tracing         *sdktrace.TracerProvider
+	Log             logrus.FieldLogger
+	Router          *mux.Router
+	auditMu         sync.Mutex
 }
 
 // ConnectSQL connects to the cloud SQL database.
@@ -40,7 +69,19 @@ func (s *Server) ConnectSQL(dbs dlib.SQLExecutor) error {
 	}
 
 	s.Tokens = lib.NewTokenAccessor(s.SQL)
+	s.Revocations = lib.NewRevocationAccessor(s.SQL)
+	s.RefreshTokens = lib.NewRefreshTokenAccessor(s.SQL)
+	s.Sessions = lib.NewSessionAccessor(s.SQL)
 	s.Users = lib.NewUserAccessor(s.SQL)
+	s.Perms = lib.NewPermAccessor(s.SQL)
+	s.UserPerms = lib.NewUserPermAccessor(s.SQL)
+	s.Roles = lib.NewRoleAccessor(s.SQL)
+	s.Groups = lib.NewGroupAccessor(s.SQL)
+	s.Grants = lib.NewGrantAccessor(s.SQL)
+	s.MFA = lib.NewMFAAccessor(s.SQL)
+	s.Passwords = lib.NewPasswordAccessor(s.SQL)
+	s.Audit = lib.NewAuditAccessor(s.SQL)
+	s.TokenStats = lib.NewTokenStatsAccessor(s.SQL)
 	err := s.SQL.Ping()
 	if err != nil {
 		return err
@@ -55,7 +96,15 @@ func (s *Server) ConnectSQL(dbs dlib.SQLExecutor) error {
 
 // Close releases all server resources for shutdown.
 func (s *Server) Close() {
+	if s.Notifier != nil {
+		s.Notifier.Close()
+	}
+
 	if s.SQL != nil {
 		s.SQL.Close()
 	}
+
+	if s.Tracing != nil {
+		s.Tracing.Shutdown(context.Background())
+	}
 }
@@ -0,0 +1,533 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dhaifley/dauth/lib"
+	"github.com/dhaifley/dlib"
+	"github.com/dhaifley/dlib/dauth"
+	"github.com/dhaifley/dlib/ptypes"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc/metadata"
+)
+
+// DeviceHeader is the request header which labels the device a client logs
+// in from, such as "work laptop".
+const DeviceHeader = "device-label"
+
+// DefaultSessionTouchInterval is how often Auth records that a session was
+// used.
+const DefaultSessionTouchInterval = time.Minute
+
+// Maximum lengths of the client details recorded for a session.
+const (
+	maxSessionUserAgent = 256
+	maxSessionDevice    = 128
+)
+
+// LogoutAllRequest values request that every session of the holder of a
+// token is ended.
+type LogoutAllRequest struct {
+	Token string `json:"token"`
+}
+
+// RevokeSessionsRequest values request that every session of a user is
+// ended.
+type RevokeSessionsRequest struct {
+	UserID int64 `json:"user_id"`
+}
+
+// RevokeSessionsResponse values count the sessions, tokens and refresh
+// tokens of a user which were revoked.
+type RevokeSessionsResponse struct {
+	UserID        int64 `json:"user_id"`
+	Sessions      int64 `json:"sessions,omitempty"`
+	Tokens        int64 `json:"tokens"`
+	RefreshTokens int64 `json:"refresh_tokens"`
+}
+
+// SessionsRequest values request the sessions of the holder of a token.
+type SessionsRequest struct {
+	Token string `json:"token"`
+}
+
+// SessionInfo values describe a session of a user. Current is set for the
+// session of the token which requested it.
+type SessionInfo struct {
+	lib.Session
+	Current bool `json:"current,omitempty"`
+}
+
+// SessionList values contain lists of sessions.
+type SessionList struct {
+	Sessions []SessionInfo `json:"sessions"`
+}
+
+// RevokeSessionRequest values request that sessions of the holder of a
+// token are ended.
+type RevokeSessionRequest struct {
+	Token string   `json:"token"`
+	IDs   []string `json:"ids"`
+}
+
+// LoadSessions configures how often Auth records that a session was used
+// from the session_touch_interval setting. An interval of zero records
+// every use.
+func (s *Server) LoadSessions() {
+	s.Touches = nil
+	interval := viper.GetDuration("session_touch_interval")
+	if interval > 0 {
+		s.Touches = lib.NewCache(lib.DefaultCacheSize, interval)
+	}
+
+	if s.Log != nil {
+		s.Log.WithField("touch_interval", interval).
+			Info("Session tracking configured")
+	}
+}
+
+// LogoutAll ends every session of the holder of the provided token,
+// including the session of the token itself.
+func (s *Server) LogoutAll(ctx context.Context,
+	req *LogoutAllRequest) (*RevokeSessionsResponse, error) {
+	u, err := s.sessionUser(ctx, "LogoutAll", req, req.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s.revokeSessions(ctx, "LogoutAll", req, u.ID)
+	s.auditUser(ctx, u, "LogoutAll", userTarget(u.ID), err)
+	return res, err
+}
+
+// ListSessions returns the sessions of the holder of the provided token,
+// with where and when they logged in and when each session was last used.
+func (s *Server) ListSessions(ctx context.Context,
+	req *SessionsRequest) (*SessionList, error) {
+	u, err := s.sessionUser(ctx, "ListSessions", req, req.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	current := ""
+	rts, err := s.refreshTokens(ctx,
+		&lib.RefreshTokenFind{AccessToken: &req.Token})
+	if err != nil {
+		return nil, s.extError(ctx, "ListSessions", req, err)
+	}
+
+	if len(rts) > 0 {
+		current = rts[0].Family
+	}
+
+	ss, err := s.userSessions(ctx, u.ID, nil)
+	if err != nil {
+		return nil, s.extError(ctx, "ListSessions", req, err)
+	}
+
+	res := SessionList{Sessions: []SessionInfo{}}
+	for _, v := range ss {
+		res.Sessions = append(res.Sessions,
+			SessionInfo{Session: v, Current: v.ID == current})
+	}
+
+	s.extDone(ctx, "ListSessions", req, len(res.Sessions))
+	return &res, nil
+}
+
+// RevokeSessions ends sessions of the holder of the provided token. No
+// session is ended unless all of them belong to the holder.
+func (s *Server) RevokeSessions(ctx context.Context,
+	req *RevokeSessionRequest) (res *RevokeSessionsResponse, err error) {
+	u, err := s.sessionUser(ctx, "RevokeSessions", req, req.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		s.auditUser(ctx, u, "RevokeSessions",
+			"session:"+strings.Join(req.IDs, ","), err)
+	}()
+
+	if len(req.IDs) == 0 {
+		err := dlib.NewError(http.StatusBadRequest, "invalid session id")
+		return nil, s.extError(ctx, "RevokeSessions", req, err)
+	}
+
+	for i := range req.IDs {
+		ss, err := s.userSessions(ctx, u.ID, &req.IDs[i])
+		if err != nil {
+			return nil, s.extError(ctx, "RevokeSessions", req, err)
+		}
+
+		if len(ss) == 0 {
+			err := dlib.NewError(http.StatusNotFound, "session not found")
+			return nil, s.extError(ctx, "RevokeSessions", req, err)
+		}
+	}
+
+	defer s.Cache.InvalidateUser(u.ID)
+	res = &RevokeSessionsResponse{UserID: u.ID}
+	for i := range req.IDs {
+		n, err := s.revokeRefreshTokens(ctx,
+			&lib.RefreshTokenFind{Family: &req.IDs[i]})
+		if err != nil {
+			return nil, s.extError(ctx, "RevokeSessions", req, err)
+		}
+
+		res.Sessions++
+		res.RefreshTokens += n
+	}
+
+	s.extDone(ctx, "RevokeSessions", req, int(res.Sessions))
+	return res, nil
+}
+
+// sessionUser authenticates the token of a session request and returns its
+// user.
+func (s *Server) sessionUser(ctx context.Context, rpc string,
+	req interface{}, token string) (*dauth.User, error) {
+	if token == "" {
+		err := dlib.NewError(http.StatusBadRequest, "invalid token value")
+		return nil, s.extError(ctx, rpc, req, err)
+	}
+
+	return s.tokenUser(ctx, &ptypes.AuthRequest{
+		Token: &ptypes.TokenRequest{Token: token},
+	})
+}
+
+// userSessions returns the sessions of a user, or only the session with the
+// provided id.
+func (s *Server) userSessions(ctx context.Context, userID int64,
+	id *string) ([]lib.Session, error) {
+	if s.Sessions == nil {
+		return nil, dlib.NewError(http.StatusInternalServerError,
+			"sessions not configured")
+	}
+
+	var ss []lib.Session
+	var err error
+	for r := range s.Sessions.GetSessions(ctx, userID, id) {
+		if r.Err != nil {
+			if e, ok := r.Err.(*dlib.Error); !ok ||
+				e.Code != http.StatusNotFound {
+				err = r.Err
+			}
+
+			continue
+		}
+
+		switch v := r.Val.(type) {
+		case lib.Session:
+			ss = append(ss, v)
+		case *lib.Session:
+			ss = append(ss, *v)
+		}
+	}
+
+	return ss, err
+}
+
+// saveSession records the client details of a new login session.
+func (s *Server) saveSession(ctx context.Context, userID int64,
+	family string, created time.Time) error {
+	if s.Sessions == nil {
+		return nil
+	}
+
+	ses := lib.Session{
+		ID:      family,
+		UserID:  userID,
+		Address: peerAddr(ctx),
+		Created: &created,
+	}
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		ses.UserAgent = truncate(firstValue(md, "user-agent"),
+			maxSessionUserAgent)
+		ses.Device = truncate(firstValue(md, DeviceHeader), maxSessionDevice)
+	}
+
+	for r := range s.Sessions.SaveSession(ctx, &ses) {
+		if r.Err != nil {
+			return r.Err
+		}
+	}
+
+	return nil
+}
+
+// touchSession records that the session of a token was used, at most once
+// per touch interval for each token. Failures are logged, but do not fail
+// the request.
+func (s *Server) touchSession(ctx context.Context, token string) {
+	if s.Sessions == nil {
+		return
+	}
+
+	if s.Touches != nil {
+		if _, ok := s.Touches.Get(token); ok {
+			return
+		}
+
+		s.Touches.Set(token, true)
+	}
+
+	for r := range s.Sessions.TouchSession(ctx, token, time.Now()) {
+		if r.Err != nil {
+			s.Log.WithFields(logrus.Fields{
+				"rpc":     "Auth",
+				"context": ctx,
+			}).Warning(r.Err)
+		}
+	}
+}
+
+// firstValue returns the first value of a metadata key, if present.
+func firstValue(md metadata.MD, key string) string {
+	if v := md.Get(key); len(v) > 0 {
+		return v[0]
+	}
+
+	return ""
+}
+
+// truncate shortens a string to at most n bytes, without splitting a
+// character.
+func truncate(v string, n int) string {
+	if len(v) <= n {
+		return v
+	}
+
+	for n > 0 && !utf8.RuneStart(v[n]) {
+		n--
+	}
+
+	return v[:n]
+}
+
+// RevokeUserSessions ends every session of a user, for example after their
+// password has leaked.
+func (s *Server) RevokeUserSessions(ctx context.Context,
+	req *RevokeSessionsRequest) (res *RevokeSessionsResponse, err error) {
+	defer func() {
+		s.audit(ctx, "RevokeUserSessions", userTarget(req.UserID), err)
+	}()
+	if req.UserID == 0 {
+		err := dlib.NewError(http.StatusBadRequest, "invalid user id")
+		return nil, s.extError(ctx, "RevokeUserSessions", req, err)
+	}
+
+	return s.revokeSessions(ctx, "RevokeUserSessions", req, req.UserID)
+}
+
+// revokeSessions revokes every token and refresh token of a user.
+func (s *Server) revokeSessions(ctx context.Context, rpc string,
+	req interface{}, userID int64) (*RevokeSessionsResponse, error) {
+	defer s.Cache.InvalidateUser(userID)
+	res := RevokeSessionsResponse{UserID: userID}
+	n, err := s.revokeRefreshTokens(ctx,
+		&lib.RefreshTokenFind{UserID: &userID})
+	if err != nil {
+		return nil, s.extError(ctx, rpc, req, err)
+	}
+
+	res.RefreshTokens = n
+	if n, err = s.revokeTokens(ctx,
+		&dauth.TokenFind{UserID: &userID}); err != nil {
+		return nil, s.extError(ctx, rpc, req, err)
+	}
+
+	res.Tokens = n
+	s.extDone(ctx, rpc, req, int(res.Tokens+res.RefreshTokens))
+	return &res, nil
+}
+
+// revokeTokens adds the tokens found by a query to the revocation list, so
+// that they are refused by stateless verification, and deletes them. It
+// returns the number of tokens deleted.
+func (s *Server) revokeTokens(ctx context.Context,
+	q *dauth.TokenFind) (int64, error) {
+	if err := s.addRevocations(ctx, q); err != nil {
+		return 0, err
+	}
+
+	count := int64(0)
+	for tr := range s.Tokens.DeleteTokens(ctx, q) {
+		if tr.Err != nil {
+			return count, tr.Err
+		}
+
+		count += int64(tr.Num)
+	}
+
+	return count, nil
+}
+
+// revokeRefreshTokens deletes the refresh token families found by a query,
+// which also deletes the access tokens issued from them, after adding those
+// access tokens to the revocation list. It returns the number of refresh
+// tokens deleted.
+func (s *Server) revokeRefreshTokens(ctx context.Context,
+	q *lib.RefreshTokenFind) (int64, error) {
+	if s.Revocations != nil {
+		families := map[string]bool{}
+		rts, err := s.refreshTokens(ctx, q)
+		if err != nil {
+			return 0, err
+		}
+
+		for _, rt := range rts {
+			families[rt.Family] = true
+		}
+
+		ids := map[int64]bool{}
+		for f := range families {
+			family := f
+			frts, err := s.refreshTokens(ctx,
+				&lib.RefreshTokenFind{Family: &family})
+			if err != nil {
+				return 0, err
+			}
+
+			for _, rt := range frts {
+				ids[rt.TokenID] = true
+			}
+		}
+
+		for i := range ids {
+			id := i
+			if err := s.addRevocations(ctx,
+				&dauth.TokenFind{ID: &id}); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	count := int64(0)
+	for rr := range s.RefreshTokens.DeleteRefreshTokens(ctx, q) {
+		if rr.Err != nil {
+			return count, rr.Err
+		}
+
+		count += int64(rr.Num)
+	}
+
+	return count, nil
+}
+
+// refreshTokens returns the refresh tokens found by a query.
+func (s *Server) refreshTokens(ctx context.Context,
+	q *lib.RefreshTokenFind) ([]lib.RefreshToken, error) {
+	var rts []lib.RefreshToken
+	var err error
+	for rr := range s.RefreshTokens.GetRefreshTokens(ctx, q) {
+		if rr.Err != nil {
+			if e, ok := rr.Err.(*dlib.Error); !ok ||
+				e.Code != http.StatusNotFound {
+				err = rr.Err
+			}
+
+			continue
+		}
+
+		switch v := rr.Val.(type) {
+		case lib.RefreshToken:
+			rts = append(rts, v)
+		case *lib.RefreshToken:
+			rts = append(rts, *v)
+		}
+	}
+
+	return rts, err
+}
+
+// addRevocations adds the tokens found by a query to the revocation list.
+func (s *Server) addRevocations(ctx context.Context, q *dauth.TokenFind) error {
+	if s.Revocations == nil {
+		return nil
+	}
+
+	rts, err := s.tokenRevocations(ctx, q)
+	if err != nil {
+		return err
+	}
+
+	for i := range rts {
+		for rr := range s.Revocations.RevokeToken(ctx, &rts[i]) {
+			if rr.Err != nil {
+				return rr.Err
+			}
+		}
+	}
+
+	return nil
+}
+
+// tokenRevocations returns the revocation records of the tokens found by a
+// query. Tokens which are not JWTs are skipped, since they can not be
+// verified statelessly.
+func (s *Server) tokenRevocations(ctx context.Context,
+	q *dauth.TokenFind) ([]lib.RevokedToken, error) {
+	var rts []lib.RevokedToken
+	var err error
+	for tr := range s.Tokens.GetTokens(ctx, q) {
+		if tr.Err != nil {
+			if e, ok := tr.Err.(*dlib.Error); !ok ||
+				e.Code != http.StatusNotFound {
+				err = tr.Err
+			}
+
+			continue
+		}
+
+		var ts string
+		switch v := tr.Val.(type) {
+		case *dauth.Token:
+			ts = v.Token
+		case dauth.Token:
+			ts = v.Token
+		default:
+			continue
+		}
+
+		if tc, perr := lib.ParseTokenClaims(ts); perr == nil && tc.Id != "" {
+			rts = append(rts, lib.NewRevokedToken(tc))
+		}
+	}
+
+	return rts, err
+}
+
+// tokenRevoked returns whether a token id is in the revocation list.
+func (s *Server) tokenRevoked(ctx context.Context, id string) (bool, error) {
+	if s.Revocations == nil {
+		return false, dlib.NewError(http.StatusInternalServerError,
+			"token revocation list not configured")
+	}
+
+	revoked := false
+	for r := range s.Revocations.GetRevokedToken(ctx, id) {
+		if r.Err != nil {
+			if err, ok := r.Err.(*dlib.Error); ok &&
+				err.Code == http.StatusNotFound {
+				continue
+			}
+
+			return false, r.Err
+		}
+
+		switch r.Val.(type) {
+		case lib.RevokedToken, *lib.RevokedToken:
+			revoked = true
+		}
+	}
+
+	return revoked, nil
+}
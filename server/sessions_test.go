@@ -0,0 +1,575 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dhaifley/dauth/lib"
+	"github.com/dhaifley/dlib"
+	"github.com/dhaifley/dlib/dauth"
+	"github.com/dhaifley/dlib/ptypes"
+	"github.com/sirupsen/logrus/hooks/test"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+type MockRevocationAccess struct {
+	mu      sync.Mutex
+	Revoked map[string]lib.RevokedToken
+	Calls   int
+}
+
+func (m *MockRevocationAccess) GetRevokedToken(ctx context.Context,
+	id string) <-chan dlib.Result {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Calls++
+	ch := make(chan dlib.Result, 1)
+	if rt, ok := m.Revoked[id]; ok {
+		ch <- dlib.Result{Val: rt, Num: 1}
+	}
+
+	close(ch)
+	return ch
+}
+
+func (m *MockRevocationAccess) RevokeToken(ctx context.Context,
+	rt *lib.RevokedToken) <-chan dlib.Result {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Revoked == nil {
+		m.Revoked = map[string]lib.RevokedToken{}
+	}
+
+	n := 0
+	if _, ok := m.Revoked[rt.ID]; !ok {
+		m.Revoked[rt.ID] = *rt
+		n = 1
+	}
+
+	ch := make(chan dlib.Result, 1)
+	ch <- dlib.Result{Val: *rt, Num: n}
+	close(ch)
+	return ch
+}
+
+func (m *MockRevocationAccess) DeleteOldRevokedTokens(ctx context.Context,
+	old time.Time,
+	limit int) <-chan dlib.Result {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for id, rt := range m.Revoked {
+		if n < limit && rt.Expires.Before(old) {
+			delete(m.Revoked, id)
+			n++
+		}
+	}
+
+	ch := make(chan dlib.Result, 1)
+	ch <- dlib.Result{Num: n}
+	close(ch)
+	return ch
+}
+
+type MockSessionTokenAccess struct {
+	MockTokenAccess
+	mu     sync.Mutex
+	Tokens []dauth.Token
+}
+
+func (m *MockSessionTokenAccess) find(opt *dauth.TokenFind,
+	t *dauth.Token) bool {
+	return (opt.ID == nil || *opt.ID == t.ID) &&
+		(opt.Token == nil || *opt.Token == t.Token) &&
+		(opt.UserID == nil || *opt.UserID == t.UserID)
+}
+
+func (m *MockSessionTokenAccess) GetTokens(ctx context.Context,
+	opt *dauth.TokenFind) <-chan dlib.Result {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ch := make(chan dlib.Result, len(m.Tokens))
+	for i := range m.Tokens {
+		if m.find(opt, &m.Tokens[i]) {
+			ch <- dlib.Result{Val: m.Tokens[i], Num: 1}
+		}
+	}
+
+	close(ch)
+	return ch
+}
+
+func (m *MockSessionTokenAccess) DeleteTokens(ctx context.Context,
+	opt *dauth.TokenFind) <-chan dlib.Result {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var kept []dauth.Token
+	for _, t := range m.Tokens {
+		if !m.find(opt, &t) {
+			kept = append(kept, t)
+		}
+	}
+
+	n := len(m.Tokens) - len(kept)
+	m.Tokens = kept
+	ch := make(chan dlib.Result, 1)
+	ch <- dlib.Result{Num: n}
+	close(ch)
+	return ch
+}
+
+type MockSessionAccess struct {
+	mu       sync.Mutex
+	Sessions []lib.Session
+	Touched  map[string]int
+}
+
+func (m *MockSessionAccess) GetSessions(ctx context.Context,
+	userID int64, id *string) <-chan dlib.Result {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ch := make(chan dlib.Result, len(m.Sessions))
+	for _, v := range m.Sessions {
+		if v.UserID == userID && (id == nil || *id == v.ID) {
+			ch <- dlib.Result{Val: v, Num: 1}
+		}
+	}
+
+	close(ch)
+	return ch
+}
+
+func (m *MockSessionAccess) SaveSession(ctx context.Context,
+	v *lib.Session) <-chan dlib.Result {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Sessions = append(m.Sessions, *v)
+	ch := make(chan dlib.Result, 1)
+	ch <- dlib.Result{Val: *v, Num: 1}
+	close(ch)
+	return ch
+}
+
+func (m *MockSessionAccess) TouchSession(ctx context.Context,
+	token string, used time.Time) <-chan dlib.Result {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Touched == nil {
+		m.Touched = map[string]int{}
+	}
+
+	m.Touched[token]++
+	ch := make(chan dlib.Result, 1)
+	ch <- dlib.Result{Num: 1}
+	close(ch)
+	return ch
+}
+
+// DeleteOldSessions deletes the sessions created before old, without
+// checking their refresh tokens.
+func (m *MockSessionAccess) DeleteOldSessions(ctx context.Context,
+	old time.Time, limit int) <-chan dlib.Result {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var kept []lib.Session
+	n := 0
+	for _, v := range m.Sessions {
+		if n < limit && v.Created != nil && v.Created.Before(old) {
+			n++
+			continue
+		}
+
+		kept = append(kept, v)
+	}
+
+	m.Sessions = kept
+	ch := make(chan dlib.Result, 1)
+	ch <- dlib.Result{Num: n}
+	close(ch)
+	return ch
+}
+
+func (m *MockSessionAccess) delete(family string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var kept []lib.Session
+	for _, v := range m.Sessions {
+		if v.ID != family {
+			kept = append(kept, v)
+		}
+	}
+
+	m.Sessions = kept
+}
+
+type MockSessionRefreshTokenAccess struct {
+	MockRefreshTokenAccess
+	Tokens   *MockSessionTokenAccess
+	Sessions *MockSessionAccess
+	mu       sync.Mutex
+	Rows     []lib.RefreshToken
+}
+
+func (m *MockSessionRefreshTokenAccess) find(
+	opt *lib.RefreshTokenFind) []lib.RefreshToken {
+	var tokenID int64
+	if opt.AccessToken != nil {
+		for r := range m.Tokens.GetTokens(context.Background(),
+			&dauth.TokenFind{Token: opt.AccessToken}) {
+			tokenID = r.Val.(dauth.Token).ID
+		}
+	}
+
+	var rts []lib.RefreshToken
+	for _, rt := range m.Rows {
+		if (opt.Family == nil || *opt.Family == rt.Family) &&
+			(opt.UserID == nil || *opt.UserID == rt.UserID) &&
+			(opt.AccessToken == nil || tokenID == rt.TokenID) {
+			rts = append(rts, rt)
+		}
+	}
+
+	return rts
+}
+
+func (m *MockSessionRefreshTokenAccess) GetRefreshTokens(ctx context.Context,
+	opt *lib.RefreshTokenFind) <-chan dlib.Result {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rts := m.find(opt)
+	ch := make(chan dlib.Result, len(rts))
+	for _, rt := range rts {
+		ch <- dlib.Result{Val: rt, Num: 1}
+	}
+
+	close(ch)
+	return ch
+}
+
+// DeleteRefreshTokens deletes the families found, and the access tokens and
+// sessions of them, as the delete_refresh_tokens function does.
+func (m *MockSessionRefreshTokenAccess) DeleteRefreshTokens(ctx context.Context,
+	opt *lib.RefreshTokenFind) <-chan dlib.Result {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	families := map[string]bool{}
+	for _, rt := range m.find(opt) {
+		families[rt.Family] = true
+	}
+
+	var kept []lib.RefreshToken
+	for _, rt := range m.Rows {
+		if !families[rt.Family] {
+			kept = append(kept, rt)
+			continue
+		}
+
+		id := rt.TokenID
+		for range m.Tokens.DeleteTokens(ctx, &dauth.TokenFind{ID: &id}) {
+		}
+
+		m.Sessions.delete(rt.Family)
+	}
+
+	n := len(m.Rows) - len(kept)
+	m.Rows = kept
+	ch := make(chan dlib.Result, 1)
+	ch <- dlib.Result{Num: n}
+	close(ch)
+	return ch
+}
+
+func (m *MockSessionRefreshTokenAccess) DeleteOldRefreshTokens(
+	ctx context.Context, old time.Time, limit int) <-chan dlib.Result {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var kept []lib.RefreshToken
+	n := 0
+	for _, rt := range m.Rows {
+		if n < limit && rt.Expires != nil && rt.Expires.Before(old) {
+			n++
+			continue
+		}
+
+		kept = append(kept, rt)
+	}
+
+	m.Rows = kept
+	ch := make(chan dlib.Result, 1)
+	ch <- dlib.Result{Num: n}
+	close(ch)
+	return ch
+}
+
+func testSessionServer(t *testing.T) (*Server, *MockSessionTokenAccess,
+	*MockRevocationAccess, []string) {
+	mta := MockSessionTokenAccess{}
+	msa := MockSessionAccess{}
+	mrta := MockSessionRefreshTokenAccess{Tokens: &mta, Sessions: &msa}
+	mra := MockRevocationAccess{}
+	lm, _ := test.NewNullLogger()
+	svr := Server{Users: &MockUserAccess{}, Tokens: &mta, Revocations: &mra,
+		RefreshTokens: &mrta, Sessions: &msa, Perms: &MockPermAccess{},
+		UserPerms: &MockUserPermAccess{}, Keys: testKeyRing(t),
+		Stateless: true, Cache: NewAuthCache(10, time.Minute), Log: lm}
+	now := time.Now()
+	var tokens []string
+	for _, id := range []int64{1, 1, 2} {
+		exp := now.Add(time.Hour)
+		tc, err := lib.NewTokenClaims("test", id, "", "", now, exp)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ts, err := svr.Keys.Sign(tc)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tid := int64(len(tokens) + 1)
+		mta.Tokens = append(mta.Tokens, dauth.Token{ID: tid, Token: ts,
+			UserID: id, Created: &now, Expires: &exp})
+		family := fmt.Sprintf("user%v", id)
+		mrta.Rows = append(mrta.Rows, lib.RefreshToken{ID: tid,
+			Family: family, UserID: id, TokenID: tid, Expires: &exp})
+		if tid != 2 {
+			msa.Sessions = append(msa.Sessions, lib.Session{ID: family,
+				UserID: id, Created: &now, LastUsed: &now})
+		}
+
+		tokens = append(tokens, ts)
+	}
+
+	return &svr, &mta, &mra, tokens
+}
+
+func testSessionAuth(svr *Server, token string) error {
+	_, err := svr.Auth(context.Background(), &ptypes.AuthRequest{
+		Token: &ptypes.TokenRequest{Token: token},
+		Perm:  &ptypes.PermRequest{Service: "test", Name: "test"},
+	})
+	return err
+}
+
+func TestServerLogoutAll(t *testing.T) {
+	svr, mta, mra, tokens := testSessionServer(t)
+	for _, ts := range tokens {
+		if err := testSessionAuth(svr, ts); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	res, err := svr.LogoutAll(context.Background(),
+		&LogoutAllRequest{Token: tokens[0]})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.UserID != 1 || res.RefreshTokens != 2 {
+		t.Errorf("Expected 2 refresh tokens of user 1 revoked, got: %+v",
+			res)
+	}
+
+	if len(mra.Revoked) != 2 || len(mta.Tokens) != 1 {
+		t.Errorf("Revoked expected: 2, remaining: 1, got: %v, %v",
+			len(mra.Revoked), len(mta.Tokens))
+	}
+
+	for i, ts := range tokens {
+		err := testSessionAuth(svr, ts)
+		if i < 2 && err == nil {
+			t.Errorf("Expected token %v to be revoked", i)
+		}
+
+		if i == 2 && err != nil {
+			t.Errorf("Expected the token of another user to be valid: %v",
+				err)
+		}
+	}
+
+	if _, err := svr.LogoutAll(context.Background(),
+		&LogoutAllRequest{Token: tokens[0]}); err == nil {
+		t.Error("Expected a revoked token to be refused")
+	}
+}
+
+func TestServerRevokeUserSessions(t *testing.T) {
+	svr, _, mra, tokens := testSessionServer(t)
+	res, err := svr.RevokeUserSessions(context.Background(),
+		&RevokeSessionsRequest{UserID: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.RefreshTokens != 1 {
+		t.Errorf("Refresh tokens expected: 1, got: %v", res.RefreshTokens)
+	}
+
+	if err := testSessionAuth(svr, tokens[2]); err == nil {
+		t.Error("Expected the token to be revoked")
+	}
+
+	if err := testSessionAuth(svr, tokens[0]); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := svr.RevokeUserSessions(context.Background(),
+		&RevokeSessionsRequest{}); err == nil {
+		t.Error("Expected an error without a user id")
+	}
+
+	r := NewReaper(svr.Tokens, 0, 10, 0, nil)
+	r.RefreshTokens = svr.RefreshTokens
+	r.Sessions = svr.Sessions
+	r.Revocations = mra
+	c, err := r.Prune(context.Background(), time.Now().Add(2*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(mra.Revoked) != 0 {
+		t.Errorf("Expected expired revocations to be pruned, got: %v",
+			len(mra.Revoked))
+	}
+
+	if c.RefreshTokens != 2 || c.Sessions != 1 || c.Revocations == 0 {
+		t.Errorf("Expected 2 refresh tokens, 1 session and revocations "+
+			"to be pruned, got: %+v", c)
+	}
+
+	if _, total := r.Stats(); total != c {
+		t.Errorf("Stats expected: %+v, got: %+v", c, total)
+	}
+}
+
+func TestServerLogoutRevokesFamily(t *testing.T) {
+	svr, mta, mra, tokens := testSessionServer(t)
+	if _, err := svr.Logout(context.Background(),
+		&ptypes.TokenRequest{Token: tokens[1]}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(mra.Revoked) != 2 || len(mta.Tokens) != 1 {
+		t.Errorf("Revoked expected: 2, remaining: 1, got: %v, %v",
+			len(mra.Revoked), len(mta.Tokens))
+	}
+
+	if err := testSessionAuth(svr, tokens[0]); err == nil {
+		t.Error("Expected the token refreshed from the same login to be revoked")
+	}
+}
+
+func TestServerSaveSession(t *testing.T) {
+	msa := MockSessionAccess{}
+	lm, _ := test.NewNullLogger()
+	svr := Server{Users: &MockUserAccess{}, Tokens: &MockTokenAccess{},
+		RefreshTokens: &MockRefreshTokenAccess{}, Sessions: &msa,
+		Keys: testKeyRing(t), Log: lm}
+	ctx := metadata.NewIncomingContext(context.Background(),
+		metadata.Pairs("user-agent", "test-agent/1.0",
+			DeviceHeader, strings.Repeat("é", maxSessionDevice)))
+	ctx = peer.NewContext(ctx, &peer.Peer{
+		Addr: &net.TCPAddr{IP: net.ParseIP("10.1.2.3"), Port: 4321},
+	})
+	u := dauth.User{ID: 1, User: "test"}
+	if _, err := svr.issueTokens(ctx, "Login", nil, &u, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := svr.issueTokens(ctx, "Refresh", nil, &u,
+		msa.Sessions[0].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(msa.Sessions) != 1 {
+		t.Fatalf("Sessions expected: 1, got: %v", len(msa.Sessions))
+	}
+
+	ses := msa.Sessions[0]
+	if ses.UserID != 1 || ses.Address != "10.1.2.3" ||
+		ses.UserAgent != "test-agent/1.0" {
+		t.Errorf("Session expected from 10.1.2.3 with test-agent, got: %+v",
+			ses)
+	}
+
+	if len(ses.Device) != maxSessionDevice || !utf8.ValidString(ses.Device) {
+		t.Errorf("Device expected to be truncated to %v bytes, got: %q",
+			maxSessionDevice, ses.Device)
+	}
+}
+
+func TestServerListSessions(t *testing.T) {
+	svr, _, _, tokens := testSessionServer(t)
+	msa := svr.Sessions.(*MockSessionAccess)
+	svr.Touches = lib.NewCache(10, time.Minute)
+	for i := 0; i < 2; i++ {
+		if err := testSessionAuth(svr, tokens[0]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if msa.Touched[tokens[0]] != 1 {
+		t.Errorf("Touches expected: 1, got: %v", msa.Touched[tokens[0]])
+	}
+
+	res, err := svr.ListSessions(context.Background(),
+		&SessionsRequest{Token: tokens[0]})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Sessions) != 1 || res.Sessions[0].ID != "user1" ||
+		!res.Sessions[0].Current {
+		t.Errorf("Expected the current session of user 1, got: %+v",
+			res.Sessions)
+	}
+
+	if _, err := svr.ListSessions(context.Background(),
+		&SessionsRequest{}); err == nil {
+		t.Error("Expected an error without a token")
+	}
+}
+
+func TestServerRevokeSessions(t *testing.T) {
+	svr, _, _, tokens := testSessionServer(t)
+	if _, err := svr.RevokeSessions(context.Background(),
+		&RevokeSessionRequest{Token: tokens[0],
+			IDs: []string{"user1", "user2"}}); err == nil {
+		t.Error("Expected an error revoking the session of another user")
+	}
+
+	if err := testSessionAuth(svr, tokens[0]); err != nil {
+		t.Errorf("Expected no session to be revoked, got: %v", err)
+	}
+
+	res, err := svr.RevokeSessions(context.Background(),
+		&RevokeSessionRequest{Token: tokens[2], IDs: []string{"user2"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.UserID != 2 || res.Sessions != 1 || res.RefreshTokens != 1 {
+		t.Errorf("Expected 1 session of user 2 revoked, got: %+v", res)
+	}
+
+	if err := testSessionAuth(svr, tokens[2]); err == nil {
+		t.Error("Expected the token of the session to be revoked")
+	}
+
+	ls, err := svr.ListSessions(context.Background(),
+		&SessionsRequest{Token: tokens[0]})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ls.Sessions) != 1 {
+		t.Errorf("Sessions of user 1 expected: 1, got: %v", len(ls.Sessions))
+	}
+}
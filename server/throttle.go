@@ -0,0 +1,213 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/dhaifley/dauth/lib"
+	"github.com/dhaifley/dlib"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc/peer"
+)
+
+// UnlockRequest values are requests to clear the failed logins counted for
+// a user name, a client address, or both.
+type UnlockRequest struct {
+	User string `json:"user"`
+	Peer string `json:"peer"`
+}
+
+// UnlockResponse values report how many of the requested keys had failed
+// logins counted.
+type UnlockResponse struct {
+	Num int `json:"num"`
+}
+
+// LoadThrottle configures login throttling. Failed logins are counted in
+// the database, unless login_throttle_store is set to memory.
+func (s *Server) LoadThrottle() error {
+	var lfa lib.LoginFailureAccessor
+	switch st := viper.GetString("login_throttle_store"); st {
+	case "memory":
+		lfa = lib.NewMemLoginFailureAccessor()
+	case "sql", "":
+		if s.SQL == nil {
+			return fmt.Errorf("login throttle store %q requires SQL", st)
+		}
+
+		lfa = lib.NewLoginFailureAccessor(s.SQL)
+	default:
+		return fmt.Errorf("invalid login throttle store: %q", st)
+	}
+
+	s.Throttle = lib.NewLoginThrottle(lfa,
+		viper.GetInt("login_failure_threshold"),
+		viper.GetDuration("login_failure_delay"),
+		viper.GetDuration("login_lockout"))
+	if s.Log != nil {
+		s.Log.WithFields(logrus.Fields{
+			"threshold": s.Throttle.Threshold,
+			"delay":     s.Throttle.Delay,
+			"lockout":   s.Throttle.Lockout,
+		}).Info("Login throttling configured")
+	}
+
+	return nil
+}
+
+// loginKeys returns the throttling keys for a login request.
+func loginKeys(ctx context.Context, user string) []string {
+	keys := []string{lib.LoginUserKey(user)}
+	if addr := peerAddr(ctx); addr != "" {
+		keys = append(keys, lib.LoginPeerKey(addr))
+	}
+
+	return keys
+}
+
+// peerAddr returns the host address of the client of a request, if known.
+func peerAddr(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+
+	addr := p.Addr.String()
+	if h, _, err := net.SplitHostPort(addr); err == nil {
+		addr = h
+	}
+
+	return addr
+}
+
+// checkThrottle returns an error if a login attempt must wait because of
+// previous failures. Otherwise the attempt is counted as a failure until it
+// is released with releaseThrottle.
+func (s *Server) checkThrottle(ctx context.Context, rpc string,
+	req interface{}, keys []string) error {
+	if s.Throttle == nil {
+		return nil
+	}
+
+	wait, locked, err := s.Throttle.Wait(ctx, keys...)
+	if err != nil {
+		s.Log.WithFields(logrus.Fields{
+			"rpc":     rpc,
+			"code":    http.StatusInternalServerError,
+			"context": ctx,
+			"request": req,
+		}).Error(err)
+		return err
+	}
+
+	if wait <= 0 {
+		return nil
+	}
+
+	msg := "too many failed logins"
+	if locked {
+		msg = "account locked"
+	}
+
+	s.Log.WithFields(logrus.Fields{
+		"rpc":     rpc,
+		"code":    http.StatusTooManyRequests,
+		"context": ctx,
+		"request": req,
+		"keys":    keys,
+		"wait":    wait,
+	}).Warning(msg)
+	return dlib.NewError(http.StatusTooManyRequests,
+		fmt.Sprintf("%s, retry in %v", msg, wait.Round(time.Second)))
+}
+
+// resetThrottle clears the failed logins counted for keys after a
+// successful login.
+func (s *Server) resetThrottle(ctx context.Context, rpc string,
+	req interface{}, keys []string) {
+	if s.Throttle == nil {
+		return
+	}
+
+	if _, err := s.Throttle.Reset(ctx, keys...); err != nil {
+		s.Log.WithFields(logrus.Fields{
+			"rpc":     rpc,
+			"code":    http.StatusInternalServerError,
+			"context": ctx,
+			"request": req,
+		}).Error(err)
+	}
+}
+
+// releaseThrottle uncounts a login attempt allowed by checkThrottle which
+// did not fail. Failures to release it are logged, but do not change the
+// result of the login.
+func (s *Server) releaseThrottle(ctx context.Context, rpc string,
+	req interface{}, keys []string) {
+	if s.Throttle == nil {
+		return
+	}
+
+	if err := s.Throttle.Release(ctx, keys...); err != nil {
+		s.Log.WithFields(logrus.Fields{
+			"rpc":     rpc,
+			"code":    http.StatusInternalServerError,
+			"context": ctx,
+			"request": req,
+		}).Error(err)
+	}
+}
+
+// Unlock clears the failed logins counted for a user name or a client
+// address, ending any lockout.
+func (s *Server) Unlock(ctx context.Context,
+	req *UnlockRequest) (res *UnlockResponse, err error) {
+	defer func() { s.audit(ctx, "Unlock", req, err) }()
+	if req.User == "" && req.Peer == "" {
+		err := dlib.NewError(http.StatusBadRequest, "user or peer required")
+		s.Log.WithFields(logrus.Fields{
+			"rpc":     "Unlock",
+			"code":    http.StatusBadRequest,
+			"context": ctx,
+			"request": req,
+		}).Error(err)
+		return nil, err
+	}
+
+	if s.Throttle == nil {
+		return &UnlockResponse{}, nil
+	}
+
+	var keys []string
+	if req.User != "" {
+		keys = append(keys, lib.LoginUserKey(req.User))
+	}
+
+	if req.Peer != "" {
+		keys = append(keys, lib.LoginPeerKey(req.Peer))
+	}
+
+	n, err := s.Throttle.Reset(ctx, keys...)
+	if err != nil {
+		s.Log.WithFields(logrus.Fields{
+			"rpc":     "Unlock",
+			"code":    http.StatusInternalServerError,
+			"context": ctx,
+			"request": req,
+		}).Error(err)
+		return nil, err
+	}
+
+	s.Log.WithFields(logrus.Fields{
+		"rpc":     "Unlock",
+		"code":    http.StatusOK,
+		"context": ctx,
+		"request": req,
+		"count":   n,
+	}).Info("Unlock request processed")
+	return &UnlockResponse{Num: n}, nil
+}
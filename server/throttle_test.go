@@ -0,0 +1,73 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/dhaifley/dauth/lib"
+	"github.com/dhaifley/dlib"
+	"github.com/dhaifley/dlib/ptypes"
+	"github.com/sirupsen/logrus/hooks/test"
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc/peer"
+)
+
+func TestServerLoginThrottle(t *testing.T) {
+	ph, err := lib.HashPassword("test", bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mua := MockUserAccess{Pass: ph}
+	lm, _ := test.NewNullLogger()
+	svr := Server{Users: &mua, Tokens: &MockTokenAccess{},
+		RefreshTokens: &MockRefreshTokenAccess{}, Keys: testKeyRing(t),
+		PasswordCost: bcrypt.MinCost, Log: lm,
+		Throttle: lib.NewLoginThrottle(lib.NewMemLoginFailureAccessor(),
+			2, time.Minute, time.Hour)}
+	ctx := peer.NewContext(context.Background(), &peer.Peer{
+		Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1234},
+	})
+
+	req := ptypes.UserRequest{
+		User: "test",
+		Pass: dlib.EncodeBase64String("wrong"),
+	}
+
+	if _, err := svr.login(ctx, &req); err == nil {
+		t.Fatal("Expected error for wrong password")
+	}
+
+	req.Pass = dlib.EncodeBase64String("test")
+	_, err = svr.login(ctx, &req)
+	if e, ok := err.(*dlib.Error); !ok || e.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected throttled login, got: %v", err)
+	}
+
+	res, err := svr.Unlock(context.Background(),
+		&UnlockRequest{User: "test", Peer: "10.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Num != 2 {
+		t.Errorf("Unlock count expected: 2, got: %v", res.Num)
+	}
+
+	if _, err := svr.login(ctx, &req); err != nil {
+		t.Errorf("Expected login after unlock, got: %v", err)
+	}
+
+	if _, err := svr.login(ctx, &req); err != nil {
+		t.Errorf("Expected successful logins not to be counted, got: %v",
+			err)
+	}
+
+	if _, err := svr.Unlock(context.Background(),
+		&UnlockRequest{}); err == nil {
+		t.Error("Expected error for empty unlock request")
+	}
+}
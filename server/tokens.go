@@ -13,6 +13,7 @@ import (
 // GetTokens returns a stream of tokens from the database.
 func (s *Server) GetTokens(req *ptypes.TokenRequest,
 	stream ptypes.Auth_GetTokensServer) error {
+	ctx := stream.Context()
 	q := dauth.TokenFind{}
 	if err := q.FromTokenRequest(req); err != nil {
 		s.Log.WithFields(logrus.Fields{
@@ -24,13 +25,17 @@ func (s *Server) GetTokens(req *ptypes.TokenRequest,
 		return err
 	}
 
-	ch := s.Tokens.GetTokens(&q)
+	ch := s.Tokens.GetTokens(ctx, &q)
 	for r := range ch {
 		if r.Err != nil {
 			s.Log.Error(r.Err)
 			return r.Err
 		}
 
+		if v, ok := r.Val.(dauth.Token); ok {
+			r.Val = &v
+		}
+
 		switch v := r.Val.(type) {
 		case *dauth.Token:
 			res := v.ToResponse()
@@ -61,6 +66,7 @@ func (s *Server) GetTokens(req *ptypes.TokenRequest,
 // SaveTokens serializes a stream of tokens to the database.
 func (s *Server) SaveTokens(
 	stream ptypes.Auth_SaveTokensServer) error {
+	ctx := stream.Context()
 	count := 0
 	for {
 		req, err := stream.Recv()
@@ -88,20 +94,23 @@ func (s *Server) SaveTokens(
 
 		v := dauth.Token{}
 		v.FromRequest(req)
-		ch := s.Tokens.SaveToken(&v)
+		ch := s.Tokens.SaveToken(ctx, &v)
 		for r := range ch {
 			if r.Err != nil {
+				s.audit(ctx, "SaveTokens", req, r.Err)
 				s.Log.WithFields(logrus.Fields{
 					"rpc":     "SaveTokens",
 					"code":    http.StatusInternalServerError,
 					"context": stream.Context,
 					"request": req,
 					"count":   count,
-				}).Error(err)
-				return err
+				}).Error(r.Err)
+				return r.Err
 			}
 		}
 
+		s.audit(ctx, "SaveTokens", &v, nil)
+
 		res := v.ToResponse()
 		if err := stream.Send(&res); err != nil {
 			s.Log.WithFields(logrus.Fields{
@@ -119,8 +128,11 @@ func (s *Server) SaveTokens(
 	}
 }
 
-// DeleteTokens deletes tokens from the database.
-func (s *Server) DeleteTokens(ctx context.Context, req *ptypes.TokenRequest) (*ptypes.DeleteResponse, error) {
+// DeleteTokens deletes tokens from the database and adds them to the
+// revocation list.
+func (s *Server) DeleteTokens(ctx context.Context,
+	req *ptypes.TokenRequest) (res *ptypes.DeleteResponse, err error) {
+	defer func() { s.audit(ctx, "DeleteTokens", req, err) }()
 	q := dauth.TokenFind{}
 	if err := q.FromTokenRequest(req); err != nil {
 		s.Log.WithFields(logrus.Fields{
@@ -132,22 +144,18 @@ func (s *Server) DeleteTokens(ctx context.Context, req *ptypes.TokenRequest) (*p
 		return nil, err
 	}
 
-	ch := s.Tokens.DeleteTokens(&q)
-	count := int64(0)
-	for r := range ch {
-		if r.Err != nil {
-			s.Log.WithFields(logrus.Fields{
-				"rpc":     "DeleteTokens",
-				"code":    http.StatusInternalServerError,
-				"context": ctx,
-				"request": req,
-			}).Error(r.Err)
-			return nil, r.Err
-		}
-
-		count += int64(r.Num)
+	count, err := s.revokeTokens(ctx, &q)
+	if err != nil {
+		s.Log.WithFields(logrus.Fields{
+			"rpc":     "DeleteTokens",
+			"code":    http.StatusInternalServerError,
+			"context": ctx,
+			"request": req,
+		}).Error(err)
+		return nil, err
 	}
 
+	s.Cache.InvalidateTokens()
 	s.Log.WithFields(logrus.Fields{
 		"rpc":     "DeleteTokens",
 		"code":    http.StatusOK,
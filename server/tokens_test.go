@@ -7,17 +7,19 @@ import (
 	"time"
 
 	"github.com/dhaifley/dlib"
-	"github.com/dhaifley/dlib/ptypes"
 	"github.com/dhaifley/dlib/dauth"
+	"github.com/dhaifley/dlib/ptypes"
 	"github.com/sirupsen/logrus/hooks/test"
 	"google.golang.org/grpc"
 )
 
 type MockTokenAccess struct {
 	DBS dlib.SQLExecutor
+	Old int
 }
 
-func (m *MockTokenAccess) GetTokens(opt *dauth.TokenFind) <-chan dlib.Result {
+func (m *MockTokenAccess) GetTokens(ctx context.Context,
+	opt *dauth.TokenFind) <-chan dlib.Result {
 	ch := make(chan dlib.Result, 256)
 	go func() {
 		defer close(ch)
@@ -38,11 +40,13 @@ func (m *MockTokenAccess) GetTokens(opt *dauth.TokenFind) <-chan dlib.Result {
 	return ch
 }
 
-func (m *MockTokenAccess) GetTokenByID(id int64) <-chan dlib.Result {
-	return m.GetTokens(nil)
+func (m *MockTokenAccess) GetTokenByID(ctx context.Context,
+	id int64) <-chan dlib.Result {
+	return m.GetTokens(ctx, nil)
 }
 
-func (m *MockTokenAccess) DeleteTokens(opt *dauth.TokenFind) <-chan dlib.Result {
+func (m *MockTokenAccess) DeleteTokens(ctx context.Context,
+	opt *dauth.TokenFind) <-chan dlib.Result {
 	ch := make(chan dlib.Result, 256)
 	go func() {
 		defer close(ch)
@@ -53,11 +57,30 @@ func (m *MockTokenAccess) DeleteTokens(opt *dauth.TokenFind) <-chan dlib.Result
 	return ch
 }
 
-func (m *MockTokenAccess) DeleteTokenByID(id int64) <-chan dlib.Result {
-	return m.DeleteTokens(nil)
+func (m *MockTokenAccess) DeleteTokenByID(ctx context.Context,
+	id int64) <-chan dlib.Result {
+	return m.DeleteTokens(ctx, nil)
+}
+
+func (m *MockTokenAccess) DeleteOldTokens(ctx context.Context, old time.Time,
+	limit int) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 256)
+	go func() {
+		defer close(ch)
+		n := m.Old
+		if n > limit {
+			n = limit
+		}
+
+		m.Old -= n
+		ch <- dlib.Result{Num: n}
+	}()
+
+	return ch
 }
 
-func (m *MockTokenAccess) SaveToken(a *dauth.Token) <-chan dlib.Result {
+func (m *MockTokenAccess) SaveToken(ctx context.Context,
+	a *dauth.Token) <-chan dlib.Result {
 	ch := make(chan dlib.Result, 256)
 	go func() {
 		defer close(ch)
@@ -69,8 +92,9 @@ func (m *MockTokenAccess) SaveToken(a *dauth.Token) <-chan dlib.Result {
 	return ch
 }
 
-func (m *MockTokenAccess) SaveTokens(a []dauth.Token) <-chan dlib.Result {
-	return m.SaveToken(nil)
+func (m *MockTokenAccess) SaveTokens(ctx context.Context,
+	a []dauth.Token) <-chan dlib.Result {
+	return m.SaveToken(ctx, nil)
 }
 
 type MockRFAuthGetTokensServer struct {
@@ -83,6 +107,10 @@ func (m *MockRFAuthGetTokensServer) Send(msg *ptypes.TokenResponse) error {
 	return nil
 }
 
+func (m *MockRFAuthGetTokensServer) Context() context.Context {
+	return context.Background()
+}
+
 type MockRFAuthSaveTokensServer struct {
 	grpc.ServerStream
 	Results []ptypes.TokenResponse
@@ -94,6 +122,10 @@ func (m *MockRFAuthSaveTokensServer) Send(msg *ptypes.TokenResponse) error {
 	return nil
 }
 
+func (m *MockRFAuthSaveTokensServer) Context() context.Context {
+	return context.Background()
+}
+
 func (m *MockRFAuthSaveTokensServer) Recv() (*ptypes.TokenRequest, error) {
 	if m.Count < 1 {
 		msg := ptypes.TokenRequest{
@@ -0,0 +1,170 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/dhaifley/dauth/lib"
+	"github.com/dhaifley/dlib"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/metadata"
+)
+
+// TracerName is the name of the OpenTelemetry tracer of the server.
+const TracerName = "github.com/dhaifley/dauth/server"
+
+// Trace exporters.
+const (
+	TraceExporterNone = "none"
+	TraceExporterOTLP = "otlp"
+)
+
+// LoadTracing configures the OpenTelemetry tracing of the server from the
+// trace_* settings. Unless trace_exporter is otlp, spans are not recorded.
+func (s *Server) LoadTracing() error {
+	exp := strings.ToLower(viper.GetString("trace_exporter"))
+	switch exp {
+	case "", TraceExporterNone:
+		return nil
+	case TraceExporterOTLP:
+	default:
+		return dlib.NewError(http.StatusBadRequest,
+			"unknown trace exporter: "+exp)
+	}
+
+	opts := []otlptracegrpc.Option{}
+	if ep := viper.GetString("trace_otlp_endpoint"); ep != "" {
+		opts = append(opts, otlptracegrpc.WithEndpoint(ep))
+	}
+
+	if viper.GetBool("trace_otlp_insecure") {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	}
+
+	e, err := otlptracegrpc.New(context.Background(), opts...)
+	if err != nil {
+		return err
+	}
+
+	ratio := viper.GetFloat64("trace_sample_ratio")
+	s.SetTracerProvider(sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(e),
+		sdktrace.WithSampler(sdktrace.ParentBased(
+			sdktrace.TraceIDRatioBased(ratio))),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceName(lib.ServiceInfo.Name),
+			semconv.ServiceVersion(lib.ServiceInfo.Version))),
+	))
+
+	if s.Log != nil {
+		s.Log.WithFields(logrus.Fields{
+			"exporter":     exp,
+			"endpoint":     viper.GetString("trace_otlp_endpoint"),
+			"sample_ratio": ratio,
+		}).Info("Tracing configured")
+	}
+
+	return nil
+}
+
+// SetTracerProvider sets the OpenTelemetry tracer provider used by the
+// server and the accessors, and the W3C trace context propagator. The
+// provider is shut down, flushing its spans, when the server is closed.
+func (s *Server) SetTracerProvider(tp *sdktrace.TracerProvider) {
+	s.Tracing = tp
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{}))
+}
+
+// startRPCSpan starts the span of a gRPC call, continuing the trace of the
+// caller found in the metadata of the call.
+func startRPCSpan(ctx context.Context,
+	method string) (context.Context, trace.Span) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	ctx = otel.GetTextMapPropagator().Extract(ctx, metadataCarrier(md))
+	name := strings.TrimPrefix(method, "/")
+	return otel.Tracer(TracerName).Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			semconv.RPCSystemNameGRPC,
+			semconv.RPCMethod(name),
+		))
+}
+
+// endRPCSpan ends the span of a gRPC call, recording its error.
+func endRPCSpan(span trace.Span, err error) {
+	if err != nil {
+		lib.SpanError(span, err)
+	}
+
+	span.End()
+}
+
+// startHTTPSpan starts the span of an HTTP request, continuing the trace
+// of the caller found in its headers.
+func startHTTPSpan(r *http.Request) (*http.Request, trace.Span) {
+	route := r.URL.Path
+	if cr := mux.CurrentRoute(r); cr != nil {
+		if tpl, err := cr.GetPathTemplate(); err == nil {
+			route = tpl
+		}
+	}
+
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(),
+		propagation.HeaderCarrier(r.Header))
+	ctx, span := otel.Tracer(TracerName).Start(ctx, r.Method+" "+route,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(r.Method),
+			semconv.HTTPRoute(route),
+		))
+	return r.WithContext(ctx), span
+}
+
+// endHTTPSpan ends the span of an HTTP request, marking server errors as
+// failures.
+func endHTTPSpan(span trace.Span, code int) {
+	span.SetAttributes(semconv.HTTPResponseStatusCode(code))
+	if code >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(code))
+	}
+
+	span.End()
+}
+
+// metadataCarrier adapts gRPC metadata to carry trace context.
+type metadataCarrier metadata.MD
+
+func (mc metadataCarrier) Get(key string) string {
+	if v := metadata.MD(mc).Get(key); len(v) > 0 {
+		return v[0]
+	}
+
+	return ""
+}
+
+func (mc metadataCarrier) Set(key, value string) {
+	metadata.MD(mc).Set(key, value)
+}
+
+func (mc metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(mc))
+	for k := range mc {
+		keys = append(keys, k)
+	}
+
+	return keys
+}
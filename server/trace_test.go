@@ -0,0 +1,110 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/dhaifley/dlib"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	testTraceID     = "4bf92f3577b34da6a3ce929d0e0e4736"
+	testTraceParent = "00-" + testTraceID + "-00f067aa0ba902b7-01"
+)
+
+func testTraceServer(t *testing.T, svr *Server) *tracetest.SpanRecorder {
+	sr := tracetest.NewSpanRecorder()
+	svr.SetTracerProvider(sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(sr)))
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+	return sr
+}
+
+func TestServerTraceInterceptor(t *testing.T) {
+	svr := testInterceptorServer(true)
+	sr := testTraceServer(t, svr)
+	var traceID string
+	handler := func(ctx context.Context, req interface{}) (interface{},
+		error) {
+		sc := trace.SpanFromContext(ctx).SpanContext()
+		traceID = sc.TraceID().String()
+		return nil, nil
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(),
+		metadata.Pairs("authorization", "Bearer test",
+			"traceparent", testTraceParent))
+	info := grpc.UnaryServerInfo{FullMethod: "/dauth.AuthExt/SaveRoles"}
+	_, err := svr.UnaryInterceptor(ctx, nil, &info, handler)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if traceID != testTraceID {
+		t.Errorf("Trace expected: %v, got: %v", testTraceID, traceID)
+	}
+
+	svr.UnaryInterceptor(context.Background(), nil, &info, handler)
+	spans := sr.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("Spans expected: 2, got: %v", len(spans))
+	}
+
+	if s := spans[0]; s.Name() != "dauth.AuthExt/SaveRoles" ||
+		s.SpanKind() != trace.SpanKindServer ||
+		s.Parent().TraceID().String() != testTraceID ||
+		s.Status().Code == codes.Error {
+		t.Errorf("RPC span expected, got: %v %v %v", s.Name(),
+			s.SpanKind(), s.Status())
+	}
+
+	if s := spans[1]; s.Status().Code != codes.Error {
+		t.Errorf("Unauthorized span expected to fail, got: %v",
+			s.Status())
+	}
+}
+
+func TestHTTPTrace(t *testing.T) {
+	svr := testHTTPServer(t)
+	sr := testTraceServer(t, svr)
+	rec := serveHTTP(svr, "POST", "/dauth/login",
+		`{"user":"test","pass":"`+dlib.EncodeBase64String("test")+`"}`,
+		"traceparent", testTraceParent)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status expected: %v, got: %v", http.StatusOK,
+			rec.Code)
+	}
+
+	spans := sr.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("Spans expected: 1, got: %v", len(spans))
+	}
+
+	s := spans[0]
+	if s.Name() != "POST /dauth/login" ||
+		s.SpanContext().TraceID().String() != testTraceID {
+		t.Errorf("HTTP span expected, got: %v %v", s.Name(),
+			s.SpanContext().TraceID())
+	}
+
+	code := semconv.HTTPResponseStatusCode(http.StatusOK)
+	found := false
+	for _, a := range s.Attributes() {
+		found = found || a == code
+	}
+
+	if !found {
+		t.Errorf("Status code attribute expected, got: %v",
+			s.Attributes())
+	}
+}
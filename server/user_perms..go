@@ -13,6 +13,7 @@ import (
 // GetUserPerms returns a stream of user_perms from the database.
 func (s *Server) GetUserPerms(req *ptypes.UserPermRequest,
 	stream ptypes.Auth_GetUserPermsServer) error {
+	ctx := stream.Context()
 	q := dauth.UserPermFind{}
 	if err := q.FromUserPermRequest(req); err != nil {
 		s.Log.WithFields(logrus.Fields{
@@ -23,7 +24,7 @@ func (s *Server) GetUserPerms(req *ptypes.UserPermRequest,
 		return err
 	}
 
-	ch := s.UserPerms.GetUserPerms(&q)
+	ch := s.UserPerms.GetUserPerms(ctx, &q)
 	for r := range ch {
 		if r.Err != nil {
 			s.Log.WithFields(logrus.Fields{
@@ -34,6 +35,10 @@ func (s *Server) GetUserPerms(req *ptypes.UserPermRequest,
 			return r.Err
 		}
 
+		if v, ok := r.Val.(dauth.UserPerm); ok {
+			r.Val = &v
+		}
+
 		switch v := r.Val.(type) {
 		case *dauth.UserPerm:
 			res := v.ToResponse()
@@ -62,6 +67,7 @@ func (s *Server) GetUserPerms(req *ptypes.UserPermRequest,
 // SaveUserPerms serializes a stream of user_perms to the database.
 func (s *Server) SaveUserPerms(
 	stream ptypes.Auth_SaveUserPermsServer) error {
+	ctx := stream.Context()
 	count := 0
 	for {
 		req, err := stream.Recv()
@@ -87,19 +93,28 @@ func (s *Server) SaveUserPerms(
 
 		v := dauth.UserPerm{}
 		v.FromRequest(req)
-		ch := s.UserPerms.SaveUserPerm(&v)
+		ch := s.UserPerms.SaveUserPerm(ctx, &v)
 		for r := range ch {
 			if r.Err != nil {
+				s.audit(ctx, "SaveUserPerms", req, r.Err)
 				s.Log.WithFields(logrus.Fields{
 					"rpc":     "SaveUserPerms",
 					"code":    http.StatusInternalServerError,
 					"request": req,
 					"count":   count,
-				}).Error(err)
-				return err
+				}).Error(r.Err)
+				return r.Err
 			}
 		}
 
+		// A saved assignment may have belonged to another user before.
+		if req.ID == 0 {
+			s.Cache.InvalidatePerms(v.UserID)
+		} else {
+			s.Cache.InvalidatePerms()
+		}
+
+		s.audit(ctx, "SaveUserPerms", &v, nil)
 		res := v.ToResponse()
 		if err := stream.Send(&res); err != nil {
 			s.Log.WithFields(logrus.Fields{
@@ -117,7 +132,9 @@ func (s *Server) SaveUserPerms(
 }
 
 // DeleteUserPerms deletes user_perms from the database.
-func (s *Server) DeleteUserPerms(ctx context.Context, req *ptypes.UserPermRequest) (*ptypes.DeleteResponse, error) {
+func (s *Server) DeleteUserPerms(ctx context.Context,
+	req *ptypes.UserPermRequest) (res *ptypes.DeleteResponse, err error) {
+	defer func() { s.audit(ctx, "DeleteUserPerms", req, err) }()
 	q := dauth.UserPermFind{}
 	if err := q.FromUserPermRequest(req); err != nil {
 		s.Log.WithFields(logrus.Fields{
@@ -128,7 +145,7 @@ func (s *Server) DeleteUserPerms(ctx context.Context, req *ptypes.UserPermReques
 		return nil, err
 	}
 
-	ch := s.UserPerms.DeleteUserPerms(&q)
+	ch := s.UserPerms.DeleteUserPerms(ctx, &q)
 	count := int64(0)
 	for r := range ch {
 		if r.Err != nil {
@@ -143,6 +160,12 @@ func (s *Server) DeleteUserPerms(ctx context.Context, req *ptypes.UserPermReques
 		count += int64(r.Num)
 	}
 
+	if q.UserID != nil {
+		s.Cache.InvalidatePerms(*q.UserID)
+	} else {
+		s.Cache.InvalidatePerms()
+	}
+
 	s.Log.WithFields(logrus.Fields{
 		"rpc":     "DeleteUserPerms",
 		"code":    http.StatusOK,
@@ -3,20 +3,24 @@ package server
 import (
 	"context"
 	"io"
+	"strings"
 	"testing"
 
+	"github.com/dhaifley/dauth/lib"
 	"github.com/dhaifley/dlib"
-	"github.com/dhaifley/dlib/ptypes"
 	"github.com/dhaifley/dlib/dauth"
+	"github.com/dhaifley/dlib/ptypes"
 	"github.com/sirupsen/logrus/hooks/test"
 	"google.golang.org/grpc"
 )
 
 type MockUserPermAccess struct {
-	DBS dlib.SQLExecutor
+	DBS    dlib.SQLExecutor
+	Server *Server
 }
 
-func (m *MockUserPermAccess) GetUserPerms(opt *dauth.UserPermFind) <-chan dlib.Result {
+func (m *MockUserPermAccess) GetUserPerms(ctx context.Context,
+	opt *dauth.UserPermFind) <-chan dlib.Result {
 	ch := make(chan dlib.Result, 256)
 	go func() {
 		defer close(ch)
@@ -28,11 +32,66 @@ func (m *MockUserPermAccess) GetUserPerms(opt *dauth.UserPermFind) <-chan dlib.R
 	return ch
 }
 
-func (m *MockUserPermAccess) GetUserPermByID(id int64) <-chan dlib.Result {
-	return m.GetUserPerms(nil)
+// GetUserEffectivePerms resolves the mock user perm, and the role and group
+// perms of the linked server, through the linked server's perm accessor, as
+// the get_user_effective_perms function does, with deny perms first.
+func (m *MockUserPermAccess) GetUserEffectivePerms(ctx context.Context,
+	userID int64) <-chan dlib.Result {
+	if m.Server == nil || m.Server.Perms == nil {
+		return mockResults(dauth.Perm{ID: 1, Service: "test", Name: "test"})
+	}
+
+	ids := []int64{1}
+	if m.Server.Roles != nil {
+		for r := range m.Server.Roles.GetUserRolePerms(ctx, userID) {
+			if v, ok := r.Val.(lib.RolePerm); ok {
+				ids = append(ids, v.PermID)
+			}
+		}
+	}
+
+	if m.Server.Groups != nil {
+		for r := range m.Server.Groups.GetUserGroupPerms(ctx, userID) {
+			if v, ok := r.Val.(lib.GroupPerm); ok {
+				ids = append(ids, v.PermID)
+			}
+		}
+	}
+
+	var deny, allow []interface{}
+	seen := map[int64]bool{}
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+
+		seen[id] = true
+		p, err := m.Server.getPerm(ctx, id)
+		if err != nil {
+			return mockError(err)
+		}
+
+		if p == nil {
+			continue
+		}
+
+		if strings.HasPrefix(p.Service, lib.PermDeny) {
+			deny = append(deny, *p)
+		} else {
+			allow = append(allow, *p)
+		}
+	}
+
+	return mockResults(append(deny, allow...)...)
+}
+
+func (m *MockUserPermAccess) GetUserPermByID(ctx context.Context,
+	id int64) <-chan dlib.Result {
+	return m.GetUserPerms(ctx, nil)
 }
 
-func (m *MockUserPermAccess) DeleteUserPerms(opt *dauth.UserPermFind) <-chan dlib.Result {
+func (m *MockUserPermAccess) DeleteUserPerms(ctx context.Context,
+	opt *dauth.UserPermFind) <-chan dlib.Result {
 	ch := make(chan dlib.Result, 256)
 	go func() {
 		defer close(ch)
@@ -43,11 +102,13 @@ func (m *MockUserPermAccess) DeleteUserPerms(opt *dauth.UserPermFind) <-chan dli
 	return ch
 }
 
-func (m *MockUserPermAccess) DeleteUserPermByID(id int64) <-chan dlib.Result {
-	return m.DeleteUserPerms(nil)
+func (m *MockUserPermAccess) DeleteUserPermByID(ctx context.Context,
+	id int64) <-chan dlib.Result {
+	return m.DeleteUserPerms(ctx, nil)
 }
 
-func (m *MockUserPermAccess) SaveUserPerm(a *dauth.UserPerm) <-chan dlib.Result {
+func (m *MockUserPermAccess) SaveUserPerm(ctx context.Context,
+	a *dauth.UserPerm) <-chan dlib.Result {
 	ch := make(chan dlib.Result, 256)
 	go func() {
 		defer close(ch)
@@ -59,8 +120,9 @@ func (m *MockUserPermAccess) SaveUserPerm(a *dauth.UserPerm) <-chan dlib.Result
 	return ch
 }
 
-func (m *MockUserPermAccess) SaveUserPerms(a []dauth.UserPerm) <-chan dlib.Result {
-	return m.SaveUserPerm(nil)
+func (m *MockUserPermAccess) SaveUserPerms(ctx context.Context,
+	a []dauth.UserPerm) <-chan dlib.Result {
+	return m.SaveUserPerm(ctx, nil)
 }
 
 type MockRFAuthGetUserPermsServer struct {
@@ -73,6 +135,10 @@ func (m *MockRFAuthGetUserPermsServer) Send(msg *ptypes.UserPermResponse) error
 	return nil
 }
 
+func (m *MockRFAuthGetUserPermsServer) Context() context.Context {
+	return context.Background()
+}
+
 type MockRFAuthSaveUserPermsServer struct {
 	grpc.ServerStream
 	Results []ptypes.UserPermResponse
@@ -84,6 +150,10 @@ func (m *MockRFAuthSaveUserPermsServer) Send(msg *ptypes.UserPermResponse) error
 	return nil
 }
 
+func (m *MockRFAuthSaveUserPermsServer) Context() context.Context {
+	return context.Background()
+}
+
 func (m *MockRFAuthSaveUserPermsServer) Recv() (*ptypes.UserPermRequest, error) {
 	if m.Count < 1 {
 		msg := ptypes.UserPermRequest{ID: 1, UserID: 1, PermID: 1}
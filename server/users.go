@@ -5,6 +5,7 @@ import (
 	"io"
 	"net/http"
 
+	"github.com/dhaifley/dauth/lib"
 	"github.com/dhaifley/dlib"
 	"github.com/dhaifley/dlib/dauth"
 	"github.com/dhaifley/dlib/ptypes"
@@ -14,6 +15,7 @@ import (
 // GetUsers returns a stream of users from the database.
 func (s *Server) GetUsers(req *ptypes.UserRequest,
 	stream ptypes.Auth_GetUsersServer) error {
+	ctx := stream.Context()
 	q := dauth.UserFind{}
 	if err := q.FromUserRequest(req); err != nil {
 		s.Log.WithFields(logrus.Fields{
@@ -24,7 +26,7 @@ func (s *Server) GetUsers(req *ptypes.UserRequest,
 		return err
 	}
 
-	ch := s.Users.GetUsers(&q)
+	ch := s.Users.GetUsers(ctx, &q)
 	for r := range ch {
 		if r.Err != nil {
 			s.Log.WithFields(logrus.Fields{
@@ -35,6 +37,10 @@ func (s *Server) GetUsers(req *ptypes.UserRequest,
 			return r.Err
 		}
 
+		if v, ok := r.Val.(dauth.User); ok {
+			r.Val = &v
+		}
+
 		switch v := r.Val.(type) {
 		case *dauth.User:
 			v.Pass = ""
@@ -64,6 +70,7 @@ func (s *Server) GetUsers(req *ptypes.UserRequest,
 // SaveUsers serializes a stream of users to the database.
 func (s *Server) SaveUsers(
 	stream ptypes.Auth_SaveUsersServer) error {
+	ctx := stream.Context()
 	count := 0
 	for {
 		req, err := stream.Recv()
@@ -101,7 +108,7 @@ func (s *Server) SaveUsers(
 				return err
 			}
 
-			v.Pass, err = dlib.EncryptString(dp)
+			v.Pass, err = lib.HashPassword(dp, s.PasswordCost)
 			if err != nil {
 				s.Log.WithFields(logrus.Fields{
 					"rpc":     "SaveUsers",
@@ -114,20 +121,27 @@ func (s *Server) SaveUsers(
 
 		}
 
-		ch := s.Users.SaveUser(&v)
+		id := v.ID
+		ch := s.Users.SaveUser(ctx, &v)
 		for r := range ch {
 			if r.Err != nil {
+				s.audit(ctx, "SaveUsers", req, r.Err)
 				s.Log.WithFields(logrus.Fields{
 					"rpc":     "SaveUsers",
 					"code":    http.StatusInternalServerError,
 					"request": req,
 					"count":   count,
-				}).Error(err)
-				return err
+				}).Error(r.Err)
+				return r.Err
 			}
 		}
 
+		// save_user replaces the row of an existing user with a new id,
+		// so the entries cached under the previous id are removed too.
+		s.Cache.InvalidateUser(id, v.ID)
+
 		v.Pass = ""
+		s.audit(ctx, "SaveUsers", userTarget(v.ID), nil)
 		res := v.ToResponse()
 		if err := stream.Send(&res); err != nil {
 			s.Log.WithFields(logrus.Fields{
@@ -145,7 +159,9 @@ func (s *Server) SaveUsers(
 }
 
 // DeleteUsers deletes users from the database.
-func (s *Server) DeleteUsers(ctx context.Context, req *ptypes.UserRequest) (*ptypes.DeleteResponse, error) {
+func (s *Server) DeleteUsers(ctx context.Context,
+	req *ptypes.UserRequest) (res *ptypes.DeleteResponse, err error) {
+	defer func() { s.audit(ctx, "DeleteUsers", req, err) }()
 	q := dauth.UserFind{}
 	if err := q.FromUserRequest(req); err != nil {
 		s.Log.WithFields(logrus.Fields{
@@ -156,7 +172,7 @@ func (s *Server) DeleteUsers(ctx context.Context, req *ptypes.UserRequest) (*pty
 		return nil, err
 	}
 
-	ch := s.Users.DeleteUsers(&q)
+	ch := s.Users.DeleteUsers(ctx, &q)
 	count := int64(0)
 	for r := range ch {
 		if r.Err != nil {
@@ -171,6 +187,12 @@ func (s *Server) DeleteUsers(ctx context.Context, req *ptypes.UserRequest) (*pty
 		count += int64(r.Num)
 	}
 
+	if q.ID != nil {
+		s.Cache.InvalidateUser(*q.ID)
+	} else {
+		s.Cache.InvalidateAll()
+	}
+
 	s.Log.WithFields(logrus.Fields{
 		"rpc":     "DeleteUsers",
 		"code":    http.StatusOK,
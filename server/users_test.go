@@ -4,23 +4,28 @@ import (
 	"context"
 	"io"
 	"testing"
+	"time"
 
 	"github.com/dhaifley/dlib"
-	"github.com/dhaifley/dlib/ptypes"
 	"github.com/dhaifley/dlib/dauth"
+	"github.com/dhaifley/dlib/ptypes"
 	"github.com/sirupsen/logrus/hooks/test"
 	"google.golang.org/grpc"
 )
 
 type MockUserAccess struct {
-	DBS dlib.SQLExecutor
+	DBS   dlib.SQLExecutor
+	Pass  string
+	Hash  string
+	NewID int64
 }
 
-func (m *MockUserAccess) GetUsers(opt *dauth.UserFind) <-chan dlib.Result {
+func (m *MockUserAccess) GetUsers(ctx context.Context,
+	opt *dauth.UserFind) <-chan dlib.Result {
 	ch := make(chan dlib.Result, 256)
 	go func() {
 		defer close(ch)
-		user := dauth.User{ID: 1, User: "test"}
+		user := dauth.User{ID: 1, User: "test", Pass: m.Pass}
 		r := dlib.Result{Val: &user}
 		ch <- r
 	}()
@@ -28,11 +33,13 @@ func (m *MockUserAccess) GetUsers(opt *dauth.UserFind) <-chan dlib.Result {
 	return ch
 }
 
-func (m *MockUserAccess) GetUserByID(id int64) <-chan dlib.Result {
-	return m.GetUsers(nil)
+func (m *MockUserAccess) GetUserByID(ctx context.Context,
+	id int64) <-chan dlib.Result {
+	return m.GetUsers(ctx, nil)
 }
 
-func (m *MockUserAccess) DeleteUsers(opt *dauth.UserFind) <-chan dlib.Result {
+func (m *MockUserAccess) DeleteUsers(ctx context.Context,
+	opt *dauth.UserFind) <-chan dlib.Result {
 	ch := make(chan dlib.Result, 256)
 	go func() {
 		defer close(ch)
@@ -43,15 +50,22 @@ func (m *MockUserAccess) DeleteUsers(opt *dauth.UserFind) <-chan dlib.Result {
 	return ch
 }
 
-func (m *MockUserAccess) DeleteUserByID(id int64) <-chan dlib.Result {
-	return m.DeleteUsers(nil)
+func (m *MockUserAccess) DeleteUserByID(ctx context.Context,
+	id int64) <-chan dlib.Result {
+	return m.DeleteUsers(ctx, nil)
 }
 
-func (m *MockUserAccess) SaveUser(a *dauth.User) <-chan dlib.Result {
+func (m *MockUserAccess) SaveUser(ctx context.Context,
+	a *dauth.User) <-chan dlib.Result {
 	ch := make(chan dlib.Result, 256)
 	go func() {
 		defer close(ch)
 		user := dauth.User{ID: 1, User: "test"}
+		if m.NewID != 0 && a != nil {
+			a.ID = m.NewID
+			user.ID = m.NewID
+		}
+
 		r := dlib.Result{Val: &user}
 		ch <- r
 	}()
@@ -59,8 +73,22 @@ func (m *MockUserAccess) SaveUser(a *dauth.User) <-chan dlib.Result {
 	return ch
 }
 
-func (m *MockUserAccess) SaveUsers(a []dauth.User) <-chan dlib.Result {
-	return m.SaveUser(nil)
+func (m *MockUserAccess) SaveUsers(ctx context.Context,
+	a []dauth.User) <-chan dlib.Result {
+	return m.SaveUser(ctx, nil)
+}
+
+func (m *MockUserAccess) SaveUserPass(ctx context.Context,
+	id int64, pass string) <-chan dlib.Result {
+	ch := make(chan dlib.Result, 256)
+	go func() {
+		defer close(ch)
+		m.Hash = pass
+		r := dlib.Result{Num: 1}
+		ch <- r
+	}()
+
+	return ch
 }
 
 type MockRFAuthGetUsersServer struct {
@@ -73,6 +101,10 @@ func (m *MockRFAuthGetUsersServer) Send(msg *ptypes.UserResponse) error {
 	return nil
 }
 
+func (m *MockRFAuthGetUsersServer) Context() context.Context {
+	return context.Background()
+}
+
 type MockRFAuthSaveUsersServer struct {
 	grpc.ServerStream
 	Results []ptypes.UserResponse
@@ -84,6 +116,10 @@ func (m *MockRFAuthSaveUsersServer) Send(msg *ptypes.UserResponse) error {
 	return nil
 }
 
+func (m *MockRFAuthSaveUsersServer) Context() context.Context {
+	return context.Background()
+}
+
 func (m *MockRFAuthSaveUsersServer) Recv() (*ptypes.UserRequest, error) {
 	if m.Count < 1 {
 		msg := ptypes.UserRequest{
@@ -127,6 +163,43 @@ func TestServerSaveUsers(t *testing.T) {
 	}
 }
 
+func TestServerSaveUsersInvalidatesCache(t *testing.T) {
+	mpa := MockPermAccess{Perms: map[int64]dauth.Perm{
+		1: {ID: 1, Service: "test", Name: "test"},
+	}}
+	lm, _ := test.NewNullLogger()
+	svr := Server{Users: &MockUserAccess{NewID: 2}, Tokens: &MockTokenAccess{},
+		Perms: &mpa, Cache: NewAuthCache(10, time.Minute), Log: lm}
+	svr.UserPerms = &MockUserPermAccess{Server: &svr}
+	req := ptypes.AuthRequest{
+		Token: &ptypes.TokenRequest{Token: "test"},
+		Perm:  &ptypes.PermRequest{Service: "test", Name: "test"},
+	}
+
+	if res, err := svr.Auth(context.Background(), &req); err != nil ||
+		!res.Ok {
+		t.Fatalf("Auth expected to allow the request, got: %v", err)
+	}
+
+	mpa.Perms[1] = dauth.Perm{ID: 1, Service: "other", Name: "other"}
+	if res, _ := svr.Auth(context.Background(), &req); !res.Ok {
+		t.Error("Cached perms expected before saving the user")
+	}
+
+	var stream MockRFAuthSaveUsersServer
+	if err := svr.SaveUsers(&stream); err != nil {
+		t.Fatal(err)
+	}
+
+	if stream.Results[0].ID != 2 {
+		t.Errorf("ID expected: 2, got %v", stream.Results[0].ID)
+	}
+
+	if res, _ := svr.Auth(context.Background(), &req); res.Ok {
+		t.Error("Perms of the previous user id expected to be invalidated")
+	}
+}
+
 func TestServerDeleteUsers(t *testing.T) {
 	ma := MockUserAccess{}
 	lm, _ := test.NewNullLogger()
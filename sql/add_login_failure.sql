@@ -0,0 +1,33 @@
+-- ============================================================================
+-- add_login_failure
+-- Counts a failed login for a key. Failures older than p_window seconds are
+-- forgotten.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.add_login_failure(
+	p_key CHARACTER VARYING,
+	p_window DOUBLE PRECISION)
+RETURNS TABLE(
+	"key" CHARACTER VARYING,
+	"count" INTEGER,
+	"last" TIMESTAMP WITH TIME ZONE)
+LANGUAGE 'plpgsql'
+AS $$
+BEGIN
+RETURN QUERY
+INSERT INTO login_failure AS f ("key", "count", "last")
+	VALUES (p_key, 1, now())
+ON CONFLICT ("key") DO UPDATE
+	SET "count" = CASE
+			WHEN f.last < now() - make_interval(secs => p_window) THEN 1
+			ELSE f.count + 1
+		END,
+		"last" = now()
+RETURNING f.key, f.count, f.last;
+END;
+$$;
+
+/* Test code:
+SELECT * FROM add_login_failure('user:test', 900)
+SELECT * FROM get_login_failure('user:test')
+SELECT delete_login_failures('user:test') AS num
+*/
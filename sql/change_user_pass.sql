@@ -0,0 +1,52 @@
+-- ============================================================================
+-- change_user_pass
+-- Replaces the password hash of a user, records it in the password history,
+-- keeping only the p_keep most recent hashes, and clears the must change
+-- flag of the user.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.change_user_pass(
+	p_id BIGINT,
+	p_pass CHARACTER VARYING,
+	p_keep BIGINT DEFAULT 5)
+RETURNS BIGINT
+LANGUAGE 'plpgsql'
+AS $$
+DECLARE
+	num BIGINT;
+BEGIN
+WITH n AS (
+	UPDATE "user" u
+	SET pass = p_pass
+	WHERE u.id = p_id
+	RETURNING *
+) SELECT INTO num COUNT(notify_invalidate('user', n.id::TEXT)) FROM n;
+IF num = 0 THEN
+	RETURN num;
+END IF;
+INSERT INTO password_history (user_id, pass, created)
+	VALUES (p_id, p_pass, now());
+DELETE FROM password_history h
+WHERE h.user_id = p_id
+	AND h.id NOT IN (
+		SELECT k.id
+		FROM password_history k
+		WHERE k.user_id = p_id
+		ORDER BY k.created DESC, k.id DESC
+		LIMIT GREATEST(p_keep, 0));
+INSERT INTO user_password AS p
+	(user_id, must_change, changed)
+	VALUES (p_id, false, now())
+ON CONFLICT (user_id) DO UPDATE
+	SET must_change = false,
+		changed = now();
+RETURN num;
+END;
+$$;
+
+/* Test code:
+SELECT save_user(1, 'test', 'test', 'test', 'test') AS id
+SELECT change_user_pass(1, 'test', 5) AS num
+SELECT * FROM get_password_history(1, 5)
+SELECT * FROM get_user_password(1)
+SELECT delete_users(NULL, 'test') AS num
+*/
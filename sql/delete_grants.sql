@@ -0,0 +1,36 @@
+-- ============================================================================
+-- delete_grants
+-- Deletes resource scoped permission grant records from the database.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.delete_grants(
+	p_id BIGINT DEFAULT NULL,
+	p_user_id BIGINT DEFAULT NULL,
+	p_role_id BIGINT DEFAULT NULL,
+	p_group_id BIGINT DEFAULT NULL,
+	p_perm_id BIGINT DEFAULT NULL)
+RETURNS BIGINT
+LANGUAGE 'plpgsql'
+AS $$
+DECLARE
+	num BIGINT;
+BEGIN
+WITH n AS (
+	DELETE FROM perm_grant g
+	WHERE g.id = COALESCE(p_id, g.id)
+		AND g.user_id = COALESCE(p_user_id, g.user_id)
+		AND g.role_id = COALESCE(p_role_id, g.role_id)
+		AND g.group_id = COALESCE(p_group_id, g.group_id)
+		AND g.perm_id = COALESCE(p_perm_id, g.perm_id)
+	RETURNING *
+) SELECT INTO num COUNT(*) FROM n;
+IF num > 0 THEN
+	PERFORM notify_invalidate('perms');
+END IF;
+RETURN num;
+END;
+$$;
+
+/* Test code:
+SELECT save_grant(1, 1, 0, 0, 1, 'project:42', '') AS id
+SELECT delete_grants(1) AS num
+*/
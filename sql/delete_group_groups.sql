@@ -0,0 +1,32 @@
+-- ============================================================================
+-- delete_group_groups
+-- Deletes group nesting records from the database.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.delete_group_groups(
+	p_id BIGINT DEFAULT NULL,
+	p_parent_id BIGINT DEFAULT NULL,
+	p_child_id BIGINT DEFAULT NULL)
+RETURNS BIGINT
+LANGUAGE 'plpgsql'
+AS $$
+DECLARE
+	num BIGINT;
+BEGIN
+WITH n AS (
+	DELETE FROM group_group gg
+	WHERE gg.id = COALESCE(p_id, gg.id)
+		AND gg.parent_id = COALESCE(p_parent_id, gg.parent_id)
+		AND gg.child_id = COALESCE(p_child_id, gg.child_id)
+	RETURNING *
+) SELECT INTO num COUNT(*) FROM n;
+IF num > 0 THEN
+	PERFORM notify_invalidate('perms');
+END IF;
+RETURN num;
+END;
+$$;
+
+/* Test code:
+SELECT save_group_group(1, 1, 2) AS id
+SELECT delete_group_groups(NULL, 1) AS num
+*/
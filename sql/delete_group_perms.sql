@@ -0,0 +1,32 @@
+-- ============================================================================
+-- delete_group_perms
+-- Deletes group permission grant records from the database.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.delete_group_perms(
+	p_id BIGINT DEFAULT NULL,
+	p_group_id BIGINT DEFAULT NULL,
+	p_perm_id BIGINT DEFAULT NULL)
+RETURNS BIGINT
+LANGUAGE 'plpgsql'
+AS $$
+DECLARE
+	num BIGINT;
+BEGIN
+WITH n AS (
+	DELETE FROM group_perm gp
+	WHERE gp.id = COALESCE(p_id, gp.id)
+		AND gp.group_id = COALESCE(p_group_id, gp.group_id)
+		AND gp.perm_id = COALESCE(p_perm_id, gp.perm_id)
+	RETURNING *
+) SELECT INTO num COUNT(*) FROM n;
+IF num > 0 THEN
+	PERFORM notify_invalidate('perms');
+END IF;
+RETURN num;
+END;
+$$;
+
+/* Test code:
+SELECT save_group_perm(1, 1, 2) AS id
+SELECT delete_group_perms(NULL, 1) AS num
+*/
@@ -0,0 +1,41 @@
+-- ============================================================================
+-- delete_groups
+-- Deletes group records, and the group_perm, user_group and group_group
+-- records referring to them, from the database.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.delete_groups(
+	p_id BIGINT DEFAULT NULL,
+	p_name CHARACTER VARYING DEFAULT NULL)
+RETURNS BIGINT
+LANGUAGE 'plpgsql'
+AS $$
+DECLARE
+	num BIGINT;
+BEGIN
+WITH n AS (
+	DELETE FROM "group" g
+	WHERE g.id = COALESCE(p_id, g.id)
+		AND g.name = COALESCE(p_name, g.name)
+	RETURNING *
+), gp AS (
+	DELETE FROM group_perm gp
+	WHERE gp.group_id IN (SELECT n.id FROM n)
+), ug AS (
+	DELETE FROM user_group ug
+	WHERE ug.group_id IN (SELECT n.id FROM n)
+), gg AS (
+	DELETE FROM group_group gg
+	WHERE gg.parent_id IN (SELECT n.id FROM n)
+		OR gg.child_id IN (SELECT n.id FROM n)
+) SELECT INTO num COUNT(*) FROM n;
+IF num > 0 THEN
+	PERFORM notify_invalidate('perms');
+END IF;
+RETURN num;
+END;
+$$;
+
+/* Test code:
+SELECT save_group(1, 'test', 'Test group') AS id
+SELECT delete_groups(NULL, 'test') AS num
+*/
@@ -0,0 +1,25 @@
+-- ============================================================================
+-- delete_login_failures
+-- Deletes the login failure record for a key from the database.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.delete_login_failures(
+	p_key CHARACTER VARYING)
+RETURNS BIGINT
+LANGUAGE 'plpgsql'
+AS $$
+DECLARE
+	num BIGINT;
+BEGIN
+WITH n AS (
+	DELETE FROM login_failure f
+	WHERE f.key = p_key
+	RETURNING *
+) SELECT INTO num COUNT(*) FROM n;
+RETURN num;
+END;
+$$;
+
+/* Test code:
+SELECT * FROM add_login_failure('user:test', 900)
+SELECT delete_login_failures('user:test') AS num
+*/
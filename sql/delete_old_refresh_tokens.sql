@@ -0,0 +1,31 @@
+-- ============================================================================
+-- delete_old_refresh_tokens
+-- Deletes at most p_limit refresh token records which expired before p_old.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.delete_old_refresh_tokens(
+	p_old TIMESTAMP WITH TIME ZONE,
+	p_limit BIGINT DEFAULT 1000)
+RETURNS BIGINT
+LANGUAGE 'plpgsql'
+AS $$
+DECLARE
+	num BIGINT;
+BEGIN
+WITH n AS (
+	DELETE FROM refresh_token r
+	WHERE r.id IN (
+		SELECT o.id
+		FROM refresh_token o
+		WHERE o.expires < p_old
+		ORDER BY o.expires
+		LIMIT p_limit)
+	RETURNING *
+) SELECT INTO num COUNT(*) FROM n;
+RETURN num;
+END;
+$$;
+
+/* Test code:
+SELECT save_refresh_token(-1, 'test', 'test', 1, 1, now(), now()) AS id
+SELECT delete_old_refresh_tokens(now() + interval '1 day', 100) AS num
+*/
@@ -0,0 +1,32 @@
+-- ============================================================================
+-- delete_old_revoked_tokens
+-- Deletes at most p_limit revocation records for tokens which expired before
+-- p_old, since expired tokens are refused without them.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.delete_old_revoked_tokens(
+	p_old TIMESTAMP WITH TIME ZONE,
+	p_limit BIGINT DEFAULT 1000)
+RETURNS BIGINT
+LANGUAGE 'plpgsql'
+AS $$
+DECLARE
+	num BIGINT;
+BEGIN
+WITH n AS (
+	DELETE FROM revoked_token r
+	WHERE r.jti IN (
+		SELECT o.jti
+		FROM revoked_token o
+		WHERE o.expires < p_old
+		ORDER BY o.expires
+		LIMIT p_limit)
+	RETURNING *
+) SELECT INTO num COUNT(*) FROM n;
+RETURN num;
+END;
+$$;
+
+/* Test code:
+SELECT revoke_token('test', 1, now() - interval '1 day') AS num
+SELECT delete_old_revoked_tokens(now(), 100) AS num
+*/
@@ -0,0 +1,37 @@
+-- ============================================================================
+-- delete_old_sessions
+-- Deletes at most p_limit session records created before p_old which have no
+-- refresh token expiring after p_old.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.delete_old_sessions(
+	p_old TIMESTAMP WITH TIME ZONE,
+	p_limit BIGINT DEFAULT 1000)
+RETURNS BIGINT
+LANGUAGE 'plpgsql'
+AS $$
+DECLARE
+	num BIGINT;
+BEGIN
+WITH n AS (
+	DELETE FROM session s
+	WHERE s.family IN (
+		SELECT o.family
+		FROM session o
+		WHERE o.created < p_old
+			AND NOT EXISTS (
+				SELECT 1
+				FROM refresh_token r
+				WHERE r.family = o.family
+					AND r.expires >= p_old)
+		ORDER BY o.created
+		LIMIT p_limit)
+	RETURNING *
+) SELECT INTO num COUNT(*) FROM n;
+RETURN num;
+END;
+$$;
+
+/* Test code:
+SELECT save_session('test', 1, '127.0.0.1', 'test', 'laptop') AS num
+SELECT delete_old_sessions(now() + interval '1 day', 100) AS num
+*/
@@ -0,0 +1,31 @@
+-- ============================================================================
+-- delete_old_tokens
+-- Deletes at most p_limit token records which expired before p_old.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.delete_old_tokens(
+	p_old TIMESTAMP WITH TIME ZONE,
+	p_limit BIGINT DEFAULT 1000)
+RETURNS BIGINT
+LANGUAGE 'plpgsql'
+AS $$
+DECLARE
+	num BIGINT;
+BEGIN
+WITH n AS (
+	DELETE FROM token t
+	WHERE t.id IN (
+		SELECT o.id
+		FROM token o
+		WHERE o.expires < p_old
+		ORDER BY o.expires
+		LIMIT p_limit)
+	RETURNING *
+) SELECT INTO num COUNT(*) FROM n;
+RETURN num;
+END;
+$$;
+
+/* Test code:
+SELECT save_token(-1, 'test', 1, now(), now() - interval '1 day') AS id
+SELECT delete_old_tokens(now(), 100) AS num
+*/
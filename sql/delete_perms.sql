@@ -21,6 +21,9 @@ WITH n AS (
 		AND p.name = COALESCE(p_name, p.name)
 	RETURNING *
 ) SELECT INTO num COUNT(*) FROM n;
+IF num > 0 THEN
+	PERFORM notify_invalidate('perms');
+END IF;
 RETURN num;
 END;
 $$
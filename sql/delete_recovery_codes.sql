@@ -0,0 +1,25 @@
+-- ============================================================================
+-- delete_recovery_codes
+-- Deletes the recovery codes of a user.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.delete_recovery_codes(
+	p_user_id BIGINT)
+RETURNS BIGINT
+LANGUAGE 'plpgsql'
+AS $$
+DECLARE
+	num BIGINT;
+BEGIN
+WITH n AS (
+	DELETE FROM recovery_code c
+	WHERE c.user_id = p_user_id
+	RETURNING *
+) SELECT INTO num COUNT(*) FROM n;
+RETURN num;
+END;
+$$;
+
+/* Test code:
+SELECT save_recovery_code(1, 'test') AS num
+SELECT delete_recovery_codes(1) AS num
+*/
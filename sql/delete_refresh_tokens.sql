@@ -0,0 +1,47 @@
+-- ============================================================================
+-- delete_refresh_tokens
+-- Deletes refresh token families, and the access tokens and sessions of
+-- them, from the database, announcing the deleted access tokens.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.delete_refresh_tokens(
+	p_id BIGINT DEFAULT NULL,
+	p_token CHARACTER VARYING DEFAULT NULL,
+	p_family CHARACTER VARYING DEFAULT NULL,
+	p_user_id BIGINT DEFAULT NULL,
+	p_access_token CHARACTER VARYING DEFAULT NULL)
+RETURNS BIGINT
+LANGUAGE 'plpgsql'
+AS $$
+DECLARE
+	num BIGINT;
+	families CHARACTER VARYING[];
+BEGIN
+SELECT INTO families ARRAY(
+	SELECT DISTINCT r.family
+	FROM get_refresh_tokens(p_id, p_token, p_family, p_user_id,
+		p_access_token) AS r);
+WITH d AS (
+	DELETE FROM token t
+	WHERE t.id IN (
+		SELECT r.token_id
+		FROM refresh_token r
+		WHERE r.family = ANY(families))
+	RETURNING t.token
+) SELECT INTO num COUNT(notify_invalidate('token',
+	encode(sha256(convert_to(d.token, 'UTF8')), 'hex'))) FROM d;
+DELETE FROM session s
+WHERE s.family = ANY(families);
+WITH n AS (
+	DELETE FROM refresh_token r
+	WHERE r.family = ANY(families)
+	RETURNING *
+) SELECT INTO num COUNT(*) FROM n;
+RETURN num;
+END;
+$$;
+
+/* Test code:
+SELECT save_refresh_token(-1, 'test', 'test', 1, 1, now(), now()) AS id
+SELECT * FROM refresh_token
+SELECT delete_refresh_tokens(NULL, NULL, 'test') AS num
+*/
@@ -0,0 +1,32 @@
+-- ============================================================================
+-- delete_role_perms
+-- Deletes role permission assignment records from the database.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.delete_role_perms(
+	p_id BIGINT DEFAULT NULL,
+	p_role_id BIGINT DEFAULT NULL,
+	p_perm_id BIGINT DEFAULT NULL)
+RETURNS BIGINT
+LANGUAGE 'plpgsql'
+AS $$
+DECLARE
+	num BIGINT;
+BEGIN
+WITH n AS (
+	DELETE FROM role_perm rp
+	WHERE rp.id = COALESCE(p_id, rp.id)
+		AND rp.role_id = COALESCE(p_role_id, rp.role_id)
+		AND rp.perm_id = COALESCE(p_perm_id, rp.perm_id)
+	RETURNING *
+) SELECT INTO num COUNT(*) FROM n;
+IF num > 0 THEN
+	PERFORM notify_invalidate('perms');
+END IF;
+RETURN num;
+END;
+$$;
+
+/* Test code:
+SELECT save_role_perm(1, 1, 1) AS id
+SELECT delete_role_perms(NULL, 1) AS num
+*/
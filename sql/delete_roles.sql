@@ -0,0 +1,37 @@
+-- ============================================================================
+-- delete_roles
+-- Deletes role records, and the role_perm and user_role records assigning
+-- them, from the database.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.delete_roles(
+	p_id BIGINT DEFAULT NULL,
+	p_name CHARACTER VARYING DEFAULT NULL)
+RETURNS BIGINT
+LANGUAGE 'plpgsql'
+AS $$
+DECLARE
+	num BIGINT;
+BEGIN
+WITH n AS (
+	DELETE FROM role r
+	WHERE r.id = COALESCE(p_id, r.id)
+		AND r.name = COALESCE(p_name, r.name)
+	RETURNING *
+), rp AS (
+	DELETE FROM role_perm rp
+	WHERE rp.role_id IN (SELECT n.id FROM n)
+), ur AS (
+	DELETE FROM user_role ur
+	WHERE ur.role_id IN (SELECT n.id FROM n)
+) SELECT INTO num COUNT(*) FROM n;
+IF num > 0 THEN
+	PERFORM notify_invalidate('perms');
+END IF;
+RETURN num;
+END;
+$$;
+
+/* Test code:
+SELECT save_role(1, 'test', 'Test role') AS id
+SELECT delete_roles(NULL, 'test') AS num
+*/
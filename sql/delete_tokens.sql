@@ -29,7 +29,8 @@ WITH n AS (
  		AND t.expires BETWEEN COALESCE(p_start, t.expires) AND COALESCE(p_end, t.expires)
  		AND t.expires < COALESCE(p_old, TIMESTAMP WITH TIME ZONE '12/31/2999')
 	RETURNING *
-) SELECT INTO num COUNT(*) FROM n;
+) SELECT INTO num COUNT(notify_invalidate('token',
+	encode(sha256(convert_to(n.token, 'UTF8')), 'hex'))) FROM n;
 RETURN num;
 END;
 $$
@@ -0,0 +1,29 @@
+-- ============================================================================
+-- delete_user_groups
+-- Deletes group membership records from the database.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.delete_user_groups(
+	p_id BIGINT DEFAULT NULL,
+	p_user_id BIGINT DEFAULT NULL,
+	p_group_id BIGINT DEFAULT NULL)
+RETURNS BIGINT
+LANGUAGE 'plpgsql'
+AS $$
+DECLARE
+	num BIGINT;
+BEGIN
+WITH n AS (
+	DELETE FROM user_group ug
+	WHERE ug.id = COALESCE(p_id, ug.id)
+		AND ug.user_id = COALESCE(p_user_id, ug.user_id)
+		AND ug.group_id = COALESCE(p_group_id, ug.group_id)
+	RETURNING *
+) SELECT INTO num COUNT(notify_invalidate('perms', n.user_id::TEXT)) FROM n;
+RETURN num;
+END;
+$$;
+
+/* Test code:
+SELECT save_user_group(1, 1, 2) AS id
+SELECT delete_user_groups(NULL, 1) AS num
+*/
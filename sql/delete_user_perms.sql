@@ -20,7 +20,7 @@ WITH n AS (
 		AND up.user_id = COALESCE(p_user_id, up.user_id)
 		AND up.perm_id = COALESCE(p_perm_id, up.perm_id)
 	RETURNING *
-) SELECT INTO num COUNT(*) FROM n;
+) SELECT INTO num COUNT(notify_invalidate('perms', n.user_id::TEXT)) FROM n;
 RETURN num;
 END;
 $$
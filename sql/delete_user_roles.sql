@@ -0,0 +1,29 @@
+-- ============================================================================
+-- delete_user_roles
+-- Deletes user role assignment records from the database.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.delete_user_roles(
+	p_id BIGINT DEFAULT NULL,
+	p_user_id BIGINT DEFAULT NULL,
+	p_role_id BIGINT DEFAULT NULL)
+RETURNS BIGINT
+LANGUAGE 'plpgsql'
+AS $$
+DECLARE
+	num BIGINT;
+BEGIN
+WITH n AS (
+	DELETE FROM user_role ur
+	WHERE ur.id = COALESCE(p_id, ur.id)
+		AND ur.user_id = COALESCE(p_user_id, ur.user_id)
+		AND ur.role_id = COALESCE(p_role_id, ur.role_id)
+	RETURNING *
+) SELECT INTO num COUNT(notify_invalidate('perms', n.user_id::TEXT)) FROM n;
+RETURN num;
+END;
+$$;
+
+/* Test code:
+SELECT save_user_role(1, 1, 1) AS id
+SELECT delete_user_roles(NULL, 1) AS num
+*/
@@ -24,7 +24,7 @@ WITH n AS (
 	AND u.name = COALESCE(p_name, u.name)
 	AND u.email = COALESCE(p_email, u.email)
 	RETURNING *
-) SELECT INTO num COUNT(*) FROM n;
+) SELECT INTO num COUNT(notify_invalidate('user', n.id::TEXT)) FROM n;
 RETURN num;
 END;
 $$
@@ -0,0 +1,56 @@
+-- ============================================================================
+-- get_audit_events
+-- Retrieves events of the audit log, in the order they were saved.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.get_audit_events(
+	p_actor_id BIGINT DEFAULT NULL,
+	p_actor CHARACTER VARYING DEFAULT NULL,
+	p_action CHARACTER VARYING DEFAULT NULL,
+	p_target CHARACTER VARYING DEFAULT NULL,
+	p_outcome CHARACTER VARYING DEFAULT NULL,
+	p_start TIMESTAMP WITH TIME ZONE DEFAULT NULL,
+	p_end TIMESTAMP WITH TIME ZONE DEFAULT NULL,
+	p_limit BIGINT DEFAULT NULL)
+RETURNS TABLE(
+	"id" BIGINT,
+	"actor_id" BIGINT,
+	"actor" CHARACTER VARYING,
+	"action" CHARACTER VARYING,
+	"target" CHARACTER VARYING,
+	"outcome" CHARACTER VARYING,
+	"peer" CHARACTER VARYING,
+	"created" TIMESTAMP WITH TIME ZONE,
+	"prev_hash" CHARACTER VARYING,
+	"hash" CHARACTER VARYING)
+LANGUAGE 'plpgsql'
+AS $$
+BEGIN
+RETURN QUERY
+SELECT
+	a.id,
+	a.actor_id,
+	a.actor,
+	a.action,
+	a.target,
+	a.outcome,
+	a.peer,
+	a.created,
+	a.prev_hash,
+	a.hash
+FROM audit_event a
+WHERE a.actor_id = COALESCE(p_actor_id, a.actor_id)
+	AND a.actor = COALESCE(p_actor, a.actor)
+	AND a.action = COALESCE(p_action, a.action)
+	AND a.target = COALESCE(p_target, a.target)
+	AND a.outcome = COALESCE(p_outcome, a.outcome)
+	AND a.created BETWEEN COALESCE(p_start, a.created) AND COALESCE(p_end, a.created)
+ORDER BY a.id
+LIMIT p_limit;
+END;
+$$;
+
+/* Test code:
+SELECT * FROM get_audit_events()
+SELECT * FROM get_audit_events(NULL, 'test', 'Login', NULL, 'failure')
+SELECT * FROM get_audit_events(p_start := now() - interval '1 day')
+*/
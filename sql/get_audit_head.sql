@@ -0,0 +1,23 @@
+-- ============================================================================
+-- get_audit_head
+-- Retrieves the hash of the last event of the audit log, or an empty string
+-- when the audit log is empty.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.get_audit_head()
+RETURNS CHARACTER VARYING
+LANGUAGE 'plpgsql'
+AS $$
+DECLARE
+	head CHARACTER VARYING;
+BEGIN
+SELECT a.hash INTO head
+FROM audit_event a
+ORDER BY a.id DESC
+LIMIT 1;
+RETURN COALESCE(head, '');
+END;
+$$;
+
+/* Test code:
+SELECT get_audit_head() AS hash
+*/
@@ -0,0 +1,44 @@
+-- ============================================================================
+-- get_grants
+-- Retrieves resource scoped permission grant records from the database.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.get_grants(
+	p_id BIGINT DEFAULT NULL,
+	p_user_id BIGINT DEFAULT NULL,
+	p_role_id BIGINT DEFAULT NULL,
+	p_group_id BIGINT DEFAULT NULL,
+	p_perm_id BIGINT DEFAULT NULL)
+RETURNS TABLE(
+	"id" BIGINT,
+	"user_id" BIGINT,
+	"role_id" BIGINT,
+	"group_id" BIGINT,
+	"perm_id" BIGINT,
+	"resource" CHARACTER VARYING,
+	"conditions" TEXT)
+LANGUAGE 'plpgsql'
+AS $$
+BEGIN
+RETURN QUERY
+SELECT
+	g.id,
+	g.user_id,
+	g.role_id,
+	g.group_id,
+	g.perm_id,
+	g.resource,
+	g.conditions
+FROM perm_grant g
+WHERE g.id = COALESCE(p_id, g.id)
+		AND g.user_id = COALESCE(p_user_id, g.user_id)
+		AND g.role_id = COALESCE(p_role_id, g.role_id)
+		AND g.group_id = COALESCE(p_group_id, g.group_id)
+		AND g.perm_id = COALESCE(p_perm_id, g.perm_id);
+END;
+$$;
+
+/* Test code:
+SELECT save_grant(1, 1, 0, 0, 1, 'project:42', '') AS id
+SELECT * FROM get_grants(NULL, 1)
+SELECT delete_grants(NULL, 1) AS num
+*/
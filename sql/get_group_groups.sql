@@ -0,0 +1,32 @@
+-- ============================================================================
+-- get_group_groups
+-- Retrieves group nesting records from the database.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.get_group_groups(
+	p_id BIGINT DEFAULT NULL,
+	p_parent_id BIGINT DEFAULT NULL,
+	p_child_id BIGINT DEFAULT NULL)
+RETURNS TABLE(
+	"id" BIGINT,
+	"parent_id" BIGINT,
+	"child_id" BIGINT)
+LANGUAGE 'plpgsql'
+AS $$
+BEGIN
+RETURN QUERY
+SELECT
+	gg.id,
+	gg.parent_id,
+	gg.child_id
+FROM group_group gg
+WHERE gg.id = COALESCE(p_id, gg.id)
+		AND gg.parent_id = COALESCE(p_parent_id, gg.parent_id)
+		AND gg.child_id = COALESCE(p_child_id, gg.child_id);
+END;
+$$;
+
+/* Test code:
+SELECT save_group_group(1, 1, 2) AS id
+SELECT * FROM get_group_groups(NULL, 1)
+SELECT delete_group_groups(NULL, 1) AS num
+*/
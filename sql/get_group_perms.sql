@@ -0,0 +1,32 @@
+-- ============================================================================
+-- get_group_perms
+-- Retrieves group permission grant records from the database.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.get_group_perms(
+	p_id BIGINT DEFAULT NULL,
+	p_group_id BIGINT DEFAULT NULL,
+	p_perm_id BIGINT DEFAULT NULL)
+RETURNS TABLE(
+	"id" BIGINT,
+	"group_id" BIGINT,
+	"perm_id" BIGINT)
+LANGUAGE 'plpgsql'
+AS $$
+BEGIN
+RETURN QUERY
+SELECT
+	gp.id,
+	gp.group_id,
+	gp.perm_id
+FROM group_perm gp
+WHERE gp.id = COALESCE(p_id, gp.id)
+		AND gp.group_id = COALESCE(p_group_id, gp.group_id)
+		AND gp.perm_id = COALESCE(p_perm_id, gp.perm_id);
+END;
+$$;
+
+/* Test code:
+SELECT save_group_perm(1, 1, 2) AS id
+SELECT * FROM get_group_perms(NULL, 1)
+SELECT delete_group_perms(NULL, 1) AS num
+*/
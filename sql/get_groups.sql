@@ -0,0 +1,30 @@
+-- ============================================================================
+-- get_groups
+-- Retrieves group records from the database.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.get_groups(
+	p_id BIGINT DEFAULT NULL,
+	p_name CHARACTER VARYING DEFAULT NULL)
+RETURNS TABLE(
+	"id" BIGINT,
+	"name" CHARACTER VARYING,
+	"description" CHARACTER VARYING)
+LANGUAGE 'plpgsql'
+AS $$
+BEGIN
+RETURN QUERY
+SELECT
+	g.id,
+	g.name,
+	g.description
+FROM "group" g
+WHERE g.id = COALESCE(p_id, g.id)
+		AND g.name = COALESCE(p_name, g.name);
+END;
+$$;
+
+/* Test code:
+SELECT save_group(1, 'test', 'Test group') AS id
+SELECT * FROM get_groups(NULL, 'test')
+SELECT delete_groups(NULL, 'test') AS num
+*/
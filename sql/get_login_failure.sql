@@ -0,0 +1,28 @@
+-- ============================================================================
+-- get_login_failure
+-- Retrieves the login failure record for a key from the database.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.get_login_failure(
+	p_key CHARACTER VARYING)
+RETURNS TABLE(
+	"key" CHARACTER VARYING,
+	"count" INTEGER,
+	"last" TIMESTAMP WITH TIME ZONE)
+LANGUAGE 'plpgsql'
+AS $$
+BEGIN
+RETURN QUERY
+SELECT
+	f.key,
+	f.count,
+	f.last
+FROM login_failure f
+WHERE f.key = p_key;
+END;
+$$;
+
+/* Test code:
+SELECT * FROM add_login_failure('user:test', 900)
+SELECT * FROM get_login_failure('user:test')
+SELECT delete_login_failures('user:test') AS num
+*/
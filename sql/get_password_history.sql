@@ -0,0 +1,26 @@
+-- ============================================================================
+-- get_password_history
+-- Retrieves the p_limit most recent password hashes of a user.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.get_password_history(
+	p_user_id BIGINT,
+	p_limit BIGINT DEFAULT 5)
+RETURNS TABLE(
+	"pass" CHARACTER VARYING)
+LANGUAGE 'plpgsql'
+AS $$
+BEGIN
+RETURN QUERY
+SELECT
+	h.pass
+FROM password_history h
+WHERE h.user_id = p_user_id
+ORDER BY h.created DESC, h.id DESC
+LIMIT p_limit;
+END;
+$$;
+
+/* Test code:
+SELECT change_user_pass(1, 'test', 5) AS num
+SELECT * FROM get_password_history(1, 5)
+*/
@@ -0,0 +1,50 @@
+-- ============================================================================
+-- get_refresh_tokens
+-- Retrieves refresh token records from the database.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.get_refresh_tokens(
+	p_id BIGINT DEFAULT NULL,
+	p_token CHARACTER VARYING DEFAULT NULL,
+	p_family CHARACTER VARYING DEFAULT NULL,
+	p_user_id BIGINT DEFAULT NULL,
+	p_access_token CHARACTER VARYING DEFAULT NULL)
+RETURNS TABLE(
+	"id" BIGINT,
+	"token" CHARACTER VARYING,
+	"family" CHARACTER VARYING,
+	"user_id" BIGINT,
+	"token_id" BIGINT,
+	"created" TIMESTAMP WITH TIME ZONE,
+	"expires" TIMESTAMP WITH TIME ZONE,
+	"used" TIMESTAMP WITH TIME ZONE)
+LANGUAGE 'plpgsql'
+AS $$
+BEGIN
+RETURN QUERY
+SELECT
+	r.id,
+	r.token,
+	r.family,
+	r.user_id,
+	r.token_id,
+	r.created,
+	r.expires,
+	r.used
+FROM refresh_token r
+WHERE r.id = COALESCE(p_id, r.id)
+	AND r.token = COALESCE(p_token, r.token)
+	AND r.family = COALESCE(p_family, r.family)
+	AND r.user_id = COALESCE(p_user_id, r.user_id)
+	AND (p_access_token IS NULL OR r.family IN (
+		SELECT rt.family
+		FROM refresh_token rt
+			INNER JOIN token t ON t.id = rt.token_id
+		WHERE t.token = p_access_token));
+END;
+$$
+
+/* Test code:
+SELECT save_refresh_token(-1, 'test', 'test', 1, 1, now(), now()) AS id
+SELECT * FROM get_refresh_tokens(NULL, 'test')
+SELECT delete_refresh_tokens(NULL, NULL, 'test') AS num
+*/
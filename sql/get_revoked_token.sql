@@ -0,0 +1,30 @@
+-- ============================================================================
+-- get_revoked_token
+-- Retrieves the revocation record for a token id from the database.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.get_revoked_token(
+	p_jti CHARACTER VARYING)
+RETURNS TABLE(
+	jti CHARACTER VARYING,
+	user_id BIGINT,
+	expires TIMESTAMP WITH TIME ZONE,
+	created TIMESTAMP WITH TIME ZONE)
+LANGUAGE 'plpgsql'
+AS $$
+BEGIN
+RETURN QUERY
+SELECT
+	r.jti,
+	r.user_id,
+	r.expires,
+	r.created
+FROM revoked_token r
+WHERE r.jti = p_jti;
+END;
+$$;
+
+/* Test code:
+SELECT revoke_token('test', 1, now() + interval '1 day') AS num
+SELECT * FROM get_revoked_token('test')
+SELECT delete_old_revoked_tokens(now() + interval '2 days') AS num
+*/
@@ -0,0 +1,32 @@
+-- ============================================================================
+-- get_role_perms
+-- Retrieves role permission assignment records from the database.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.get_role_perms(
+	p_id BIGINT DEFAULT NULL,
+	p_role_id BIGINT DEFAULT NULL,
+	p_perm_id BIGINT DEFAULT NULL)
+RETURNS TABLE(
+	"id" BIGINT,
+	"role_id" BIGINT,
+	"perm_id" BIGINT)
+LANGUAGE 'plpgsql'
+AS $$
+BEGIN
+RETURN QUERY
+SELECT
+	rp.id,
+	rp.role_id,
+	rp.perm_id
+FROM role_perm rp
+WHERE rp.id = COALESCE(p_id, rp.id)
+		AND rp.role_id = COALESCE(p_role_id, rp.role_id)
+		AND rp.perm_id = COALESCE(p_perm_id, rp.perm_id);
+END;
+$$;
+
+/* Test code:
+SELECT save_role_perm(1, 1, 1) AS id
+SELECT * FROM get_role_perms(NULL, 1)
+SELECT delete_role_perms(NULL, 1) AS num
+*/
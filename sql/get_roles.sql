@@ -0,0 +1,30 @@
+-- ============================================================================
+-- get_roles
+-- Retrieves role records from the database.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.get_roles(
+	p_id BIGINT DEFAULT NULL,
+	p_name CHARACTER VARYING DEFAULT NULL)
+RETURNS TABLE(
+	"id" BIGINT,
+	"name" CHARACTER VARYING,
+	"description" CHARACTER VARYING)
+LANGUAGE 'plpgsql'
+AS $$
+BEGIN
+RETURN QUERY
+SELECT
+	r.id,
+	r.name,
+	r.description
+FROM role r
+WHERE r.id = COALESCE(p_id, r.id)
+		AND r.name = COALESCE(p_name, r.name);
+END;
+$$;
+
+/* Test code:
+SELECT save_role(1, 'test', 'Test role') AS id
+SELECT * FROM get_roles(NULL, 'test')
+SELECT delete_roles(NULL, 'test') AS num
+*/
@@ -0,0 +1,45 @@
+-- ============================================================================
+-- get_sessions
+-- Retrieves the login sessions of a user which have not expired, with the
+-- expiry of their latest refresh token.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.get_sessions(
+	p_user_id BIGINT,
+	p_family CHARACTER VARYING DEFAULT NULL)
+RETURNS TABLE(
+	"family" CHARACTER VARYING,
+	"user_id" BIGINT,
+	"address" CHARACTER VARYING,
+	"user_agent" CHARACTER VARYING,
+	"device" CHARACTER VARYING,
+	"created" TIMESTAMP WITH TIME ZONE,
+	"last_used" TIMESTAMP WITH TIME ZONE,
+	"expires" TIMESTAMP WITH TIME ZONE)
+LANGUAGE 'plpgsql'
+AS $$
+BEGIN
+RETURN QUERY
+SELECT
+	s.family,
+	s.user_id,
+	s.address,
+	s.user_agent,
+	s.device,
+	s.created,
+	s.last_used,
+	MAX(r.expires)
+FROM session s
+	INNER JOIN refresh_token r ON r.family = s.family
+WHERE s.user_id = p_user_id
+	AND s.family = COALESCE(p_family, s.family)
+GROUP BY s.family
+HAVING MAX(r.expires) > now()
+ORDER BY s.last_used DESC;
+END;
+$$;
+
+/* Test code:
+SELECT save_session('test', 1, '127.0.0.1', 'test', 'laptop') AS num
+SELECT * FROM get_sessions(1)
+SELECT * FROM get_sessions(1, 'test')
+*/
@@ -0,0 +1,31 @@
+-- ============================================================================
+-- get_token_stats
+-- Counts the access tokens and unused refresh tokens which have not expired,
+-- and the sessions they belong to.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.get_token_stats()
+RETURNS TABLE(
+	"tokens" BIGINT,
+	"refresh_tokens" BIGINT,
+	"sessions" BIGINT)
+LANGUAGE 'plpgsql'
+AS $$
+BEGIN
+RETURN QUERY
+SELECT
+	(SELECT COUNT(*)
+		FROM token t
+		WHERE t.expires > now()),
+	(SELECT COUNT(*)
+		FROM refresh_token r
+		WHERE r.expires > now()
+			AND r.used IS NULL),
+	(SELECT COUNT(DISTINCT r.family)
+		FROM refresh_token r
+		WHERE r.expires > now());
+END;
+$$;
+
+/* Test code:
+SELECT * FROM get_token_stats()
+*/
@@ -0,0 +1,56 @@
+-- ============================================================================
+-- get_user_effective_perms
+-- Retrieves the permission records a user holds directly, through the
+-- user's roles, and through the groups the user belongs to, directly or
+-- through nested groups, from the database in one query. Each permission is
+-- returned once. Deny permissions are returned first, so that callers can
+-- stop reading at the first exact match once they are past them.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.get_user_effective_perms(
+	p_user_id BIGINT)
+RETURNS TABLE(
+	"id" BIGINT,
+	"service" CHARACTER VARYING,
+	"name" CHARACTER VARYING)
+LANGUAGE 'plpgsql'
+AS $$
+BEGIN
+RETURN QUERY
+WITH RECURSIVE g(group_id) AS (
+	SELECT ug.group_id
+	FROM user_group ug
+	WHERE ug.user_id = p_user_id
+	UNION
+	SELECT gg.parent_id
+	FROM group_group gg
+	JOIN g ON gg.child_id = g.group_id
+), ids(perm_id) AS (
+	SELECT up.perm_id
+	FROM user_perm up
+	WHERE up.user_id = p_user_id
+	UNION
+	SELECT rp.perm_id
+	FROM user_role ur
+	JOIN role_perm rp ON rp.role_id = ur.role_id
+	WHERE ur.user_id = p_user_id
+	UNION
+	SELECT gp.perm_id
+	FROM g
+	JOIN group_perm gp ON gp.group_id = g.group_id
+)
+SELECT
+	p.id,
+	p.service,
+	p.name
+FROM ids
+JOIN perm p ON p.id = ids.perm_id
+ORDER BY LEFT(p.service, 1) = '!' DESC, p.id;
+END;
+$$;
+
+/* Test code:
+SELECT save_user_perm(1, 1, 1) AS id
+SELECT save_user_role(1, 1, 1) AS id
+SELECT save_role_perm(1, 1, 2) AS id
+SELECT * FROM get_user_effective_perms(1)
+*/
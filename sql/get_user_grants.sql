@@ -0,0 +1,50 @@
+-- ============================================================================
+-- get_user_grants
+-- Retrieves the resource scoped permission grant records given to a user
+-- directly, through the user's roles, and through the groups the user
+-- belongs to, directly or by nesting, from the database.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.get_user_grants(
+	p_user_id BIGINT)
+RETURNS TABLE(
+	"id" BIGINT,
+	"user_id" BIGINT,
+	"role_id" BIGINT,
+	"group_id" BIGINT,
+	"perm_id" BIGINT,
+	"resource" CHARACTER VARYING,
+	"conditions" TEXT)
+LANGUAGE 'plpgsql'
+AS $$
+BEGIN
+RETURN QUERY
+WITH RECURSIVE gr(group_id) AS (
+	SELECT ug.group_id
+	FROM user_group ug
+	WHERE ug.user_id = p_user_id
+	UNION
+	SELECT gg.parent_id
+	FROM group_group gg
+	JOIN gr ON gg.child_id = gr.group_id
+)
+SELECT
+	g.id,
+	g.user_id,
+	g.role_id,
+	g.group_id,
+	g.perm_id,
+	g.resource,
+	g.conditions
+FROM perm_grant g
+WHERE g.user_id = p_user_id
+	OR g.role_id IN (
+		SELECT ur.role_id FROM user_role ur WHERE ur.user_id = p_user_id)
+	OR g.group_id IN (SELECT gr.group_id FROM gr);
+END;
+$$;
+
+/* Test code:
+SELECT save_grant(1, 0, 1, 0, 1, 'project:42', '') AS id
+SELECT save_user_role(1, 1, 1) AS id
+SELECT * FROM get_user_grants(1)
+*/
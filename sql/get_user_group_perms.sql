@@ -0,0 +1,40 @@
+-- ============================================================================
+-- get_user_group_perms
+-- Retrieves the group permission grant records of all groups a user belongs
+-- to, directly or through nested groups, from the database. UNION discards
+-- groups already visited, so nesting cycles end the recursion.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.get_user_group_perms(
+	p_user_id BIGINT)
+RETURNS TABLE(
+	"id" BIGINT,
+	"group_id" BIGINT,
+	"perm_id" BIGINT)
+LANGUAGE 'plpgsql'
+AS $$
+BEGIN
+RETURN QUERY
+WITH RECURSIVE g(group_id) AS (
+	SELECT ug.group_id
+	FROM user_group ug
+	WHERE ug.user_id = p_user_id
+	UNION
+	SELECT gg.parent_id
+	FROM group_group gg
+	JOIN g ON gg.child_id = g.group_id
+)
+SELECT
+	gp.id,
+	gp.group_id,
+	gp.perm_id
+FROM g
+JOIN group_perm gp ON gp.group_id = g.group_id;
+END;
+$$;
+
+/* Test code:
+SELECT save_user_group(1, 1, 2) AS id
+SELECT save_group_group(1, 1, 2) AS id
+SELECT save_group_perm(1, 1, 1) AS id
+SELECT * FROM get_user_group_perms(1)
+*/
@@ -0,0 +1,32 @@
+-- ============================================================================
+-- get_user_groups
+-- Retrieves group membership records from the database.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.get_user_groups(
+	p_id BIGINT DEFAULT NULL,
+	p_user_id BIGINT DEFAULT NULL,
+	p_group_id BIGINT DEFAULT NULL)
+RETURNS TABLE(
+	"id" BIGINT,
+	"user_id" BIGINT,
+	"group_id" BIGINT)
+LANGUAGE 'plpgsql'
+AS $$
+BEGIN
+RETURN QUERY
+SELECT
+	ug.id,
+	ug.user_id,
+	ug.group_id
+FROM user_group ug
+WHERE ug.id = COALESCE(p_id, ug.id)
+		AND ug.user_id = COALESCE(p_user_id, ug.user_id)
+		AND ug.group_id = COALESCE(p_group_id, ug.group_id);
+END;
+$$;
+
+/* Test code:
+SELECT save_user_group(1, 1, 2) AS id
+SELECT * FROM get_user_groups(NULL, 1)
+SELECT delete_user_groups(NULL, 1) AS num
+*/
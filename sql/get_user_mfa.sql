@@ -0,0 +1,33 @@
+-- ============================================================================
+-- get_user_mfa
+-- Retrieves the two-factor authentication record of a user.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.get_user_mfa(
+	p_user_id BIGINT)
+RETURNS TABLE(
+	"user_id" BIGINT,
+	"secret" CHARACTER VARYING,
+	"enabled" BOOLEAN,
+	"required" BOOLEAN,
+	"last_step" BIGINT,
+	"created" TIMESTAMP WITH TIME ZONE)
+LANGUAGE 'plpgsql'
+AS $$
+BEGIN
+RETURN QUERY
+SELECT
+	m.user_id,
+	m.secret,
+	m.enabled,
+	m.required,
+	m.last_step,
+	m.created
+FROM user_mfa m
+WHERE m.user_id = p_user_id;
+END;
+$$;
+
+/* Test code:
+SELECT save_user_mfa(1, 'TEST', false, true, 0, now()) AS num
+SELECT * FROM get_user_mfa(1)
+*/
@@ -0,0 +1,27 @@
+-- ============================================================================
+-- get_user_password
+-- Retrieves the password settings of a user.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.get_user_password(
+	p_user_id BIGINT)
+RETURNS TABLE(
+	"user_id" BIGINT,
+	"must_change" BOOLEAN,
+	"changed" TIMESTAMP WITH TIME ZONE)
+LANGUAGE 'plpgsql'
+AS $$
+BEGIN
+RETURN QUERY
+SELECT
+	p.user_id,
+	p.must_change,
+	p.changed
+FROM user_password p
+WHERE p.user_id = p_user_id;
+END;
+$$;
+
+/* Test code:
+SELECT save_user_password(1, true) AS num
+SELECT * FROM get_user_password(1)
+*/
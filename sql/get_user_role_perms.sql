@@ -0,0 +1,30 @@
+-- ============================================================================
+-- get_user_role_perms
+-- Retrieves the role permission assignment records of all roles held by a
+-- user from the database.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.get_user_role_perms(
+	p_user_id BIGINT)
+RETURNS TABLE(
+	"id" BIGINT,
+	"role_id" BIGINT,
+	"perm_id" BIGINT)
+LANGUAGE 'plpgsql'
+AS $$
+BEGIN
+RETURN QUERY
+SELECT
+	rp.id,
+	rp.role_id,
+	rp.perm_id
+FROM user_role ur
+JOIN role_perm rp ON rp.role_id = ur.role_id
+WHERE ur.user_id = p_user_id;
+END;
+$$;
+
+/* Test code:
+SELECT save_role_perm(1, 1, 1) AS id
+SELECT save_user_role(1, 1, 1) AS id
+SELECT * FROM get_user_role_perms(1)
+*/
@@ -0,0 +1,32 @@
+-- ============================================================================
+-- get_user_roles
+-- Retrieves user role assignment records from the database.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.get_user_roles(
+	p_id BIGINT DEFAULT NULL,
+	p_user_id BIGINT DEFAULT NULL,
+	p_role_id BIGINT DEFAULT NULL)
+RETURNS TABLE(
+	"id" BIGINT,
+	"user_id" BIGINT,
+	"role_id" BIGINT)
+LANGUAGE 'plpgsql'
+AS $$
+BEGIN
+RETURN QUERY
+SELECT
+	ur.id,
+	ur.user_id,
+	ur.role_id
+FROM user_role ur
+WHERE ur.id = COALESCE(p_id, ur.id)
+		AND ur.user_id = COALESCE(p_user_id, ur.user_id)
+		AND ur.role_id = COALESCE(p_role_id, ur.role_id);
+END;
+$$;
+
+/* Test code:
+SELECT save_user_role(1, 1, 1) AS id
+SELECT * FROM get_user_roles(NULL, 1)
+SELECT delete_user_roles(NULL, 1) AS num
+*/
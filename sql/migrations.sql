@@ -70,7 +70,7 @@ CREATE UNIQUE INDEX ix_perm_service_name
 CREATE TABLE public.token
 (
     id bigint NOT NULL,
-    token character varying(255) COLLATE pg_catalog."default" NOT NULL,
+    token character varying COLLATE pg_catalog."default" NOT NULL,
     user_id bigint NOT NULL,
     created timestamp with time zone,
     expires timestamp with time zone,
@@ -84,6 +84,11 @@ TABLESPACE pg_default;
 ALTER TABLE public.token
     OWNER to dauth;
 
+-- Signed tokens are longer than the 255 characters allowed by the first
+-- version of the schema.
+ALTER TABLE public.token
+    ALTER COLUMN token TYPE character varying COLLATE pg_catalog."default";
+
 -- Index: ix_token_created
 
 -- DROP INDEX public.ix_token_created;
@@ -249,3 +254,561 @@ CREATE UNIQUE INDEX ix_user_perm_user_id_perm_id
     ON public.user_perm USING btree
     (user_id, perm_id)
     TABLESPACE pg_default;
+
+-- Table: public.refresh_token
+
+-- DROP TABLE public.refresh_token;
+
+CREATE TABLE public.refresh_token
+(
+    id bigint NOT NULL,
+    token character varying(64) COLLATE pg_catalog."default" NOT NULL,
+    family character varying(32) COLLATE pg_catalog."default" NOT NULL,
+    user_id bigint NOT NULL,
+    token_id bigint NOT NULL,
+    created timestamp with time zone,
+    expires timestamp with time zone,
+    used timestamp with time zone,
+    CONSTRAINT refresh_token_pkey PRIMARY KEY (id)
+)
+WITH (
+    OIDS = FALSE
+)
+TABLESPACE pg_default;
+
+ALTER TABLE public.refresh_token
+    OWNER to dauth;
+
+-- Index: ix_refresh_token_id
+
+-- DROP INDEX public.ix_refresh_token_id;
+
+CREATE UNIQUE INDEX ix_refresh_token_id
+    ON public.refresh_token USING btree
+    (id)
+    TABLESPACE pg_default;
+
+ALTER TABLE public.refresh_token
+    CLUSTER ON ix_refresh_token_id;
+
+-- Index: ix_refresh_token_token
+
+-- DROP INDEX public.ix_refresh_token_token;
+
+CREATE UNIQUE INDEX ix_refresh_token_token
+    ON public.refresh_token USING btree
+    (token COLLATE pg_catalog."default")
+    TABLESPACE pg_default;
+
+-- Index: ix_refresh_token_family
+
+-- DROP INDEX public.ix_refresh_token_family;
+
+CREATE INDEX ix_refresh_token_family
+    ON public.refresh_token USING btree
+    (family COLLATE pg_catalog."default")
+    TABLESPACE pg_default;
+
+-- Index: ix_refresh_token_user_id
+
+-- DROP INDEX public.ix_refresh_token_user_id;
+
+CREATE INDEX ix_refresh_token_user_id
+    ON public.refresh_token USING btree
+    (user_id)
+    TABLESPACE pg_default;
+
+-- Index: ix_refresh_token_token_id
+
+-- DROP INDEX public.ix_refresh_token_token_id;
+
+CREATE INDEX ix_refresh_token_token_id
+    ON public.refresh_token USING btree
+    (token_id)
+    TABLESPACE pg_default;
+
+-- Table: public.login_failure
+
+-- DROP TABLE public.login_failure;
+
+CREATE TABLE public.login_failure
+(
+    key character varying(128) COLLATE pg_catalog."default" NOT NULL,
+    count integer NOT NULL,
+    last timestamp with time zone,
+    CONSTRAINT login_failure_pkey PRIMARY KEY (key)
+)
+WITH (
+    OIDS = FALSE
+)
+TABLESPACE pg_default;
+
+ALTER TABLE public.login_failure
+    OWNER to dauth;
+
+-- Table: public.user_mfa
+
+-- DROP TABLE public.user_mfa;
+
+CREATE TABLE public.user_mfa
+(
+    user_id bigint NOT NULL,
+    secret character varying(64) COLLATE pg_catalog."default" NOT NULL,
+    enabled boolean NOT NULL DEFAULT false,
+    required boolean NOT NULL DEFAULT false,
+    last_step bigint NOT NULL DEFAULT 0,
+    created timestamp with time zone,
+    CONSTRAINT user_mfa_pkey PRIMARY KEY (user_id)
+)
+WITH (
+    OIDS = FALSE
+)
+TABLESPACE pg_default;
+
+ALTER TABLE public.user_mfa
+    OWNER to dauth;
+
+-- Table: public.recovery_code
+
+-- DROP TABLE public.recovery_code;
+
+CREATE TABLE public.recovery_code
+(
+    user_id bigint NOT NULL,
+    code character varying(64) COLLATE pg_catalog."default" NOT NULL,
+    used timestamp with time zone,
+    CONSTRAINT recovery_code_pkey PRIMARY KEY (user_id, code)
+)
+WITH (
+    OIDS = FALSE
+)
+TABLESPACE pg_default;
+
+ALTER TABLE public.recovery_code
+    OWNER to dauth;
+
+-- Table: public.role
+
+-- DROP TABLE public.role;
+
+CREATE TABLE public.role
+(
+    id bigint NOT NULL,
+    name character varying(255) COLLATE pg_catalog."default" NOT NULL,
+    description character varying(1024) COLLATE pg_catalog."default" NOT NULL DEFAULT ''::character varying,
+    CONSTRAINT role_pkey PRIMARY KEY (id)
+)
+WITH (
+    OIDS = FALSE
+)
+TABLESPACE pg_default;
+
+ALTER TABLE public.role
+    OWNER to dauth;
+
+-- Index: ix_role_name
+
+-- DROP INDEX public.ix_role_name;
+
+CREATE UNIQUE INDEX ix_role_name
+    ON public.role USING btree
+    (name COLLATE pg_catalog."default")
+    TABLESPACE pg_default;
+
+-- Table: public.role_perm
+
+-- DROP TABLE public.role_perm;
+
+CREATE TABLE public.role_perm
+(
+    id bigint NOT NULL,
+    role_id bigint NOT NULL,
+    perm_id bigint NOT NULL,
+    CONSTRAINT role_perm_pkey PRIMARY KEY (id)
+)
+WITH (
+    OIDS = FALSE
+)
+TABLESPACE pg_default;
+
+ALTER TABLE public.role_perm
+    OWNER to dauth;
+
+-- Index: ix_role_perm_role_id_perm_id
+
+-- DROP INDEX public.ix_role_perm_role_id_perm_id;
+
+CREATE UNIQUE INDEX ix_role_perm_role_id_perm_id
+    ON public.role_perm USING btree
+    (role_id, perm_id)
+    TABLESPACE pg_default;
+
+-- Table: public.user_role
+
+-- DROP TABLE public.user_role;
+
+CREATE TABLE public.user_role
+(
+    id bigint NOT NULL,
+    user_id bigint NOT NULL,
+    role_id bigint NOT NULL,
+    CONSTRAINT user_role_pkey PRIMARY KEY (id)
+)
+WITH (
+    OIDS = FALSE
+)
+TABLESPACE pg_default;
+
+ALTER TABLE public.user_role
+    OWNER to dauth;
+
+-- Index: ix_user_role_user_id_role_id
+
+-- DROP INDEX public.ix_user_role_user_id_role_id;
+
+CREATE UNIQUE INDEX ix_user_role_user_id_role_id
+    ON public.user_role USING btree
+    (user_id, role_id)
+    TABLESPACE pg_default;
+
+-- Index: ix_user_role_role_id
+
+-- DROP INDEX public.ix_user_role_role_id;
+
+CREATE INDEX ix_user_role_role_id
+    ON public.user_role USING btree
+    (role_id)
+    TABLESPACE pg_default;
+
+-- Table: public."group"
+
+-- DROP TABLE public."group";
+
+CREATE TABLE public."group"
+(
+    id bigint NOT NULL,
+    name character varying(255) COLLATE pg_catalog."default" NOT NULL,
+    description character varying(1024) COLLATE pg_catalog."default" NOT NULL DEFAULT ''::character varying,
+    CONSTRAINT group_pkey PRIMARY KEY (id)
+)
+WITH (
+    OIDS = FALSE
+)
+TABLESPACE pg_default;
+
+ALTER TABLE public."group"
+    OWNER to dauth;
+
+-- Index: ix_group_name
+
+-- DROP INDEX public.ix_group_name;
+
+CREATE UNIQUE INDEX ix_group_name
+    ON public."group" USING btree
+    (name COLLATE pg_catalog."default")
+    TABLESPACE pg_default;
+
+-- Table: public.group_perm
+
+-- DROP TABLE public.group_perm;
+
+CREATE TABLE public.group_perm
+(
+    id bigint NOT NULL,
+    group_id bigint NOT NULL,
+    perm_id bigint NOT NULL,
+    CONSTRAINT group_perm_pkey PRIMARY KEY (id)
+)
+WITH (
+    OIDS = FALSE
+)
+TABLESPACE pg_default;
+
+ALTER TABLE public.group_perm
+    OWNER to dauth;
+
+-- Index: ix_group_perm_group_id_perm_id
+
+-- DROP INDEX public.ix_group_perm_group_id_perm_id;
+
+CREATE UNIQUE INDEX ix_group_perm_group_id_perm_id
+    ON public.group_perm USING btree
+    (group_id, perm_id)
+    TABLESPACE pg_default;
+
+-- Table: public.user_group
+
+-- DROP TABLE public.user_group;
+
+CREATE TABLE public.user_group
+(
+    id bigint NOT NULL,
+    user_id bigint NOT NULL,
+    group_id bigint NOT NULL,
+    CONSTRAINT user_group_pkey PRIMARY KEY (id)
+)
+WITH (
+    OIDS = FALSE
+)
+TABLESPACE pg_default;
+
+ALTER TABLE public.user_group
+    OWNER to dauth;
+
+-- Index: ix_user_group_user_id_group_id
+
+-- DROP INDEX public.ix_user_group_user_id_group_id;
+
+CREATE UNIQUE INDEX ix_user_group_user_id_group_id
+    ON public.user_group USING btree
+    (user_id, group_id)
+    TABLESPACE pg_default;
+
+-- Index: ix_user_group_group_id
+
+-- DROP INDEX public.ix_user_group_group_id;
+
+CREATE INDEX ix_user_group_group_id
+    ON public.user_group USING btree
+    (group_id)
+    TABLESPACE pg_default;
+
+-- Table: public.group_group
+
+-- DROP TABLE public.group_group;
+
+CREATE TABLE public.group_group
+(
+    id bigint NOT NULL,
+    parent_id bigint NOT NULL,
+    child_id bigint NOT NULL,
+    CONSTRAINT group_group_pkey PRIMARY KEY (id)
+)
+WITH (
+    OIDS = FALSE
+)
+TABLESPACE pg_default;
+
+ALTER TABLE public.group_group
+    OWNER to dauth;
+
+-- Index: ix_group_group_parent_id_child_id
+
+-- DROP INDEX public.ix_group_group_parent_id_child_id;
+
+CREATE UNIQUE INDEX ix_group_group_parent_id_child_id
+    ON public.group_group USING btree
+    (parent_id, child_id)
+    TABLESPACE pg_default;
+
+-- Index: ix_group_group_child_id
+
+-- DROP INDEX public.ix_group_group_child_id;
+
+CREATE INDEX ix_group_group_child_id
+    ON public.group_group USING btree
+    (child_id)
+    TABLESPACE pg_default;
+
+-- Table: public.perm_grant
+
+-- DROP TABLE public.perm_grant;
+
+CREATE TABLE public.perm_grant
+(
+    id bigint NOT NULL,
+    user_id bigint NOT NULL DEFAULT 0,
+    role_id bigint NOT NULL DEFAULT 0,
+    group_id bigint NOT NULL DEFAULT 0,
+    perm_id bigint NOT NULL,
+    resource character varying(255) COLLATE pg_catalog."default" NOT NULL DEFAULT ''::character varying,
+    conditions text COLLATE pg_catalog."default" NOT NULL DEFAULT ''::text,
+    CONSTRAINT perm_grant_pkey PRIMARY KEY (id)
+)
+WITH (
+    OIDS = FALSE
+)
+TABLESPACE pg_default;
+
+ALTER TABLE public.perm_grant
+    OWNER to dauth;
+
+-- Index: ix_perm_grant_user_id
+
+-- DROP INDEX public.ix_perm_grant_user_id;
+
+CREATE INDEX ix_perm_grant_user_id
+    ON public.perm_grant USING btree
+    (user_id)
+    TABLESPACE pg_default;
+
+-- Index: ix_perm_grant_role_id
+
+-- DROP INDEX public.ix_perm_grant_role_id;
+
+CREATE INDEX ix_perm_grant_role_id
+    ON public.perm_grant USING btree
+    (role_id)
+    TABLESPACE pg_default;
+
+-- Index: ix_perm_grant_group_id
+
+-- DROP INDEX public.ix_perm_grant_group_id;
+
+CREATE INDEX ix_perm_grant_group_id
+    ON public.perm_grant USING btree
+    (group_id)
+    TABLESPACE pg_default;
+
+-- Table: public.revoked_token
+
+-- DROP TABLE public.revoked_token;
+
+CREATE TABLE public.revoked_token
+(
+    jti character varying(64) COLLATE pg_catalog."default" NOT NULL,
+    user_id bigint NOT NULL,
+    expires timestamp with time zone NOT NULL,
+    created timestamp with time zone,
+    CONSTRAINT revoked_token_pkey PRIMARY KEY (jti)
+)
+WITH (
+    OIDS = FALSE
+)
+TABLESPACE pg_default;
+
+ALTER TABLE public.revoked_token
+    OWNER to dauth;
+
+-- Index: ix_revoked_token_expires
+
+-- DROP INDEX public.ix_revoked_token_expires;
+
+CREATE INDEX ix_revoked_token_expires
+    ON public.revoked_token USING btree
+    (expires)
+    TABLESPACE pg_default;
+
+-- Table: public.session
+
+-- DROP TABLE public.session;
+
+CREATE TABLE public.session
+(
+    family character varying(64) COLLATE pg_catalog."default" NOT NULL,
+    user_id bigint NOT NULL,
+    address character varying(64) COLLATE pg_catalog."default" NOT NULL DEFAULT ''::character varying,
+    user_agent character varying(256) COLLATE pg_catalog."default" NOT NULL DEFAULT ''::character varying,
+    device character varying(128) COLLATE pg_catalog."default" NOT NULL DEFAULT ''::character varying,
+    created timestamp with time zone,
+    last_used timestamp with time zone,
+    CONSTRAINT session_pkey PRIMARY KEY (family)
+)
+WITH (
+    OIDS = FALSE
+)
+TABLESPACE pg_default;
+
+ALTER TABLE public.session
+    OWNER to dauth;
+
+-- Index: ix_session_user_id
+
+-- DROP INDEX public.ix_session_user_id;
+
+CREATE INDEX ix_session_user_id
+    ON public.session USING btree
+    (user_id)
+    TABLESPACE pg_default;
+
+-- Table: public.user_password
+
+-- DROP TABLE public.user_password;
+
+CREATE TABLE public.user_password
+(
+    user_id bigint NOT NULL,
+    must_change boolean NOT NULL DEFAULT false,
+    changed timestamp with time zone,
+    CONSTRAINT user_password_pkey PRIMARY KEY (user_id)
+)
+WITH (
+    OIDS = FALSE
+)
+TABLESPACE pg_default;
+
+ALTER TABLE public.user_password
+    OWNER to dauth;
+
+-- Table: public.password_history
+
+-- DROP TABLE public.password_history;
+
+CREATE TABLE public.password_history
+(
+    id bigserial NOT NULL,
+    user_id bigint NOT NULL,
+    pass character varying(255) COLLATE pg_catalog."default" NOT NULL,
+    created timestamp with time zone,
+    CONSTRAINT password_history_pkey PRIMARY KEY (id)
+)
+WITH (
+    OIDS = FALSE
+)
+TABLESPACE pg_default;
+
+ALTER TABLE public.password_history
+    OWNER to dauth;
+
+-- Index: ix_password_history_user_id
+
+-- DROP INDEX public.ix_password_history_user_id;
+
+CREATE INDEX ix_password_history_user_id
+    ON public.password_history USING btree
+    (user_id)
+    TABLESPACE pg_default;
+
+-- Table: public.audit_event
+
+-- DROP TABLE public.audit_event;
+
+CREATE TABLE public.audit_event
+(
+    id bigserial NOT NULL,
+    actor_id bigint NOT NULL DEFAULT 0,
+    actor character varying(255) COLLATE pg_catalog."default" NOT NULL DEFAULT ''::character varying,
+    action character varying(64) COLLATE pg_catalog."default" NOT NULL,
+    target character varying(1024) COLLATE pg_catalog."default" NOT NULL DEFAULT ''::character varying,
+    outcome character varying(16) COLLATE pg_catalog."default" NOT NULL,
+    peer character varying(64) COLLATE pg_catalog."default" NOT NULL DEFAULT ''::character varying,
+    created timestamp with time zone NOT NULL,
+    prev_hash character varying(64) COLLATE pg_catalog."default" NOT NULL DEFAULT ''::character varying,
+    hash character varying(64) COLLATE pg_catalog."default" NOT NULL,
+    CONSTRAINT audit_event_pkey PRIMARY KEY (id)
+)
+WITH (
+    OIDS = FALSE
+)
+TABLESPACE pg_default;
+
+ALTER TABLE public.audit_event
+    OWNER to dauth;
+
+-- Index: ix_audit_event_created
+
+-- DROP INDEX public.ix_audit_event_created;
+
+CREATE INDEX ix_audit_event_created
+    ON public.audit_event USING btree
+    (created)
+    TABLESPACE pg_default;
+
+-- Index: ix_audit_event_actor_id
+
+-- DROP INDEX public.ix_audit_event_actor_id;
+
+CREATE INDEX ix_audit_event_actor_id
+    ON public.audit_event USING btree
+    (actor_id)
+    TABLESPACE pg_default;
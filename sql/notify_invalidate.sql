@@ -0,0 +1,23 @@
+-- ============================================================================
+-- notify_invalidate
+-- Notifies listening servers that cached records have changed.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.notify_invalidate(
+	p_kind CHARACTER VARYING,
+	p_key CHARACTER VARYING DEFAULT '')
+RETURNS BOOLEAN
+LANGUAGE 'plpgsql'
+AS $$
+BEGIN
+	PERFORM pg_notify('dauth_invalidate',
+		p_kind || ':' || COALESCE(p_key, ''));
+	RETURN TRUE;
+END;
+$$;
+
+/* Test code:
+LISTEN dauth_invalidate
+SELECT notify_invalidate('perms') AS ok
+SELECT notify_invalidate('token',
+	encode(sha256(convert_to('test', 'UTF8')), 'hex')) AS ok
+*/
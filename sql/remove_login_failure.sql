@@ -0,0 +1,27 @@
+-- ============================================================================
+-- remove_login_failure
+-- Uncounts one failed login for a key.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.remove_login_failure(
+	p_key CHARACTER VARYING)
+RETURNS BIGINT
+LANGUAGE 'plpgsql'
+AS $$
+DECLARE
+	num BIGINT;
+BEGIN
+WITH n AS (
+	UPDATE login_failure f
+	SET "count" = f.count - 1
+	WHERE f.key = p_key
+		AND f.count > 0
+	RETURNING *
+) SELECT INTO num COUNT(*) FROM n;
+RETURN num;
+END;
+$$;
+
+/* Test code:
+SELECT * FROM add_login_failure('user:test', 900)
+SELECT remove_login_failure('user:test') AS num
+*/
@@ -0,0 +1,32 @@
+-- ============================================================================
+-- revoke_token
+-- Adds a token id to the revocation list until the token expires. The
+-- cached tokens of the user are announced, since they are cached by token
+-- rather than by id.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.revoke_token(
+	p_jti CHARACTER VARYING,
+	p_user_id BIGINT,
+	p_expires TIMESTAMP WITH TIME ZONE,
+	p_created TIMESTAMP WITH TIME ZONE DEFAULT NULL)
+RETURNS BIGINT
+LANGUAGE 'plpgsql'
+AS $$
+DECLARE
+	num BIGINT;
+BEGIN
+WITH n AS (
+	INSERT INTO revoked_token (jti, user_id, expires, created)
+		VALUES (p_jti, p_user_id, p_expires, COALESCE(p_created, now()))
+	ON CONFLICT (jti) DO NOTHING
+	RETURNING *
+) SELECT INTO num COUNT(notify_invalidate('user', n.user_id::TEXT)) FROM n;
+RETURN num;
+END;
+$$;
+
+/* Test code:
+SELECT revoke_token('test', 1, now() + interval '1 day') AS num
+SELECT * FROM revoked_token
+SELECT delete_old_revoked_tokens(now() + interval '2 days') AS num
+*/
@@ -0,0 +1,47 @@
+-- ============================================================================
+-- save_audit_event
+-- Appends an event to the audit log, if p_prev_hash is still the hash of the
+-- last event. Returns the id of the event, or 0 when another event was saved
+-- first and the event must be hashed again.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.save_audit_event(
+	p_actor_id BIGINT,
+	p_actor CHARACTER VARYING,
+	p_action CHARACTER VARYING,
+	p_target CHARACTER VARYING,
+	p_outcome CHARACTER VARYING,
+	p_peer CHARACTER VARYING,
+	p_created TIMESTAMP WITH TIME ZONE,
+	p_prev_hash CHARACTER VARYING,
+	p_hash CHARACTER VARYING)
+RETURNS BIGINT
+LANGUAGE 'plpgsql'
+AS $$
+DECLARE
+	head CHARACTER VARYING;
+	new_id BIGINT;
+BEGIN
+PERFORM pg_advisory_xact_lock(hashtext('audit_event'));
+SELECT a.hash INTO head
+FROM audit_event a
+ORDER BY a.id DESC
+LIMIT 1;
+IF COALESCE(head, '') <> COALESCE(p_prev_hash, '') THEN
+	RETURN 0;
+END IF;
+INSERT INTO audit_event
+	(actor_id, actor, action, target, outcome, peer, created, prev_hash,
+		hash)
+	VALUES (COALESCE(p_actor_id, 0), COALESCE(p_actor, ''), p_action,
+		COALESCE(p_target, ''), p_outcome, COALESCE(p_peer, ''), p_created,
+		COALESCE(p_prev_hash, ''), p_hash)
+	RETURNING id INTO new_id;
+RETURN new_id;
+END;
+$$;
+
+/* Test code:
+SELECT save_audit_event(1, 'test', 'Login', 'user:1', 'success', '127.0.0.1',
+	now(), get_audit_head(), 'test') AS id
+SELECT * FROM get_audit_events()
+*/
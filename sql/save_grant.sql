@@ -0,0 +1,34 @@
+-- ============================================================================
+-- save_grant
+-- Saves a resource scoped permission grant record into the database.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.save_grant(
+	p_id BIGINT,
+	p_user_id BIGINT,
+	p_role_id BIGINT,
+	p_group_id BIGINT,
+	p_perm_id BIGINT,
+	p_resource CHARACTER VARYING,
+	p_conditions TEXT)
+RETURNS BIGINT
+LANGUAGE 'plpgsql'
+AS $$
+DECLARE
+	new_id BIGINT;
+BEGIN
+	DELETE FROM perm_grant g WHERE g.id = p_id;
+	SELECT INTO new_id COALESCE(MAX(g.id), 0) + 1 FROM perm_grant g;
+	INSERT INTO perm_grant ("id", user_id, role_id, group_id, perm_id,
+		resource, conditions)
+		VALUES (new_id, p_user_id, p_role_id, p_group_id, p_perm_id,
+			COALESCE(p_resource, ''), COALESCE(p_conditions, ''));
+	PERFORM notify_invalidate('perms');
+	RETURN new_id AS "id";
+END;
+$$;
+
+/* Test code:
+SELECT save_grant(-1, 1, 0, 0, 1, 'project:*', '[{"attr":"tenant","op":"eq","value":"acme"}]') AS id
+SELECT * FROM perm_grant
+SELECT delete_grants(NULL, 1) AS num
+*/
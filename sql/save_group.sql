@@ -0,0 +1,37 @@
+-- ============================================================================
+-- save_group
+-- Saves a group record into the database.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.save_group(
+	p_id BIGINT,
+	p_name CHARACTER VARYING,
+	p_description CHARACTER VARYING)
+RETURNS BIGINT
+LANGUAGE 'plpgsql'
+AS $$
+DECLARE
+	new_id BIGINT;
+BEGIN
+	SELECT INTO new_id g.id FROM "group" g
+		WHERE g.id = p_id OR g.name = p_name
+		ORDER BY g.id = p_id DESC
+		LIMIT 1;
+	IF new_id IS NULL THEN
+		SELECT INTO new_id COALESCE(MAX(g.id), 0) + 1 FROM "group" g;
+		INSERT INTO "group" ("id", name, description)
+			VALUES (new_id, p_name, COALESCE(p_description, ''));
+	ELSE
+		UPDATE "group" g
+		SET name = p_name,
+			description = COALESCE(p_description, '')
+		WHERE g.id = new_id;
+	END IF;
+	RETURN new_id AS "id";
+END;
+$$;
+
+/* Test code:
+SELECT save_group(-1, 'test', 'Test group') AS id
+SELECT * FROM "group"
+SELECT delete_groups(NULL, 'test') AS num
+*/
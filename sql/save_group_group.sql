@@ -0,0 +1,43 @@
+-- ============================================================================
+-- save_group_group
+-- Saves a group nesting record into the database. Raises an exception if
+-- the child group is the parent group or one of its ancestors.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.save_group_group(
+	p_id BIGINT,
+	p_parent_id BIGINT,
+	p_child_id BIGINT)
+RETURNS BIGINT
+LANGUAGE 'plpgsql'
+AS $$
+DECLARE
+	new_id BIGINT;
+BEGIN
+	IF EXISTS (
+		WITH RECURSIVE a(group_id) AS (
+			SELECT p_parent_id
+			UNION
+			SELECT gg.parent_id
+			FROM group_group gg
+			JOIN a ON gg.child_id = a.group_id
+		) SELECT 1 FROM a WHERE a.group_id = p_child_id) THEN
+		RAISE EXCEPTION 'group % can not be nested in group %',
+			p_child_id, p_parent_id;
+	END IF;
+	DELETE FROM group_group gg WHERE gg.id = p_id;
+	DELETE FROM group_group gg WHERE gg.parent_id = p_parent_id
+		AND gg.child_id = p_child_id;
+	SELECT INTO new_id COALESCE(MAX(gg.id), 0) + 1 FROM group_group gg;
+	INSERT INTO group_group ("id", parent_id, child_id)
+		VALUES (new_id, p_parent_id, p_child_id);
+	PERFORM notify_invalidate('perms');
+	RETURN new_id AS "id";
+END;
+$$;
+
+/* Test code:
+SELECT save_group_group(1, 1, 2) AS id
+SELECT save_group_group(2, 2, 1) AS id
+SELECT * FROM group_group
+SELECT delete_group_groups(NULL, 1) AS num
+*/
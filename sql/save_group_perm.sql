@@ -0,0 +1,30 @@
+-- ============================================================================
+-- save_group_perm
+-- Saves a group permission grant record into the database.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.save_group_perm(
+	p_id BIGINT,
+	p_group_id BIGINT,
+	p_perm_id BIGINT)
+RETURNS BIGINT
+LANGUAGE 'plpgsql'
+AS $$
+DECLARE
+	new_id BIGINT;
+BEGIN
+	DELETE FROM group_perm gp WHERE gp.id = p_id;
+	DELETE FROM group_perm gp WHERE gp.group_id = p_group_id
+		AND gp.perm_id = p_perm_id;
+	SELECT INTO new_id COALESCE(MAX(gp.id), 0) + 1 FROM group_perm gp;
+	INSERT INTO group_perm ("id", group_id, perm_id)
+		VALUES (new_id, p_group_id, p_perm_id);
+	PERFORM notify_invalidate('perms');
+	RETURN new_id AS "id";
+END;
+$$;
+
+/* Test code:
+SELECT save_group_perm(1, 1, 1) AS id
+SELECT * FROM group_perm
+SELECT delete_group_perms(NULL, 1) AS num
+*/
@@ -20,6 +20,7 @@ BEGIN
 	SELECT INTO new_id COALESCE(MAX(p.id), 0) + 1 FROM perm p;
 	INSERT INTO perm ("id", service, name)
 		VALUES (new_id, p_service, p_name);
+	PERFORM notify_invalidate('perms');
 	RETURN new_id AS "id";
 END;
 $$;
@@ -0,0 +1,23 @@
+-- ============================================================================
+-- save_recovery_code
+-- Saves the hash of a recovery code for a user.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.save_recovery_code(
+	p_user_id BIGINT,
+	p_code CHARACTER VARYING)
+RETURNS BIGINT
+LANGUAGE 'plpgsql'
+AS $$
+BEGIN
+	INSERT INTO recovery_code (user_id, code, used)
+		VALUES (p_user_id, p_code, NULL)
+	ON CONFLICT (user_id, code) DO NOTHING;
+	RETURN 1;
+END;
+$$;
+
+/* Test code:
+SELECT save_recovery_code(1, 'test') AS num
+SELECT use_recovery_code(1, 'test') AS num
+SELECT delete_recovery_codes(1) AS num
+*/
@@ -0,0 +1,35 @@
+-- ============================================================================
+-- save_refresh_token
+-- Saves a refresh token record into the database.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.save_refresh_token(
+	p_id BIGINT,
+	p_token CHARACTER VARYING,
+	p_family CHARACTER VARYING,
+	p_user_id BIGINT,
+	p_token_id BIGINT,
+	p_created TIMESTAMP WITH TIME ZONE DEFAULT NULL,
+	p_expires TIMESTAMP WITH TIME ZONE DEFAULT NULL,
+	p_used TIMESTAMP WITH TIME ZONE DEFAULT NULL)
+RETURNS BIGINT
+LANGUAGE 'plpgsql'
+AS $$
+DECLARE
+	new_id BIGINT;
+BEGIN
+	DELETE FROM refresh_token r WHERE r.id = p_id;
+	DELETE FROM refresh_token r WHERE r.token = p_token;
+	SELECT INTO new_id COALESCE(MAX(r.id), 0) + 1 FROM refresh_token r;
+	INSERT INTO refresh_token ("id", "token", family, user_id, token_id,
+		created, expires, used)
+		VALUES (new_id, p_token, p_family, p_user_id, p_token_id,
+			p_created, p_expires, p_used);
+	RETURN new_id AS "id";
+END;
+$$;
+
+/* Test code:
+SELECT save_refresh_token(-1, 'test', 'test', 1, 1, now(), now()) AS id
+SELECT * FROM refresh_token
+SELECT delete_refresh_tokens(NULL, NULL, 'test') AS num
+*/
@@ -0,0 +1,37 @@
+-- ============================================================================
+-- save_role
+-- Saves a role record into the database.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.save_role(
+	p_id BIGINT,
+	p_name CHARACTER VARYING,
+	p_description CHARACTER VARYING)
+RETURNS BIGINT
+LANGUAGE 'plpgsql'
+AS $$
+DECLARE
+	new_id BIGINT;
+BEGIN
+	SELECT INTO new_id r.id FROM role r
+		WHERE r.id = p_id OR r.name = p_name
+		ORDER BY r.id = p_id DESC
+		LIMIT 1;
+	IF new_id IS NULL THEN
+		SELECT INTO new_id COALESCE(MAX(r.id), 0) + 1 FROM role r;
+		INSERT INTO role ("id", name, description)
+			VALUES (new_id, p_name, COALESCE(p_description, ''));
+	ELSE
+		UPDATE role r
+		SET name = p_name,
+			description = COALESCE(p_description, '')
+		WHERE r.id = new_id;
+	END IF;
+	RETURN new_id AS "id";
+END;
+$$;
+
+/* Test code:
+SELECT save_role(-1, 'test', 'Test role') AS id
+SELECT * FROM role
+SELECT delete_roles(NULL, 'test') AS num
+*/
@@ -0,0 +1,30 @@
+-- ============================================================================
+-- save_role_perm
+-- Saves a role permission assignment record into the database.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.save_role_perm(
+	p_id BIGINT,
+	p_role_id BIGINT,
+	p_perm_id BIGINT)
+RETURNS BIGINT
+LANGUAGE 'plpgsql'
+AS $$
+DECLARE
+	new_id BIGINT;
+BEGIN
+	DELETE FROM role_perm rp WHERE rp.id = p_id;
+	DELETE FROM role_perm rp WHERE rp.role_id = p_role_id
+		AND rp.perm_id = p_perm_id;
+	SELECT INTO new_id COALESCE(MAX(rp.id), 0) + 1 FROM role_perm rp;
+	INSERT INTO role_perm ("id", role_id, perm_id)
+		VALUES (new_id, p_role_id, p_perm_id);
+	PERFORM notify_invalidate('perms');
+	RETURN new_id AS "id";
+END;
+$$;
+
+/* Test code:
+SELECT save_role_perm(1, 1, 1) AS id
+SELECT * FROM role_perm
+SELECT delete_role_perms(NULL, 1) AS num
+*/
@@ -0,0 +1,33 @@
+-- ============================================================================
+-- save_session
+-- Saves the client details of a login session into the database.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.save_session(
+	p_family CHARACTER VARYING,
+	p_user_id BIGINT,
+	p_address CHARACTER VARYING DEFAULT NULL,
+	p_user_agent CHARACTER VARYING DEFAULT NULL,
+	p_device CHARACTER VARYING DEFAULT NULL,
+	p_created TIMESTAMP WITH TIME ZONE DEFAULT NULL)
+RETURNS BIGINT
+LANGUAGE 'plpgsql'
+AS $$
+BEGIN
+	INSERT INTO session AS s
+		(family, user_id, address, user_agent, device, created, last_used)
+		VALUES (p_family, p_user_id, COALESCE(p_address, ''),
+			COALESCE(p_user_agent, ''), COALESCE(p_device, ''),
+			COALESCE(p_created, now()), COALESCE(p_created, now()))
+	ON CONFLICT (family) DO UPDATE
+		SET address = COALESCE(p_address, s.address),
+			user_agent = COALESCE(p_user_agent, s.user_agent),
+			device = COALESCE(p_device, s.device);
+	RETURN 1;
+END;
+$$;
+
+/* Test code:
+SELECT save_session('test', 1, '127.0.0.1', 'test', 'laptop') AS num
+SELECT * FROM get_sessions(1)
+SELECT delete_refresh_tokens(NULL, NULL, 'test') AS num
+*/
@@ -16,6 +16,8 @@ AS $$
 DECLARE
 	new_id BIGINT;
 BEGIN
+	PERFORM notify_invalidate('user', u.id::TEXT) FROM "user" u
+		WHERE u.id = p_id OR u.user = p_user;
 	DELETE FROM "user" u WHERE u.id = p_id;
 	DELETE FROM "user" u WHERE u.user = p_user;
 	SELECT INTO new_id COALESCE(MAX(u.id), 0) + 1 FROM "user" u;
@@ -0,0 +1,32 @@
+-- ============================================================================
+-- save_user_group
+-- Saves a group membership record into the database.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.save_user_group(
+	p_id BIGINT,
+	p_user_id BIGINT,
+	p_group_id BIGINT)
+RETURNS BIGINT
+LANGUAGE 'plpgsql'
+AS $$
+DECLARE
+	new_id BIGINT;
+BEGIN
+	PERFORM notify_invalidate('perms', ug.user_id::TEXT) FROM user_group ug
+		WHERE ug.id = p_id;
+	DELETE FROM user_group ug WHERE ug.id = p_id;
+	DELETE FROM user_group ug WHERE ug.user_id = p_user_id
+		AND ug.group_id = p_group_id;
+	SELECT INTO new_id COALESCE(MAX(ug.id), 0) + 1 FROM user_group ug;
+	INSERT INTO user_group ("id", user_id, group_id)
+		VALUES (new_id, p_user_id, p_group_id);
+	PERFORM notify_invalidate('perms', p_user_id::TEXT);
+	RETURN new_id AS "id";
+END;
+$$;
+
+/* Test code:
+SELECT save_user_group(1, 1, 1) AS id
+SELECT * FROM user_group
+SELECT delete_user_groups(NULL, 1) AS num
+*/
@@ -0,0 +1,33 @@
+-- ============================================================================
+-- save_user_mfa
+-- Saves the two-factor authentication record of a user.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.save_user_mfa(
+	p_user_id BIGINT,
+	p_secret CHARACTER VARYING,
+	p_enabled BOOLEAN,
+	p_required BOOLEAN,
+	p_last_step BIGINT DEFAULT 0,
+	p_created TIMESTAMP WITH TIME ZONE DEFAULT NULL)
+RETURNS BIGINT
+LANGUAGE 'plpgsql'
+AS $$
+BEGIN
+	INSERT INTO user_mfa AS m
+		(user_id, secret, enabled, required, last_step, created)
+		VALUES (p_user_id, p_secret, p_enabled, p_required, p_last_step,
+			COALESCE(p_created, now()))
+	ON CONFLICT (user_id) DO UPDATE
+		SET secret = p_secret,
+			enabled = p_enabled,
+			required = p_required,
+			last_step = p_last_step,
+			created = COALESCE(p_created, m.created);
+	RETURN 1;
+END;
+$$;
+
+/* Test code:
+SELECT save_user_mfa(1, 'TEST', false, true, 0, now()) AS num
+SELECT * FROM get_user_mfa(1)
+*/
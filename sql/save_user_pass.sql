@@ -0,0 +1,29 @@
+-- ============================================================================
+-- save_user_pass
+-- Replaces the password hash of a user record in the database.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.save_user_pass(
+	p_id BIGINT,
+	p_pass CHARACTER VARYING)
+RETURNS BIGINT
+LANGUAGE 'plpgsql'
+AS $$
+DECLARE
+	num BIGINT;
+BEGIN
+WITH n AS (
+	UPDATE "user" u
+	SET pass = p_pass
+	WHERE u.id = p_id
+	RETURNING *
+) SELECT INTO num COUNT(notify_invalidate('user', n.id::TEXT)) FROM n;
+RETURN num;
+END;
+$$;
+
+/* Test code:
+SELECT save_user(1, 'test', 'test', 'test', 'test') AS id
+SELECT save_user_pass(1, 'test') AS num
+SELECT * FROM get_users(1)
+SELECT delete_users(NULL, 'test') AS num
+*/
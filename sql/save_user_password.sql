@@ -0,0 +1,24 @@
+-- ============================================================================
+-- save_user_password
+-- Sets whether a user must change their password on next login.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.save_user_password(
+	p_user_id BIGINT,
+	p_must_change BOOLEAN)
+RETURNS BIGINT
+LANGUAGE 'plpgsql'
+AS $$
+BEGIN
+	INSERT INTO user_password AS p
+		(user_id, must_change)
+		VALUES (p_user_id, p_must_change)
+	ON CONFLICT (user_id) DO UPDATE
+		SET must_change = p_must_change;
+	RETURN 1;
+END;
+$$;
+
+/* Test code:
+SELECT save_user_password(1, true) AS num
+SELECT * FROM get_user_password(1)
+*/
@@ -14,12 +14,15 @@ AS $$
 DECLARE
 	new_id BIGINT;
 BEGIN
+	PERFORM notify_invalidate('perms', up.user_id::TEXT) FROM user_perm up
+		WHERE up.id = up_id;
 	DELETE FROM user_perm up WHERE up.id = up_id;
 	DELETE FROM user_perm up WHERE up.user_id = p_user_id
 		AND up.perm_id = p_perm_id;
 	SELECT INTO new_id COALESCE(MAX(up.id), 0) + 1 FROM user_perm up;
 	INSERT INTO user_perm ("id", user_id, perm_id)
 		VALUES (new_id, p_user_id, p_perm_id);
+	PERFORM notify_invalidate('perms', p_user_id::TEXT);
 	RETURN new_id AS "id";
 END;
 $$;
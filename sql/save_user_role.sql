@@ -0,0 +1,32 @@
+-- ============================================================================
+-- save_user_role
+-- Saves a user role assignment record into the database.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.save_user_role(
+	p_id BIGINT,
+	p_user_id BIGINT,
+	p_role_id BIGINT)
+RETURNS BIGINT
+LANGUAGE 'plpgsql'
+AS $$
+DECLARE
+	new_id BIGINT;
+BEGIN
+	PERFORM notify_invalidate('perms', ur.user_id::TEXT) FROM user_role ur
+		WHERE ur.id = p_id;
+	DELETE FROM user_role ur WHERE ur.id = p_id;
+	DELETE FROM user_role ur WHERE ur.user_id = p_user_id
+		AND ur.role_id = p_role_id;
+	SELECT INTO new_id COALESCE(MAX(ur.id), 0) + 1 FROM user_role ur;
+	INSERT INTO user_role ("id", user_id, role_id)
+		VALUES (new_id, p_user_id, p_role_id);
+	PERFORM notify_invalidate('perms', p_user_id::TEXT);
+	RETURN new_id AS "id";
+END;
+$$;
+
+/* Test code:
+SELECT save_user_role(1, 1, 1) AS id
+SELECT * FROM user_role
+SELECT delete_user_roles(NULL, 1) AS num
+*/
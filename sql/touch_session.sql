@@ -0,0 +1,31 @@
+-- ============================================================================
+-- touch_session
+-- Records when the session an access token was issued in was last used.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.touch_session(
+	p_token CHARACTER VARYING,
+	p_used TIMESTAMP WITH TIME ZONE DEFAULT NULL)
+RETURNS BIGINT
+LANGUAGE 'plpgsql'
+AS $$
+DECLARE
+	num BIGINT;
+BEGIN
+WITH n AS (
+	UPDATE session s
+	SET last_used = GREATEST(s.last_used, COALESCE(p_used, now()))
+	FROM refresh_token r
+		INNER JOIN token t ON t.id = r.token_id
+	WHERE t.token = p_token
+		AND s.family = r.family
+	RETURNING s.*
+) SELECT INTO num COUNT(*) FROM n;
+RETURN num;
+END;
+$$;
+
+/* Test code:
+SELECT save_session('test', 1, '127.0.0.1', 'test', 'laptop') AS num
+SELECT touch_session('test') AS num
+SELECT * FROM get_sessions(1)
+*/
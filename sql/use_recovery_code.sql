@@ -0,0 +1,31 @@
+-- ============================================================================
+-- use_recovery_code
+-- Marks an unused recovery code of a user as used. Returns 1 if a matching
+-- unused code was found, otherwise 0.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.use_recovery_code(
+	p_user_id BIGINT,
+	p_code CHARACTER VARYING)
+RETURNS BIGINT
+LANGUAGE 'plpgsql'
+AS $$
+DECLARE
+	num BIGINT;
+BEGIN
+WITH n AS (
+	UPDATE recovery_code c
+	SET used = now()
+	WHERE c.user_id = p_user_id
+	AND c.code = p_code
+	AND c.used IS NULL
+	RETURNING *
+) SELECT INTO num COUNT(*) FROM n;
+RETURN num;
+END;
+$$;
+
+/* Test code:
+SELECT save_recovery_code(1, 'test') AS num
+SELECT use_recovery_code(1, 'test') AS num
+SELECT delete_recovery_codes(1) AS num
+*/
@@ -0,0 +1,37 @@
+-- ============================================================================
+-- use_refresh_token
+-- Marks a refresh token record as used and returns it as it was before.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.use_refresh_token(
+	p_token CHARACTER VARYING)
+RETURNS TABLE(
+	"id" BIGINT,
+	"token" CHARACTER VARYING,
+	"family" CHARACTER VARYING,
+	"user_id" BIGINT,
+	"token_id" BIGINT,
+	"created" TIMESTAMP WITH TIME ZONE,
+	"expires" TIMESTAMP WITH TIME ZONE,
+	"used" TIMESTAMP WITH TIME ZONE)
+LANGUAGE 'plpgsql'
+AS $$
+DECLARE
+	r refresh_token%ROWTYPE;
+BEGIN
+	SELECT * INTO r FROM refresh_token rt WHERE rt.token = p_token FOR UPDATE;
+	IF NOT FOUND THEN
+		RETURN;
+	END IF;
+
+	UPDATE refresh_token rt SET used = COALESCE(rt.used, now())
+		WHERE rt.id = r.id;
+	RETURN QUERY SELECT r.id, r.token, r.family, r.user_id, r.token_id,
+		r.created, r.expires, r.used;
+END;
+$$;
+
+/* Test code:
+SELECT save_refresh_token(-1, 'test', 'test', 1, 1, now(), now()) AS id
+SELECT * FROM use_refresh_token('test')
+SELECT delete_refresh_tokens(NULL, NULL, 'test') AS num
+*/
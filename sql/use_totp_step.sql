@@ -0,0 +1,30 @@
+-- ============================================================================
+-- use_totp_step
+-- Records the time step of an accepted TOTP code for a user. Returns 1 if no
+-- code for the same or a later time step was accepted before, otherwise 0.
+-- ============================================================================
+CREATE OR REPLACE FUNCTION public.use_totp_step(
+	p_user_id BIGINT,
+	p_step BIGINT)
+RETURNS BIGINT
+LANGUAGE 'plpgsql'
+AS $$
+DECLARE
+	num BIGINT;
+BEGIN
+WITH n AS (
+	UPDATE user_mfa m
+	SET last_step = p_step
+	WHERE m.user_id = p_user_id
+	AND m.last_step < p_step
+	RETURNING *
+) SELECT INTO num COUNT(*) FROM n;
+RETURN num;
+END;
+$$;
+
+/* Test code:
+SELECT save_user_mfa(1, 'TEST', false, true, 0, now()) AS num
+SELECT use_totp_step(1, 100) AS num
+SELECT use_totp_step(1, 100) AS num
+*/